@@ -0,0 +1,265 @@
+package agent
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/darcinc/repository"
+)
+
+var (
+	senderKey    = generateTestKey()
+	recipientKey = generateTestKey()
+)
+
+func generateTestKey() *rsa.PrivateKey {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func startAgent(t *testing.T, config Config) (*Agent, *Client) {
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	keystore := &repository.Keystore{PrivateKeys: map[string][]byte{}, PublicKeys: map[string][]byte{}}
+	keystore.AddPrivateKey("sender", senderKey)
+	keystore.AddPrivateKey("recipient", recipientKey)
+
+	agent, err := New(keystore, config)
+	if err != nil {
+		t.Fatalf("Unable to create agent: %v", err)
+	}
+
+	listener, err := Listen(filepath.Join(dir, "agent.sock"), config)
+	if err != nil {
+		t.Fatalf("Unable to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	go agent.Serve(listener)
+
+	client, err := Dial(filepath.Join(dir, "agent.sock"))
+	if err != nil {
+		t.Fatalf("Unable to dial agent: %v", err)
+	}
+
+	return agent, client
+}
+
+func TestAgentTapeRoundTrip(t *testing.T) {
+	_, client := startAgent(t, Config{})
+
+	sender, err := client.PrivateKey("sender")
+	if err != nil {
+		t.Fatalf("Unable to get sender key: %v", err)
+	}
+
+	buffer := new(bytes.Buffer)
+	tw, err := repository.NewTapeWriter(repository.Key{PublicKey: &recipientKey.PublicKey, PrivateKey: sender}, buffer)
+	if err != nil {
+		t.Fatalf("Unable to write tape through agent: %v", err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatalf("Unable to sign tape through agent: %v", err)
+	}
+
+	recipient, err := client.PrivateKey("recipient")
+	if err != nil {
+		t.Fatalf("Unable to get recipient key: %v", err)
+	}
+
+	_, err = repository.OpenTape(recipient, &senderKey.PublicKey, bytes.NewReader(buffer.Bytes()))
+	if err != nil {
+		t.Fatalf("Unable to open tape through agent: %v", err)
+	}
+}
+
+func TestAgentSignsEachLabelHash(t *testing.T) {
+	_, client := startAgent(t, Config{})
+	sender, err := client.PrivateKey("sender")
+	if err != nil {
+		t.Fatalf("Unable to get sender key: %v", err)
+	}
+	recipient, err := client.PrivateKey("recipient")
+	if err != nil {
+		t.Fatalf("Unable to get recipient key: %v", err)
+	}
+
+	for _, name := range repository.HashAlgorithms() {
+		buffer := new(bytes.Buffer)
+		tw, err := repository.NewTapeWriterWithOptions(repository.Key{PublicKey: &recipientKey.PublicKey, PrivateKey: sender}, buffer, repository.WithHash(name))
+		if err != nil {
+			t.Fatalf("%s: unable to write tape through agent: %v", name, err)
+		}
+		if err = tw.Close(); err != nil {
+			t.Fatalf("%s: unable to sign tape through agent: %v", name, err)
+		}
+		if _, err = repository.OpenTape(recipient, &senderKey.PublicKey, bytes.NewReader(buffer.Bytes())); err != nil {
+			t.Errorf("%s: unable to open tape signed through agent: %v", name, err)
+		}
+	}
+
+	// PKCS#1 v1.5 has no encoding for BLAKE2b digests, which labels sign
+	// with RSA-PSS.
+	for _, hash := range labelHashes {
+		digest := make([]byte, hash.Size())
+		if hash != crypto.BLAKE2b_512 {
+			signature, err := sender.Sign(rand.Reader, digest, hash)
+			if err != nil || rsa.VerifyPKCS1v15(&senderKey.PublicKey, hash, digest, signature) != nil {
+				t.Errorf("%v: no PKCS#1 v1.5 signature from the agent: %v", hash, err)
+			}
+		}
+		opts := &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: hash}
+		signature, err := sender.Sign(rand.Reader, digest, opts)
+		if err != nil || rsa.VerifyPSS(&senderKey.PublicKey, hash, digest, signature, opts) != nil {
+			t.Errorf("%v: no RSA-PSS signature from the agent: %v", hash, err)
+		}
+	}
+}
+
+func TestAgentAllowlist(t *testing.T) {
+	_, client := startAgent(t, Config{Clients: []ClientRule{{UID: os.Getuid(), Keys: []string{"recipient"}}}})
+
+	keys, err := client.Keys()
+	if err != nil || len(keys) != 1 || keys[0] != "recipient" {
+		t.Errorf("Expected only the recipient key but got %v: %v", keys, err)
+	}
+
+	if names, err := client.KeyNames(); err != nil || len(names) != 2 || names[1] != "recipient" {
+		t.Errorf("Expected only the recipient's keys to be named but got %v: %v", names, err)
+	}
+
+	if _, err = client.PrivateKey("sender"); err == nil {
+		t.Error("Should not give out a key the client is not allowed to use")
+	}
+
+	sender := &remoteKey{client: client, name: "sender", public: &senderKey.PublicKey}
+	if _, err = sender.Sign(rand.Reader, make([]byte, 32), crypto.SHA256); err == nil {
+		t.Error("Should not sign with a key the client is not allowed to use")
+	}
+}
+
+func TestAgentOtherUser(t *testing.T) {
+	if !peerCredentials {
+		t.Skip("Clients cannot be identified on this platform")
+	}
+	other := os.Getuid() + 1000
+	agent, _ := startAgent(t, Config{Clients: []ClientRule{{UID: os.Getuid(), Keys: []string{"recipient"}}, {UID: other, Keys: []string{"sender"}}}})
+
+	sign := request{Op: opSign, Key: "sender", Hash: uint(crypto.SHA256), Digest: make([]byte, 32)}
+	if resp := agent.handle(other, sign); resp.Error != "" {
+		t.Errorf("Expected the other user to sign with its key but got %s", resp.Error)
+	}
+	if resp := agent.handle(os.Getuid(), sign); resp.Error == "" {
+		t.Error("Should not sign with a key only the other user may use")
+	}
+	sign.Key = "recipient"
+	if resp := agent.handle(other, sign); resp.Error == "" {
+		t.Error("Should not sign for the other user with a key it is not allowed")
+	}
+
+	list := agent.handle(other, request{Op: opList})
+	if list.Error != "" || len(list.Keys) != 1 || list.Keys[0] != "sender" || len(list.Public) != 1 || list.Public[0] != "sender" {
+		t.Errorf("Expected the other user to see only its key but got %+v", list)
+	}
+	if resp := agent.handle(other, request{Op: opPublic, Key: "recipient"}); resp.Error == "" {
+		t.Error("Should not give the other user a key it is not allowed")
+	}
+
+	stranger := other + 1000
+	for _, op := range []string{opList, opPublic} {
+		if resp := agent.handle(stranger, request{Op: op, Key: "sender"}); resp.Error == "" {
+			t.Errorf("Should not answer %s for a user the config does not list", op)
+		}
+	}
+}
+
+func TestListenShared(t *testing.T) {
+	if !peerCredentials {
+		t.Skip("Clients cannot be identified on this platform")
+	}
+	dir, err := ioutil.TempDir("", "agent")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for config, expected := range map[*Config]os.FileMode{
+		{}: 0600,
+		{Clients: []ClientRule{{UID: os.Getuid() + 1000, Keys: []string{"*"}}}}: 0666,
+	} {
+		path := filepath.Join(dir, "agent.sock")
+		listener, err := Listen(path, *config)
+		if err != nil {
+			t.Fatalf("Unable to listen: %v", err)
+		}
+		info, err := os.Stat(path)
+		listener.Close()
+		if err != nil || info.Mode().Perm() != expected {
+			t.Errorf("Expected the socket mode %v for %v but got %v %v", expected, config.Clients, info.Mode().Perm(), err)
+		}
+	}
+}
+
+func TestAgentSignsOnlyLabelDigests(t *testing.T) {
+	_, client := startAgent(t, Config{})
+	sender, err := client.PrivateKey("sender")
+	if err != nil {
+		t.Fatalf("Unable to get sender key: %v", err)
+	}
+
+	refused := map[string]struct {
+		digest []byte
+		hash   crypto.Hash
+	}{
+		"Raw data":           {[]byte("pay the bearer"), crypto.Hash(0)},
+		"MD5 digest":         {make([]byte, 16), crypto.MD5},
+		"Short SHA-256":      {make([]byte, 20), crypto.SHA256},
+		"Long SHA-512":       {make([]byte, 80), crypto.SHA512},
+		"Unknown hash value": {make([]byte, 32), crypto.Hash(99)},
+	}
+	for name, sign := range refused {
+		if _, err := sender.Sign(rand.Reader, sign.digest, sign.hash); err == nil {
+			t.Errorf("%s: should not be signed by the agent", name)
+		}
+	}
+	if _, err := sender.Sign(rand.Reader, make([]byte, 48), crypto.SHA384); err != nil {
+		t.Errorf("Unable to sign a SHA-384 label digest: %v", err)
+	}
+}
+
+func TestAgentLifetime(t *testing.T) {
+	agent, client := startAgent(t, Config{Lifetime: Duration(time.Hour), KeyLifetimes: map[string]Duration{"sender": Duration(time.Minute)}})
+
+	agent.mu.Lock()
+	agent.now = func() time.Time { return time.Now().Add(30 * time.Minute) }
+	agent.mu.Unlock()
+
+	keys, err := client.Keys()
+	if err != nil || len(keys) != 1 || keys[0] != "recipient" {
+		t.Errorf("Expected the sender key to expire but got %v: %v", keys, err)
+	}
+}
+
+func TestReadConfig(t *testing.T) {
+	config, err := ReadConfig(bytes.NewBufferString(`{"clients": [{"uid": 1001, "keys": ["nightly"]}], "lifetime": "8h"}`))
+	if err != nil {
+		t.Fatalf("Unable to read config: %v", err)
+	}
+
+	if len(config.Clients) != 1 || config.Clients[0].UID != 1001 || time.Duration(config.Lifetime) != 8*time.Hour {
+		t.Errorf("Unexpected config: %+v", config)
+	}
+}
@@ -0,0 +1,151 @@
+package agent
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"github.com/darcinc/repository"
+)
+
+// Client talks to an agent.  It is a repository.KeyProvider whose private
+// keys sign and unwrap labels inside the agent.
+type Client struct {
+	path string
+}
+
+// Dial checks that an agent is listening on the socket and returns a client
+// for it.
+func Dial(path string) (*Client, error) {
+	result := &Client{path: path}
+	if _, err := result.Keys(); err != nil {
+		return nil, repository.NewError(err, fmt.Sprintf("Unable to reach agent at %s", path))
+	}
+	return result, nil
+}
+
+func (c *Client) call(req request) (response, error) {
+	resp := response{}
+
+	conn, err := net.Dial("unix", c.path)
+	if err != nil {
+		return resp, err
+	}
+	defer conn.Close()
+
+	encoder, decoder := newCodec(conn)
+	if err = encoder.Encode(req); err != nil {
+		return resp, err
+	}
+	if err = decoder.Decode(&resp); err != nil {
+		return resp, err
+	}
+
+	if resp.Error != "" {
+		return resp, fmt.Errorf("Agent refused %s with key %s: %s", req.Op, req.Key, resp.Error)
+	}
+	return resp, nil
+}
+
+// Keys lists the unlocked keys this client may use.
+func (c *Client) Keys() ([]string, error) {
+	resp, err := c.call(request{Op: opList})
+	return resp.Keys, err
+}
+
+// KeyNames lists the unlocked keys this client may use and every public key
+// known to the agent.
+func (c *Client) KeyNames() ([]string, error) {
+	resp, err := c.call(request{Op: opList})
+	if err != nil {
+		return nil, err
+	}
+
+	return append(resp.Keys, resp.Public...), nil
+}
+
+// EscrowKeys returns the escrow keys of the agent's keystore.
+func (c *Client) EscrowKeys() ([]*rsa.PublicKey, error) {
+	resp, err := c.call(request{Op: opList})
+	if err != nil {
+		return nil, err
+	}
+
+	result := []*rsa.PublicKey{}
+	for _, name := range resp.Escrow {
+		key, err := c.PublicKey(name)
+		if err != nil {
+			return nil, fmt.Errorf("Escrow key %s not found: %v", name, err)
+		}
+		result = append(result, key)
+	}
+	return result, nil
+}
+
+// PublicKey returns a public key known to the agent.
+func (c *Client) PublicKey(name string) (*rsa.PublicKey, error) {
+	resp, err := c.call(request{Op: opPublic, Key: name})
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := x509.ParsePKIXPublicKey(resp.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("Agent returned a non-RSA public key")
+	}
+	return pub, nil
+}
+
+// PrivateKey returns a handle to a private key held by the agent.
+func (c *Client) PrivateKey(name string) (repository.PrivateKey, error) {
+	pub, err := c.PublicKey(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &remoteKey{client: c, name: name, public: pub}, nil
+}
+
+// remoteKey is a private key that stays in the agent.
+type remoteKey struct {
+	client *Client
+	name   string
+	public *rsa.PublicKey
+}
+
+func (k *remoteKey) Public() crypto.PublicKey {
+	return k.public
+}
+
+func (k *remoteKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	req := request{Op: opSign, Key: k.name, Digest: digest}
+	if opts != nil {
+		req.Hash = uint(opts.HashFunc())
+	}
+	if pss, ok := opts.(*rsa.PSSOptions); ok {
+		req.PSS, req.SaltLength = true, pss.SaltLength
+	}
+
+	resp, err := k.client.call(req)
+	return resp.Signature, err
+}
+
+func (k *remoteKey) Decrypt(rand io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	if opts != nil {
+		if _, ok := opts.(*rsa.PKCS1v15DecryptOptions); !ok {
+			return nil, errors.New("The agent supports only PKCS#1 v1.5 decryption")
+		}
+	}
+
+	resp, err := k.client.call(request{Op: opUnwrap, Key: k.name, Ciphertext: ciphertext})
+	return resp.Plaintext, err
+}
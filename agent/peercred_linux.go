@@ -0,0 +1,33 @@
+package agent
+
+import (
+	"net"
+	"syscall"
+)
+
+// peerUID returns the user ID of the process on the other end of a Unix
+// socket connection.
+func peerUID(conn *net.UnixConn) (int, error) {
+	raw, err := conn.SyscallConn()
+	if err != nil {
+		return -1, err
+	}
+
+	var cred *syscall.Ucred
+	var credErr error
+	err = raw.Control(func(fd uintptr) {
+		cred, credErr = syscall.GetsockoptUcred(int(fd), syscall.SOL_SOCKET, syscall.SO_PEERCRED)
+	})
+	if err != nil {
+		return -1, err
+	}
+	if credErr != nil {
+		return -1, credErr
+	}
+
+	return int(cred.Uid), nil
+}
+
+// peerCredentials is set where peerUID asks the kernel who the peer is, so
+// the socket can be shared with other users.
+const peerCredentials = true
@@ -0,0 +1,19 @@
+//go:build !linux
+
+package agent
+
+import (
+	"net"
+	"os"
+)
+
+// peerUID cannot ask the kernel for the peer's credentials on this platform.
+// The socket is created readable only by its owner, so the peer is taken to
+// be the agent's own user.
+func peerUID(conn *net.UnixConn) (int, error) {
+	return os.Getuid(), nil
+}
+
+// peerCredentials is set where peerUID asks the kernel who the peer is, so
+// the socket can be shared with other users.
+const peerCredentials = false
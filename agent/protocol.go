@@ -0,0 +1,51 @@
+// Package agent holds unlocked private keys in a long running process and
+// lets other processes use them over a Unix domain socket, in the manner of
+// ssh-agent.  Clients may unwrap label headers and sign digests made with the
+// hash algorithms labels use; the private keys never leave the agent.
+package agent
+
+import (
+	"encoding/json"
+	"net"
+)
+
+// SocketEnv is the environment variable naming the agent's socket.  When it
+// is set, tools use the agent instead of reading private keys themselves.
+const SocketEnv = "REPOSITORY_AGENT_SOCK"
+
+// Operations understood by the agent.
+const (
+	opList   = "list"
+	opPublic = "public"
+	opSign   = "sign"
+	opUnwrap = "unwrap"
+)
+
+// request is one call from a client.  Requests and responses are written as
+// one JSON document per line.  A digest is signed with RSA-PSS and the salt
+// length, as in rsa.PSSOptions, when PSS is set, and with PKCS#1 v1.5
+// otherwise.
+type request struct {
+	Op         string `json:"op"`
+	Key        string `json:"key,omitempty"`
+	Hash       uint   `json:"hash,omitempty"`
+	PSS        bool   `json:"pss,omitempty"`
+	SaltLength int    `json:"saltLength,omitempty"`
+	Digest     []byte `json:"digest,omitempty"`
+	Ciphertext []byte `json:"ciphertext,omitempty"`
+}
+
+// response is the agent's answer to a request.
+type response struct {
+	Error     string   `json:"error,omitempty"`
+	Keys      []string `json:"keys,omitempty"`
+	Public    []string `json:"public,omitempty"`
+	Escrow    []string `json:"escrow,omitempty"`
+	PublicKey []byte   `json:"publicKey,omitempty"`
+	Signature []byte   `json:"signature,omitempty"`
+	Plaintext []byte   `json:"plaintext,omitempty"`
+}
+
+func newCodec(conn net.Conn) (*json.Encoder, *json.Decoder) {
+	return json.NewEncoder(conn), json.NewDecoder(conn)
+}
@@ -0,0 +1,377 @@
+package agent
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/darcinc/repository"
+)
+
+// Duration is a time.Duration read from and written to JSON as a string
+// such as "8h" or "30m".
+type Duration time.Duration
+
+// UnmarshalJSON parses a duration string.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// MarshalJSON writes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// ClientRule allows the processes of one user to use some keys.
+type ClientRule struct {
+	UID  int      `json:"uid"`
+	Keys []string `json:"keys"`
+}
+
+// Config controls which clients may use which keys and how long keys stay
+// unlocked.
+type Config struct {
+	// Clients lists the users allowed to use the agent and the keys each
+	// may use, "*" meaning every key.  When empty, only the agent's own
+	// user may connect and it may use every key.  Listing other users
+	// makes the socket connectable by anyone; requests are then allowed
+	// by the user ID the kernel reports for the client.  Clients only see
+	// the keys they may use, and the public halves of the escrow keys.
+	Clients []ClientRule `json:"clients"`
+
+	// Lifetime is how long keys stay unlocked.  Zero keeps them until the
+	// agent exits.
+	Lifetime Duration `json:"lifetime"`
+
+	// KeyLifetimes overrides the lifetime of individual keys.
+	KeyLifetimes map[string]Duration `json:"keyLifetimes"`
+}
+
+// ReadConfig reads an agent configuration from JSON.
+func ReadConfig(in io.Reader) (Config, error) {
+	config := Config{}
+	err := json.NewDecoder(in).Decode(&config)
+	return config, err
+}
+
+type unlockedKey struct {
+	key     repository.PrivateKey
+	expires time.Time
+}
+
+// Agent holds unlocked keys and answers requests to use them.
+type Agent struct {
+	mu         sync.Mutex
+	config     Config
+	keys       map[string]unlockedKey
+	publicKeys map[string]*rsa.PublicKey
+	escrow     []string
+	now        func() time.Time
+}
+
+// New unlocks every private key in the keystore and remembers its public
+// keys and escrow setting.  Keys expire according to the configured lifetimes.
+func New(keystore *repository.Keystore, config Config) (*Agent, error) {
+	result := &Agent{
+		config:     config,
+		keys:       make(map[string]unlockedKey),
+		publicKeys: make(map[string]*rsa.PublicKey),
+		now:        time.Now,
+	}
+
+	for name := range keystore.PrivateKeys {
+		key, ok := keystore.FindPrivateKey(name)
+		if !ok {
+			return nil, fmt.Errorf("Unable to unlock key %s", name)
+		}
+		result.AddKey(name, key)
+	}
+
+	for name := range keystore.PublicKeys {
+		if key, ok := keystore.FindPublicKey(name); ok {
+			result.publicKeys[name] = key
+		}
+	}
+	result.escrow = keystore.Escrow
+
+	return result, nil
+}
+
+// AddKey unlocks a private key under the given name.
+func (a *Agent) AddKey(name string, key repository.PrivateKey) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	lifetime := time.Duration(a.config.Lifetime)
+	if l, ok := a.config.KeyLifetimes[name]; ok {
+		lifetime = time.Duration(l)
+	}
+
+	unlocked := unlockedKey{key: key}
+	if lifetime > 0 {
+		unlocked.expires = a.now().Add(lifetime)
+	}
+	a.keys[name] = unlocked
+
+	if pub, ok := key.Public().(*rsa.PublicKey); ok {
+		a.publicKeys[name] = pub
+	}
+}
+
+// expire forgets private keys whose lifetime has passed.  The caller must
+// hold the lock.
+func (a *Agent) expire() {
+	now := a.now()
+	for name, key := range a.keys {
+		if !key.expires.IsZero() && now.After(key.expires) {
+			log.Printf("Key %s has expired and was removed from the agent", name)
+			delete(a.keys, name)
+		}
+	}
+}
+
+func (a *Agent) allowed(uid int, name string) bool {
+	if len(a.config.Clients) == 0 {
+		return uid == os.Getuid()
+	}
+
+	for _, rule := range a.config.Clients {
+		if rule.UID != uid {
+			continue
+		}
+		for _, k := range rule.Keys {
+			if k == "*" || k == name {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// client reports whether the configuration lets uid use the agent at all.
+func (a *Agent) client(uid int) bool {
+	if len(a.config.Clients) == 0 {
+		return uid == os.Getuid()
+	}
+
+	for _, rule := range a.config.Clients {
+		if rule.UID == uid {
+			return true
+		}
+	}
+	return false
+}
+
+// escrowKey reports whether name is one of the keystore's escrow keys, whose
+// public halves every client needs to write tapes.
+func (a *Agent) escrowKey(name string) bool {
+	for _, escrow := range a.escrow {
+		if escrow == name {
+			return true
+		}
+	}
+	return false
+}
+
+// sharedUIDs reports whether the configuration allows users other than the
+// agent's own to connect.
+func (c Config) sharedUIDs() bool {
+	for _, rule := range c.Clients {
+		if rule.UID != os.Getuid() {
+			return true
+		}
+	}
+	return false
+}
+
+// Listen creates the agent's socket at path, replacing a stale socket left
+// by an earlier agent.  The socket is only accessible by its owner unless
+// the configuration allows other users, when anyone may connect and the
+// peer's user ID, read from the kernel, decides which keys it may use.  The
+// directory holding the socket must then be searchable by those users.
+// Platforms that cannot read the peer's user ID refuse to share the socket.
+func Listen(path string, config Config) (net.Listener, error) {
+	mode, dirMode := os.FileMode(0600), os.FileMode(0700)
+	if config.sharedUIDs() {
+		if !peerCredentials {
+			return nil, errors.New("Unable to identify other users' clients on this platform, only the agent's own user may be allowed")
+		}
+		mode, dirMode = 0666, 0711
+	}
+	if err := os.MkdirAll(filepath.Dir(path), dirMode); err != nil {
+		return nil, err
+	}
+
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+
+	return listener, nil
+}
+
+// Serve answers clients on the listener until it is closed.
+func (a *Agent) Serve(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+		go a.serveConn(conn)
+	}
+}
+
+func (a *Agent) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	unixConn, ok := conn.(*net.UnixConn)
+	if !ok {
+		return
+	}
+	uid, err := peerUID(unixConn)
+	if err != nil {
+		log.Printf("Unable to identify agent client: %v", err)
+		return
+	}
+
+	encoder, decoder := newCodec(conn)
+	for {
+		req := request{}
+		if err := decoder.Decode(&req); err != nil {
+			return
+		}
+
+		resp := a.handle(uid, req)
+		if resp.Error != "" {
+			log.Printf("Refused %s request for key %q from uid %d: %s", req.Op, req.Key, uid, resp.Error)
+		}
+		if err := encoder.Encode(resp); err != nil {
+			return
+		}
+	}
+}
+
+func (a *Agent) handle(uid int, req request) response {
+	a.mu.Lock()
+	a.expire()
+	key, unlocked := a.keys[req.Key]
+	pub, public := a.publicKeys[req.Key]
+	names := []string{}
+	for name := range a.keys {
+		if a.allowed(uid, name) {
+			names = append(names, name)
+		}
+	}
+	publicNames := []string{}
+	for name := range a.publicKeys {
+		if a.allowed(uid, name) {
+			publicNames = append(publicNames, name)
+		}
+	}
+	a.mu.Unlock()
+
+	if !a.client(uid) {
+		return response{Error: "client not allowed"}
+	}
+
+	switch req.Op {
+	case opList:
+		sort.Strings(names)
+		sort.Strings(publicNames)
+		return response{Keys: names, Public: publicNames, Escrow: a.escrow}
+	case opPublic:
+		if !a.allowed(uid, req.Key) && !a.escrowKey(req.Key) {
+			return response{Error: "key not allowed for this client"}
+		}
+		if !public {
+			return response{Error: "no such key"}
+		}
+		bytes, err := x509.MarshalPKIXPublicKey(pub)
+		if err != nil {
+			return response{Error: err.Error()}
+		}
+		return response{PublicKey: bytes}
+	}
+
+	if !a.allowed(uid, req.Key) {
+		return response{Error: "key not allowed for this client"}
+	}
+	if !unlocked {
+		return response{Error: "no such key or key has expired"}
+	}
+
+	switch req.Op {
+	case opSign:
+		if err := checkLabelDigest(req.Hash, req.Digest); err != nil {
+			return response{Error: err.Error()}
+		}
+		var opts crypto.SignerOpts = crypto.Hash(req.Hash)
+		if req.PSS {
+			opts = &rsa.PSSOptions{SaltLength: req.SaltLength, Hash: crypto.Hash(req.Hash)}
+		}
+		signature, err := key.key.Sign(rand.Reader, req.Digest, opts)
+		if err != nil {
+			return response{Error: err.Error()}
+		}
+		return response{Signature: signature}
+	case opUnwrap:
+		plaintext, err := key.key.Decrypt(rand.Reader, req.Ciphertext, &rsa.PKCS1v15DecryptOptions{})
+		if err != nil {
+			return response{Error: err.Error()}
+		}
+		return response{Plaintext: plaintext}
+	}
+
+	return response{Error: fmt.Sprintf("unknown operation %s", req.Op)}
+}
+
+// labelHashes are the hash algorithms labels are signed with, see
+// repository.HashAlgorithms.
+var labelHashes = []crypto.Hash{crypto.SHA256, crypto.SHA384, crypto.SHA512, crypto.BLAKE2b_512}
+
+// checkLabelDigest refuses to sign anything but a digest of the right size
+// for one of the hash algorithms labels are signed with.  The agent cannot
+// tell what was hashed, so this only keeps clients to those algorithms.
+func checkLabelDigest(hash uint, digest []byte) error {
+	for _, algorithm := range labelHashes {
+		if crypto.Hash(hash) != algorithm {
+			continue
+		}
+		if len(digest) != algorithm.Size() {
+			return fmt.Errorf("digest is %d bytes, %v digests are %d", len(digest), algorithm, algorithm.Size())
+		}
+		return nil
+	}
+	return fmt.Errorf("hash %d is not used to sign labels", hash)
+}
@@ -0,0 +1,198 @@
+// Package cli is the command line of the repository tool: the keys and tape
+// commands, their flags and help, and shell completion for them.  The
+// repository, tapedrive and keymgr binaries all run their commands through
+// Run.
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository/commands"
+)
+
+// Program is the name of the repository tool, used in help and completion.
+const Program = "repository"
+
+// Env is what a command runs against: the file system and where its output
+// and errors are written.
+type Env struct {
+	Fs     afero.Fs
+	Stdout io.Writer
+	Stderr io.Writer
+}
+
+// runner validates the flags a command was given and runs it.
+type runner func(env Env) error
+
+// Command is a command of the repository tool.  A group, such as keys,
+// only has subcommands; the other commands define their flags in setup,
+// which returns the function that runs the command once they are parsed.
+type Command struct {
+	Name     string
+	Summary  string
+	Help     string
+	Commands []*Command
+
+	setup func(flags *flag.FlagSet) runner
+}
+
+// Root is the repository command, the parent of all the others.
+var Root = &Command{
+	Name:    Program,
+	Summary: "Create and open secure tapes and manage their keys",
+	Help: "Packs files into tapes that are encrypted for, and signed by, keys in a keystore,\n" +
+		"and opens, checks and relabels them.",
+	Commands: []*Command{keysCommand, tapeCommand},
+}
+
+// Find returns the command at the path of names below the root, or nil if
+// there is no such command.
+func Find(path ...string) *Command {
+	command := Root
+	for _, name := range path {
+		if command = command.find(name); command == nil {
+			return nil
+		}
+	}
+	return command
+}
+
+func (c *Command) find(name string) *Command {
+	for _, command := range c.Commands {
+		if command.Name == name {
+			return command
+		}
+	}
+	return nil
+}
+
+// FlagSet returns a new set of the command's flags, which is empty for a
+// group.
+func (c *Command) FlagSet() *flag.FlagSet {
+	flags, _ := c.flags(c.Name)
+	return flags
+}
+
+// flags returns the command's flags, named for the command's path, and the
+// function that runs it.
+func (c *Command) flags(path string) (*flag.FlagSet, runner) {
+	flags := flag.NewFlagSet(path, flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	if c.setup == nil {
+		return flags, nil
+	}
+	return flags, c.setup(flags)
+}
+
+// usage writes the command's help, its subcommands or flags to out.
+func (c *Command) usage(out io.Writer, path string) {
+	if len(c.Commands) > 0 {
+		fmt.Fprintf(out, "Usage: %s <command> [flags]\n\n%s\n\nCommands:\n", path, c.Help)
+		for _, command := range c.Commands {
+			fmt.Fprintf(out, "  %-14s %s\n", command.Name, command.Summary)
+		}
+		fmt.Fprintf(out, "\nRun '%s help %s<command>' for more about a command.\n", Program, strings.TrimPrefix(path+" ", Program+" "))
+		return
+	}
+
+	fmt.Fprintf(out, "Usage: %s [flags]\n\n%s\n", path, c.Help)
+	flags, _ := c.flags(path)
+	if hasFlags(flags) {
+		fmt.Fprintf(out, "\nFlags:\n")
+		flags.SetOutput(out)
+		flags.PrintDefaults()
+	}
+}
+
+func hasFlags(flags *flag.FlagSet) bool {
+	result := false
+	flags.VisitAll(func(*flag.Flag) { result = true })
+	return result
+}
+
+// Run runs the command named by args, which do not include the program
+// name, and returns the exit code for its error, see commands.ExitCode.
+// Unknown commands and bad flags are usage errors.  "help" followed by a
+// command, or -h after one, writes its help to env.Stdout.
+func Run(args []string, env Env) int {
+	help := len(args) > 0 && args[0] == "help"
+	if help {
+		args = args[1:]
+	}
+
+	command, path := Root, Program
+	for len(args) > 0 && len(command.Commands) > 0 && !strings.HasPrefix(args[0], "-") {
+		next := command.find(args[0])
+		if next == nil {
+			return fail(env, path, usageError("Unknown command %q", args[0]))
+		}
+		command, path, args = next, path+" "+args[0], args[1:]
+	}
+
+	if help || len(args) > 0 && (args[0] == "-h" || args[0] == "-help" || args[0] == "--help") {
+		command.usage(env.Stdout, path)
+		return commands.ExitOK
+	}
+	if len(command.Commands) > 0 {
+		if len(args) > 0 {
+			return fail(env, path, usageError("Unknown flag %s", args[0]))
+		}
+		command.usage(env.Stderr, path)
+		return commands.ExitUsage
+	}
+
+	flags, run := command.flags(path)
+	if err := flags.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			command.usage(env.Stdout, path)
+			return commands.ExitOK
+		}
+		return fail(env, path, usageError("%v", err))
+	}
+	if flags.NArg() > 0 {
+		return fail(env, path, usageError("Unexpected argument %q", flags.Arg(0)))
+	}
+	return fail(env, path, run(env))
+}
+
+// fail reports a command's error, pointing at its help for a usage error,
+// and returns its exit code.
+func fail(env Env, path string, err error) int {
+	if err == nil {
+		return commands.ExitOK
+	}
+	fmt.Fprintf(env.Stderr, "%s: %v\n", path, err)
+	var usage *commands.UsageError
+	if errors.As(err, &usage) {
+		fmt.Fprintf(env.Stderr, "Run '%s help%s' for usage.\n", Program, strings.TrimPrefix(path, Program))
+	}
+	return commands.ExitCode(err)
+}
+
+// outputFlag adds the -output flag of the commands that can write records
+// for programs, and returns a function that parses it.
+func outputFlag(flags *flag.FlagSet) func() (commands.OutputFormat, error) {
+	output := flags.String("output", "text", "The output format: text, json or ndjson")
+	return func() (commands.OutputFormat, error) {
+		return commands.ParseOutputFormat(*output)
+	}
+}
+
+// usageError returns a usage error, formatted like fmt.Sprintf.
+func usageError(format string, args ...interface{}) error {
+	return &commands.UsageError{Message: fmt.Sprintf(format, args...)}
+}
+
+// splitList splits a comma separated list, which may be empty.
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
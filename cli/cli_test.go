@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository/commands"
+)
+
+// run runs a command on the file system and returns its exit code, output
+// and errors.
+func run(fs afero.Fs, args ...string) (int, string, string) {
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	code := Run(args, Env{Fs: fs, Stdout: stdout, Stderr: stderr})
+	return code, stdout.String(), stderr.String()
+}
+
+// usage checks that a command is refused as a usage error.
+func usage(t *testing.T, message string, args ...string) {
+	t.Helper()
+	if code, _, _ := run(afero.NewMemMapFs(), args...); code != commands.ExitUsage {
+		t.Errorf("%s: expected a usage error for %v but got exit code %d", message, args, code)
+	}
+}
+
+// valid checks that a command's arguments are accepted, although running it
+// against an empty file system fails.
+func valid(t *testing.T, message string, args ...string) {
+	t.Helper()
+	if code, _, stderr := run(afero.NewMemMapFs(), args...); code == commands.ExitUsage {
+		t.Errorf("%s: expected %v to be valid but got %s", message, args, stderr)
+	}
+}
+
+func TestRun(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if code, out, _ := run(fs, "help"); code != commands.ExitOK || !strings.Contains(out, "keys") || !strings.Contains(out, "tape") {
+		t.Errorf("Expected the commands in the help but got %d %s", code, out)
+	}
+	if code, out, _ := run(fs, "help", "tape", "pack"); code != commands.ExitOK || !strings.Contains(out, "-archive") {
+		t.Errorf("Expected the flags in the help for tape pack but got %d %s", code, out)
+	}
+	if code, out, _ := run(fs, "keys", "create", "-h"); code != commands.ExitOK || !strings.Contains(out, "-bits") {
+		t.Errorf("Expected the flags in the help for keys create but got %d %s", code, out)
+	}
+	if code, _, errors := run(fs); code != commands.ExitUsage || !strings.Contains(errors, "Usage:") {
+		t.Errorf("Expected the usage without a command but got %d %s", code, errors)
+	}
+
+	usage(t, "Unknown command", "tape", "pakc")
+	usage(t, "Unknown group", "tapes", "pack")
+	usage(t, "Group without a command", "keys")
+	usage(t, "Unknown flag", "tape", "inspect", "-archive", "a", "-files", "b")
+	usage(t, "Unexpected argument", "tape", "inspect", "-archive", "a", "b")
+	usage(t, "Flag on a group", "tape", "-archive", "a")
+}
+
+func TestFind(t *testing.T) {
+	if command := Find("tape", "pack"); command == nil || command.Name != "pack" {
+		t.Errorf("Expected to find tape pack but got %v", command)
+	}
+	if Find("tape", "missing") != nil || Find("keys", "create", "more") != nil {
+		t.Error("Found a command that does not exist")
+	}
+	if Find() != Root {
+		t.Error("Expected the root for an empty path")
+	}
+	if Find("keys").FlagSet().NFlag() != 0 || Find("keys", "create").FlagSet().Lookup("bits") == nil {
+		t.Error("Wrong flags for the keys commands")
+	}
+}
+
+func TestLegacyArgs(t *testing.T) {
+	flags := flag.NewFlagSet("tapedrive", flag.ContinueOnError)
+	flags.String("action", "", "")
+	flags.String("archive", "", "")
+	flags.String("keyFile", "", "")
+	flags.String("files", "", "")
+	flags.Parse([]string{"-action", "inspect", "-archive", "monday.tape", "-keyFile", "foo", "-files", "a,b"})
+
+	args, ignored, err := LegacyArgs(flags, []string{"tape", "inspect"}, map[string]string{"keyFile": "keystore"})
+	if err != nil {
+		t.Fatalf("Unable to translate the arguments: %v", err)
+	}
+	if expected := []string{"tape", "inspect", "-archive=monday.tape", "-keystore=foo"}; !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v but got %v", expected, args)
+	}
+	if !reflect.DeepEqual(ignored, []string{"files"}) {
+		t.Errorf("Expected -files to be ignored but got %v", ignored)
+	}
+
+	if _, _, err = LegacyArgs(flags, []string{"tape", "inspekt"}, nil); commands.ExitCode(err) != commands.ExitUsage {
+		t.Errorf("Expected a usage error for an unknown action but got %v", err)
+	}
+	if _, _, err = LegacyArgs(flags, []string{"tape", ""}, nil); commands.ExitCode(err) != commands.ExitUsage {
+		t.Errorf("Expected a usage error for no action but got %v", err)
+	}
+}
@@ -0,0 +1,250 @@
+package cli
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+)
+
+var completionCommand = &Command{
+	Name:    "completion",
+	Summary: "Write a shell completion script",
+	Help:    "Writes a script completing the repository tool's commands and flags in a shell.",
+	Commands: []*Command{
+		{
+			Name:    "bash",
+			Summary: "Write the bash completion script",
+			Help:    "Writes the bash completion script, for example to load in ~/.bashrc with\n\n\tsource <(repository completion bash)",
+			setup:   completion(writeBash),
+		},
+		{
+			Name:    "zsh",
+			Summary: "Write the zsh completion script",
+			Help:    "Writes the zsh completion script, to save as _repository in a directory on $fpath.",
+			setup:   completion(writeZsh),
+		},
+		{
+			Name:    "fish",
+			Summary: "Write the fish completion script",
+			Help:    "Writes the fish completion script, to save as\n~/.config/fish/completions/repository.fish.",
+			setup:   completion(writeFish),
+		},
+	},
+}
+
+// The completion command writes its scripts from the root, so it is added
+// to the root here rather than in the root's declaration, which would make
+// the two depend on each other.
+func init() {
+	Root.Commands = append(Root.Commands, completionCommand)
+}
+
+// completion returns the setup of a command writing a completion script.
+func completion(write func(out io.Writer, commands []completed)) func(*flag.FlagSet) runner {
+	return func(*flag.FlagSet) runner {
+		return func(env Env) error {
+			write(env.Stdout, completions(Root, ""))
+			return nil
+		}
+	}
+}
+
+// completed is what a shell completes after a command: its subcommands, or
+// its flags.
+type completed struct {
+	path    string
+	command *Command
+	words   []string
+	flags   []*flag.Flag
+}
+
+// completions lists the completions of the command at path and the
+// commands below it.
+func completions(command *Command, path string) []completed {
+	current := completed{path: path, command: command}
+	for _, sub := range command.Commands {
+		current.words = append(current.words, sub.Name)
+	}
+	if command == Root {
+		current.words = append(current.words, "help")
+	}
+	command.FlagSet().VisitAll(func(f *flag.Flag) {
+		current.flags = append(current.flags, f)
+	})
+
+	result := []completed{current}
+	for _, sub := range command.Commands {
+		result = append(result, completions(sub, strings.TrimSpace(path+" "+sub.Name))...)
+	}
+	return result
+}
+
+// isBool reports whether a flag is a switch that takes no value.
+func isBool(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// valueFlags lists every flag that takes a value, so the shells can skip
+// the values when finding the command being completed.
+func valueFlags(commands []completed) string {
+	seen := map[string]bool{}
+	names := []string{}
+	for _, c := range commands {
+		for _, f := range c.flags {
+			if !isBool(f) && !seen[f.Name] {
+				seen[f.Name] = true
+				names = append(names, "-"+f.Name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return " " + strings.Join(names, " ") + " "
+}
+
+// list lists the subcommands or flags completed after a command.
+func (c completed) list() string {
+	words := append([]string{}, c.words...)
+	for _, f := range c.flags {
+		words = append(words, "-"+f.Name)
+	}
+	return strings.Join(words, " ")
+}
+
+func writeBash(out io.Writer, commands []completed) {
+	var script bytes.Buffer
+	fmt.Fprintf(&script, `# bash completion for %[1]s, written by "%[1]s completion bash".
+_%[1]s() {
+	local cur="${COMP_WORDS[COMP_CWORD]}" prev="${COMP_WORDS[COMP_CWORD-1]}"
+	local values="%[2]s" cmd="" word i
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		word="${COMP_WORDS[i]}"
+		case "$word" in
+		-*=*) ;;
+		-*) [[ $values == *" $word "* ]] && ((i++)) ;;
+		*) cmd="$cmd $word" ;;
+		esac
+	done
+	cmd="${cmd# help}"
+
+	if [[ $values == *" $prev "* ]]; then
+		COMPREPLY=($(compgen -f -- "$cur"))
+		return
+	fi
+
+	local words=""
+	case "$cmd" in
+`, Program, valueFlags(commands))
+	for _, c := range commands {
+		fmt.Fprintf(&script, "\t\"%s\") words=\"%s\" ;;\n", prefixed(c.path), c.list())
+	}
+	fmt.Fprintf(&script, `	esac
+	COMPREPLY=($(compgen -W "$words" -- "$cur"))
+}
+complete -F _%[1]s %[1]s
+`, Program)
+	out.Write(script.Bytes())
+}
+
+func writeZsh(out io.Writer, commands []completed) {
+	var script bytes.Buffer
+	fmt.Fprintf(&script, `#compdef %[1]s
+# zsh completion for %[1]s, written by "%[1]s completion zsh".
+_%[1]s() {
+	local values="%[2]s" cmd="" word i
+	for ((i = 2; i < CURRENT; i++)); do
+		word="${words[i]}"
+		case "$word" in
+		-*=*) ;;
+		-*) [[ $values == *" $word "* ]] && ((i++)) ;;
+		*) cmd="$cmd $word" ;;
+		esac
+	done
+	cmd="${cmd# help}"
+
+	if [[ $values == *" ${words[CURRENT-1]} "* ]]; then
+		_files
+		return
+	fi
+
+	case "$cmd" in
+`, Program, valueFlags(commands))
+	for _, c := range commands {
+		fmt.Fprintf(&script, "\t\"%s\") compadd -- %s ;;\n", prefixed(c.path), c.list())
+	}
+	fmt.Fprintf(&script, `	esac
+}
+
+if [[ "${funcstack[1]}" == "_%[1]s" ]]; then
+	_%[1]s "$@"
+else
+	compdef _%[1]s %[1]s
+fi
+`, Program)
+	out.Write(script.Bytes())
+}
+
+func writeFish(out io.Writer, commands []completed) {
+	var script bytes.Buffer
+	fmt.Fprintf(&script, `# fish completion for %[1]s, written by "%[1]s completion fish".
+function __%[1]s_command
+	set -l values %[2]s
+	set -l cmd
+	set -l skip 0
+	set -l words (commandline -opc)
+	set -e words[1]
+	for word in $words
+		if test $skip = 1
+			set skip 0
+		else if string match -q -- '-*=*' $word
+		else if string match -q -- '-*' $word
+			contains -- $word $values; and set skip 1
+		else
+			set -a cmd $word
+		end
+	end
+	string replace -r '^help ?' '' -- "$cmd"
+end
+
+function __%[1]s_is
+	set -l cmd (__%[1]s_command)
+	test "$cmd" = "$argv"
+end
+
+complete -c %[1]s -f
+`, Program, strings.TrimSpace(valueFlags(commands)))
+	for _, c := range commands {
+		condition := strings.TrimSpace(fmt.Sprintf("__%s_is %s", Program, c.path))
+		for _, sub := range c.command.Commands {
+			fmt.Fprintf(&script, "complete -c %s -n '%s' -a %s -d %s\n", Program, condition, sub.Name, fishQuote(sub.Summary))
+		}
+		if c.command == Root {
+			fmt.Fprintf(&script, "complete -c %s -n '%s' -a help -d %s\n", Program, condition, fishQuote("Show help for a command"))
+		}
+		for _, f := range c.flags {
+			value := " -r -F"
+			if isBool(f) {
+				value = ""
+			}
+			fmt.Fprintf(&script, "complete -c %s -n '%s' -o %s%s -d %s\n", Program, condition, f.Name, value, fishQuote(f.Usage))
+		}
+	}
+	out.Write(script.Bytes())
+}
+
+// prefixed returns the command path as the shells build it, each word
+// following a space.
+func prefixed(path string) string {
+	if path == "" {
+		return ""
+	}
+	return " " + path
+}
+
+// fishQuote quotes a description for fish.
+func fishQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
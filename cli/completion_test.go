@@ -0,0 +1,42 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository/commands"
+)
+
+func TestCompletion(t *testing.T) {
+	scripts := map[string][]string{
+		"bash": {`"") words="keys tape completion help`, `" tape pack") words="-archive`, "complete -F _repository repository"},
+		"zsh":  {"#compdef repository", `" keys") compadd -- create list import export delete`, "_files"},
+		"fish": {"complete -c repository -n '__repository_is tape' -a pack", "-o archive -r -F", "-o sign-only -d", `recipient\'s`},
+	}
+	for shell, expected := range scripts {
+		code, out, _ := run(afero.NewMemMapFs(), "completion", shell)
+		if code != commands.ExitOK {
+			t.Errorf("Unable to write the %s completion", shell)
+		}
+		for _, text := range expected {
+			if !strings.Contains(out, text) {
+				t.Errorf("Expected %q in the %s completion", text, shell)
+			}
+		}
+	}
+
+	usage(t, "Unknown shell", "completion", "powershell")
+}
+
+func TestCompletionCoversCommands(t *testing.T) {
+	_, out, _ := run(afero.NewMemMapFs(), "completion", "bash")
+	for _, c := range completions(Root, "") {
+		if !strings.Contains(out, `"`+prefixed(c.path)+`")`) {
+			t.Errorf("No completion for %q", c.path)
+		}
+	}
+	if strings.Contains(valueFlags(completions(Root, "")), " -sign-only ") {
+		t.Error("Switches should not be listed as flags taking values")
+	}
+}
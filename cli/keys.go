@@ -0,0 +1,265 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/darcinc/repository"
+	"github.com/darcinc/repository/commands"
+)
+
+var keysCommand = &Command{
+	Name:    "keys",
+	Summary: "Create, list, import, export and delete keys",
+	Help:    "Manages the keys in a keystore, the keystore's policy, prekeys and escrow keys.",
+	Commands: []*Command{
+		{
+			Name:    "create",
+			Summary: "Create a new key",
+			Help:    "Creates a new RSA or hybrid post-quantum key pair in the keystore, creating the\nkeystore if it does not exist.",
+			setup:   createKey,
+		},
+		{
+			Name:    "list",
+			Summary: "List the keys in a keystore",
+			Help:    "Lists the private and public keys in the keystore.",
+			setup:   listKeys,
+		},
+		{
+			Name:    "import",
+			Summary: "Import a key from a file",
+			Help:    "Imports a private or public key from a file into the keystore.  The format is\ndetected if it is not given.",
+			setup:   importKey,
+		},
+		{
+			Name:    "export",
+			Summary: "Export a key to a file",
+			Help:    "Exports a key from the keystore to a file, or to standard out if no file is given.",
+			setup:   exportKey,
+		},
+		{
+			Name:    "delete",
+			Summary: "Delete a key",
+			Help:    "Deletes a key, private and public, from the keystore.",
+			setup:   deleteKey,
+		},
+		{
+			Name:    "doctor",
+			Summary: "Check the keys against the keystore's policy",
+			Help:    "Checks the keys in the keystore against its policy, or against a policy file, and\nexits with a non-zero status if any of them fail.",
+			setup:   doctor,
+		},
+		{
+			Name:    "policy",
+			Summary: "Set the keystore's policy",
+			Help:    "Stores a JSON key policy in the keystore.",
+			setup:   setPolicy,
+		},
+		{
+			Name:    "prekey",
+			Summary: "Publish a new prekey",
+			Help:    "Creates a prekey signed by a key in the keystore and publishes it in a file, or on\nstandard out, for senders to pack forward-secret tapes with.",
+			setup:   createPrekey,
+		},
+		{
+			Name:    "prune",
+			Summary: "Remove expired prekeys",
+			Help:    "Removes the expired prekeys from the keystore.",
+			setup:   prunePrekeys,
+		},
+		{
+			Name:    "escrow",
+			Summary: "Set the keystore's escrow keys",
+			Help:    "Sets the public keys every tape packed with the keystore is also wrapped for.  No\nnames clears them.",
+			setup:   setEscrow,
+		},
+	},
+}
+
+// keystoreFlag adds the -keystore flag every keys command has.
+func keystoreFlag(flags *flag.FlagSet) *string {
+	return flags.String("keystore", "keys", "The name of the keystore, can be the name or an absolute path")
+}
+
+func createKey(flags *flag.FlagSet) runner {
+	keystore := keystoreFlag(flags)
+	name := flags.String("name", "", "The name of the key (required)")
+	keyType := flags.String("type", "rsa", "The type of key to create (rsa or "+repository.HybridKeyType+")")
+	bits := flags.Int("bits", 4096, "The number of bits for the RSA key")
+
+	return func(env Env) error {
+		if *name == "" {
+			return usageError("The name of the key is required when creating a new key")
+		}
+		if *keyType != "rsa" && *keyType != repository.HybridKeyType {
+			return usageError("Valid key types are rsa or %s", repository.HybridKeyType)
+		}
+		if *keyType == repository.HybridKeyType {
+			return commands.CreateHybridKey(env.Fs, *name, *keystore)
+		}
+		if *bits != 1024 && *bits != 2048 && *bits != 4096 && *bits != 8192 {
+			return usageError("Valid bits for cipher strength are 1024 (if the keystore policy allows it), 2048, 4096, or 8192")
+		}
+		return commands.CreateKeys(env.Fs, *name, *keystore, *bits)
+	}
+}
+
+func listKeys(flags *flag.FlagSet) runner {
+	keystore := keystoreFlag(flags)
+	output := outputFlag(flags)
+
+	return func(env Env) error {
+		format, err := output()
+		if err != nil {
+			return err
+		}
+		return commands.ListKeys(env.Fs, *keystore, format, env.Stdout)
+	}
+}
+
+// formatFlags adds the -format and -passphrase-file flags of the commands
+// that read or write key files, and returns a function that checks the
+// format and reads the passphrase.
+func formatFlags(flags *flag.FlagSet) (*string, func(env Env) ([]byte, error)) {
+	format := flags.String("format", "", "The key format (pem, pkcs8, openssh, jwk, pkcs12), detected on import if omitted")
+	passphraseFile := flags.String("passphrase-file", "", "A file containing the passphrase for encrypted pkcs8, openssh or pkcs12 keys")
+
+	return format, func(env Env) ([]byte, error) {
+		if _, err := repository.ParseKeyFormat(*format); err != nil {
+			return nil, usageError("Valid key formats are pem, pkcs8, openssh, jwk, or pkcs12")
+		}
+		passphrase, err := commands.ReadPassphrase(env.Fs, *passphraseFile)
+		if err != nil {
+			return nil, repository.NewError(err, "Failed to read passphrase file")
+		}
+		return passphrase, nil
+	}
+}
+
+func importKey(flags *flag.FlagSet) runner {
+	keystore := keystoreFlag(flags)
+	name := flags.String("name", "", "The name to give the imported key (required)")
+	file := flags.String("file", "", "The key file to import (required)")
+	format, passphrase := formatFlags(flags)
+
+	return func(env Env) error {
+		if *name == "" {
+			return usageError("A key name for the imported key is required when importing a key")
+		}
+		if *file == "" {
+			return usageError("The file to import is required when importing a key")
+		}
+		pass, err := passphrase(env)
+		if err != nil {
+			return err
+		}
+		return commands.ImportKey(env.Fs, *keystore, *name, *file, *format, pass)
+	}
+}
+
+func exportKey(flags *flag.FlagSet) runner {
+	keystore := keystoreFlag(flags)
+	name := flags.String("name", "", "The name of the key to export (required)")
+	file := flags.String("file", "", "The file to export the key to, standard out if omitted")
+	format, passphrase := formatFlags(flags)
+
+	return func(env Env) error {
+		if *name == "" {
+			return usageError("The name of the key to export is required")
+		}
+		pass, err := passphrase(env)
+		if err != nil {
+			return err
+		}
+		if *file == "" {
+			return commands.ExtractKeysTo(env.Fs, *keystore, *name, env.Stdout, *format, pass)
+		}
+		return commands.ExtractKeys(env.Fs, *keystore, *name, *file, *format, pass)
+	}
+}
+
+func deleteKey(flags *flag.FlagSet) runner {
+	keystore := keystoreFlag(flags)
+	name := flags.String("name", "", "The name of the key to delete (required)")
+
+	return func(env Env) error {
+		if *name == "" {
+			return usageError("The name of the key to delete is required")
+		}
+		return commands.DeleteKeys(env.Fs, *keystore, *name)
+	}
+}
+
+func doctor(flags *flag.FlagSet) runner {
+	keystore := keystoreFlag(flags)
+	policy := flags.String("policy", "", "A JSON key policy to check the keys against instead of the keystore's")
+
+	return func(env Env) error {
+		problems, err := commands.Doctor(env.Fs, *keystore, *policy, env.Stdout)
+		if err != nil {
+			return err
+		}
+		if problems > 0 {
+			return fmt.Errorf("Found %d problems in keystore %s", problems, *keystore)
+		}
+		return nil
+	}
+}
+
+func setPolicy(flags *flag.FlagSet) runner {
+	keystore := keystoreFlag(flags)
+	policy := flags.String("policy", "", "The JSON key policy to store in the keystore (required)")
+
+	return func(env Env) error {
+		if *policy == "" {
+			return usageError("The policy file is required when setting the keystore policy")
+		}
+		return commands.SetPolicy(env.Fs, *keystore, *policy)
+	}
+}
+
+func createPrekey(flags *flag.FlagSet) runner {
+	keystore := keystoreFlag(flags)
+	name := flags.String("name", "", "The name of the key to sign the prekey with (required)")
+	file := flags.String("file", "", "The file to publish the prekey in, standard out if omitted")
+	lifetime := flags.Duration("lifetime", 30*24*time.Hour, "How long the prekey can be used before it expires")
+
+	return func(env Env) error {
+		if *name == "" {
+			return usageError("The name of the key to sign the prekey with is required when creating a prekey")
+		}
+		out := env.Stdout
+		if *file != "" {
+			published, err := env.Fs.OpenFile(*file, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+			if err != nil {
+				return err
+			}
+			defer published.Close()
+			out = published
+		}
+		return commands.CreatePrekey(env.Fs, *keystore, *name, *lifetime, out)
+	}
+}
+
+func prunePrekeys(flags *flag.FlagSet) runner {
+	keystore := keystoreFlag(flags)
+
+	return func(env Env) error {
+		return commands.PrunePrekeys(env.Fs, *keystore, env.Stdout)
+	}
+}
+
+func setEscrow(flags *flag.FlagSet) runner {
+	keystore := keystoreFlag(flags)
+	names := flags.String("name", "", "The comma separated names of the escrow keys, none to clear them")
+
+	return func(env Env) error {
+		escrow := splitList(*names)
+		if escrow == nil {
+			escrow = []string{}
+		}
+		return commands.SetEscrow(env.Fs, *keystore, escrow)
+	}
+}
@@ -0,0 +1,67 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository/commands"
+)
+
+func TestValidateKeys(t *testing.T) {
+	valid(t, "Create", "keys", "create", "-name", "mykey", "-keystore", "foo", "-bits", "2048")
+	usage(t, "Create without a name", "keys", "create", "-keystore", "foo")
+	usage(t, "Import without a name", "keys", "import", "-file", "import.pem")
+	usage(t, "Import without a file", "keys", "import", "-name", "mykey")
+	valid(t, "Import", "keys", "import", "-name", "mykey", "-file", "import.pem")
+	usage(t, "Export without a name", "keys", "export", "-file", "export.pem")
+	valid(t, "Export", "keys", "export", "-name", "mykey", "-file", "export.pem")
+	usage(t, "Delete without a name", "keys", "delete")
+	valid(t, "List", "keys", "list", "-keystore", "foo")
+	valid(t, "List as NDJSON", "keys", "list", "-keystore", "foo", "-output", "ndjson")
+	usage(t, "List in an unknown format", "keys", "list", "-output", "csv")
+	usage(t, "Policy without a policy file", "keys", "policy", "-keystore", "foo")
+	valid(t, "Policy", "keys", "policy", "-policy", "policy.json")
+	usage(t, "Prekey without a key name", "keys", "prekey")
+	valid(t, "Prekey", "keys", "prekey", "-name", "mykey")
+}
+
+func TestValidateKeyFormatAndType(t *testing.T) {
+	for _, format := range []string{"pem", "pkcs8", "openssh", "jwk", "pkcs12"} {
+		valid(t, "Key format", "keys", "export", "-name", "mykey", "-format", format)
+	}
+	usage(t, "Unknown key format", "keys", "export", "-name", "mykey", "-format", "der")
+
+	usage(t, "Unknown key type", "keys", "create", "-name", "mykey", "-type", "dsa")
+	for _, bits := range []string{"-100", "0", "9000"} {
+		usage(t, "Invalid cipher strength", "keys", "create", "-name", "mykey", "-bits", bits)
+	}
+	usage(t, "Cipher strength too large", "keys", "create", "-name", "mykey", "-bits", "9000000000000000000000")
+}
+
+func TestKeysCommands(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	if code, _, errors := run(fs, "keys", "create", "-name", "alice", "-keystore", "foo", "-bits", "2048"); code != commands.ExitOK {
+		t.Fatalf("Unable to create a key: %s", errors)
+	}
+	if code, _, errors := run(fs, "keys", "create", "-name", "bob", "-keystore", "foo", "-bits", "1024"); code != commands.ExitPolicy {
+		t.Errorf("Expected the default policy to refuse a 1024 bit key but got %d %s", code, errors)
+	}
+
+	if _, out, _ := run(fs, "keys", "list", "-keystore", "foo"); !strings.Contains(out, "alice") {
+		t.Errorf("Expected alice in the keys listed but got %s", out)
+	}
+	if _, out, _ := run(fs, "keys", "list", "-keystore", "foo", "-output", "json"); !strings.Contains(out, `"name": "alice"`) {
+		t.Errorf("Expected a record for alice but got %s", out)
+	}
+	if _, out, _ := run(fs, "keys", "export", "-name", "alice", "-keystore", "foo"); !strings.Contains(out, "PUBLIC KEY") {
+		t.Errorf("Expected alice's public key on standard out but got %s", out)
+	}
+
+	if code, _, errors := run(fs, "keys", "delete", "-name", "alice", "-keystore", "foo"); code != commands.ExitOK {
+		t.Fatalf("Unable to delete a key: %s", errors)
+	}
+	if code, _, _ := run(fs, "keys", "export", "-name", "alice", "-keystore", "foo"); code != commands.ExitNotFound {
+		t.Errorf("Expected a deleted key not to be found but got exit code %d", code)
+	}
+}
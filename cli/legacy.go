@@ -0,0 +1,47 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+)
+
+// LegacyArgs returns the arguments that run the command at path with the
+// flags set on one of the older tools, tapedrive or keymgr, which chose the
+// command with -action.  renamed maps the older tool's flag names to the
+// command's, or to "" for a flag the command has with another meaning.
+// Flags the command does not have are left out and returned as ignored, as
+// the older tools ignored them.  A flag whose Get returns a
+// []string, like a repeated flag, is passed once for each value.
+func LegacyArgs(flags *flag.FlagSet, path []string, renamed map[string]string) (args, ignored []string, err error) {
+	command := Find(path...)
+	if command == nil || len(command.Commands) > 0 {
+		return nil, nil, usageError("Unknown action %q", path[len(path)-1])
+	}
+	known := command.FlagSet()
+
+	args = append([]string{}, path...)
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == "action" {
+			return
+		}
+		name := f.Name
+		if to, ok := renamed[name]; ok {
+			name = to
+		}
+		if name == "" || known.Lookup(name) == nil {
+			ignored = append(ignored, f.Name)
+			return
+		}
+
+		if getter, ok := f.Value.(flag.Getter); ok {
+			if values, ok := getter.Get().([]string); ok {
+				for _, value := range values {
+					args = append(args, fmt.Sprintf("-%s=%s", name, value))
+				}
+				return
+			}
+		}
+		args = append(args, fmt.Sprintf("-%s=%s", name, f.Value.String()))
+	})
+	return args, ignored, nil
+}
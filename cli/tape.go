@@ -0,0 +1,542 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/darcinc/repository"
+	"github.com/darcinc/repository/commands"
+)
+
+var tapeCommand = &Command{
+	Name:    "tape",
+	Summary: "Pack, unpack, list, verify and inspect tapes",
+	Help:    "Packs files into tapes, opens and checks them, and changes who can open them.",
+	Commands: []*Command{
+		{
+			Name:    "pack",
+			Summary: "Pack files into a tape",
+			Help: "Packs files, or a directory, into a tape encrypted for the recipient's public key\n" +
+				"and signed with the sender's private key.  A tape can instead be protected by a\n" +
+				"passphrase, split among custodians, or only signed.",
+			setup: packTape,
+		},
+		{
+			Name:    "unpack",
+			Summary: "Unpack the files on a tape",
+			Help: "Checks and decrypts a tape and writes out its files.  The keys are found from the\n" +
+				"label if they are not given.",
+			setup: unpackTape,
+		},
+		{
+			Name:    "intake",
+			Summary: "Unpack the next tape of a stream",
+			Help:    "Unpacks a tape after checking it follows the last tape received in its stream.",
+			setup:   intakeTape,
+		},
+		{
+			Name:    "list",
+			Summary: "List the files on a tape",
+			Help: "Checks and decrypts a tape and lists its files without writing them out.  The\n" +
+				"keys are found from the label if they are not given.",
+			setup: listTape,
+		},
+		{
+			Name:    "verify",
+			Summary: "Verify a sign-only tape",
+			Help: "Checks a sign-only tape's signature and manifest with the sender's public key,\n" +
+				"and can write a signed receipt for it.",
+			setup: verifyTape,
+		},
+		{
+			Name:    "inspect",
+			Summary: "Describe a tape without keys",
+			Help:    "Describes a tape's label, recipients and signers without opening it.",
+			setup:   inspectTape,
+		},
+		{
+			Name:    "relabel",
+			Summary: "Relabel a tape for a new recipient",
+			Help: "Decrypts a tape's label with your private key and writes a new label for another\n" +
+				"recipient, in place or to the output file.  The payload is not touched.",
+			setup: relabelTape,
+		},
+		{
+			Name:    "cosign",
+			Summary: "Add a co-signature to a tape",
+			Help:    "Adds an approver's signature to a tape's label, in place or to the output file.",
+			setup:   cosignTape,
+		},
+		{
+			Name:    "share",
+			Summary: "Write a custodian's share of a tape key",
+			Help:    "Decrypts a custodian's share of the key of a tape packed for custodians.",
+			setup:   shareTape,
+		},
+		{
+			Name:    "combine",
+			Summary: "Unpack a tape from custodians' shares",
+			Help:    "Combines enough custodians' shares to recover a tape's key and unpacks the tape.",
+			setup:   combineShares,
+		},
+		{
+			Name:    "check-sender",
+			Summary: "Check who signed a tape",
+			Help:    "Checks the sender's signature on a tape with only the sender's public key.",
+			setup:   checkSender,
+		},
+		{
+			Name:    "check-receipt",
+			Summary: "Check a receipt for the tapes sent",
+			Help:    "Checks a receipt signed by the recipient against the tapes that were sent.",
+			setup:   checkReceipt,
+		},
+		{
+			Name:    "check-escrow",
+			Summary: "Check a tape is wrapped for the escrow keys",
+			Help:    "Checks a tape's label is wrapped for every escrow key of the keystore.",
+			setup:   checkEscrow,
+		},
+	},
+}
+
+// tapeFlags adds the -archive and -keystore flags every tape command has.
+func tapeFlags(flags *flag.FlagSet, archiveUsage string) (archive, keystore *string) {
+	archive = flags.String("archive", "", archiveUsage)
+	keystore = flags.String("keystore", "keys", "The keystore containing the keys, or pemdir:<directory> or a pkcs11: URI")
+	return archive, keystore
+}
+
+// keyFlags are the key names and passphrase file used to open a tape.
+type keyFlags struct {
+	privkey, pubkey, passphraseFile *string
+}
+
+func addKeyFlags(flags *flag.FlagSet) keyFlags {
+	return keyFlags{
+		privkey:        flags.String("privkey", "", "The name of your private key, found from the label if omitted"),
+		pubkey:         flags.String("pubkey", "", "The name of the sender's public key, found from the label if omitted"),
+		passphraseFile: flags.String("passphrase-file", "", "A file whose first line is the passphrase protecting the tape, instead of a private key"),
+	}
+}
+
+// check checks the keys given to the command named what.
+func (k keyFlags) check(what string) error {
+	if *k.privkey == "" && *k.pubkey != "" && *k.passphraseFile == "" {
+		return usageError("When %s contents with a public key you must specify a key name", what)
+	}
+	if *k.privkey != "" && *k.passphraseFile != "" {
+		return usageError("When %s contents with a passphrase you must not specify a key name", what)
+	}
+	if *k.pubkey == "" && *k.privkey != "" {
+		return usageError("When %s contents with a key name you must specify a public key", what)
+	}
+	return nil
+}
+
+// openFlags are the checks made when opening a tape, see
+// commands.OpenOptions.
+type openFlags struct {
+	signers      *string
+	minSigners   *int
+	ignoreWindow *bool
+	state        *string
+	acceptGaps   *bool
+	receipt      *string
+	unverified   *bool
+}
+
+// addOpenFlags adds the flags of the commands that open a tape, with
+// -receipt if the command can write one.
+func addOpenFlags(flags *flag.FlagSet, receipt bool) openFlags {
+	result := openFlags{
+		signers:      flags.String("signers", "", "The comma separated keys that must have signed or co-signed the tape"),
+		minSigners:   flags.Int("min-signers", 0, "How many of -signers must have signed the tape, all of them if omitted"),
+		ignoreWindow: flags.Bool("ignore-window", false, "Open the tape outside its validity window, which is recorded in the audit log"),
+		state:        flags.String("state", "", "The file keeping the last tape of each stream received"),
+		acceptGaps:   flags.Bool("accept-gaps", false, "Take in the tape even though earlier tapes in its stream are missing"),
+		unverified:   flags.Bool("allow-unverified", false, "Read an encrypted tape even though its sender's signature of the whole tape cannot be checked"),
+		receipt:      new(string),
+	}
+	if receipt {
+		result.receipt = flags.String("receipt", "", "The receipt to write after unpacking the tape")
+	}
+	return result
+}
+
+// options checks the flags and returns the options to open a tape with.
+// Tapes opened with a passphrase have no signers, window, stream or receipt
+// to check.
+func (o openFlags) options(passphrase bool) (commands.OpenOptions, error) {
+	signers := splitList(*o.signers)
+	result := commands.OpenOptions{
+		Signers:      signers,
+		MinSigners:   *o.minSigners,
+		IgnoreWindow: *o.ignoreWindow,
+		StateFile:    *o.state,
+		AcceptGaps:   *o.acceptGaps,
+		ReceiptFile:  *o.receipt,
+		Unverified:   *o.unverified,
+	}
+	if result.MinSigners == 0 {
+		result.MinSigners = len(signers)
+	}
+
+	switch {
+	case *o.minSigners < 0 || *o.minSigners > len(signers):
+		return result, usageError("The number of signers required must not be more than the number of signers")
+	case signers != nil && passphrase:
+		return result, usageError("Signers cannot be required of a tape opened with a passphrase")
+	case result.IgnoreWindow && passphrase:
+		return result, usageError("The validity window of a tape opened with a passphrase cannot be ignored")
+	case result.StateFile != "" && passphrase:
+		return result, usageError("Tapes opened with a passphrase cannot be checked against a stream state")
+	case result.ReceiptFile != "" && passphrase:
+		return result, usageError("Receipts are only written for tapes unpacked with a private key")
+	}
+	return result, nil
+}
+
+// reportSigners writes the signers verified on a tape opened with -signers.
+func reportSigners(env Env, result *commands.TapeResult, opts commands.OpenOptions) {
+	if result != nil && opts.Signers != nil {
+		fmt.Fprintf(env.Stderr, "Verified signers: %s\n", strings.Join(result.Signers, ", "))
+	}
+}
+
+// metaFlags collects each -meta key=value.
+type metaFlags []string
+
+func (m *metaFlags) String() string {
+	return strings.Join(*m, ",")
+}
+
+func (m *metaFlags) Set(value string) error {
+	*m = append(*m, value)
+	return nil
+}
+
+func supportedHash(name string) bool {
+	for _, supported := range repository.HashAlgorithms() {
+		if name == supported {
+			return true
+		}
+	}
+	return false
+}
+
+func packTape(flags *flag.FlagSet) runner {
+	archive, keystore := tapeFlags(flags, "The tape to pack (required)")
+	files := flags.String("files", "", "The comma separated list of files to pack")
+	directory := flags.String("dir", "", "The directory containing the files to pack, all of them if -files is omitted")
+	privkey := flags.String("privkey", "", "The name of the sender's private key to sign the tape with")
+	pubkey := flags.String("pubkey", "", "The name of the recipient's public key")
+	recipients := flags.String("recipients", "", "The comma separated names of further public keys to pack the tape for")
+	prekey := flags.String("prekey", "", "A prekey published by the recipient, packs a forward-secret tape")
+	custodians := flags.String("custodians", "", "The comma separated custodian key names to split the tape key among")
+	threshold := flags.Int("threshold", 0, "The number of custodians needed to open a tape packed with -custodians")
+	passphraseFile := flags.String("passphrase-file", "", "A file whose first line is the passphrase protecting the tape, instead of the recipient's key")
+	signOnly := flags.Bool("sign-only", false, "Pack a tape that is signed but not encrypted, verified with only the sender's public key")
+	expires := flags.String("expires", "", "When the tape expires, as an RFC 3339 time or a duration from now such as 720h")
+	notBefore := flags.String("not-before", "", "When the tape may first be opened, as an RFC 3339 time or a duration from now")
+	stream := flags.String("stream", "", "The stream to number and chain the tape in, kept in the -state file")
+	state := flags.String("state", "", "The file keeping the last tape of each stream sent")
+	description := flags.String("description", "", "A description of the tape, recorded in its metadata")
+	meta := &metaFlags{}
+	flags.Var(meta, "meta", "A key=value recorded in the tape's metadata, may be repeated")
+	hash := flags.String("hash", "", "The hash algorithm to sign the tape with: "+strings.Join(repository.HashAlgorithms(), ", ")+" (sha256 if omitted)")
+	compression := flags.String("compression", "", "How to compress the tape: none (the default) or gzip")
+
+	return func(env Env) error {
+		switch {
+		case *archive == "":
+			return usageError("Packing an archive requires a path to an archive")
+		case *files == "" && *directory == "":
+			return usageError("Packing an archive requires a list of files or a directory")
+		case *pubkey == "" && *custodians == "" && *passphraseFile == "" && !*signOnly:
+			return usageError("Packing an archive requires a key name")
+		case *custodians != "" && (*threshold < 1 || *threshold > len(splitList(*custodians))):
+			return usageError("Packing an archive for custodians requires a threshold between 1 and the number of custodians")
+		case *privkey == "" && *passphraseFile == "":
+			return usageError("Packing an archive requires a private key name")
+		case *stream != "" && (*state == "" || *privkey == ""):
+			return usageError("Packing an archive in a stream requires a state file and a private key name")
+		case *compression != "" && *compression != repository.CompressionNone && *compression != repository.CompressionGzip:
+			return usageError("Unsupported compression %s, use none or gzip", *compression)
+		case *hash != "" && !supportedHash(*hash):
+			return usageError("Unsupported hash algorithm %s, use one of %s", *hash, strings.Join(repository.HashAlgorithms(), ", "))
+		}
+		for _, field := range *meta {
+			if !strings.Contains(field, "=") {
+				return usageError("Metadata must be given as -meta key=value, not %s", field)
+			}
+		}
+
+		return commands.PackRepository(env.Fs, map[string]string{
+			"archive":         *archive,
+			"files":           *files,
+			"directory":       *directory,
+			"keystore":        *keystore,
+			"privkey":         *privkey,
+			"pubkey":          *pubkey,
+			"recipients":      *recipients,
+			"prekey":          *prekey,
+			"custodians":      *custodians,
+			"threshold":       strconv.Itoa(*threshold),
+			"passphrase-file": *passphraseFile,
+			"sign-only":       strconv.FormatBool(*signOnly),
+			"expires":         *expires,
+			"not-before":      *notBefore,
+			"stream":          *stream,
+			"state":           *state,
+			"description":     *description,
+			"meta":            strings.Join(*meta, "\n"),
+			"hash":            *hash,
+			"compression":     *compression,
+		})
+	}
+}
+
+func unpackTape(flags *flag.FlagSet) runner {
+	archive, keystore := tapeFlags(flags, "The tape to unpack (required)")
+	keys := addKeyFlags(flags)
+	open := addOpenFlags(flags, true)
+
+	return func(env Env) error {
+		if *archive == "" {
+			return usageError("When unpacking contents you must specify an archive")
+		}
+		if err := keys.check("unpacking"); err != nil {
+			return err
+		}
+		opts, err := open.options(*keys.passphraseFile != "")
+		if err != nil {
+			return err
+		}
+
+		var result *commands.TapeResult
+		if *keys.passphraseFile != "" {
+			result, err = commands.UnpackWithPassphrase(env.Fs, *archive, *keystore, *keys.pubkey, *keys.passphraseFile, opts)
+		} else {
+			result, err = commands.UnpackRepositoryWithOptions(env.Fs, *archive, *keystore, *keys.privkey, *keys.pubkey, opts)
+		}
+		reportSigners(env, result, opts)
+		return err
+	}
+}
+
+func intakeTape(flags *flag.FlagSet) runner {
+	archive, keystore := tapeFlags(flags, "The tape to take in (required)")
+	privkey := flags.String("privkey", "", "The name of your private key, found from the label if omitted")
+	pubkey := flags.String("pubkey", "", "The name of the sender's public key, found from the label if omitted")
+	open := addOpenFlags(flags, true)
+
+	return func(env Env) error {
+		switch {
+		case *archive == "":
+			return usageError("Taking in a tape requires an archive")
+		case *open.state == "":
+			return usageError("Taking in a tape requires a state file")
+		case (*privkey == "") != (*pubkey == ""):
+			return usageError("Taking in a tape requires both a private and a public key name, or neither")
+		}
+		opts, err := open.options(false)
+		if err != nil {
+			return err
+		}
+
+		result, err := commands.UnpackRepositoryWithOptions(env.Fs, *archive, *keystore, *privkey, *pubkey, opts)
+		reportSigners(env, result, opts)
+		return err
+	}
+}
+
+func listTape(flags *flag.FlagSet) runner {
+	archive, keystore := tapeFlags(flags, "The tape to list (required)")
+	keys := addKeyFlags(flags)
+	open := addOpenFlags(flags, false)
+	output := outputFlag(flags)
+
+	return func(env Env) error {
+		if *archive == "" {
+			return usageError("When listing contents you must specify an archive")
+		}
+		if err := keys.check("listing"); err != nil {
+			return err
+		}
+		opts, err := open.options(*keys.passphraseFile != "")
+		if err != nil {
+			return err
+		}
+		format, err := output()
+		if err != nil {
+			return err
+		}
+
+		var result *commands.TapeResult
+		if *keys.passphraseFile != "" {
+			result, err = commands.ListWithPassphrase(env.Fs, *archive, *keystore, *keys.pubkey, *keys.passphraseFile, opts, format, env.Stdout)
+		} else {
+			result, err = commands.ListContentsWithOptions(env.Fs, *archive, *keystore, *keys.pubkey, *keys.privkey, opts, format, env.Stdout)
+		}
+		reportSigners(env, result, opts)
+		return err
+	}
+}
+
+func verifyTape(flags *flag.FlagSet) runner {
+	archive, keystore := tapeFlags(flags, "The sign-only tape to verify (required)")
+	pubkey := flags.String("pubkey", "", "The name of the sender's public key, found from the label if omitted")
+	privkey := flags.String("privkey", "", "The name of your private key to sign the receipt with")
+	receipt := flags.String("receipt", "", "The receipt to write after verifying the tape")
+	output := outputFlag(flags)
+
+	return func(env Env) error {
+		if *archive == "" {
+			return usageError("When verifying you must specify an archive")
+		}
+		if *receipt != "" && *privkey == "" {
+			return usageError("When writing a receipt you must specify the private key to sign it with")
+		}
+		format, err := output()
+		if err != nil {
+			return err
+		}
+
+		if *receipt != "" {
+			_, err = commands.VerifyTapeWithReceipt(env.Fs, *archive, *keystore, *pubkey, *privkey, *receipt, format, env.Stdout)
+		} else {
+			_, err = commands.VerifyTape(env.Fs, *archive, *keystore, *pubkey, format, env.Stdout)
+		}
+		return err
+	}
+}
+
+func inspectTape(flags *flag.FlagSet) runner {
+	archive, keystore := tapeFlags(flags, "The tape or label to inspect (required)")
+	output := outputFlag(flags)
+
+	return func(env Env) error {
+		if *archive == "" {
+			return usageError("When inspecting you must specify an archive or label")
+		}
+		format, err := output()
+		if err != nil {
+			return err
+		}
+		_, err = commands.InspectTape(env.Fs, *archive, *keystore, format, env.Stdout)
+		return err
+	}
+}
+
+func relabelTape(flags *flag.FlagSet) runner {
+	archive, keystore := tapeFlags(flags, "The tape or label to relabel (required)")
+	recipient := flags.String("recipient", "", "The name of the new recipient's public key (required)")
+	privkey := flags.String("privkey", "", "The name of your private key, found from the label if omitted")
+	pubkey := flags.String("pubkey", "", "The name of the sender's public key, found from the label if omitted")
+	output := flags.String("output", "", "The file to write the relabeled tape to, the tape is changed in place if omitted")
+
+	return func(env Env) error {
+		switch {
+		case *archive == "":
+			return usageError("When relabeling you must specify an archive or label")
+		case *recipient == "":
+			return usageError("When relabeling you must specify the new recipient's key")
+		case (*privkey == "") != (*pubkey == ""):
+			return usageError("When relabeling with key names you must specify both a private and a public key")
+		}
+		return commands.RelabelTape(env.Fs, *archive, *output, *keystore, *privkey, *pubkey, *recipient)
+	}
+}
+
+func cosignTape(flags *flag.FlagSet) runner {
+	archive, keystore := tapeFlags(flags, "The tape or label to co-sign (required)")
+	privkey := flags.String("privkey", "", "The name of the approver's private key (required)")
+	output := flags.String("output", "", "The file to write the co-signed tape to, the tape is changed in place if omitted")
+
+	return func(env Env) error {
+		switch {
+		case *archive == "":
+			return usageError("When co-signing you must specify an archive or label")
+		case *privkey == "":
+			return usageError("When co-signing you must specify the approver's private key")
+		}
+		return commands.CoSignTape(env.Fs, *archive, *output, *keystore, *privkey)
+	}
+}
+
+func shareTape(flags *flag.FlagSet) runner {
+	archive, keystore := tapeFlags(flags, "The tape or label packed for custodians (required)")
+	privkey := flags.String("privkey", "", "The name of the custodian's private key, found from the label if omitted")
+	output := flags.String("output", "", "The file to write the share to (required)")
+
+	return func(env Env) error {
+		switch {
+		case *archive == "":
+			return usageError("When creating a share you must specify an archive or label")
+		case *output == "":
+			return usageError("When creating a share you must specify the output file for the share")
+		}
+		return commands.CreateShare(env.Fs, *archive, *keystore, *privkey, *output)
+	}
+}
+
+func combineShares(flags *flag.FlagSet) runner {
+	archive, keystore := tapeFlags(flags, "The tape packed for custodians (required)")
+	pubkey := flags.String("pubkey", "", "The name of the sender's public key (required)")
+	shares := flags.String("shares", "", "The comma separated share files to combine (required)")
+
+	return func(env Env) error {
+		switch {
+		case *archive == "":
+			return usageError("When combining shares you must specify an archive")
+		case *pubkey == "":
+			return usageError("When combining shares you must specify the sender's public key")
+		case *shares == "":
+			return usageError("When combining shares you must specify the share files")
+		}
+		_, err := commands.CombineShares(env.Fs, *archive, *keystore, *pubkey, splitList(*shares))
+		return err
+	}
+}
+
+func checkSender(flags *flag.FlagSet) runner {
+	archive, keystore := tapeFlags(flags, "The tape to check (required)")
+	pubkey := flags.String("pubkey", "", "The name of the sender's public key, found from the trailer if omitted")
+
+	return func(env Env) error {
+		if *archive == "" {
+			return usageError("When checking the sender you must specify an archive")
+		}
+		return commands.CheckSender(env.Fs, *archive, *keystore, *pubkey, env.Stdout)
+	}
+}
+
+func checkReceipt(flags *flag.FlagSet) runner {
+	archive, keystore := tapeFlags(flags, "The comma separated tapes sent (required)")
+	receipt := flags.String("receipt", "", "The receipt to check (required)")
+	pubkey := flags.String("pubkey", "", "The name of the recipient's public key, found from the receipt if omitted")
+
+	return func(env Env) error {
+		switch {
+		case *archive == "":
+			return usageError("When checking a receipt you must specify the archives sent")
+		case *receipt == "":
+			return usageError("When checking a receipt you must specify the receipt")
+		}
+		return commands.CheckReceipt(env.Fs, *receipt, *keystore, *pubkey, splitList(*archive), env.Stdout)
+	}
+}
+
+func checkEscrow(flags *flag.FlagSet) runner {
+	archive, keystore := tapeFlags(flags, "The tape or label to check (required)")
+
+	return func(env Env) error {
+		if *archive == "" {
+			return usageError("When checking escrow you must specify an archive or label")
+		}
+		return commands.CheckEscrow(env.Fs, *archive, *keystore, env.Stdout)
+	}
+}
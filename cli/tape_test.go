@@ -0,0 +1,128 @@
+package cli
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+	"github.com/darcinc/repository/commands"
+)
+
+func TestValidatePack(t *testing.T) {
+	pack := []string{"tape", "pack", "-archive", "myarchive", "-keystore", "keystore", "-pubkey", "pubkey", "-privkey", "privkey"}
+	with := func(args ...string) []string {
+		return append(append([]string{}, pack...), args...)
+	}
+
+	valid(t, "Pack files", with("-files", "foo,bar")...)
+	valid(t, "Pack a directory", with("-dir", "foo")...)
+	usage(t, "Pack without an archive", "tape", "pack", "-files", "foo,bar", "-pubkey", "pubkey", "-privkey", "privkey")
+	usage(t, "Pack without files or directory", pack...)
+	usage(t, "Pack without a public key", "tape", "pack", "-archive", "myarchive", "-files", "a", "-privkey", "privkey")
+	usage(t, "Pack without a private key", "tape", "pack", "-archive", "myarchive", "-files", "a", "-pubkey", "pubkey")
+
+	valid(t, "Pack for custodians", "tape", "pack", "-archive", "myarchive", "-files", "a,b", "-privkey", "privkey", "-custodians", "alice,bob,carol", "-threshold", "2")
+	usage(t, "Threshold above the custodians", "tape", "pack", "-archive", "myarchive", "-files", "a,b", "-privkey", "privkey", "-custodians", "alice,bob,carol", "-threshold", "4")
+	valid(t, "Pack with a passphrase", "tape", "pack", "-archive", "myarchive", "-files", "a,b", "-passphrase-file", "passphrase")
+	valid(t, "Pack sign-only", "tape", "pack", "-archive", "myarchive", "-files", "a,b", "-privkey", "privkey", "-sign-only")
+
+	usage(t, "Stream without a state file", with("-files", "a,b", "-stream", "nightly")...)
+	valid(t, "Pack in a stream", with("-files", "a,b", "-stream", "nightly", "-state", "sender.state")...)
+	valid(t, "Pack with a hash and compression", with("-files", "a,b", "-hash", "sha384", "-compression", "gzip", "-recipients", "auditor,backup")...)
+	usage(t, "Unsupported hash", with("-files", "a,b", "-hash", "md5")...)
+	usage(t, "Unsupported compression", with("-files", "a,b", "-compression", "zip")...)
+	valid(t, "Pack with metadata", with("-files", "a,b", "-meta", "job=nightly", "-meta", "ticket=OPS-12", "-expires", "720h")...)
+	usage(t, "Metadata without a value", with("-files", "a,b", "-meta", "nightly")...)
+	usage(t, "Invalid expiry", with("-files", "a,b", "-expires", "soon")...)
+}
+
+func TestValidateOpen(t *testing.T) {
+	for _, command := range []string{"unpack", "list"} {
+		valid(t, command, "tape", command, "-archive", "myarchive", "-pubkey", "pubkey", "-privkey", "privkey")
+		valid(t, command+" with the keys in the label", "tape", command, "-archive", "myarchive")
+		usage(t, command+" without an archive", "tape", command, "-pubkey", "pubkey", "-privkey", "privkey")
+		usage(t, command+" without a private key", "tape", command, "-archive", "myarchive", "-pubkey", "pubkey")
+		usage(t, command+" without a public key", "tape", command, "-archive", "myarchive", "-privkey", "privkey")
+
+		valid(t, command+" with a passphrase", "tape", command, "-archive", "myarchive", "-pubkey", "sender", "-passphrase-file", "passphrase")
+		usage(t, command+" with a passphrase and a key", "tape", command, "-archive", "myarchive", "-pubkey", "sender", "-privkey", "mine", "-passphrase-file", "passphrase")
+		usage(t, command+" ignoring the window with a passphrase", "tape", command, "-archive", "myarchive", "-passphrase-file", "passphrase", "-ignore-window")
+
+		usage(t, command+" with more signers required than named", "tape", command, "-archive", "myarchive", "-signers", "alice,bob", "-min-signers", "3")
+		valid(t, command+" with required signers", "tape", command, "-archive", "myarchive", "-signers", "alice,bob", "-min-signers", "2")
+		usage(t, command+" with signers and a passphrase", "tape", command, "-archive", "myarchive", "-signers", "alice", "-passphrase-file", "passphrase")
+	}
+	valid(t, "Unpack outside the window", "tape", "unpack", "-archive", "myarchive", "-ignore-window")
+	valid(t, "Unpack with a receipt", "tape", "unpack", "-archive", "myarchive", "-receipt", "myarchive.receipt")
+	usage(t, "List with a receipt", "tape", "list", "-archive", "myarchive", "-receipt", "myarchive.receipt")
+
+	valid(t, "Intake", "tape", "intake", "-archive", "myarchive", "-state", "sender.state")
+	usage(t, "Intake without a state file", "tape", "intake", "-archive", "myarchive")
+	usage(t, "Intake without an archive", "tape", "intake", "-state", "sender.state")
+	usage(t, "Intake with only a private key", "tape", "intake", "-archive", "myarchive", "-state", "sender.state", "-privkey", "mine")
+}
+
+func TestValidateTapeCommands(t *testing.T) {
+	valid(t, "Relabel", "tape", "relabel", "-archive", "myarchive", "-pubkey", "pubkey", "-privkey", "privkey", "-recipient", "auditor")
+	valid(t, "Relabel with the keys in the label", "tape", "relabel", "-archive", "myarchive", "-recipient", "auditor")
+	usage(t, "Relabel without a recipient", "tape", "relabel", "-archive", "myarchive")
+	usage(t, "Relabel with only a private key", "tape", "relabel", "-archive", "myarchive", "-privkey", "privkey", "-recipient", "auditor")
+
+	valid(t, "Share", "tape", "share", "-archive", "myarchive", "-output", "alice.share")
+	usage(t, "Share without an output file", "tape", "share", "-archive", "myarchive")
+	valid(t, "Combine", "tape", "combine", "-archive", "myarchive", "-pubkey", "sender", "-shares", "alice.share,bob.share")
+	usage(t, "Combine without shares", "tape", "combine", "-archive", "myarchive", "-pubkey", "sender")
+	usage(t, "Combine without a public key", "tape", "combine", "-archive", "myarchive", "-shares", "alice.share")
+
+	valid(t, "Co-sign", "tape", "cosign", "-archive", "myarchive", "-privkey", "approver")
+	usage(t, "Co-sign without a private key", "tape", "cosign", "-archive", "myarchive")
+
+	valid(t, "Verify", "tape", "verify", "-archive", "myarchive")
+	for _, command := range []string{"list", "verify", "inspect"} {
+		valid(t, command+" as JSON", "tape", command, "-archive", "myarchive", "-output", "json")
+		usage(t, command+" in an unknown format", "tape", command, "-archive", "myarchive", "-output", "yaml")
+	}
+	usage(t, "Verify without an archive", "tape", "verify")
+	usage(t, "Receipt without a private key", "tape", "verify", "-archive", "myarchive", "-receipt", "myarchive.receipt")
+
+	valid(t, "Check receipt", "tape", "check-receipt", "-archive", "monday.tape,tuesday.tape", "-receipt", "tuesday.receipt")
+	usage(t, "Check receipt without a receipt", "tape", "check-receipt", "-archive", "monday.tape")
+
+	for _, command := range []string{"inspect", "check-sender", "check-escrow"} {
+		valid(t, command, "tape", command, "-archive", "myarchive")
+		usage(t, command+" without an archive", "tape", command)
+	}
+}
+
+func TestTapeCommands(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	for _, name := range []string{"sender", "receiver"} {
+		if code, _, errors := run(fs, "keys", "create", "-name", name, "-keystore", "foo", "-bits", "2048"); code != commands.ExitOK {
+			t.Fatalf("Unable to create key %s: %s", name, errors)
+		}
+	}
+	data := filepath.Join(repository.HomeDir(), "data")
+	afero.WriteFile(fs, filepath.Join(data, "report.txt"), []byte("quarterly report"), 0644)
+	archive := filepath.Join(filepath.Dir(repository.HomeDir()), "report.tape")
+
+	if code, _, errors := run(fs, "tape", "pack", "-archive", archive, "-dir", data, "-keystore", "foo", "-privkey", "sender", "-pubkey", "receiver"); code != commands.ExitOK {
+		t.Fatalf("Unable to pack a tape: %s", errors)
+	}
+	if code, out, errors := run(fs, "tape", "list", "-archive", archive, "-keystore", "foo"); code != commands.ExitOK || !strings.Contains(out, "report.txt") {
+		t.Errorf("Expected report.txt on the tape but got %d %s %s", code, out, errors)
+	}
+	if code, out, _ := run(fs, "tape", "inspect", "-archive", archive, "-keystore", "foo"); code != commands.ExitOK || !strings.Contains(out, "receiver") {
+		t.Errorf("Expected the recipient in the description but got %d %s", code, out)
+	}
+	if code, out, _ := run(fs, "tape", "list", "-archive", archive, "-keystore", "foo", "-output", "ndjson"); code != commands.ExitOK || !strings.Contains(out, `report.txt","type":"file","size":16`) {
+		t.Errorf("Expected a record for report.txt but got %d %s", code, out)
+	}
+	if code, out, _ := run(fs, "tape", "inspect", "-archive", archive, "-keystore", "foo", "-output", "json"); code != commands.ExitOK || !strings.Contains(out, `"name": "receiver"`) {
+		t.Errorf("Expected the recipient in the record but got %d %s", code, out)
+	}
+	if code, _, _ := run(fs, "tape", "list", "-archive", archive, "-keystore", "foo", "-privkey", "sender", "-pubkey", "sender"); code != commands.ExitKeyMismatch {
+		t.Errorf("Expected the wrong key to be refused but got exit code %d", code)
+	}
+}
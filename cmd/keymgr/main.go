@@ -1,83 +1,70 @@
+// Command keymgr runs the repository tool's keys commands with the flags of
+// the original keymgr tool, where -action names the command.  It is kept for
+// existing scripts, see the repository command.
 package main
 
 import (
 	"flag"
-	"fmt"
 	"log"
+	"os"
+	"time"
 
 	"github.com/darcinc/afero"
+	"github.com/darcinc/repository/cli"
 	"github.com/darcinc/repository/commands"
 )
 
-func about() {
-	flag.Usage()
+// renamed maps keymgr's flags to the flags of the repository keys commands.
+var renamed = map[string]string{
+	"keyName":  "name",
+	"keyFile":  "keystore",
+	"pemFile":  "file",
+	"passFile": "passphrase-file",
 }
 
-func validateArguments(action, keyname, keyfile, pemfile string, cipherStrength int) bool {
-	switch {
-	case action == "about":
-		about()
-	case action == "import":
-		if keyname == "" {
-			fmt.Println("A key name for the imported key is required when importing a key.")
-			return false
-		}
-		if pemfile == "" {
-			fmt.Println("The pem file to import is required when importing a key.")
-			return false
-		}
+// newFlags returns keymgr's flags.
+func newFlags() *flag.FlagSet {
+	flags := flag.NewFlagSet("keymgr", flag.ExitOnError)
+	flags.String("action", "about", "What to do (create, list, export, import, delete, doctor, policy, prekey, prune, escrow)")
+	flags.String("keyName", "", "The name of the key (required for create or import key), or the comma separated escrow keys")
+	flags.String("keyFile", "keys", "The name of the keystore, can be the name or an absolute path")
+	flags.String("pemFile", "", "The key file to import or export, or the file to publish a prekey in")
+	flags.String("format", "", "The key format (pem, pkcs8, openssh, jwk, pkcs12), detected on import if omitted")
+	flags.String("passFile", "", "A file containing the passphrase for encrypted pkcs8, openssh or pkcs12 keys")
+	flags.String("policy", "", "A JSON key policy to store in the keystore (policy) or check keys against (doctor)")
+	flags.String("type", "rsa", "The type of key to create (rsa or mlkem768-x25519)")
+	flags.Int("bits", 4096, "The number of bits for the RSA key")
+	flags.Duration("lifetime", 30*24*time.Hour, "How long a new prekey can be used before it expires")
+	return flags
+}
 
-	case action == "export":
-		if keyname == "" {
-			fmt.Println("The name of the key to export is required.")
-			return false
-		}
-	case action == "create":
-		if keyname == "" {
-			fmt.Println("The name of the key is required when creating a new key")
-			return false
-		}
-		if !(cipherStrength == 1024 || cipherStrength == 2048 || cipherStrength == 4096 || cipherStrength == 8192) {
-			fmt.Println("Valid bits for cipher strength are 1024 (not recommended), 2048, 4096, or 8192")
-			return false
-		}
+// commandArguments returns the arguments of the repository keys command
+// that runs the action given to keymgr.
+func commandArguments(flags *flag.FlagSet) ([]string, error) {
+	action := flags.Lookup("action").Value.String()
+	args, ignored, err := cli.LegacyArgs(flags, []string{"keys", action}, renamed)
+	if err != nil {
+		return nil, err
 	}
-
-	return true
+	for _, name := range ignored {
+		log.Printf("Ignoring -%s, which %s does not use", name, action)
+	}
+	return args, nil
 }
 
 func main() {
-	var (
-		action, keyName  string
-		keyfile, pemfile string
-		cipherStrength   int
-	)
-	flag.StringVar(&action, "action", "about", "What to do (create, list, export, import)")
-	flag.StringVar(&keyName, "keyName", "", "The name of the key (required for create or import key)")
-	flag.StringVar(&keyfile, "keyFile", "keys", "The name of the keystore, can be the name or an absolute path")
-	flag.StringVar(&pemfile, "pemFile", "", "The pem encoded key file to import")
-	flag.IntVar(&cipherStrength, "bits", 4096, "The number of bits for the RSA key")
-
-	flag.Parse()
-
-	if !validateArguments(action, keyName, keyfile, pemfile, cipherStrength) {
-		log.Printf("Unable to continue, invalid or missing arguments")
-		about()
+	flags := newFlags()
+	flags.Parse(os.Args[1:])
+	if flags.Lookup("action").Value.String() == "about" {
+		flags.Usage()
 		return
 	}
 
-	fs := afero.NewOsFs()
-
-	switch action {
-	case "create":
-		commands.CreateKeys(fs, keyName, keyfile, cipherStrength)
-	case "list":
-		commands.ListKeys(fs, keyfile)
-	case "import":
-		commands.ImportKey(fs, keyfile, keyName, pemfile)
-	case "export":
-		commands.ExtractKeys(fs, keyfile, keyName, pemfile)
-	case "about":
-		about()
+	args, err := commandArguments(flags)
+	if err != nil {
+		log.Printf("Unable to continue: %v", err)
+		flags.Usage()
+		os.Exit(commands.ExitCode(err))
 	}
+	os.Exit(cli.Run(args, cli.Env{Fs: afero.NewOsFs(), Stdout: os.Stdout, Stderr: os.Stderr}))
 }
@@ -1,65 +1,38 @@
 package main
 
-import "testing"
+import (
+	"reflect"
+	"testing"
 
-func TestValidateAbout(t *testing.T) {
-	if !validateArguments("about", "", "", "", 0) {
-		t.Error("Failed to return true for about validation")
-	}
-}
-
-func TestValidateCreate(t *testing.T) {
-	if !validateArguments("create", "mykey", "foo", "", 2048) {
-		t.Error("Failed to return true for valid create validation")
-	}
-
-	if validateArguments("create", "", "foo", "", 2048) {
-		t.Error("Returned true when validating create without keyname")
-	}
-}
-
-func TestValidateImport(t *testing.T) {
-	if !validateArguments("import", "mykey", "foo", "import.pem", 0) {
-		t.Error("Returned false with valid import validate")
-	}
+	"github.com/darcinc/repository/commands"
+)
 
-	if validateArguments("import", "", "foo", "import.pem", 0) {
-		t.Error("Returned true with invalid import validate")
-	}
+func TestCommandArguments(t *testing.T) {
+	flags := newFlags()
+	flags.Parse([]string{"-action", "import", "-keyName", "mykey", "-keyFile", "foo", "-pemFile", "import.pem", "-passFile", "pass", "-bits", "2048"})
 
-	if validateArguments("import", "mykey", "foo", "", 0) {
-		t.Error("Returned true with invalid import validate")
+	args, err := commandArguments(flags)
+	if err != nil {
+		t.Fatalf("Unable to translate the arguments: %v", err)
 	}
-}
-
-func TestValidateExport(t *testing.T) {
-	if !validateArguments("export", "mykey", "foo", "export.pem", 0) {
-		t.Error("Returned false with valid export validate")
-	}
-
-	if validateArguments("export", "", "foo", "export.pem", 0) {
-		t.Error("Returned true with invalid export validate")
+	expected := []string{"keys", "import", "-keystore=foo", "-name=mykey", "-passphrase-file=pass", "-file=import.pem"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v but got %v", expected, args)
 	}
 }
 
-func TestValidateList(t *testing.T) {
-	if !validateArguments("list", "", "", "", 0) {
-		t.Error("Returned false with valid list validate")
-	}
-}
-
-func TestValidCipherStrength(t *testing.T) {
-	validStrengths := []int{1024, 2048, 4096, 8192}
-	for _, v := range validStrengths {
-		if !validateArguments("create", "mykey", "", "", v) {
-			t.Errorf("Failed to validate valid cipher strength of %d", v)
+func TestActions(t *testing.T) {
+	for _, action := range []string{"create", "list", "export", "import", "delete", "doctor", "policy", "prekey", "prune", "escrow"} {
+		flags := newFlags()
+		flags.Parse([]string{"-action", action, "-keyName", "mykey"})
+		if args, err := commandArguments(flags); err != nil || args[1] != action {
+			t.Errorf("Action %s not run as a keys command: %v %v", action, args, err)
 		}
 	}
 
-	invalidStrengths := []int{-100, 0, 9000000000}
-	for _, v := range invalidStrengths {
-		if validateArguments("create", "mykey", "", "", v) {
-			t.Errorf("Validated invalid key strength")
-		}
+	flags := newFlags()
+	flags.Parse([]string{"-action", "remove", "-keyName", "mykey"})
+	if _, err := commandArguments(flags); commands.ExitCode(err) != commands.ExitUsage {
+		t.Errorf("Expected a usage error for an unknown action but got %v", err)
 	}
 }
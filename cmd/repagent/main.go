@@ -0,0 +1,92 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+	"github.com/darcinc/repository/agent"
+)
+
+func defaultSocket() string {
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" {
+		return filepath.Join(dir, "repository-agent.sock")
+	}
+	return filepath.Join(repository.KeystoreDefaultDirectory(), "agent.sock")
+}
+
+func readConfig(fs afero.Fs, configFile string, lifetime time.Duration) (agent.Config, error) {
+	config := agent.Config{}
+	if configFile != "" {
+		file, err := fs.Open(configFile)
+		if err != nil {
+			return config, err
+		}
+		defer file.Close()
+
+		if config, err = agent.ReadConfig(file); err != nil {
+			return config, err
+		}
+	}
+
+	if lifetime > 0 {
+		config.Lifetime = agent.Duration(lifetime)
+	}
+	return config, nil
+}
+
+func main() {
+	var (
+		keystore, socket, configFile string
+		lifetime                     time.Duration
+	)
+	flag.StringVar(&keystore, "keystore", "keys", "The name of the keystore whose keys are unlocked")
+	flag.StringVar(&socket, "socket", defaultSocket(), "The path of the agent's Unix socket")
+	flag.StringVar(&configFile, "config", "", "A JSON file with the client allowlist and key lifetimes")
+	flag.DurationVar(&lifetime, "lifetime", 0, "How long keys stay unlocked (e.g. 8h), overriding the config file")
+	flag.Parse()
+
+	fs := afero.NewOsFs()
+	config, err := readConfig(fs, configFile, lifetime)
+	if err != nil {
+		log.Fatalf("Failed to read agent config: %v", err)
+	}
+
+	file, err := fs.Open(repository.KeystorePath(keystore))
+	if err != nil {
+		log.Fatalf("Failed to open keystore: %v", err)
+	}
+	keys, err := repository.OpenKeystore(file)
+	file.Close()
+	if err != nil {
+		log.Fatalf("Failed to read keystore: %v", err)
+	}
+
+	keyAgent, err := agent.New(keys, config)
+	if err != nil {
+		log.Fatalf("Failed to unlock keys: %v", err)
+	}
+
+	listener, err := agent.Listen(socket, config)
+	if err != nil {
+		log.Fatalf("Failed to listen on %s: %v", socket, err)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-signals
+		listener.Close()
+	}()
+
+	fmt.Printf("%s=%s; export %s\n", agent.SocketEnv, socket, agent.SocketEnv)
+	keyAgent.Serve(listener)
+	os.Remove(socket)
+}
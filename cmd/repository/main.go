@@ -0,0 +1,12 @@
+package main
+
+import (
+	"os"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository/cli"
+)
+
+func main() {
+	os.Exit(cli.Run(os.Args[1:], cli.Env{Fs: afero.NewOsFs(), Stdout: os.Stdout, Stderr: os.Stderr}))
+}
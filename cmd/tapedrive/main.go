@@ -1,3 +1,6 @@
+// Command tapedrive runs the repository tool's tape commands with the flags
+// of the original tapedrive tool, where -action names the command.  It is
+// kept for existing scripts, see the repository command.
 package main
 
 import (
@@ -7,146 +10,93 @@ import (
 	"strings"
 
 	"github.com/darcinc/afero"
+	"github.com/darcinc/repository/cli"
 	"github.com/darcinc/repository/commands"
 )
 
-var (
-	action, archive string
-	files, keystore string
-	privkey, pubkey string
-	directory       string
-)
-
-func about() {
-	flag.Usage()
-}
-
-type arguments map[string]string
-
-func packArguments() arguments {
-	result := make(arguments)
-
-	vals := []string{action, archive, files, keystore, privkey, pubkey, directory}
-	keys := []string{"action", "archive", "files", "keystore", "privkey", "pubkey", "directory"}
-
-	for i := range vals {
-		result[keys[i]] = vals[i]
-	}
-
-	return result
-}
-
-func (a arguments) Action() string {
-	return a["action"]
-}
+// metaFlags collects each -meta key=value.
+type metaFlags []string
 
-func (a arguments) Archive() string {
-	return a["archive"]
+func (m *metaFlags) String() string {
+	return strings.Join(*m, ",")
 }
 
-func (a arguments) Files() string {
-	return a["files"]
+func (m *metaFlags) Set(value string) error {
+	*m = append(*m, value)
+	return nil
 }
 
-func (a arguments) FilesList() []string {
-	return strings.Split(a["files"], ",")
+func (m *metaFlags) Get() interface{} {
+	return []string(*m)
 }
 
-func (a arguments) Keystore() string {
-	return a["keystore"]
+// newFlags returns tapedrive's flags.
+func newFlags() *flag.FlagSet {
+	flags := flag.NewFlagSet("tapedrive", flag.ExitOnError)
+	flags.String("action", "about", "What to do (pack, unpack, intake, list, relabel, cosign, share, combine, check-escrow, verify, check-sender, check-receipt, inspect)")
+	flags.String("archive", "", "The name of the archive (required for pack, unpack, and list), or the comma separated tapes sent for check-receipt")
+	flags.String("files", "", "The comma separated list of files to pack (required for pack)")
+	flags.String("privkey", "", "The name of the private key to use (required for pack, found from the label for unpack and list if omitted)")
+	flags.String("pubkey", "", "The name of the public key to use (required for pack, found from the label for unpack and list if omitted)")
+	flags.String("keystore", "keys", "The keystore containing the keys, or pemdir:<directory> or a pkcs11: URI")
+	flags.String("dir", "", "The optional directory containing the files to pack")
+	flags.String("recipient", "", "The name of the new recipient's public key (required for relabel)")
+	flags.String("prekey", "", "A prekey published by the recipient, packs a forward-secret tape")
+	flags.String("output", "", "The file to write a share, relabeled or co-signed tape to, the archive is changed in place if omitted")
+	flags.String("custodians", "", "The comma separated custodian key names to split the tape key among when packing")
+	flags.Int("threshold", 0, "The number of custodians needed to open a tape packed with -custodians")
+	flags.String("passphrase-file", "", "A file whose first line is the passphrase protecting the tape, instead of the recipient's key")
+	flags.Bool("sign-only", false, "Pack a tape that is signed but not encrypted, verified with only the sender's public key")
+	flags.String("shares", "", "The comma separated share files to combine")
+	flags.String("signers", "", "The comma separated keys that must have signed or co-signed a tape to unpack or list it")
+	flags.Int("min-signers", 0, "How many of -signers must have signed the tape, all of them if omitted")
+	flags.String("expires", "", "When a packed tape expires, as an RFC 3339 time or a duration from now such as 720h")
+	flags.String("not-before", "", "When a packed tape may first be opened, as an RFC 3339 time or a duration from now")
+	flags.String("stream", "", "The stream to number and chain a packed tape in, kept in the -state file")
+	flags.String("state", "", "The file keeping the last tape of each stream sent (pack) or received (intake, unpack, list)")
+	flags.Bool("accept-gaps", false, "Take in a tape even though earlier tapes in its stream are missing")
+	flags.String("description", "", "A description of a packed tape, recorded in its metadata")
+	flags.Var(&metaFlags{}, "meta", "A key=value recorded in a packed tape's metadata, may be repeated")
+	flags.String("compression", "", "How to compress a packed tape: none (the default) or gzip")
+	flags.String("recipients", "", "The comma separated names of further public keys to pack a tape for")
+	flags.String("hash", "", "The hash algorithm to sign a packed tape with: sha256 (the default), sha384, sha512 or blake2b-512")
+	flags.String("receipt", "", "The receipt to write after unpacking or verifying a tape, or to check with check-receipt")
+	flags.Bool("ignore-window", false, "Unpack or list a tape outside its validity window, which is recorded in the audit log")
+	return flags
 }
 
-func (a arguments) PrivKey() string {
-	return a["privkey"]
-}
-
-func (a arguments) PubKey() string {
-	return a["pubkey"]
-}
-
-func (a arguments) Directory() string {
-	return a["directory"]
-}
-
-// ValidateArguments checks to see that all arguments are correct.
-func validateArguments() bool {
-	args := packArguments()
-
-	result := true
-	switch action {
-	case "pack":
-		if args.Archive() == "" {
-			log.Printf("Packing an archive requires a path to an archive")
-			return false
-		}
-		if args.Files() == "" && args.Directory() == "" {
-			log.Printf("Packing an archive requires a list of files or a directory")
-			result = false
-		}
-		if args.PubKey() == "" {
-			log.Printf("Packing an archive requires a key name")
-			result = false
-		}
-		if args.PrivKey() == "" {
-			log.Printf("Packing an archive requries a private key name")
-			result = false
-		}
-	case "unpack":
-		if args.Archive() == "" {
-			log.Printf("When unpacking contents you must specify an archive")
-			result = false
-		}
-		if args.PrivKey() == "" {
-			log.Printf("When unpacking contents you must specify a key name")
-			result = false
-		}
-		if args.PubKey() == "" {
-			log.Printf("When unpacking contetns you must specify a public key")
-			result = false
-		}
-	case "list":
-		if args.Archive() == "" {
-			log.Printf("When listing contents you must specify an archive")
-			result = false
-		}
-		if args.PrivKey() == "" {
-			log.Printf("When listing contents you must specify a key name")
-			result = false
-		}
-		if args.PubKey() == "" {
-			log.Printf("When listing contetns you must specify a public key")
-			result = false
-		}
+// commandArguments returns the arguments of the repository tape command
+// that runs the action given to tapedrive.
+func commandArguments(flags *flag.FlagSet) ([]string, error) {
+	action := flags.Lookup("action").Value.String()
+	var renamed map[string]string
+	if action != "share" && action != "relabel" && action != "cosign" {
+		// -output names the file those actions write, not an output format.
+		renamed = map[string]string{"output": ""}
+	}
+	args, ignored, err := cli.LegacyArgs(flags, []string{"tape", action}, renamed)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range ignored {
+		log.Printf("Ignoring -%s, which %s does not use", name, action)
 	}
-	return result
+	return args, nil
 }
 
 func main() {
-	flag.StringVar(&action, "action", "about", "What to do (pack, unpack, list)")
-	flag.StringVar(&archive, "archive", "", "The name of the archive (required for pack, unpack, and list)")
-	flag.StringVar(&files, "files", "", "The comma separated list of files to pack (required for pack)")
-	flag.StringVar(&privkey, "privkey", "", "The name of the private key to use (rquired for pack, unpack, and list)")
-	flag.StringVar(&pubkey, "pubkey", "", "The name of the public key to use (required for pack, unpack, and list")
-	flag.StringVar(&keystore, "keystore", "keys", "The name of the keystore containing the keys")
-	flag.StringVar(&directory, "dir", "", "The optional directory containing the files to pack")
-	flag.Parse()
-
-	if !validateArguments() {
-		log.Printf("Unable to continue, invalid or missing arguments")
-		about()
+	flags := newFlags()
+	flags.Parse(os.Args[1:])
+	if flags.Lookup("action").Value.String() == "about" {
+		flags.Usage()
 		return
 	}
 
-	fs := afero.NewOsFs()
-
-	switch action {
-	case "pack":
-		commands.PackRepository(fs, packArguments())
-	case "unpack":
-		commands.UnpackRepository(fs, archive, keystore, privkey, pubkey)
-	case "list":
-		commands.ListContents(fs, archive, keystore, pubkey, privkey, os.Stdout)
-	case "about":
-		flag.Usage()
+	args, err := commandArguments(flags)
+	if err != nil {
+		log.Printf("Unable to continue: %v", err)
+		flags.Usage()
+		os.Exit(commands.ExitCode(err))
 	}
+	os.Exit(cli.Run(args, cli.Env{Fs: afero.NewOsFs(), Stdout: os.Stdout, Stderr: os.Stderr}))
 }
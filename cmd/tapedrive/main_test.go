@@ -1,152 +1,54 @@
 package main
 
-import "testing"
+import (
+	"reflect"
+	"testing"
 
-func TestPackArguments(t *testing.T) {
-	action = "pack"
-	archive = "myarchive"
-	files = "foo,bar"
-	keystore = "keystore"
-	pubkey = "pubkey"
-	privkey = "privkey"
-	directory = "directory"
+	"github.com/darcinc/repository/commands"
+)
 
-	args := packArguments()
-	if args.Action() != action {
-		t.Errorf("Expected %s but got %s", action, args.Action())
-	}
-
-	if args.Archive() != archive {
-		t.Errorf("Expected %s but got %s", archive, args.Archive())
-	}
-
-	if args.Files() != files {
-		t.Errorf("Expected %s but got %s", files, args.Files())
-	}
-
-	allfiles := args.FilesList()
-	if allfiles[0] != "foo" || allfiles[1] != "bar" {
-		t.Errorf("Got %s %s instead of foo bar", allfiles[0], allfiles[1])
-	}
-
-	if args.Keystore() != keystore {
-		t.Errorf("Expected %s but got %s", keystore, args.Keystore())
-	}
-
-	if args.PubKey() != pubkey {
-		t.Errorf("Expected %s but got %s", pubkey, args.PubKey())
-	}
-
-	if args.PrivKey() != privkey {
-		t.Errorf("Expected %s but got %s", privkey, args.PrivKey())
-	}
-
-	if args.Directory() != directory {
-		t.Errorf("Expected %s but got %s", directory, args.Directory())
-	}
-}
-
-func TestValidatePack(t *testing.T) {
-	action = "pack"
-	archive = "myarchive"
-	files = "foo,bar"
-	keystore = "keystore"
-	pubkey = "pubkey"
-	privkey = "privkey"
-	directory = ""
-
-	if !validateArguments() {
-		t.Error("Should have validated a valid call to pack an archive")
-	}
+func TestCommandArguments(t *testing.T) {
+	flags := newFlags()
+	flags.Parse([]string{"-action", "pack", "-archive", "myarchive", "-files", "foo,bar", "-privkey", "sender", "-pubkey", "receiver",
+		"-meta", "job=nightly", "-meta", "ticket=OPS-12", "-sign-only", "-recipient", "auditor"})
 
-	directory = "foo"
-	files = ""
-	if !validateArguments() {
-		t.Error("Should have validated a valid call to pack an archive")
+	args, err := commandArguments(flags)
+	if err != nil {
+		t.Fatalf("Unable to translate the arguments: %v", err)
 	}
-
-	files = "foo,bar"
-	archive = ""
-	if validateArguments() {
-		t.Error("Should not have validated a call to pack without an archive path")
-	}
-
-	archive = "myarchive"
-	files = ""
-	directory = ""
-	if validateArguments() {
-		t.Error("Should not have validated a call to pack without files or directory")
-	}
-
-	files = "foo,bar"
-	pubkey = ""
-	if validateArguments() {
-		t.Error("Should not have validated a call to pack without a public key")
-	}
-
-	pubkey = "pubkey"
-	privkey = ""
-	if validateArguments() {
-		t.Error("Should not have validated a call to pack without a private key")
+	expected := []string{"tape", "pack", "-archive=myarchive", "-files=foo,bar", "-meta=job=nightly", "-meta=ticket=OPS-12",
+		"-privkey=sender", "-pubkey=receiver", "-sign-only=true"}
+	if !reflect.DeepEqual(args, expected) {
+		t.Errorf("Expected %v but got %v", expected, args)
 	}
 }
 
-func TestValidateUnpack(t *testing.T) {
-	action = "unpack"
-	archive = "myarchive"
-	keystore = ""
-	files = ""
-	pubkey = "pubkey"
-	privkey = "privkey"
-
-	if !validateArguments() {
-		t.Error("Should have validated a valid call to unpack an archive")
-	}
-
-	archive = ""
-	if validateArguments() {
-		t.Error("Should not validate a call to unpack without an archive")
-	}
-
-	archive = "myarchive"
-	pubkey = ""
-	if validateArguments() {
-		t.Error("Should not validate a call to unpack without a public key")
-	}
-
-	pubkey = "pubkey"
-	privkey = ""
-	if validateArguments() {
-		t.Error("Should not validate a call to unpack without a private key")
+func TestOutputFile(t *testing.T) {
+	for action, expected := range map[string]bool{"share": true, "list": false, "inspect": false} {
+		flags := newFlags()
+		flags.Parse([]string{"-action", action, "-archive", "myarchive", "-output", "alice.share"})
+		args, err := commandArguments(flags)
+		if err != nil {
+			t.Fatalf("Unable to translate the arguments for %s: %v", action, err)
+		}
+		if passed := args[len(args)-1] == "-output=alice.share"; passed != expected {
+			t.Errorf("Expected -output passed to %s to be %v but got %v", action, expected, args)
+		}
 	}
 }
 
-func TestValidateList(t *testing.T) {
-	action = "list"
-	archive = "myarchive"
-	keystore = ""
-	files = ""
-	pubkey = "pubkey"
-	privkey = "privkey"
-
-	if !validateArguments() {
-		t.Error("Should have validated a valid call to list an archive")
-	}
-
-	archive = ""
-	if validateArguments() {
-		t.Error("Should not validate a call to list without an archive")
-	}
-
-	archive = "myarchive"
-	pubkey = ""
-	if validateArguments() {
-		t.Error("Should not validate a call to list without a public key")
+func TestActions(t *testing.T) {
+	for _, action := range []string{"pack", "unpack", "intake", "list", "relabel", "cosign", "share", "combine", "check-escrow", "verify", "check-sender", "check-receipt", "inspect"} {
+		flags := newFlags()
+		flags.Parse([]string{"-action", action, "-archive", "myarchive"})
+		if args, err := commandArguments(flags); err != nil || args[1] != action {
+			t.Errorf("Action %s not run as a tape command: %v %v", action, args, err)
+		}
 	}
 
-	pubkey = "pubkey"
-	privkey = ""
-	if validateArguments() {
-		t.Error("Should not validate a call to list without a private key")
+	flags := newFlags()
+	flags.Parse([]string{"-action", "unpak", "-archive", "myarchive"})
+	if _, err := commandArguments(flags); commands.ExitCode(err) != commands.ExitUsage {
+		t.Errorf("Expected a usage error for an unknown action but got %v", err)
 	}
 }
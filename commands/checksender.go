@@ -0,0 +1,50 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+// CheckSender checks the sender's signature over a whole tape, label and
+// encrypted payload, without a private key, and writes the sender to out.
+// The sender is the named public key or, if no name is given, the key in the
+// keystore that signed the tape.  Returns an error if the tape is not signed
+// by the sender or by a known key, or if the keystore's policy does not
+// allow the tape's hash algorithm.
+func CheckSender(fs afero.Fs, archive, keystoreName, pubKeyName string, out io.Writer) error {
+	provider, err := openKeyProvider(fs, keystoreName)
+	if err != nil {
+		return err
+	}
+	defer repository.CloseKeyProvider(provider)
+
+	file, err := fs.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if pubKeyName == "" {
+		signer, err := repository.TapeSigner(file)
+		if err != nil {
+			return err
+		}
+		if pubKeyName, err = repository.FindKeyName(provider, signer, false); err != nil {
+			return &repository.NoSuchKeyError{Kind: "Tape signing key", Name: signer}
+		}
+	}
+
+	publicKey, err := provider.PublicKey(pubKeyName)
+	if err != nil {
+		return err
+	}
+	if err = repository.CheckSenderWithPolicy(file, publicKey, repository.ProviderPolicy(provider)); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%s is signed by %s (%s)\n", archive, pubKeyName, repository.Fingerprint(publicKey))
+	return nil
+}
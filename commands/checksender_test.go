@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+func TestCheckSender(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+	packTestRepository(fs)
+
+	archive := filepath.Join(repository.HomeDir(), "archive1")
+	out := new(bytes.Buffer)
+	if err := CheckSender(fs, archive, "foo", "", out); err != nil {
+		t.Fatalf("Unable to check the sender: %v", err)
+	}
+	if !regexp.MustCompile("signed by test3").Match(out.Bytes()) {
+		t.Errorf("Sender not reported: %s", out.String())
+	}
+
+	if err := CheckSender(fs, archive, "foo", "test1", out); err == nil {
+		t.Error("Should not check the sender with the wrong key")
+	}
+}
+
+func TestCheckSenderHashPolicy(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+	packTestRepository(fs)
+
+	policyFile := filepath.Join(repository.HomeDir(), "policy.json")
+	afero.WriteFile(fs, policyFile, []byte(`{"hashes": ["sha512"]}`), 0600)
+	if err := SetPolicy(fs, "foo", policyFile); err != nil {
+		t.Fatalf("Unable to set the policy: %v", err)
+	}
+
+	archive := filepath.Join(repository.HomeDir(), "archive1")
+	if err := CheckSender(fs, archive, "foo", "test3", new(bytes.Buffer)); ExitCode(err) != ExitPolicy {
+		t.Errorf("Expected the keystore policy to refuse a SHA-256 tape but got %v", err)
+	}
+}
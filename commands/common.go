@@ -1,36 +1,237 @@
 package commands
 
 import (
+	"bytes"
 	"crypto/rsa"
-	"errors"
+	"fmt"
+	"io"
+	"os"
 
 	"github.com/darcinc/afero"
 	"github.com/darcinc/repository"
+	"github.com/darcinc/repository/agent"
 )
 
-func readKeysFromKeystore(fs afero.Fs, keystoreName, privKeyName, pubKeyName string) (*rsa.PrivateKey, *rsa.PublicKey, error) {
-	keystorePath := repository.KeystorePath(keystoreName)
+// openKeyProvider returns the key agent when its socket is named in the
+// environment, otherwise the key provider at the keystore location (see
+// repository.OpenKeyProvider).
+func openKeyProvider(fs afero.Fs, keystoreName string) (repository.KeyProvider, error) {
+	if socket := os.Getenv(agent.SocketEnv); socket != "" {
+		return agent.Dial(socket)
+	}
+
+	return repository.OpenKeyProvider(fs, keystoreName)
+}
 
-	file, err := fs.Open(keystorePath)
+// readKeysFromKeystore finds the named keys with the key provider.  The key
+// carries the provider's policy and escrow keys.  An empty public key name
+// leaves the public key unset.  Either name may be a hybrid key: a hybrid
+// public key becomes the key's HybridKey and a hybrid private key is found
+// through the key's HybridKeys.  The returned function releases the provider
+// once the keys are no longer needed.
+func readKeysFromKeystore(fs afero.Fs, keystoreName, privKeyName, pubKeyName string) (repository.Key, func(), error) {
+	provider, err := openKeyProvider(fs, keystoreName)
 	if err != nil {
-		return nil, nil, err
+		return repository.Key{}, nil, err
+	}
+	done := func() { repository.CloseKeyProvider(provider) }
+
+	key := repository.Key{Policy: repository.ProviderPolicy(provider)}
+	key.Prekeys, _ = provider.(repository.PrekeyProvider)
+	key.HybridKeys, _ = provider.(repository.HybridKeyProvider)
+
+	if key.Escrow, err = repository.ProviderEscrow(provider); err != nil {
+		done()
+		return repository.Key{}, nil, repository.NewError(err, "Unable to use escrow keys")
+	}
+
+	key.PrivateKey, err = provider.PrivateKey(privKeyName)
+	if err != nil && !hasHybridKey(key.HybridKeys, privKeyName) {
+		done()
+		return repository.Key{}, nil, repository.NewError(err, fmt.Sprintf("Unable to use private key %s", privKeyName))
+	}
+
+	if pubKeyName == "" {
+		return key, done, nil
+	}
+
+	key.PublicKey, err = provider.PublicKey(pubKeyName)
+	if err != nil && key.HybridKeys != nil {
+		var hybridErr error
+		if key.HybridKey, hybridErr = key.HybridKeys.HybridPublicKey(pubKeyName); hybridErr == nil {
+			err = nil
+		}
+	}
+	if err != nil {
+		done()
+		return repository.Key{}, nil, repository.NewError(err, fmt.Sprintf("Unable to use public key %s", pubKeyName))
+	}
+
+	return key, done, nil
+}
+
+// readPublicKeys finds the named public keys with the key provider.
+func readPublicKeys(fs afero.Fs, keystoreName string, names []string) ([]*rsa.PublicKey, error) {
+	provider, err := openKeyProvider(fs, keystoreName)
+	if err != nil {
+		return nil, err
+	}
+	defer repository.CloseKeyProvider(provider)
+
+	result := []*rsa.PublicKey{}
+	for _, name := range names {
+		key, err := provider.PublicKey(name)
+		if err != nil {
+			return nil, repository.NewError(err, fmt.Sprintf("Unable to use public key %s", name))
+		}
+		result = append(result, key)
+	}
+	return result, nil
+}
+
+func hasHybridKey(provider repository.HybridKeyProvider, name string) bool {
+	if provider == nil {
+		return false
+	}
+	_, err := provider.HybridPublicKey(name)
+	return err == nil
+}
+
+// loadKeystore reads the named keystore.
+func loadKeystore(fs afero.Fs, keyfile string) (*repository.Keystore, error) {
+	file, err := fs.Open(repository.NamedKeystoreFile(keyfile))
+	if err != nil {
+		return nil, err
 	}
 	defer file.Close()
 
-	keystore, err := repository.OpenKeystore(file)
+	return repository.OpenKeystore(file)
+}
+
+// saveKeystore replaces the named keystore with keystore.
+func saveKeystore(fs afero.Fs, keyfile string, keystore *repository.Keystore) error {
+	file, err := fs.OpenFile(repository.NamedKeystoreFile(keyfile), os.O_WRONLY|os.O_TRUNC, 0600)
 	if err != nil {
-		return nil, nil, err
+		return err
+	}
+	defer file.Close()
+
+	return keystore.Save(file)
+}
+
+// ReadPassphrase reads a passphrase from the first line of a file.  An
+// empty file name returns a nil passphrase.
+func ReadPassphrase(fs afero.Fs, fileName string) ([]byte, error) {
+	if fileName == "" {
+		return nil, nil
+	}
+
+	data, err := afero.ReadFile(fs, fileName)
+	if err != nil {
+		return nil, err
+	}
+
+	if i := bytes.IndexAny(data, "\r\n"); i >= 0 {
+		data = data[:i]
+	}
+	return data, nil
+}
+
+// OpenOptions are the checks made when opening a tape.  When Signers are
+// named, at least MinSigners of them must have signed or co-signed the
+// label.  IgnoreWindow opens a tape outside its validity window.  When
+// StateFile is set the tape must follow the last tape received in its
+// stream, or come after missing tapes if AcceptGaps is set.  When
+// ReceiptFile is set a receipt is written there once the tape is unpacked.
+// Unverified opens a tape whose trailer signature cannot be checked, see
+// repository.WithUnverified.
+type OpenOptions struct {
+	Signers      []string
+	MinSigners   int
+	IgnoreWindow bool
+	StateFile    string
+	AcceptGaps   bool
+	ReceiptFile  string
+	Unverified   bool
+}
+
+// tapeOptions returns the options for reading the tape.
+func (o OpenOptions) tapeOptions() []repository.TapeOption {
+	if o.Unverified {
+		return []repository.TapeOption{repository.WithUnverified()}
+	}
+	return nil
+}
+
+// TapeResult describes a tape that was unpacked or listed: its metadata, if
+// it has any, and the names of the signers whose signatures were verified.
+type TapeResult struct {
+	Metadata *repository.Metadata
+	Signers  []string
+}
+
+// tapeResult describes the tape being read.
+func tapeResult(tr *repository.TapeReader) *TapeResult {
+	return &TapeResult{Metadata: tr.Metadata(), Signers: tr.Signers()}
+}
+
+// readSignerPolicy returns a policy requiring required signatures from the
+// named keys, or nil when no keys are named.
+func readSignerPolicy(fs afero.Fs, keystoreName string, names []string, required int) (*repository.SignerPolicy, error) {
+	if len(names) == 0 {
+		return nil, nil
 	}
 
-	privateKey, ok := keystore.FindPrivateKey(privKeyName)
-	if !ok {
-		return nil, nil, errors.New("Private key not found error")
+	keys, err := readPublicKeys(fs, keystoreName, names)
+	if err != nil {
+		return nil, err
 	}
+	return &repository.SignerPolicy{Keys: keys, Required: required}, nil
+}
 
-	publicKey, ok := keystore.FindPublicKey(pubKeyName)
-	if !ok {
-		return nil, nil, errors.New("Public key not found error")
+// openTape opens a tape with the named keys.  When no key names are given
+// the keys recorded in the tape's label are found with the key provider.
+// The tape must pass the checks in opts.  The returned function releases the
+// provider once the tape has been read.
+func openTape(fs afero.Fs, keystoreName, privKeyName, pubKeyName string, tape io.Reader, opts OpenOptions) (*repository.TapeReader, func(), error) {
+	signers, err := readSignerPolicy(fs, keystoreName, opts.Signers, opts.MinSigners)
+	if err != nil {
+		return nil, nil, repository.NewError(err, "Unable to find signer keys")
+	}
+	options := repository.Key{Signers: signers, IgnoreWindow: opts.IgnoreWindow}
+	if opts.StateFile != "" {
+		if options.Streams, err = loadStreamState(fs, opts.StateFile); err != nil {
+			return nil, nil, repository.NewError(err, "Unable to read stream state")
+		}
+		options.Streams.AcceptGaps = opts.AcceptGaps
 	}
 
-	return privateKey, publicKey, nil
+	if privKeyName == "" && pubKeyName == "" {
+		provider, err := openKeyProvider(fs, keystoreName)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		reader, err := repository.OpenTapeWithOptions(options, tape, append(opts.tapeOptions(), repository.WithProvider(provider))...)
+		if err != nil {
+			repository.CloseKeyProvider(provider)
+			return nil, nil, err
+		}
+		return reader, func() { repository.CloseKeyProvider(provider) }, nil
+	}
+
+	key, done, err := readKeysFromKeystore(fs, keystoreName, privKeyName, pubKeyName)
+	if err != nil {
+		return nil, nil, err
+	}
+	key.Signers = options.Signers
+	key.IgnoreWindow = options.IgnoreWindow
+	key.Streams = options.Streams
+
+	reader, err := repository.OpenTapeWithOptions(key, tape, opts.tapeOptions()...)
+	if err != nil {
+		done()
+		return nil, nil, err
+	}
+	return reader, done, nil
 }
@@ -0,0 +1,25 @@
+package commands
+
+import (
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+// CoSignTape approves a tape or detached label by adding a co-signature
+// made with the named private key, without decrypting the payload.  The
+// co-signed label is written to output, or over the archive if output is
+// empty.
+func CoSignTape(fs afero.Fs, archive, output, keystore, privKeyName string) error {
+	provider, err := openKeyProvider(fs, keystore)
+	if err != nil {
+		return err
+	}
+	defer repository.CloseKeyProvider(provider)
+
+	key := repository.Key{Policy: repository.ProviderPolicy(provider)}
+	if key.PrivateKey, err = provider.PrivateKey(privKeyName); err != nil {
+		return err
+	}
+
+	return repository.CoSignFile(fs, archive, output, key)
+}
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/darcinc/repository"
+)
+
+func TestCoSignTape(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+	packTestRepository(fs)
+
+	archive := filepath.Join(repository.HomeDir(), "archive1")
+	if err := CoSignTape(fs, archive, "", "foo", "test1"); err != nil {
+		t.Fatalf("Unable to co-sign tape: %v", err)
+	}
+	if err := CoSignTape(fs, archive, "", "foo", "test1"); err == nil {
+		t.Error("Should not co-sign a tape twice with the same key")
+	}
+
+	opts := OpenOptions{Signers: []string{"test1", "test3"}, MinSigners: 2}
+	for _, names := range [][]string{{"test1", "test3"}, {"", ""}} {
+		file, _ := fs.Open(archive)
+		tr, done, err := openTape(fs, "foo", names[0], names[1], file, opts)
+		file.Close()
+		if err != nil {
+			t.Fatalf("Unable to open co-signed tape with keys %v: %v", names, err)
+		}
+		done()
+		if len(tr.Signers()) != 2 {
+			t.Errorf("Expected two verified signers but got %v", tr.Signers())
+		}
+	}
+
+	opts.Signers = []string{"test1", "test2"}
+	file, _ := fs.Open(archive)
+	defer file.Close()
+	if _, _, err := openTape(fs, "foo", "test1", "test3", file, opts); err == nil {
+		t.Error("Should not open a tape that does not meet the signer policy")
+	}
+}
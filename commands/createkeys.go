@@ -3,47 +3,66 @@ package commands
 import (
 	"crypto/rand"
 	"crypto/rsa"
-	"log"
-	"os"
+	"fmt"
 	"path/filepath"
 
 	"github.com/darcinc/afero"
 	"github.com/darcinc/repository"
 )
 
-//CreateKeys builds a public and private key and saves them to a file
-func CreateKeys(fs afero.Fs, name, keyfile string, cipherStrength int) {
+// openOrCreateKeystore reads the keystore, creating it first if it does not
+// exist.  Returns the keystore's file name along with it.
+func openOrCreateKeystore(fs afero.Fs, keyfile string) (string, *repository.Keystore, error) {
 	if !filepath.IsAbs(keyfile) {
 		keyfile = repository.NamedKeystoreFile(keyfile)
 	}
 
-	_, err := fs.Stat(keyfile)
+	if _, err := fs.Stat(keyfile); err != nil {
+		if _, err = repository.CreateKeystore(fs, keyfile); err != nil {
+			return keyfile, nil, repository.NewError(err, "Failed to create keystore")
+		}
+	}
+
+	keystore, err := loadKeystore(fs, keyfile)
 	if err != nil {
-		repository.CreateKeystore(fs, keyfile)
+		return keyfile, nil, repository.NewError(err, "Failed to open keystore file")
 	}
+	return keyfile, keystore, nil
+}
 
-	file, err := fs.Open(keyfile)
+// CreateKeys builds a public and private key and saves them to a file
+func CreateKeys(fs afero.Fs, name, keyfile string, cipherStrength int) error {
+	keyfile, keystore, err := openOrCreateKeystore(fs, keyfile)
 	if err != nil {
-		log.Fatalf("Failed to open keystore file: %v", err)
+		return err
 	}
 
-	keystore, err := repository.OpenKeystore(file)
-	file.Close()
+	if minimum := keystore.KeyPolicy().MinRSABits; cipherStrength < minimum {
+		return &repository.PolicyError{Reason: fmt.Sprintf("%d bit RSA key is smaller than %d bits", cipherStrength, minimum)}
+	}
 
 	privateKey, err := rsa.GenerateKey(rand.Reader, cipherStrength)
 	if err != nil {
-		log.Fatalf("Failed to generate keys %s: %v", name, err)
+		return repository.NewError(err, fmt.Sprintf("Failed to generate keys %s", name))
 	}
 
 	keystore.AddPrivateKey(name, privateKey)
-	file, err = fs.OpenFile(keyfile, os.O_WRONLY, 0600)
+	return saveKeystore(fs, keyfile, keystore)
+}
+
+// CreateHybridKey builds a hybrid ML-KEM-768 and X25519 key and saves it to
+// the keystore.
+func CreateHybridKey(fs afero.Fs, name, keyfile string) error {
+	keyfile, keystore, err := openOrCreateKeystore(fs, keyfile)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer file.Close()
 
-	err = keystore.Save(file)
+	key, err := repository.GenerateHybridKey()
 	if err != nil {
-		panic(err)
+		return repository.NewError(err, fmt.Sprintf("Failed to generate keys %s", name))
 	}
+
+	keystore.AddHybridKey(name, key)
+	return saveKeystore(fs, keyfile, keystore)
 }
@@ -11,7 +11,9 @@ func TestDeleteKeys(t *testing.T) {
 	fs := createFSWithKeystore(t)
 	addTestKeys(fs, t)
 
-	DeleteKeys(fs, "foo", "test1")
+	if err := DeleteKeys(fs, "foo", "test1"); err != nil {
+		t.Fatalf("Unable to delete key: %v", err)
+	}
 
 	filename := repository.NamedKeystoreFile("foo")
 	file, err := fs.Open(filename)
@@ -30,25 +32,14 @@ func TestDeleteKeys(t *testing.T) {
 	}
 }
 
-func TestInvalidKeystorePanics(t *testing.T) {
-	defer func() {
-		if r := recover(); r != nil {
-
-		}
-	}()
-
+func TestInvalidKeystore(t *testing.T) {
 	fs := createFSWithKeystore(t)
-	DeleteKeys(fs, "bar", "test1")
-	t.Error("Failed to panic with invalid keystore")
+	if err := DeleteKeys(fs, "bar", "test1"); ExitCode(err) != ExitNotFound {
+		t.Errorf("Expected a missing keystore but got %v", err)
+	}
 }
 
-func TestBadKeystorePanics(t *testing.T) {
-	defer func() {
-		if r := recover(); r != nil {
-
-		}
-	}()
-
+func TestBadKeystore(t *testing.T) {
 	fs := createFSWithKeystore(t)
 	f, err := fs.Create(filepath.Join(repository.HomeDir(), "bad.keys"))
 	if err != nil {
@@ -56,6 +47,7 @@ func TestBadKeystorePanics(t *testing.T) {
 	}
 	f.Close()
 
-	DeleteKeys(fs, filepath.Join(repository.HomeDir(), "bad.keys"), "test1")
-	t.Error("Failed to panic with invalid keystore")
+	if err = DeleteKeys(fs, filepath.Join(repository.HomeDir(), "bad.keys"), "test1"); err == nil {
+		t.Error("Failed to report an invalid keystore")
+	}
 }
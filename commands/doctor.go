@@ -0,0 +1,64 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+func readPolicyFile(fs afero.Fs, policyFile string) (*repository.Policy, error) {
+	if policyFile == "" {
+		return nil, nil
+	}
+
+	file, err := fs.Open(policyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return repository.ReadPolicy(file)
+}
+
+// Doctor checks a keystore for weak, expired, unparsable and duplicate keys
+// and for loose file permissions, checking keys against the policy in
+// policyFile or the keystore's own policy if policyFile is empty.  The
+// problems are written to out.  Returns the number of problems found.
+func Doctor(fs afero.Fs, keyfile, policyFile string, out io.Writer) (int, error) {
+	policy, err := readPolicyFile(fs, policyFile)
+	if err != nil {
+		return 0, err
+	}
+
+	problems, err := repository.CheckKeystore(fs, keyfile, policy)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(problems) == 0 {
+		fmt.Fprintf(out, "No problems found in keystore %s\n", keyfile)
+	}
+	for _, problem := range problems {
+		fmt.Fprintf(out, "  %s\n", problem)
+	}
+	return len(problems), nil
+}
+
+// SetPolicy stores the policy in policyFile in the keystore.  The keystore
+// will no longer hand out keys the policy rejects.
+func SetPolicy(fs afero.Fs, keyfile, policyFile string) error {
+	policy, err := readPolicyFile(fs, policyFile)
+	if err != nil {
+		return repository.NewError(err, fmt.Sprintf("Failed to read policy %s", policyFile))
+	}
+
+	keystore, err := loadKeystore(fs, keyfile)
+	if err != nil {
+		return err
+	}
+
+	keystore.Policy = policy
+	return saveKeystore(fs, keyfile, keystore)
+}
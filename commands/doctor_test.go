@@ -0,0 +1,54 @@
+package commands
+
+import (
+	"bytes"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+func TestDoctor(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	fs.Chmod(repository.NamedKeystoreFile("foo"), 0600)
+	fs.Chmod(repository.KeystoreDefaultDirectory(), 0700)
+
+	out := new(bytes.Buffer)
+	count, err := Doctor(fs, "foo", "", out)
+	if err != nil {
+		t.Fatalf("Unable to check keystore: %v", err)
+	}
+	if count != 0 {
+		t.Errorf("Expected no problems but got %s", out.String())
+	}
+
+	policyFile := filepath.Join(repository.HomeDir(), "policy.json")
+	afero.WriteFile(fs, policyFile, []byte(`{"minRSABits": 4096}`), 0600)
+
+	out.Reset()
+	count, err = Doctor(fs, "foo", policyFile, out)
+	if err != nil {
+		t.Fatalf("Unable to check keystore: %v", err)
+	}
+	if count != 3 || !strings.Contains(out.String(), "smaller than 4096 bits") {
+		t.Errorf("Expected three weak keys but got %s", out.String())
+	}
+}
+
+func TestSetPolicy(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+
+	policyFile := filepath.Join(repository.HomeDir(), "policy.json")
+	afero.WriteFile(fs, policyFile, []byte(`{"minRSABits": 4096}`), 0600)
+	SetPolicy(fs, "foo", policyFile)
+
+	_, done, err := readKeysFromKeystore(fs, "foo", "test1", "test2")
+	if err == nil {
+		done()
+		t.Error("Keystore should refuse keys weaker than its policy")
+	}
+}
@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"errors"
+	"os"
+
+	"github.com/darcinc/repository"
+)
+
+// Exit codes the command line tools return for each kind of error, see
+// ExitCode.
+const (
+	ExitOK            = 0  // success
+	ExitFailure       = 1  // any other error, or a check found problems
+	ExitUsage         = 2  // missing or invalid arguments
+	ExitNotFound      = 3  // a file, keystore or key does not exist
+	ExitKeyMismatch   = 4  // the tape is for, or signed by, another key
+	ExitBadSignature  = 5  // a signature does not verify
+	ExitTruncated     = 6  // the tape ends early
+	ExitUnsupported   = 7  // an unknown label version, mode or algorithm
+	ExitPolicy        = 8  // a policy, validity window or stream refuses the tape
+	ExitUnsafePath    = 9  // a file on the tape has an unsafe path
+	ExitBadPassphrase = 10 // the passphrase does not open the tape
+)
+
+// UsageError reports missing or invalid arguments to a command.
+type UsageError struct {
+	Message string
+}
+
+// Error implements the error interface.
+func (e *UsageError) Error() string {
+	return e.Message
+}
+
+// ExitCode returns the exit code for an error returned by a command:
+// ExitOK for no error, ExitUsage for a *UsageError, ExitNotFound for a
+// missing file or key, ExitKeyMismatch, ExitBadSignature, ExitTruncated,
+// ExitUnsupported, ExitUnsafePath and ExitBadPassphrase for the repository
+// errors of those kinds, ExitPolicy when a policy, signer policy, validity window or stream
+// refuses a tape, and ExitFailure for everything else, including checks
+// that fail.
+func ExitCode(err error) int {
+	var usage *UsageError
+	var policy *repository.PolicyError
+	var signers *repository.SignerPolicyError
+	var window *repository.WindowError
+	var stream *repository.StreamError
+
+	switch {
+	case err == nil:
+		return ExitOK
+	case errors.As(err, &usage):
+		return ExitUsage
+	case errors.Is(err, repository.ErrUnsafePath):
+		return ExitUnsafePath
+	case errors.Is(err, repository.ErrBadPassphrase):
+		return ExitBadPassphrase
+	case errors.Is(err, repository.ErrBadSignature):
+		return ExitBadSignature
+	case errors.Is(err, repository.ErrKeyMismatch):
+		return ExitKeyMismatch
+	case errors.Is(err, repository.ErrTruncated):
+		return ExitTruncated
+	case errors.Is(err, repository.ErrUnsupportedVersion):
+		return ExitUnsupported
+	case errors.As(err, &policy), errors.As(err, &signers), errors.As(err, &window), errors.As(err, &stream):
+		return ExitPolicy
+	case errors.Is(err, repository.ErrNoSuchKey), errors.Is(err, os.ErrNotExist):
+		return ExitNotFound
+	}
+	return ExitFailure
+}
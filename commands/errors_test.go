@@ -0,0 +1,68 @@
+package commands
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+func TestExitCode(t *testing.T) {
+	codes := map[error]int{
+		nil:                                     ExitOK,
+		errors.New("failed"):                    ExitFailure,
+		&UsageError{Message: "missing archive"}: ExitUsage,
+		repository.NewError(&UsageError{}, "bad"): ExitUsage,
+		&repository.PolicyError{Reason: "weak"}:   ExitPolicy,
+		&repository.WindowError{}:                 ExitPolicy,
+		&repository.UnsafePathError{Path: ".."}:   ExitUnsafePath,
+		&repository.TruncatedError{Err: io.EOF}:   ExitTruncated,
+	}
+	for err, code := range codes {
+		if ExitCode(err) != code {
+			t.Errorf("Expected exit code %d for %v but got %d", code, err, ExitCode(err))
+		}
+	}
+}
+
+func TestCommandErrors(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+	packTestRepository(fs)
+	archive := filepath.Join(repository.HomeDir(), "archive1")
+
+	if _, err := UnpackRepository(fs, filepath.Join(repository.HomeDir(), "missing"), "foo", "test1", "test3"); ExitCode(err) != ExitNotFound {
+		t.Errorf("Expected a missing archive but got %v", err)
+	}
+	if _, err := UnpackRepository(fs, archive, "foo", "test1", "missing"); ExitCode(err) != ExitNotFound {
+		t.Errorf("Expected a missing key but got %v", err)
+	}
+	if _, err := UnpackRepository(fs, archive, "foo", "test3", "test3"); ExitCode(err) != ExitKeyMismatch {
+		t.Errorf("Expected the wrong recipient key but got %v", err)
+	}
+	if _, err := UnpackRepository(fs, archive, "foo", "test1", "test1"); ExitCode(err) != ExitKeyMismatch {
+		t.Errorf("Expected the wrong sender key but got %v", err)
+	}
+
+	tape, err := afero.ReadFile(fs, archive)
+	if err != nil {
+		t.Fatalf("Unable to read archive: %v", err)
+	}
+	tampered := filepath.Join(repository.HomeDir(), "tampered")
+	tape[len(tape)/2] ^= 0xff
+	afero.WriteFile(fs, tampered, tape, 0600)
+	if err = CheckSender(fs, tampered, "foo", "test3", new(bytes.Buffer)); ExitCode(err) != ExitBadSignature {
+		t.Errorf("Expected a bad signature but got %v", err)
+	}
+
+	truncated := filepath.Join(repository.HomeDir(), "truncated")
+	afero.WriteFile(fs, truncated, tape[:10], 0600)
+	if _, err = ListContents(fs, truncated, "foo", "test1", "test3", new(bytes.Buffer)); ExitCode(err) != ExitTruncated {
+		t.Errorf("Expected a truncated tape but got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+// SetEscrow names the escrow keys of a keystore.  Every tape written with
+// the keystore also wraps its key for each of them.  No names removes the
+// escrow setting.
+func SetEscrow(fs afero.Fs, keyfile string, names []string) error {
+	keystore, err := loadKeystore(fs, keyfile)
+	if err != nil {
+		return err
+	}
+
+	if err = keystore.SetEscrow(names); err != nil {
+		return repository.NewError(err, "Failed to set escrow keys")
+	}
+
+	return saveKeystore(fs, keyfile, keystore)
+}
+
+// CheckEscrow checks that a tape or detached label wraps its key for every
+// escrow key of the keystore, and writes the result to out.  Returns a
+// *repository.EscrowMissingError if any escrow slot is missing.
+func CheckEscrow(fs afero.Fs, archive, keystoreName string, out io.Writer) error {
+	provider, err := openKeyProvider(fs, keystoreName)
+	if err != nil {
+		return err
+	}
+	defer repository.CloseKeyProvider(provider)
+
+	escrow, err := repository.ProviderEscrow(provider)
+	if err != nil {
+		return err
+	}
+	if len(escrow) == 0 {
+		return fmt.Errorf("Keystore %s names no escrow keys", keystoreName)
+	}
+
+	file, err := fs.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err = repository.CheckEscrow(file, escrow); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(out, "%s has escrow slots for all %d escrow keys\n", archive, len(escrow))
+	return nil
+}
@@ -0,0 +1,39 @@
+package commands
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/darcinc/repository"
+)
+
+func TestEscrowTapes(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+	packTestRepository(fs)
+
+	archive := filepath.Join(repository.HomeDir(), "archive1")
+	out := new(bytes.Buffer)
+	if err := CheckEscrow(fs, archive, "foo", out); err == nil {
+		t.Error("Should not check escrow without escrow keys")
+	}
+
+	SetEscrow(fs, "foo", []string{"test2"})
+	if err := CheckEscrow(fs, archive, "foo", out); err == nil {
+		t.Error("A tape packed before escrow was set should be missing its escrow slot")
+	}
+
+	packTestRepository(fs)
+	if err := CheckEscrow(fs, archive, "foo", out); err != nil {
+		t.Errorf("Tape should have an escrow slot: %v", err)
+	}
+
+	out.Reset()
+	ListKeys(fs, "foo", OutputText, out)
+	if !regexp.MustCompile("Escrow Keys.*\n  test2").Match(out.Bytes()) {
+		t.Errorf("Escrow keys not listed: %s", out.String())
+	}
+}
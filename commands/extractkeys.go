@@ -1,76 +1,63 @@
 package commands
 
 import (
+	"fmt"
 	"io"
 	"os"
 
-	"crypto/x509"
-	"encoding/pem"
-
 	"github.com/darcinc/afero"
 	"github.com/darcinc/repository"
 )
 
-// ExtractKeys extracts a key into PEM encoded formats
-func ExtractKeys(fs afero.Fs, keyfile, name, outfile string) {
-	if outfile != "" {
-		out, err := fs.OpenFile(outfile, os.O_WRONLY|os.O_CREATE, 0600)
-		if err != nil {
-			// Unable to test using in-memory filesystem
-			panic(err)
-		}
-		extractKeys(fs, keyfile, name, out)
-	} else {
-		extractKeys(fs, keyfile, name, os.Stdout)
+// ExtractKeys extracts a key in the given format, PEM if the format is
+// empty, to outfile.  The passphrase encrypts the exported private key and
+// may be nil.
+func ExtractKeys(fs afero.Fs, keyfile, name, outfile, format string, passphrase []byte) error {
+	out, err := fs.OpenFile(outfile, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		// Unable to test using in-memory filesystem
+		return err
 	}
+	defer out.Close()
 
+	return ExtractKeysTo(fs, keyfile, name, out, format, passphrase)
 }
 
-func extractKeys(fs afero.Fs, keyfile, name string, out io.Writer) {
-	filename := repository.NamedKeystoreFile(keyfile)
-	file, err := fs.Open(filename)
+// ExtractKeysTo extracts a key like ExtractKeys, writing it to out.
+func ExtractKeysTo(fs afero.Fs, keyfile, name string, out io.Writer, format string, passphrase []byte) error {
+	keyFormat, err := repository.ParseKeyFormat(format)
 	if err != nil {
-		panic(err)
+		return &UsageError{Message: err.Error()}
 	}
 
-	keystore, err := repository.OpenKeystore(file)
+	keystore, err := loadKeystore(fs, keyfile)
 	if err != nil {
-		panic(err)
+		return err
 	}
 
-	privkey, ok := keystore.FindPrivateKey(name)
-	if ok {
-		bytes := x509.MarshalPKCS1PrivateKey(privkey)
-		err = pem.Encode(out, &pem.Block{Type: "RSA PRIVATE KEY", Bytes: bytes})
-		if err != nil {
-			panic(err)
-		}
-
-		bytes, err = x509.MarshalPKIXPublicKey(privkey.Public())
-		if err != nil {
-			panic(err)
-		}
-
-		err = pem.Encode(out, &pem.Block{Type: "RSA PUBLIC KEY", Bytes: bytes})
-		if err != nil {
-			panic(err)
-		}
+	if hybridKey, ok := keystore.FindHybridPublicKey(name); ok {
+		return extractHybridKey(keystore, name, hybridKey, out, keyFormat)
+	}
 
-		return
+	if privkey, ok := keystore.FindPrivateKey(name); ok {
+		return repository.EncodeKey(out, keyFormat, name, privkey, nil, passphrase)
 	}
 
-	pubkey, ok := keystore.FindPublicKey(name)
-	if ok {
-		bytes, err := x509.MarshalPKIXPublicKey(pubkey)
-		if err != nil {
-			panic(err)
-		}
+	if pubkey, ok := keystore.FindPublicKey(name); ok {
+		return repository.EncodeKey(out, keyFormat, name, nil, pubkey, passphrase)
+	}
 
-		err = pem.Encode(out, &pem.Block{Type: "RSA PUBLIC KEY", Bytes: bytes})
-		if err != nil {
-			panic(err)
-		}
+	return &repository.NoSuchKeyError{Kind: "Key", Name: name}
+}
 
-		return
+// extractHybridKey writes a hybrid key as PEM, the only format hybrid keys
+// support.
+func extractHybridKey(keystore *repository.Keystore, name string, pub *repository.HybridPublicKey, out io.Writer, format repository.KeyFormat) error {
+	if format != "" && format != repository.FormatPEM {
+		return &UsageError{Message: fmt.Sprintf("Hybrid key %s can only be exported as pem", name)}
 	}
+
+	priv, _ := keystore.FindHybridKey(name)
+	_, err := out.Write(repository.EncodeHybridKey(priv, pub))
+	return err
 }
@@ -15,10 +15,10 @@ func TestExtractPrivateKeys(t *testing.T) {
 
 	bfr := new(bytes.Buffer)
 
-	extractKeys(fs, "foo", "test1", bfr)
+	ExtractKeysTo(fs, "foo", "test1", bfr, "", nil)
 
 	re1 := regexp.MustCompile("RSA PRIVATE KEY")
-	re2 := regexp.MustCompile("RSA PUBLIC KEY")
+	re2 := regexp.MustCompile("BEGIN PUBLIC KEY")
 
 	if !re1.Match(bfr.Bytes()) {
 		t.Error("Did not find private key")
@@ -34,21 +34,41 @@ func TestExtractPublicKeys(t *testing.T) {
 	addTestKeys(fs, t)
 
 	bfr := new(bytes.Buffer)
-	extractKeys(fs, "foo", "test2", bfr)
+	ExtractKeysTo(fs, "foo", "test2", bfr, "", nil)
 
-	re1 := regexp.MustCompile("RSA PUBLIC KEY")
+	re1 := regexp.MustCompile("BEGIN PUBLIC KEY")
 
 	if !re1.Match(bfr.Bytes()) {
 		t.Error("Did not match public key")
 	}
 }
 
+func TestExtractPublicKeyFormats(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+
+	expected := map[string]string{
+		"pkcs8":   "BEGIN PUBLIC KEY",
+		"openssh": "^ssh-rsa .* test2",
+		"jwk":     `"kid": "test2"`,
+	}
+	for format, pattern := range expected {
+		bfr := new(bytes.Buffer)
+		ExtractKeysTo(fs, "foo", "test2", bfr, format, nil)
+		if !regexp.MustCompile(pattern).Match(bfr.Bytes()) {
+			t.Errorf("Did not find %s public key: %s", format, bfr.String())
+		}
+	}
+}
+
 func TestExtractKeysToFile(t *testing.T) {
 	fs := createFSWithKeystore(t)
 	addTestKeys(fs, t)
 
 	exportFile := filepath.Join(repository.HomeDir(), "somefile.txt")
-	ExtractKeys(fs, "foo", "test2", exportFile)
+	if err := ExtractKeys(fs, "foo", "test2", exportFile, "", nil); err != nil {
+		t.Fatalf("Unable to export key: %v", err)
+	}
 
 	if _, err := fs.Stat(exportFile); err != nil {
 		t.Errorf("Failed to export file to somefile.txt: %v", err)
@@ -59,13 +79,13 @@ func TestExtractKeysBadKeystoreName(t *testing.T) {
 	fs := createFSWithKeystore(t)
 	addTestKeys(fs, t)
 
-	defer func() {
-		recover()
-	}()
-
 	bfr := new(bytes.Buffer)
-	extractKeys(fs, "baz", "test2", bfr)
-	t.Error("Should have failed with bad keystore name")
+	if err := ExtractKeysTo(fs, "baz", "test2", bfr, "", nil); ExitCode(err) != ExitNotFound {
+		t.Errorf("Should have failed with bad keystore name but got %v", err)
+	}
+	if err := ExtractKeysTo(fs, "foo", "missing", bfr, "", nil); ExitCode(err) != ExitNotFound {
+		t.Errorf("Should have failed with a missing key but got %v", err)
+	}
 }
 
 func TestExtractKeysBadKeystoreFormat(t *testing.T) {
@@ -78,11 +98,8 @@ func TestExtractKeysBadKeystoreFormat(t *testing.T) {
 	}
 	f.Close()
 
-	defer func() {
-		recover()
-	}()
-
 	bfr := new(bytes.Buffer)
-	extractKeys(fs, "baz", "test2", bfr)
-	t.Error("Should have failed with bad keystore name")
+	if err = ExtractKeysTo(fs, "baz", "test2", bfr, "", nil); err == nil {
+		t.Error("Should have failed with bad keystore format")
+	}
 }
@@ -0,0 +1,65 @@
+package commands
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/darcinc/repository"
+)
+
+func TestHybridKeys(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+
+	CreateHybridKey(fs, "hybrid", "foo")
+
+	exported := new(bytes.Buffer)
+	ExtractKeysTo(fs, "foo", "hybrid", exported, "", nil)
+	if !bytes.Contains(exported.Bytes(), []byte("MLKEM768-X25519 PRIVATE KEY")) {
+		t.Fatalf("Expected a hybrid private key but got %s", exported.String())
+	}
+
+	priv, _, err := repository.DecodeHybridKey(exported.Bytes())
+	if err != nil {
+		t.Fatalf("Unable to decode exported key: %v", err)
+	}
+	public := bytes.NewBuffer(repository.EncodeHybridKey(nil, priv.Public()))
+	if err = importKey(fs, "foo", "partner", public, "", nil); err != nil {
+		t.Fatalf("Unable to import hybrid public key: %v", err)
+	}
+
+	keystore, err := loadKeystore(fs, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := keystore.FindHybridKey("hybrid"); !ok {
+		t.Error("Failed to find created hybrid key")
+	}
+	if _, ok := keystore.FindHybridPublicKey("partner"); !ok {
+		t.Error("Failed to find imported hybrid public key")
+	}
+
+	archive := filepath.Join(repository.HomeDir(), "archive1")
+	PackRepository(fs, map[string]string{
+		"archive":  archive,
+		"files":    filepath.Join(repository.HomeDir(), "data1.dat"),
+		"keystore": "foo",
+		"pubkey":   "partner",
+		"privkey":  "test3",
+	})
+
+	outf := new(bytes.Buffer)
+	ListContents(fs, archive, "foo", "", "", outf)
+	if !regexp.MustCompile("data1\\.dat").Match(outf.Bytes()) {
+		t.Error("Failed to find data files in the hybrid tape")
+	}
+
+	outf.Reset()
+	ListContents(fs, archive, "foo", "hybrid", "test3", outf)
+	if !regexp.MustCompile("data1\\.dat").Match(outf.Bytes()) {
+		t.Error("Failed to find data files in the hybrid tape with named keys")
+	}
+}
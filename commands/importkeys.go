@@ -1,14 +1,9 @@
 package commands
 
 import (
-	"bytes"
-	"crypto/rsa"
-	"crypto/x509"
-	"encoding/pem"
 	"io"
-	"log"
+	"io/ioutil"
 	"os"
-	"strings"
 
 	"github.com/darcinc/repository"
 
@@ -16,23 +11,37 @@ import (
 )
 
 // ImportKey imports a key into the repository with the given key name.  The
-// PEM encoded key is read from the io.Reader.  The function then saves the
-// keystore with the new key.
-func ImportKey(fs afero.Fs, repoName, keyName, fileName string) error {
+// key is read from the named file in the given format, detecting the format
+// when it is empty.  The passphrase decrypts encrypted keys and may be nil.
+// The function then saves the keystore with the new key.
+func ImportKey(fs afero.Fs, repoName, keyName, fileName, format string, passphrase []byte) error {
 	file, err := fs.Open(fileName)
 	if err != nil {
 		return err
 	}
 	defer file.Close()
-	err = importKey(fs, repoName, keyName, file)
+
+	return importKey(fs, repoName, keyName, file, format, passphrase)
+}
+
+func importKey(fs afero.Fs, repoName, keyName string, from io.Reader, format string, passphrase []byte) error {
+	keyFormat, err := repository.ParseKeyFormat(format)
 	if err != nil {
-		log.Printf("Failed to import public key: %v", err)
+		return &UsageError{Message: err.Error()}
 	}
 
-	return err
-}
+	data, err := ioutil.ReadAll(from)
+	if err != nil {
+		return err
+	}
+
+	hybridPrivate, hybridPublic, hybridErr := repository.DecodeHybridKey(data)
+
+	privateKey, publicKey, err := repository.DecodeKey(data, keyFormat, passphrase)
+	if err != nil && hybridErr != nil {
+		return err
+	}
 
-func importKey(fs afero.Fs, repoName, keyName string, from io.Reader) error {
 	filename := repository.KeystorePath(repoName)
 	file, err := fs.Open(filename)
 	if err != nil {
@@ -45,23 +54,15 @@ func importKey(fs afero.Fs, repoName, keyName string, from io.Reader) error {
 		return err
 	}
 
-	buffer := new(bytes.Buffer)
-	io.Copy(buffer, from)
-	block, _ := pem.Decode(buffer.Bytes())
-
-	if strings.Contains(block.Type, "PRIVATE") {
-		pk, err := x509.ParsePKCS1PrivateKey(block.Bytes)
-		if err != nil {
-			return err
-		}
-		keystore.AddPrivateKey(keyName, pk)
-	} else {
-		pk, err := x509.ParsePKIXPublicKey(block.Bytes)
-		if err != nil {
-			return err
-		}
-		pubkey := pk.(*rsa.PublicKey)
-		keystore.AddPublicKey(keyName, pubkey)
+	switch {
+	case hybridPrivate != nil:
+		keystore.AddHybridKey(keyName, hybridPrivate)
+	case hybridPublic != nil:
+		keystore.AddHybridPublicKey(keyName, hybridPublic)
+	case privateKey != nil:
+		keystore.AddPrivateKey(keyName, privateKey)
+	default:
+		keystore.AddPublicKey(keyName, publicKey)
 	}
 
 	file, err = fs.OpenFile(filename, os.O_WRONLY, 0600)
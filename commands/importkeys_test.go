@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
@@ -36,18 +37,18 @@ func createTestKeyFile(fs afero.Fs) {
 	}
 	defer file.Close()
 
-	file, err = fs.OpenFile(path.Join(repository.HomeDir(), "test3.pem"), os.O_WRONLY|os.O_CREATE, 0600)
+	err = pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: keybytes})
 	if err != nil {
 		panic(err)
 	}
-	defer file.Close()
 
-	_, err = file.Write([]byte(testPubkey))
+	file, err = fs.OpenFile(path.Join(repository.HomeDir(), "test3.pem"), os.O_WRONLY|os.O_CREATE, 0600)
 	if err != nil {
 		panic(err)
 	}
+	defer file.Close()
 
-	err = pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: keybytes})
+	_, err = file.Write([]byte(testPubkey))
 	if err != nil {
 		panic(err)
 	}
@@ -78,7 +79,7 @@ func TestImportPrivateKey(t *testing.T) {
 	}
 	defer file.Close()
 
-	err = importKey(fs, "foo", "imported", file)
+	err = importKey(fs, "foo", "imported", file, "", nil)
 	if err != nil {
 		t.Fatalf("Unable to import key: %v", err)
 	}
@@ -112,7 +113,7 @@ func TestImportPublicKey(t *testing.T) {
 	}
 	defer file.Close()
 
-	err = importKey(fs, "foo", "imported2", file)
+	err = importKey(fs, "foo", "imported2", file, "", nil)
 	if err != nil {
 		t.Errorf("Failed to import public key: %v", err)
 	}
@@ -145,7 +146,7 @@ func TestImportSSHPublicKey(t *testing.T) {
 	}
 	defer file.Close()
 
-	err = importKey(fs, "foo", "public-ssh", file)
+	err = importKey(fs, "foo", "public-ssh", file, "", nil)
 	if err != nil {
 		t.Errorf("Failed to import public key: %v", err)
 	}
@@ -167,3 +168,46 @@ func TestImportSSHPublicKey(t *testing.T) {
 		t.Error("Failed to find public-ssh after import")
 	}
 }
+
+func TestImportKeyFormats(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	pk, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, format := range []string{"pkcs8", "openssh", "jwk", "pkcs12"} {
+		buffer := new(bytes.Buffer)
+		err = repository.EncodeKey(buffer, repository.KeyFormat(format), format, pk, nil, []byte("secret"))
+		if err != nil {
+			t.Fatalf("Unable to encode %s key: %v", format, err)
+		}
+
+		err = importKey(fs, "foo", format, buffer, format, []byte("secret"))
+		if err != nil {
+			t.Errorf("Failed to import %s key: %v", format, err)
+		}
+	}
+
+	err = importKey(fs, "foo", "bad", bytes.NewBufferString(testPubkey), "yaml", nil)
+	if err == nil {
+		t.Error("Should not import a key in an unknown format")
+	}
+
+	file, err := fs.Open(repository.NamedKeystoreFile("foo"))
+	if err != nil {
+		t.Fatalf("Unable to open keystore file: %v", err)
+	}
+	defer file.Close()
+
+	keystore, err := repository.OpenKeystore(file)
+	if err != nil {
+		t.Fatalf("Unable to read keystore file: %v", err)
+	}
+
+	for _, format := range []string{"pkcs8", "openssh", "jwk", "pkcs12"} {
+		if _, ok := keystore.FindPrivateKey(format); !ok {
+			t.Errorf("Failed to find %s key after import", format)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+// keyNamer names keys by fingerprint with the key provider, if there is one.
+type keyNamer struct {
+	provider repository.KeyProvider
+}
+
+func (n keyNamer) name(fingerprint string) string {
+	if n.provider == nil {
+		return fingerprint
+	}
+	if name := n.lookup(fingerprint); name != "" {
+		return fmt.Sprintf("%s (%s)", fingerprint, name)
+	}
+	return fingerprint + " (unknown)"
+}
+
+// lookup returns the name of the key with the fingerprint, or "" if there is
+// no such key in the provider.
+func (n keyNamer) lookup(fingerprint string) string {
+	if n.provider == nil {
+		return ""
+	}
+	for _, private := range []bool{true, false} {
+		if name, err := repository.FindKeyName(n.provider, fingerprint, private); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// InspectTape writes the structure of a tape or detached label to out
+// without decrypting it: the format version, algorithms, recipients, signers
+// and key sizes in the label, and the sizes of the label and payload and
+// whether there is a trailer.  Fingerprints are named from the keystore where
+// possible.  Other output formats write one InspectRecord.  Returns what
+// was read of the tape's structure, and an error if the tape is corrupt.
+func InspectTape(fs afero.Fs, archive, keystoreName string, format OutputFormat, out io.Writer) (*repository.TapeInfo, error) {
+	file, err := fs.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	namer := keyNamer{}
+	if provider, err := openKeyProvider(fs, keystoreName); err == nil {
+		defer repository.CloseKeyProvider(provider)
+		namer.provider = provider
+	}
+
+	info, err := repository.InspectTape(file)
+	if format != OutputText {
+		if werr := writeRecord(out, format, inspectRecord(archive, info, err, namer)); werr != nil && err == nil {
+			err = werr
+		}
+		return info, err
+	}
+	printTapeInfo(info, namer, out)
+	return info, err
+}
+
+// inspectRecord describes what was read of the tape's structure, and the
+// error that stopped it being read.
+func inspectRecord(archive string, info *repository.TapeInfo, err error, namer keyNamer) InspectRecord {
+	record := InspectRecord{
+		Kind:        KindInspection,
+		Archive:     archive,
+		Status:      StatusUnverified,
+		Version:     info.Version,
+		Mode:        info.Mode,
+		Cipher:      info.Cipher,
+		Hash:        info.Hash,
+		Compression: info.Compression,
+		Signing:     info.Signing,
+		Threshold:   info.Threshold,
+		NotBefore:   timestamp(info.NotBefore),
+		NotAfter:    timestamp(info.NotAfter),
+		Stream:      info.Stream,
+		Metadata:    info.Metadata,
+		LabelSize:   info.LabelSize,
+		PayloadSize: info.PayloadSize,
+	}
+	if err != nil {
+		record.Status = StatusCorrupt
+		record.Error = err.Error()
+	}
+	if info.Sender != "" {
+		record.Sender = &KeyReference{Fingerprint: info.Sender, Name: namer.lookup(info.Sender)}
+	}
+	for _, slot := range info.Slots {
+		record.Recipients = append(record.Recipients, slotRecord(slot, namer))
+	}
+	for _, slot := range info.Escrow {
+		record.Escrow = append(record.Escrow, slotRecord(slot, namer))
+	}
+	for _, sig := range info.Signatures {
+		record.Signatures = append(record.Signatures, SignatureRecord{
+			KeyReference: KeyReference{Fingerprint: sig.Signer, Name: namer.lookup(sig.Signer)},
+			Sender:       sig.Sender,
+			Bits:         sig.Bits,
+		})
+	}
+	if info.Trailer {
+		record.Trailer = &TrailerRecord{
+			KeyReference: KeyReference{Fingerprint: info.TrailerSigner, Name: namer.lookup(info.TrailerSigner)},
+			Bits:         info.TrailerBits,
+			Manifest:     info.Manifest,
+		}
+	}
+	return record
+}
+
+func slotRecord(slot repository.SlotInfo, namer keyNamer) SlotRecord {
+	return SlotRecord{
+		KeyReference: KeyReference{Fingerprint: slot.Recipient, Name: namer.lookup(slot.Recipient)},
+		Wrapping:     slot.Wrapping,
+		Bits:         slot.Bits,
+		Prekey:       slot.Prekey,
+	}
+}
+
+// printTapeInfo writes what was read of the tape's structure to out.
+func printTapeInfo(info *repository.TapeInfo, namer keyNamer, out io.Writer) {
+	if info.Version == 0 {
+		return
+	}
+	fmt.Fprintf(out, "Format version: %d\n", info.Version)
+	if info.Mode == "" {
+		fmt.Fprintln(out, "Label written before versioning, it records no key fingerprints or sizes")
+		return
+	}
+
+	fmt.Fprintf(out, "Mode: %s\n", info.Mode)
+	fmt.Fprintf(out, "Cipher: %s\n", info.Cipher)
+	fmt.Fprintf(out, "Signing: %s\n", info.Signing)
+	fmt.Fprintf(out, "Compression: %s\n", info.Compression)
+	if info.Sender != "" {
+		fmt.Fprintf(out, "Sender: %s\n", namer.name(info.Sender))
+	}
+	if info.Threshold > 0 {
+		fmt.Fprintf(out, "Threshold: %d of %d custodians\n", info.Threshold, len(info.Slots))
+	}
+	for _, slot := range info.Slots {
+		printSlot(out, "Recipient", slot, namer)
+	}
+	for _, slot := range info.Escrow {
+		printSlot(out, "Escrow", slot, namer)
+	}
+	for _, sig := range info.Signatures {
+		role := "Co-signature"
+		if sig.Sender {
+			role = "Signature"
+		}
+		fmt.Fprintf(out, "%s: %s, %d bit key\n", role, namer.name(sig.Signer), sig.Bits)
+	}
+	if !info.NotBefore.IsZero() {
+		fmt.Fprintf(out, "Not before: %s\n", info.NotBefore.Format(time.RFC3339))
+	}
+	if !info.NotAfter.IsZero() {
+		fmt.Fprintf(out, "Not after: %s\n", info.NotAfter.Format(time.RFC3339))
+	}
+	if info.Stream != nil {
+		fmt.Fprintf(out, "Stream: %s, tape %d\n", info.Stream.ID, info.Stream.Sequence)
+	}
+	if info.Metadata {
+		fmt.Fprintln(out, "Metadata: present, encrypted")
+	}
+
+	fmt.Fprintf(out, "Label: %d bytes\n", info.LabelSize)
+	fmt.Fprintf(out, "Payload: %d bytes\n", info.PayloadSize)
+	if info.Trailer {
+		fmt.Fprintf(out, "Trailer: signed by %s, %d bit key", namer.name(info.TrailerSigner), info.TrailerBits)
+		if info.Manifest {
+			fmt.Fprint(out, ", with manifest")
+		}
+		fmt.Fprintln(out)
+	} else {
+		fmt.Fprintln(out, "Trailer: none")
+	}
+}
+
+func printSlot(out io.Writer, role string, slot repository.SlotInfo, namer keyNamer) {
+	fmt.Fprintf(out, "%s: %s, %s", role, namer.name(slot.Recipient), slot.Wrapping)
+	if slot.Bits > 0 {
+		fmt.Fprintf(out, ", %d bit key", slot.Bits)
+	}
+	if slot.Prekey != "" {
+		fmt.Fprintf(out, ", prekey %s", slot.Prekey)
+	}
+	fmt.Fprintln(out)
+}
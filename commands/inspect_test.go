@@ -0,0 +1,28 @@
+package commands
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/darcinc/repository"
+)
+
+func TestInspectTape(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+	packTestRepository(fs)
+
+	archive := filepath.Join(repository.HomeDir(), "archive1")
+	out := new(bytes.Buffer)
+	if _, err := InspectTape(fs, archive, "foo", OutputText, out); err != nil {
+		t.Fatalf("Unable to inspect tape: %v", err)
+	}
+	for _, expected := range []string{"Format version: 2", "Mode: rsa", "Recipient: [0-9a-f]+ \\(test1\\), RSA PKCS#1 v1.5, 2048 bit key", "Sender: [0-9a-f]+ \\(test3\\)", "Trailer: signed by", "Metadata: present"} {
+		if !regexp.MustCompile(expected).Match(out.Bytes()) {
+			t.Errorf("Expected %q in the inspection: %s", expected, out.String())
+		}
+	}
+}
@@ -2,38 +2,106 @@ package commands
 
 import (
 	"io"
-	"log"
-
-	"github.com/darcinc/repository"
 
 	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
 )
 
-// ListContents lists the contents of an archive
-func ListContents(fs afero.Fs, archive, keystore, pubkey, privkey string, output io.Writer) {
+// ListContents lists the contents of an archive to output.  If no key names
+// are given, the keys recorded in the tape's label are used.
+func ListContents(fs afero.Fs, archive, keystore, pubkey, privkey string, output io.Writer) (*TapeResult, error) {
+	return ListContentsWithOptions(fs, archive, keystore, pubkey, privkey, OpenOptions{}, OutputText, output)
+}
 
+// ListContentsWithOptions lists the contents of an archive like
+// ListContents, but only if it passes the checks in opts, and in the output
+// format.  The stream state is checked but not updated.
+func ListContentsWithOptions(fs afero.Fs, archive, keystore, pubkey, privkey string, opts OpenOptions, format OutputFormat, output io.Writer) (*TapeResult, error) {
 	file, err := fs.Open(archive)
 	if err != nil {
-		log.Fatalf("Failed to open archive: %v", err)
+		return nil, err
 	}
+	defer file.Close()
 
-	privateKey, publicKey, err := readKeysFromKeystore(fs, keystore, pubkey, privkey)
+	tr, done, err := openTape(fs, keystore, pubkey, privkey, file, opts)
 	if err != nil {
-		log.Fatalf("Failed to read keys from keystore: %v", err)
+		return nil, repository.NewError(err, "Failed to open tape")
 	}
+	defer done()
 
-	tr, err := repository.OpenTape(privateKey, publicKey, file)
-	if err != nil {
-		log.Fatalf("Failed to open tape: %v", err)
-	}
+	return tapeResult(tr), listTape(tr, archive, format, output)
+}
 
+// listTape writes the tape's metadata and the name of each file on the tape
+// to output.  As records, each file is written as an EntryRecord followed by
+// a TapeRecord for the archive, or as one TapeDocument for JSON.
+func listTape(tr *repository.TapeReader, archive string, format OutputFormat, output io.Writer) error {
+	if format != OutputText {
+		return listTapeRecords(tr, archive, format, output)
+	}
+	printMetadata(tr.Metadata(), output)
 	contents, err := tr.Contents()
 	if err != nil {
-		log.Fatalf("Failed to read tape contents: %v", err)
+		return repository.NewError(err, "Failed to read tape contents")
 	}
 
 	for _, c := range contents {
 		output.Write([]byte(c))
 		output.Write([]byte("\n"))
 	}
+	return nil
+}
+
+// listTapeRecords writes the files on the tape as records, streaming them
+// for NDJSON.
+func listTapeRecords(tr *repository.TapeReader, archive string, format OutputFormat, output io.Writer) error {
+	document := TapeDocument{TapeRecord: tapeRecord(tr, archive), Entries: []EntryRecord{}}
+	for {
+		entry, err := tr.NextEntry()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return repository.NewError(err, "Failed to read tape contents")
+		}
+
+		record := EntryRecord{
+			Kind:  KindEntry,
+			Name:  entry.Name,
+			Type:  entry.Type,
+			Size:  entry.Size,
+			Mode:  fileMode(entry.Mode),
+			MTime: timestamp(entry.ModTime),
+			Link:  entry.Link,
+		}
+		if format == OutputNDJSON {
+			if err = writeRecord(output, format, record); err != nil {
+				return err
+			}
+			continue
+		}
+		document.Entries = append(document.Entries, record)
+	}
+
+	if format == OutputNDJSON {
+		return writeRecord(output, format, document.TapeRecord)
+	}
+	return writeRecord(output, format, document)
+}
+
+// tapeRecord describes a tape that was opened.  The tape is verified only if
+// its trailer's signature was checked.
+func tapeRecord(tr *repository.TapeReader, archive string) TapeRecord {
+	record := TapeRecord{
+		Kind:     KindTape,
+		Archive:  archive,
+		Status:   StatusUnverified,
+		Signers:  tr.Signers(),
+		Metadata: tr.Metadata(),
+	}
+	if tr.Verified() {
+		record.Status = StatusVerified
+		record.Signer = repository.Fingerprint(tr.Key.PublicKey)
+	}
+	return record
 }
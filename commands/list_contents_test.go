@@ -27,3 +27,18 @@ func TestListContents(t *testing.T) {
 		t.Error("Failed to find data files in the listing")
 	}
 }
+
+func TestListContentsKeysFromLabel(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+	packTestRepository(fs)
+
+	outf := new(bytes.Buffer)
+	archive := filepath.Join(repository.HomeDir(), "archive1")
+	ListContents(fs, archive, "foo", "", "", outf)
+
+	if !regexp.MustCompile("data1\\.dat").Match(outf.Bytes()) {
+		t.Error("Failed to find data files in the listing")
+	}
+}
@@ -1,31 +1,39 @@
 package commands
 
 import (
+	"crypto/rsa"
+	"crypto/x509"
 	"fmt"
 	"io"
 	"os"
+	"sort"
 
 	"github.com/darcinc/afero"
 	"github.com/darcinc/repository"
 )
 
-func listKeys(fs afero.Fs, keyfile string, out io.Writer) {
-	filename := repository.NamedKeystoreFile(keyfile)
-	_, err := fs.Stat(filename)
-	if err != nil {
-		fmt.Fprintf(out, "No such repository: %s", keyfile)
-		return
+// ListKeys writes the names of all the keys in the keystore to out.  In
+// JSON the keystore is written as a KeystoreDocument, and in NDJSON as a
+// KeyRecord for each key followed by a KeystoreRecord.
+func ListKeys(fs afero.Fs, keyfile string, format OutputFormat, out io.Writer) error {
+	keys, err := loadKeystore(fs, keyfile)
+	if os.IsNotExist(err) {
+		return repository.NewError(err, fmt.Sprintf("No such repository: %s", keyfile))
 	}
-
-	file, err := fs.Open(filename)
 	if err != nil {
-		panic(err)
+		return err
 	}
-	defer file.Close()
 
-	keys, err := repository.OpenKeystore(file)
-	if err != nil {
-		panic(err)
+	switch format {
+	case OutputJSON:
+		return writeRecord(out, format, KeystoreDocument{KeystoreRecord: KeystoreRecord{Kind: KindKeystore, Keystore: keyfile}, Keys: keyRecords(keys)})
+	case OutputNDJSON:
+		for _, record := range keyRecords(keys) {
+			if err = writeRecord(out, format, record); err != nil {
+				return err
+			}
+		}
+		return writeRecord(out, format, KeystoreRecord{Kind: KindKeystore, Keystore: keyfile})
 	}
 
 	fmt.Fprintf(out, "Private Keys:\n")
@@ -37,9 +45,74 @@ func listKeys(fs afero.Fs, keyfile string, out io.Writer) {
 	for k := range keys.PublicKeys {
 		fmt.Fprintf(out, "  %s\n", k)
 	}
+
+	if len(keys.HybridKeys) > 0 || len(keys.HybridPublicKeys) > 0 {
+		fmt.Fprintf(out, "Hybrid Keys (%s):\n", repository.HybridKeyType)
+		for k := range keys.HybridKeys {
+			fmt.Fprintf(out, "  %s (private)\n", k)
+		}
+		for k := range keys.HybridPublicKeys {
+			fmt.Fprintf(out, "  %s\n", k)
+		}
+	}
+
+	if len(keys.Escrow) > 0 {
+		fmt.Fprintf(out, "Escrow Keys (added to every tape):\n")
+		for _, k := range keys.Escrow {
+			fmt.Fprintf(out, "  %s\n", k)
+		}
+	}
+	return nil
 }
 
-// ListKeys prints all the key names
-func ListKeys(fs afero.Fs, keyfile string) {
-	listKeys(fs, keyfile, os.Stdout)
+// keyRecords describes the private, public, hybrid private and hybrid
+// public keys in the keystore, each sorted by name.
+func keyRecords(keys *repository.Keystore) []KeyRecord {
+	escrow := map[string]bool{}
+	for _, name := range keys.Escrow {
+		escrow[name] = true
+	}
+	result := []KeyRecord{}
+	add := func(stored map[string][]byte, keyType, algorithm string, describe func([]byte, *KeyRecord)) {
+		names := make([]string, 0, len(stored))
+		for name := range stored {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			record := KeyRecord{Kind: KindKey, Name: name, Type: keyType, Algorithm: algorithm, Escrow: escrow[name]}
+			if created, ok := keys.KeyCreated(name); ok {
+				record.Created = timestamp(created)
+			}
+			describe(stored[name], &record)
+			result = append(result, record)
+		}
+	}
+
+	add(keys.PrivateKeys, "private", "rsa", func(data []byte, record *KeyRecord) {
+		if key, err := x509.ParsePKCS1PrivateKey(data); err == nil {
+			record.Bits = key.N.BitLen()
+			record.Fingerprint = repository.Fingerprint(&key.PublicKey)
+		}
+	})
+	add(keys.PublicKeys, "public", "rsa", func(data []byte, record *KeyRecord) {
+		if parsed, err := x509.ParsePKIXPublicKey(data); err == nil {
+			if key, ok := parsed.(*rsa.PublicKey); ok {
+				record.Bits = key.N.BitLen()
+				record.Fingerprint = repository.Fingerprint(key)
+			}
+		}
+	})
+	add(keys.HybridKeys, "private", repository.HybridKeyType, func(data []byte, record *KeyRecord) {
+		if key, err := repository.ParseHybridPrivateKey(data); err == nil {
+			record.Fingerprint = repository.HybridFingerprint(key.Public())
+		}
+	})
+	add(keys.HybridPublicKeys, "public", repository.HybridKeyType, func(data []byte, record *KeyRecord) {
+		if key, err := repository.ParseHybridPublicKey(data); err == nil {
+			record.Fingerprint = repository.HybridFingerprint(key)
+		}
+	})
+	return result
 }
@@ -25,20 +25,20 @@ func addTestKeys(fs afero.Fs, t *testing.T) {
 	}
 	file.Close()
 
-	priv1, err := rsa.GenerateKey(rand.Reader, 1024)
+	priv1, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	keys.AddPrivateKey("test1", priv1)
-	priv2, err := rsa.GenerateKey(rand.Reader, 1024)
+	priv2, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	keys.AddPublicKey("test2", &priv2.PublicKey)
 
-	priv3, err := rsa.GenerateKey(rand.Reader, 1024)
+	priv3, err := rsa.GenerateKey(rand.Reader, 2048)
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -62,7 +62,7 @@ func TestListKeys(t *testing.T) {
 	addTestKeys(fs, t)
 	bf := new(bytes.Buffer)
 
-	listKeys(fs, "foo", bf)
+	ListKeys(fs, "foo", OutputText, bf)
 	re1 := regexp.MustCompile("test1")
 	re2 := regexp.MustCompile("test2")
 
@@ -79,11 +79,11 @@ func TestListKeysNoKeystore(t *testing.T) {
 	fs := createFSWithKeystore(t)
 	bf := new(bytes.Buffer)
 
-	listKeys(fs, "bar", bf)
+	err := ListKeys(fs, "bar", OutputText, bf)
 
 	re1 := regexp.MustCompile("No such repo.*bar")
 
-	if !re1.Match(bf.Bytes()) {
-		t.Error("No not found message")
+	if err == nil || !re1.MatchString(err.Error()) || ExitCode(err) != ExitNotFound {
+		t.Errorf("No not found error: %v", err)
 	}
 }
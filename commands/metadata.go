@@ -0,0 +1,79 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"os/user"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/darcinc/repository"
+)
+
+// newMetadata describes a tape made now by the current user on this host.
+// fields holds one key=value pair per line.
+func newMetadata(description, fields string) (*repository.Metadata, error) {
+	result := &repository.Metadata{Created: time.Now().UTC(), Description: description, Tool: toolVersion()}
+	if current, err := user.Current(); err == nil {
+		result.Creator = current.Username
+	} else {
+		result.Creator = os.Getenv("USER")
+	}
+	result.Hostname, _ = os.Hostname()
+
+	for _, field := range strings.Split(fields, "\n") {
+		if field == "" {
+			continue
+		}
+		parts := strings.SplitN(field, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("Metadata field %q is not key=value", field)
+		}
+		if result.Fields == nil {
+			result.Fields = map[string]string{}
+		}
+		result.Fields[parts[0]] = parts[1]
+	}
+	return result, nil
+}
+
+// toolVersion names the program writing the tape and the version of the
+// module it was built from.
+func toolVersion() string {
+	name := "repository"
+	if len(os.Args) > 0 {
+		name = os.Args[0][strings.LastIndexAny(os.Args[0], `/\`)+1:]
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" {
+		return name + " " + info.Main.Version
+	}
+	return name
+}
+
+// printMetadata writes the tape's metadata, if it has any, to output.
+func printMetadata(metadata *repository.Metadata, output io.Writer) {
+	if metadata == nil {
+		return
+	}
+
+	fmt.Fprintf(output, "Creator: %s\n", metadata.Creator)
+	fmt.Fprintf(output, "Created: %s\n", metadata.Created.Format(time.RFC3339))
+	fmt.Fprintf(output, "Host: %s\n", metadata.Hostname)
+	fmt.Fprintf(output, "Tool: %s\n", metadata.Tool)
+	if metadata.Description != "" {
+		fmt.Fprintf(output, "Description: %s\n", metadata.Description)
+	}
+
+	keys := []string{}
+	for key := range metadata.Fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(output, "%s=%s\n", key, metadata.Fields[key])
+	}
+	fmt.Fprintln(output)
+}
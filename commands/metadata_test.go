@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/darcinc/repository"
+)
+
+func TestListMetadata(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+
+	home := repository.HomeDir()
+	archive := filepath.Join(home, "archive1")
+	PackRepository(fs, map[string]string{
+		"archive":     archive,
+		"files":       filepath.Join(home, "data1.dat"),
+		"keystore":    "foo",
+		"pubkey":      "test1",
+		"privkey":     "test3",
+		"description": "Nightly export",
+		"meta":        "job=nightly\nticket=OPS-12",
+	})
+
+	out := new(bytes.Buffer)
+	ListContents(fs, archive, "foo", "test1", "test3", out)
+	for _, expected := range []string{"Description: Nightly export", "job=nightly", "ticket=OPS-12", "Created: ", "data1\\.dat"} {
+		if !regexp.MustCompile(expected).Match(out.Bytes()) {
+			t.Errorf("Expected %q in the listing: %s", expected, out.String())
+		}
+	}
+}
+
+func TestNewMetadata(t *testing.T) {
+	metadata, err := newMetadata("", "a=1\nb=x=y")
+	if err != nil {
+		t.Fatalf("Unable to parse metadata fields: %v", err)
+	}
+	if metadata.Fields["a"] != "1" || metadata.Fields["b"] != "x=y" {
+		t.Errorf("Wrong metadata fields %v", metadata.Fields)
+	}
+	if metadata.Tool == "" || metadata.Created.IsZero() {
+		t.Errorf("Metadata should record the tool and time: %+v", metadata)
+	}
+
+	if _, err = newMetadata("", "novalue"); err == nil {
+		t.Error("Should not accept a field without a value")
+	}
+}
@@ -0,0 +1,208 @@
+package commands
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/darcinc/repository"
+)
+
+// OutputFormat is how a command writes what it found: as text for people,
+// or as records for programs.  OutputJSON writes one JSON document and
+// OutputNDJSON one record per line, each written as soon as it is found.
+// The records are described in the README, and fields are only ever added
+// to them.
+type OutputFormat string
+
+// The output formats, see OutputFormat.
+const (
+	OutputText   OutputFormat = "text"
+	OutputJSON   OutputFormat = "json"
+	OutputNDJSON OutputFormat = "ndjson"
+)
+
+// ParseOutputFormat returns the output format with the name, OutputText if
+// the name is empty.
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	switch format := OutputFormat(name); format {
+	case "":
+		return OutputText, nil
+	case OutputText, OutputJSON, OutputNDJSON:
+		return format, nil
+	}
+	return "", &UsageError{Message: fmt.Sprintf("Unsupported output %q, use text, json or ndjson", name)}
+}
+
+// The kind of each record, so NDJSON readers can tell them apart.
+const (
+	KindKey        = "key"
+	KindKeystore   = "keystore"
+	KindEntry      = "entry"
+	KindTape       = "tape"
+	KindInspection = "inspection"
+)
+
+// The verification status of a tape or manifest entry.  StatusVerified
+// tapes had their trailer's signature checked, StatusUnverified tapes were
+// read without checking it, and StatusCorrupt tapes could not be read to the
+// end.
+const (
+	StatusVerified   = "verified"
+	StatusUnverified = "unverified"
+	StatusCorrupt    = "corrupt"
+)
+
+// KeyRecord describes a key in a keystore.  Type is private or public, and
+// Algorithm rsa or mlkem768-x25519.  Bits is the size of an RSA key.
+// Fingerprint is empty if the key cannot be parsed.
+type KeyRecord struct {
+	Kind        string     `json:"kind"`
+	Name        string     `json:"name"`
+	Type        string     `json:"type"`
+	Algorithm   string     `json:"algorithm"`
+	Bits        int        `json:"bits,omitempty"`
+	Fingerprint string     `json:"fingerprint"`
+	Created     *time.Time `json:"created,omitempty"`
+	Escrow      bool       `json:"escrow"`
+}
+
+// KeystoreRecord describes a keystore.  In JSON it holds the keys; in
+// NDJSON it follows them.
+type KeystoreRecord struct {
+	Kind     string `json:"kind"`
+	Keystore string `json:"keystore"`
+}
+
+// EntryRecord describes a file listed on a tape, or in the verified
+// manifest of a sign-only tape.  Listed files have their Type, file, dir,
+// symlink, link or other, their permission bits as an octal Mode, their
+// modification time and the target of a link.  Manifest entries have the
+// Digest of their contents made with the hash Algorithm, and are verified.
+type EntryRecord struct {
+	Kind      string     `json:"kind"`
+	Name      string     `json:"name"`
+	Type      string     `json:"type,omitempty"`
+	Size      int64      `json:"size"`
+	Mode      string     `json:"mode,omitempty"`
+	MTime     *time.Time `json:"mtime,omitempty"`
+	Link      string     `json:"link,omitempty"`
+	Digest    string     `json:"digest,omitempty"`
+	Algorithm string     `json:"algorithm,omitempty"`
+	Status    string     `json:"status,omitempty"`
+}
+
+// TapeRecord describes a tape that was listed or verified.  Status is
+// verified when the signature on the tape's trailer was checked, and Signer
+// is the fingerprint of the key that checked it.  Algorithm is the hash algorithm
+// of a verified sign-only tape.  Signers names the keys that signed or
+// co-signed the tape, when they were required.  In JSON it holds the
+// entries; in NDJSON it follows them.
+type TapeRecord struct {
+	Kind      string               `json:"kind"`
+	Archive   string               `json:"archive"`
+	Status    string               `json:"status"`
+	Signer    string               `json:"signer,omitempty"`
+	Algorithm string               `json:"algorithm,omitempty"`
+	Signers   []string             `json:"signers,omitempty"`
+	Metadata  *repository.Metadata `json:"metadata,omitempty"`
+}
+
+// InspectRecord describes the structure of a tape or detached label as far
+// as it can be read without any key.  Status is unverified, as no signature
+// is checked, or corrupt with the Error that stopped the tape being read.
+// Labels written before versioning only have a Version.  Times are in UTC
+// and sizes in bytes.
+type InspectRecord struct {
+	Kind        string             `json:"kind"`
+	Archive     string             `json:"archive"`
+	Status      string             `json:"status"`
+	Error       string             `json:"error,omitempty"`
+	Version     int                `json:"version"`
+	Mode        string             `json:"mode,omitempty"`
+	Cipher      string             `json:"cipher,omitempty"`
+	Hash        string             `json:"hash,omitempty"`
+	Compression string             `json:"compression,omitempty"`
+	Signing     string             `json:"signing,omitempty"`
+	Sender      *KeyReference      `json:"sender,omitempty"`
+	Threshold   int                `json:"threshold,omitempty"`
+	Recipients  []SlotRecord       `json:"recipients,omitempty"`
+	Escrow      []SlotRecord       `json:"escrow,omitempty"`
+	Signatures  []SignatureRecord  `json:"signatures,omitempty"`
+	NotBefore   *time.Time         `json:"notBefore,omitempty"`
+	NotAfter    *time.Time         `json:"notAfter,omitempty"`
+	Stream      *repository.Stream `json:"stream,omitempty"`
+	Metadata    bool               `json:"metadata"`
+	LabelSize   int64              `json:"labelSize"`
+	PayloadSize int64              `json:"payloadSize"`
+	Trailer     *TrailerRecord     `json:"trailer,omitempty"`
+}
+
+// KeyReference is the fingerprint of a key in a label, with its name if it
+// is in the keystore.
+type KeyReference struct {
+	Fingerprint string `json:"fingerprint"`
+	Name        string `json:"name,omitempty"`
+}
+
+// SlotRecord describes how the tape key is wrapped for a recipient or escrow
+// key.  Bits is the size of an RSA key, and Prekey the prekey used.
+type SlotRecord struct {
+	KeyReference
+	Wrapping string `json:"wrapping"`
+	Bits     int    `json:"bits,omitempty"`
+	Prekey   string `json:"prekey,omitempty"`
+}
+
+// SignatureRecord describes a signature in a label, made by the sender or
+// by a co-signer.  It is not checked.
+type SignatureRecord struct {
+	KeyReference
+	Sender bool `json:"sender"`
+	Bits   int  `json:"bits"`
+}
+
+// TrailerRecord describes the signed trailer of a sign-only tape.
+type TrailerRecord struct {
+	KeyReference
+	Bits     int  `json:"bits"`
+	Manifest bool `json:"manifest"`
+}
+
+// KeystoreDocument is the JSON output of listing a keystore.
+type KeystoreDocument struct {
+	KeystoreRecord
+	Keys []KeyRecord `json:"keys"`
+}
+
+// TapeDocument is the JSON output of listing or verifying a tape.
+type TapeDocument struct {
+	TapeRecord
+	Entries []EntryRecord `json:"entries"`
+}
+
+// writeRecord writes a record on one line for NDJSON, or as an indented
+// document for JSON.
+func writeRecord(out io.Writer, format OutputFormat, record interface{}) error {
+	encoder := json.NewEncoder(out)
+	if format == OutputJSON {
+		encoder.SetIndent("", "  ")
+	}
+	return encoder.Encode(record)
+}
+
+// fileMode returns the permission bits of a file mode in octal.
+func fileMode(mode os.FileMode) string {
+	return fmt.Sprintf("%04o", mode.Perm())
+}
+
+// timestamp returns a pointer to the time, or nil for the zero time.
+func timestamp(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	t = t.UTC()
+	return &t
+}
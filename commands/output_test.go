@@ -0,0 +1,191 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+// readRecords decodes each line of NDJSON output, failing the test if any
+// line is not a JSON object.
+func readRecords(t *testing.T, out *bytes.Buffer) []map[string]interface{} {
+	t.Helper()
+	var records []map[string]interface{}
+	scanner := bufio.NewScanner(out)
+	for scanner.Scan() {
+		record := map[string]interface{}{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("Line is not a JSON record: %q: %v", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestParseOutputFormat(t *testing.T) {
+	for name, expected := range map[string]OutputFormat{"": OutputText, "text": OutputText, "json": OutputJSON, "ndjson": OutputNDJSON} {
+		if format, err := ParseOutputFormat(name); err != nil || format != expected {
+			t.Errorf("Expected %q to be %s but got %s %v", name, expected, format, err)
+		}
+	}
+	if _, err := ParseOutputFormat("yaml"); ExitCode(err) != ExitUsage {
+		t.Errorf("Expected a usage error for an unknown output but got %v", err)
+	}
+}
+
+func TestListKeysOutput(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+
+	out := new(bytes.Buffer)
+	if err := ListKeys(fs, "foo", OutputJSON, out); err != nil {
+		t.Fatalf("Unable to list keys: %v", err)
+	}
+	var document KeystoreDocument
+	if err := json.Unmarshal(out.Bytes(), &document); err != nil {
+		t.Fatalf("Keys not listed as a JSON document: %v", err)
+	}
+	if document.Kind != KindKeystore || len(document.Keys) != 3 {
+		t.Fatalf("Expected the keystore with three keys but got %+v", document)
+	}
+	key := document.Keys[0]
+	if key.Kind != KindKey || key.Name != "test1" || key.Type != "private" || key.Algorithm != "rsa" || key.Bits != 2048 || len(key.Fingerprint) != 64 {
+		t.Errorf("Wrong record for test1: %+v", key)
+	}
+
+	out.Reset()
+	if err := ListKeys(fs, "foo", OutputNDJSON, out); err != nil {
+		t.Fatalf("Unable to list keys: %v", err)
+	}
+	records := readRecords(t, out)
+	if len(records) != 4 || records[0]["kind"] != KindKey || records[3]["kind"] != KindKeystore {
+		t.Errorf("Expected three key records and the keystore but got %v", records)
+	}
+}
+
+func TestListContentsOutput(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+	packTestRepository(fs)
+	archive := filepath.Join(repository.HomeDir(), "archive1")
+
+	out := new(bytes.Buffer)
+	if _, err := ListContentsWithOptions(fs, archive, "foo", "", "", OpenOptions{}, OutputNDJSON, out); err != nil {
+		t.Fatalf("Unable to list tape: %v", err)
+	}
+	records := readRecords(t, out)
+	if len(records) < 2 {
+		t.Fatalf("Expected entries and the tape but got %v", records)
+	}
+	entry, tape := records[0], records[len(records)-1]
+	if entry["kind"] != KindEntry || entry["type"] != "file" || entry["mode"] == nil || entry["mtime"] == nil || entry["size"] == nil {
+		t.Errorf("Wrong entry record: %v", entry)
+	}
+	if tape["kind"] != KindTape || tape["archive"] != archive || tape["status"] != StatusVerified || tape["signer"] == "" {
+		t.Errorf("Wrong tape record: %v", tape)
+	}
+
+	out.Reset()
+	if _, err := ListContentsWithOptions(fs, archive, "foo", "", "", OpenOptions{}, OutputJSON, out); err != nil {
+		t.Fatalf("Unable to list tape: %v", err)
+	}
+	var document TapeDocument
+	if err := json.Unmarshal(out.Bytes(), &document); err != nil {
+		t.Fatalf("Tape not listed as a JSON document: %v", err)
+	}
+	if len(document.Entries) != len(records)-1 || document.Metadata == nil {
+		t.Errorf("Expected the entries and metadata in the document but got %+v", document)
+	}
+
+	// Without its trailer the tape can only be listed unverified.
+	data, _ := afero.ReadFile(fs, archive)
+	info, err := repository.InspectTape(bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unable to inspect archive: %v", err)
+	}
+	afero.WriteFile(fs, archive, data[:info.LabelSize+info.PayloadSize], 0600)
+	out.Reset()
+	if _, err = ListContentsWithOptions(fs, archive, "foo", "", "", OpenOptions{Unverified: true}, OutputNDJSON, out); err != nil {
+		t.Fatalf("Unable to list unverified tape: %v", err)
+	}
+	records = readRecords(t, out)
+	if tape = records[len(records)-1]; tape["status"] != StatusUnverified || tape["signer"] != nil {
+		t.Errorf("Expected an unverified tape record but got %v", tape)
+	}
+}
+
+func TestVerifyTapeOutput(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+
+	home := repository.HomeDir()
+	archive := filepath.Join(home, "archive1")
+	PackRepository(fs, map[string]string{
+		"archive":   archive,
+		"files":     filepath.Join(home, "data1.dat"),
+		"keystore":  "foo",
+		"privkey":   "test3",
+		"sign-only": "true",
+	})
+
+	out := new(bytes.Buffer)
+	if _, err := VerifyTape(fs, archive, "foo", "", OutputJSON, out); err != nil {
+		t.Fatalf("Unable to verify sign-only tape: %v", err)
+	}
+	var document TapeDocument
+	if err := json.Unmarshal(out.Bytes(), &document); err != nil {
+		t.Fatalf("Manifest not written as a JSON document: %v", err)
+	}
+	if document.Status != StatusVerified || document.Algorithm != repository.DefaultHash || len(document.Entries) != 1 {
+		t.Fatalf("Wrong verified tape: %+v", document)
+	}
+	if entry := document.Entries[0]; entry.Status != StatusVerified || entry.Digest == "" || entry.Algorithm != repository.DefaultHash {
+		t.Errorf("Wrong manifest entry: %+v", entry)
+	}
+}
+
+func TestInspectTapeOutput(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+	packTestRepository(fs)
+	archive := filepath.Join(repository.HomeDir(), "archive1")
+
+	out := new(bytes.Buffer)
+	if _, err := InspectTape(fs, archive, "foo", OutputJSON, out); err != nil {
+		t.Fatalf("Unable to inspect tape: %v", err)
+	}
+	var record InspectRecord
+	if err := json.Unmarshal(out.Bytes(), &record); err != nil {
+		t.Fatalf("Inspection not written as JSON: %v", err)
+	}
+	if record.Kind != KindInspection || record.Status != StatusUnverified || record.Version != 2 || record.Mode != "rsa" {
+		t.Errorf("Wrong inspection: %+v", record)
+	}
+	if record.Sender == nil || record.Sender.Name != "test3" || len(record.Recipients) != 1 || record.Recipients[0].Name != "test1" || record.Recipients[0].Bits != 2048 {
+		t.Errorf("Wrong keys in the inspection: %+v", record)
+	}
+	if record.Trailer == nil || !record.Metadata {
+		t.Errorf("Expected a trailer and metadata: %+v", record)
+	}
+
+	tape, err := afero.ReadFile(fs, archive)
+	if err != nil {
+		t.Fatalf("Unable to read archive: %v", err)
+	}
+	afero.WriteFile(fs, archive, tape[:record.LabelSize-10], 0600)
+	out.Reset()
+	if _, err := InspectTape(fs, archive, "foo", OutputNDJSON, out); err == nil {
+		t.Error("Should not inspect a truncated tape")
+	}
+	if records := readRecords(t, out); len(records) != 1 || records[0]["status"] != StatusCorrupt || records[0]["error"] == "" {
+		t.Errorf("Expected a corrupt record but got %v", records)
+	}
+}
@@ -1,45 +1,228 @@
 package commands
 
 import (
-	"log"
+	"fmt"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/darcinc/afero"
 	"github.com/darcinc/repository"
 )
 
-// PackRepository packages a repository
-func PackRepository(fs afero.Fs, args map[string]string) {
-	parts := strings.Split(args["files"], ",")
-	if len(parts) == 1 && parts[0] == "" && args["directory"] == "" {
-		panic("At least one file or directory must be specified when creating a repository")
+// PackOptions are the settings for packing a repository, see
+// PackRepository for what each does.
+type PackOptions struct {
+	Archive        string
+	Files          []string
+	Directory      string
+	Keystore       string
+	PrivKey        string
+	PubKey         string
+	Recipients     []string
+	Prekey         string
+	Custodians     []string
+	Threshold      int
+	PassphraseFile string
+	SignOnly       bool
+	NotBefore      time.Time
+	NotAfter       time.Time
+	Stream         string
+	StateFile      string
+	Description    string
+	Meta           string
+	Hash           string
+	Compression    string
+}
+
+// splitList splits a comma separated list, which may be empty.
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
+
+// packOptions reads the packing settings from the argument map, see
+// PackRepository.
+func packOptions(args map[string]string, now time.Time) (PackOptions, error) {
+	result := PackOptions{
+		Archive:        args["archive"],
+		Files:          splitList(args["files"]),
+		Directory:      args["directory"],
+		Keystore:       args["keystore"],
+		PrivKey:        args["privkey"],
+		PubKey:         args["pubkey"],
+		Recipients:     splitList(args["recipients"]),
+		Prekey:         args["prekey"],
+		Custodians:     splitList(args["custodians"]),
+		PassphraseFile: args["passphrase-file"],
+		SignOnly:       args["sign-only"] == "true",
+		Stream:         args["stream"],
+		StateFile:      args["state"],
+		Description:    args["description"],
+		Meta:           args["meta"],
+		Hash:           args["hash"],
+		Compression:    args["compression"],
+	}
+
+	var err error
+	if result.NotBefore, err = parseWindowTime(args["not-before"], now); err != nil {
+		return result, &UsageError{Message: fmt.Sprintf("Invalid not-before time %q: %v", args["not-before"], err)}
+	}
+	if result.NotAfter, err = parseWindowTime(args["expires"], now); err != nil {
+		return result, &UsageError{Message: fmt.Sprintf("Invalid expiry time %q: %v", args["expires"], err)}
+	}
+	if len(result.Custodians) > 0 {
+		if result.Threshold, err = strconv.Atoi(args["threshold"]); err != nil {
+			return result, &UsageError{Message: fmt.Sprintf("Invalid threshold %q: %v", args["threshold"], err)}
+		}
+	}
+	return result, nil
+}
+
+// tapeOptions returns the repository options for the tape, finding the
+// additional recipients' keys in the keystore.
+func (o PackOptions) tapeOptions(fs afero.Fs) ([]repository.TapeOption, error) {
+	metadata, err := newMetadata(o.Description, o.Meta)
+	if err != nil {
+		return nil, &UsageError{Message: fmt.Sprintf("Invalid metadata: %v", err)}
+	}
+	result := []repository.TapeOption{repository.WithMetadata(metadata)}
+	if o.Hash != "" {
+		result = append(result, repository.WithHash(o.Hash))
+	}
+	if o.Compression != "" {
+		result = append(result, repository.WithCompression(o.Compression))
+	}
+
+	if len(o.Recipients) > 0 {
+		recipients, err := readPublicKeys(fs, o.Keystore, o.Recipients)
+		if err != nil {
+			return nil, repository.NewError(err, "Failed to find recipient keys")
+		}
+		result = append(result, repository.WithRecipients(recipients...))
+	}
+	return result, nil
+}
+
+// PackRepository packages a repository.  When args["prekey"] names a
+// prekey published by the recipient the tape is forward secret.  When
+// args["custodians"] lists key names the tape key is split among them
+// instead, and args["threshold"] of them are needed to open the tape.
+// When args["passphrase-file"] names a file the tape key is wrapped under
+// its passphrase, and the label is only signed if args["privkey"] is set.
+// When args["sign-only"] is "true" the tape is not encrypted but signed as a
+// whole, and no public key is needed.  args["recipients"] lists the names
+// of further RSA keys the tape key is wrapped for.  args["not-before"] and
+// args["expires"] bound when the tape may be opened, each either a time in
+// RFC 3339 format or a duration from now such as 720h.  When args["stream"]
+// names a stream, the tape is numbered and chained to the last tape in the
+// stream, which is kept in the state file args["state"].  The tape's
+// metadata records who packed it, when and where, with args["description"]
+// and the key=value lines of args["meta"].  args["hash"] names the hash
+// algorithm the tape is signed with, see repository.HashAlgorithms, and
+// args["compression"] how the archive is compressed.
+func PackRepository(fs afero.Fs, args map[string]string) error {
+	opts, err := packOptions(args, time.Now())
+	if err != nil {
+		return err
+	}
+	return PackRepositoryWithOptions(fs, opts)
+}
+
+// PackRepositoryWithOptions packages a repository like PackRepository, with
+// the settings already read from the arguments.
+func PackRepositoryWithOptions(fs afero.Fs, opts PackOptions) error {
+	if len(opts.Files) == 0 && opts.Directory == "" {
+		return &UsageError{Message: "At least one file or directory must be specified when creating a repository"}
 	}
 
-	privateKey, publicKey, err := readKeysFromKeystore(fs, args["keystore"], args["privkey"], args["pubkey"])
+	var key repository.Key
+	var done func()
+	var err error
+	if opts.PassphraseFile != "" {
+		key, done, err = readPassphraseKey(fs, opts.Keystore, opts.PrivKey, opts.PassphraseFile)
+	} else {
+		key, done, err = readKeysFromKeystore(fs, opts.Keystore, opts.PrivKey, opts.PubKey)
+	}
 	if err != nil {
-		log.Fatalf("Failed to find privte or public key: %v", err)
+		return repository.NewError(err, "Failed to find private or public key")
 	}
+	defer done()
+	key.SignOnly = opts.SignOnly
+	key.NotBefore = opts.NotBefore
+	key.NotAfter = opts.NotAfter
+	key.Threshold = opts.Threshold
 
-	file, err := fs.OpenFile(args["archive"], os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	tapeOptions, err := opts.tapeOptions(fs)
 	if err != nil {
-		log.Fatalf("Failed to open archive %s: %v", args["archive"], err)
+		return err
+	}
+
+	var streams *repository.StreamState
+	if opts.Stream != "" {
+		if streams, err = loadStreamState(fs, opts.StateFile); err != nil {
+			return repository.NewError(err, fmt.Sprintf("Failed to read stream state %s", opts.StateFile))
+		}
+		key.Stream = streams.Next(opts.Stream)
+	}
+
+	if len(opts.Custodians) > 0 {
+		if key.Custodians, err = readPublicKeys(fs, opts.Keystore, opts.Custodians); err != nil {
+			return repository.NewError(err, "Failed to find custodian keys")
+		}
+	}
+
+	if opts.Prekey != "" {
+		if key.Prekey, err = readPrekey(fs, opts.Prekey); err != nil {
+			return repository.NewError(err, fmt.Sprintf("Failed to read prekey %s", opts.Prekey))
+		}
+	}
+
+	file, err := fs.OpenFile(opts.Archive, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return repository.NewError(err, fmt.Sprintf("Failed to open archive %s", opts.Archive))
 	}
 	defer file.Close()
 
-	key := repository.Key{PublicKey: publicKey, PrivateKey: privateKey}
-	repo, err := repository.NewTapeWriter(key, file)
+	repo, err := repository.NewTapeWriterWithOptions(key, file, tapeOptions...)
 	if err != nil {
-		log.Fatalf("Failed to create repository %s: %v", args["archive"], err)
+		return repository.NewError(err, fmt.Sprintf("Failed to create repository %s", opts.Archive))
 	}
 
-	if len(parts) >= 1 && parts[0] != "" {
-		for _, filepath := range parts {
+	if len(opts.Files) > 0 {
+		for _, filepath := range opts.Files {
 			if err = repo.AddFile(fs, filepath); err != nil {
-				log.Printf("Failed to add file %s to repository: %v", filepath, err)
+				return repository.NewError(err, fmt.Sprintf("Failed to add file %s to repository", filepath))
 			}
 		}
-	} else {
-		repo.AddDirectory(fs, args["directory"])
+	} else if err = repo.AddDirectory(fs, opts.Directory); err != nil {
+		return repository.NewError(err, fmt.Sprintf("Failed to add directory %s to repository", opts.Directory))
+	}
+
+	if err = repo.Close(); err != nil {
+		return repository.NewError(err, fmt.Sprintf("Failed to finish repository %s", opts.Archive))
+	}
+
+	if streams != nil {
+		streams.Sent(&repo.Key.Label)
+		if err = saveStreamState(fs, opts.StateFile, streams); err != nil {
+			return repository.NewError(err, fmt.Sprintf("Failed to save stream state %s", opts.StateFile))
+		}
+	}
+	return nil
+}
+
+// parseWindowTime parses a time in RFC 3339 format or a duration from now.
+// An empty value is the zero time.
+func parseWindowTime(value string, now time.Time) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if duration, err := time.ParseDuration(value); err == nil {
+		return now.Add(duration), nil
 	}
+	return time.Parse(time.RFC3339, value)
 }
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/darcinc/afero"
 	"github.com/darcinc/repository"
@@ -44,11 +45,17 @@ func packTestRepository(fs afero.Fs) {
 	args["privkey"] = "test3"
 	args["directory"] = ""
 
-	PackRepository(fs, args)
+	if err := PackRepository(fs, args); err != nil {
+		panic(err)
+	}
 }
 
+// directoryArchive is outside the directory packed, so the archive is not
+// packed into itself.
+var directoryArchive = filepath.Join(filepath.Dir(repository.HomeDir()), "archive1")
+
 func packTestRepositoryDirectory(fs afero.Fs) {
-	archive := filepath.Join(repository.HomeDir(), "archive1")
+	archive := directoryArchive
 
 	args := make(map[string]string)
 	args["archive"] = archive
@@ -58,7 +65,9 @@ func packTestRepositoryDirectory(fs afero.Fs) {
 	args["privkey"] = "test3"
 	args["files"] = ""
 
-	PackRepository(fs, args)
+	if err := PackRepository(fs, args); err != nil {
+		panic(err)
+	}
 }
 
 func TestPackFilesRepository(t *testing.T) {
@@ -98,7 +107,7 @@ func TestPackDirectoryRepository(t *testing.T) {
 	createTestData(fs)
 	packTestRepositoryDirectory(fs)
 
-	archive := filepath.Join(repository.HomeDir(), "archive1")
+	archive := directoryArchive
 
 	if fileinfo, err := fs.Stat(archive); err != nil {
 		t.Errorf("Failed to find archive: %v", err)
@@ -138,10 +147,64 @@ func TestNoFilesNoDir(t *testing.T) {
 	args["privkey"] = "test3"
 	args["files"] = ""
 
-	defer func() {
-		recover()
-	}()
+	if err := PackRepository(fs, args); ExitCode(err) != ExitUsage {
+		t.Errorf("Should not allow packing without files or directory, got %v", err)
+	}
+}
 
-	PackRepository(fs, args)
-	t.Error("Should not allow packing without files or directory")
+func TestParseWindowTime(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	if when, err := parseWindowTime("24h", now); err != nil || !when.Equal(now.Add(24*time.Hour)) {
+		t.Errorf("Wrong time for a duration: %v %v", when, err)
+	}
+	if when, err := parseWindowTime("2024-06-01T12:00:00Z", now); err != nil || when.Month() != time.June {
+		t.Errorf("Wrong time for a timestamp: %v %v", when, err)
+	}
+	if when, err := parseWindowTime("", now); err != nil || !when.IsZero() {
+		t.Errorf("An empty time should be zero: %v %v", when, err)
+	}
+	if _, err := parseWindowTime("tomorrow", now); err == nil {
+		t.Error("Should not parse an invalid time")
+	}
+}
+
+func TestPackOptions(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	args := map[string]string{"archive": "a.tape", "files": "x,y", "recipients": "test2", "custodians": "c1,c2", "threshold": "2", "expires": "24h", "compression": "gzip"}
+	opts, err := packOptions(args, now)
+	if err != nil {
+		t.Fatalf("Unable to read pack options: %v", err)
+	}
+	if len(opts.Files) != 2 || len(opts.Recipients) != 1 || opts.Threshold != 2 || !opts.NotAfter.Equal(now.Add(24*time.Hour)) || opts.Compression != "gzip" {
+		t.Errorf("Wrong pack options %+v", opts)
+	}
+
+	args["threshold"] = "two"
+	if _, err = packOptions(args, now); err == nil {
+		t.Error("Should not read an invalid threshold")
+	}
+}
+
+func TestPackCompressedForRecipients(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+
+	home := repository.HomeDir()
+	archive := filepath.Join(home, "archive1")
+	PackRepository(fs, map[string]string{"archive": archive, "files": filepath.Join(home, "data1.dat"), "keystore": "foo", "pubkey": "test1", "privkey": "test3", "recipients": "test3", "compression": "gzip"})
+
+	file, err := fs.Open(archive)
+	if err != nil {
+		t.Fatalf("Unable to open archive: %v", err)
+	}
+	defer file.Close()
+	tr, done, err := openTape(fs, "foo", "test3", "test3", file, OpenOptions{})
+	if err != nil {
+		t.Fatalf("The additional recipient should open the tape: %v", err)
+	}
+	defer done()
+	if contents, err := tr.Contents(); err != nil || len(contents) != 1 {
+		t.Errorf("Expected one file on the compressed tape but got %v: %v", contents, err)
+	}
 }
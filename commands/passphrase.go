@@ -0,0 +1,128 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+// readPassphraseKey returns a key for packing a passphrase tape.  The label
+// is signed with the named private key, or left unsigned if there is no key
+// name.  The keystore's policy and escrow keys are used when it can be
+// opened.
+func readPassphraseKey(fs afero.Fs, keystoreName, privKeyName, passphraseFile string) (repository.Key, func(), error) {
+	passphrase, err := ReadPassphrase(fs, passphraseFile)
+	if err != nil {
+		return repository.Key{}, nil, err
+	}
+	if len(passphrase) == 0 {
+		return repository.Key{}, nil, fmt.Errorf("Passphrase file %s is empty", passphraseFile)
+	}
+
+	if privKeyName != "" {
+		key, done, err := readKeysFromKeystore(fs, keystoreName, privKeyName, "")
+		key.Passphrase = passphrase
+		return key, done, err
+	}
+
+	key := repository.Key{Passphrase: passphrase}
+	provider, err := openKeyProvider(fs, keystoreName)
+	if err != nil {
+		return key, func() {}, nil
+	}
+	defer repository.CloseKeyProvider(provider)
+
+	key.Policy = repository.ProviderPolicy(provider)
+	if key.Escrow, err = repository.ProviderEscrow(provider); err != nil {
+		return repository.Key{}, nil, repository.NewError(err, "Unable to use escrow keys")
+	}
+	return key, func() {}, nil
+}
+
+// openPassphraseTape opens a passphrase tape, checking its signature with
+// the named public key.  Without a name the sender the label names is found
+// in the keystore by fingerprint, and a tape whose label names no sender
+// cannot be verified, so it is only opened if opts allow it.
+func openPassphraseTape(fs afero.Fs, keystoreName, pubKeyName, passphraseFile string, tape io.ReadSeeker, opts OpenOptions) (*repository.TapeReader, error) {
+	passphrase, err := ReadPassphrase(fs, passphraseFile)
+	if err != nil {
+		return nil, err
+	}
+
+	key := repository.Key{Passphrase: passphrase}
+	sender := ""
+	if pubKeyName == "" {
+		info, err := repository.InspectTape(tape)
+		if err != nil {
+			return nil, err
+		}
+		if _, err = tape.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if sender = info.Sender; sender == "" {
+			return repository.OpenTapeWithOptions(key, tape, opts.tapeOptions()...)
+		}
+	}
+
+	provider, err := openKeyProvider(fs, keystoreName)
+	if err == nil {
+		defer repository.CloseKeyProvider(provider)
+		if sender != "" {
+			pubKeyName, err = repository.FindKeyName(provider, sender, false)
+		}
+	}
+	if err != nil && sender != "" {
+		return nil, &repository.SignatureError{What: "label", Err: repository.NewError(err, "Unable to find the sender's key")}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key.Policy = repository.ProviderPolicy(provider)
+	if key.PublicKey, err = provider.PublicKey(pubKeyName); err != nil {
+		return nil, repository.NewError(err, fmt.Sprintf("Unable to use public key %s", pubKeyName))
+	}
+
+	return repository.OpenTapeWithOptions(key, tape, opts.tapeOptions()...)
+}
+
+// UnpackWithPassphrase unpacks a tape protected by the passphrase in
+// passphraseFile.  The signatures of the label and the whole tape are
+// checked with the named public key, or without a name the sender's key
+// found in the keystore.  An unsigned tape cannot be verified, so it is only
+// unpacked if opts allow unverified tapes; the other options do not apply
+// to passphrase tapes.
+func UnpackWithPassphrase(fs afero.Fs, archive, keystore, pubKeyName, passphraseFile string, opts OpenOptions) (*TapeResult, error) {
+	file, err := fs.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	repo, err := openPassphraseTape(fs, keystore, pubKeyName, passphraseFile, file, opts)
+	if err != nil {
+		return nil, repository.NewError(err, fmt.Sprintf("Failed to open repository %s", archive))
+	}
+
+	return tapeResult(repo), extractFiles(fs, repo)
+}
+
+// ListWithPassphrase lists the contents of a tape protected by the
+// passphrase in passphraseFile to output in the output format, checking the
+// tape's signatures like UnpackWithPassphrase.
+func ListWithPassphrase(fs afero.Fs, archive, keystore, pubKeyName, passphraseFile string, opts OpenOptions, format OutputFormat, output io.Writer) (*TapeResult, error) {
+	file, err := fs.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tr, err := openPassphraseTape(fs, keystore, pubKeyName, passphraseFile, file, opts)
+	if err != nil {
+		return nil, repository.NewError(err, "Failed to open tape")
+	}
+
+	return tapeResult(tr), listTape(tr, archive, format, output)
+}
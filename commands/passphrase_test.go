@@ -0,0 +1,73 @@
+package commands
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+func TestPassphraseTapes(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+
+	home := repository.HomeDir()
+	passfile := filepath.Join(home, "passphrase")
+	afero.WriteFile(fs, passfile, []byte("correct horse battery staple\n"), 0600)
+
+	archive := filepath.Join(home, "archive1")
+	args := map[string]string{
+		"archive":         archive,
+		"files":           filepath.Join(home, "data1.dat"),
+		"keystore":        "foo",
+		"privkey":         "test3",
+		"passphrase-file": passfile,
+	}
+	PackRepository(fs, args)
+
+	out := new(bytes.Buffer)
+	ListWithPassphrase(fs, archive, "foo", "test3", passfile, OpenOptions{}, OutputText, out)
+	if !regexp.MustCompile("data1\\.dat").Match(out.Bytes()) {
+		t.Error("Failed to find data files in the passphrase tape")
+	}
+
+	file, _ := fs.Open(archive)
+	defer file.Close()
+	if _, err := openPassphraseTape(fs, "foo", "test2", passfile, file, OpenOptions{}); err == nil {
+		t.Error("Should not verify a passphrase tape with the wrong sender key")
+	}
+
+	out.Reset()
+	if _, err := ListWithPassphrase(fs, archive, "foo", "", passfile, OpenOptions{}, OutputNDJSON, out); err != nil {
+		t.Fatalf("Unable to verify a passphrase tape with the sender found by fingerprint: %v", err)
+	}
+	if records := readRecords(t, out); records[len(records)-1]["status"] != StatusVerified {
+		t.Errorf("Expected the passphrase tape to be verified but got %v", records)
+	}
+	if _, err := ListWithPassphrase(fs, archive, "missing", "", passfile, OpenOptions{Unverified: true}, OutputText, out); ExitCode(err) != ExitBadSignature {
+		t.Errorf("Expected a signed passphrase tape not to open without its sender's key but got %v", err)
+	}
+
+	wrong := filepath.Join(home, "wrong")
+	afero.WriteFile(fs, wrong, []byte("incorrect horse\n"), 0600)
+	if _, err := UnpackWithPassphrase(fs, archive, "foo", "test3", wrong, OpenOptions{}); ExitCode(err) != ExitBadPassphrase {
+		t.Errorf("Expected a bad passphrase exit code but got %v", err)
+	}
+
+	args["privkey"] = ""
+	args["keystore"] = "missing"
+	PackRepository(fs, args)
+
+	out.Reset()
+	if _, err := ListWithPassphrase(fs, archive, "missing", "", passfile, OpenOptions{}, OutputText, out); ExitCode(err) != ExitBadSignature {
+		t.Errorf("Expected an unsigned passphrase tape not to verify but got %v", err)
+	}
+	ListWithPassphrase(fs, archive, "missing", "", passfile, OpenOptions{Unverified: true}, OutputText, out)
+	if !regexp.MustCompile("data1\\.dat").Match(out.Bytes()) {
+		t.Error("Failed to find data files in the unsigned passphrase tape")
+	}
+}
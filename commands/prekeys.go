@@ -0,0 +1,61 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+// CreatePrekey creates a prekey signed by the named private key and stores
+// it in the keystore.  The prekey to publish to senders is written to out.
+func CreatePrekey(fs afero.Fs, keyfile, name string, lifetime time.Duration, out io.Writer) error {
+	keystore, err := loadKeystore(fs, keyfile)
+	if err != nil {
+		return err
+	}
+
+	owner, ok := keystore.FindPrivateKey(name)
+	if !ok {
+		return &repository.NoSuchKeyError{Kind: "Private key", Name: name}
+	}
+
+	prekey, private, err := repository.NewPrekey(owner, lifetime)
+	if err != nil {
+		return err
+	}
+	keystore.AddPrekey(prekey, private)
+
+	if err = saveKeystore(fs, keyfile, keystore); err != nil {
+		return err
+	}
+	return repository.WritePrekey(out, prekey)
+}
+
+// PrunePrekeys deletes expired prekeys from the keystore, writing each
+// one deleted to out.  Tapes written to them can no longer be read.
+func PrunePrekeys(fs afero.Fs, keyfile string, out io.Writer) error {
+	keystore, err := loadKeystore(fs, keyfile)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range keystore.RemoveExpiredPrekeys() {
+		fmt.Fprintf(out, "Deleted expired prekey %s\n", id)
+	}
+
+	return saveKeystore(fs, keyfile, keystore)
+}
+
+// readPrekey reads a prekey published by a recipient.
+func readPrekey(fs afero.Fs, fileName string) (*repository.Prekey, error) {
+	file, err := fs.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return repository.ReadPrekey(file)
+}
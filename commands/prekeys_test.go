@@ -0,0 +1,71 @@
+package commands
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+func TestForwardSecretPack(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+
+	published := new(bytes.Buffer)
+	if err := CreatePrekey(fs, "foo", "test1", time.Hour, published); err != nil {
+		t.Fatalf("Unable to create prekey: %v", err)
+	}
+	prekeyFile := filepath.Join(repository.HomeDir(), "test1.prekey")
+	afero.WriteFile(fs, prekeyFile, published.Bytes(), 0644)
+
+	archive := filepath.Join(repository.HomeDir(), "archive1")
+	PackRepository(fs, map[string]string{
+		"archive":  archive,
+		"files":    filepath.Join(repository.HomeDir(), "data1.dat"),
+		"keystore": "foo",
+		"pubkey":   "test1",
+		"privkey":  "test3",
+		"prekey":   prekeyFile,
+	})
+
+	data, _ := afero.ReadFile(fs, archive)
+	if !bytes.Contains(data, []byte(`"mode":"ecdh"`)) {
+		t.Error("Tape packed with a prekey should have a forward-secret label")
+	}
+
+	outf := new(bytes.Buffer)
+	ListContents(fs, archive, "foo", "test1", "test3", outf)
+	if !regexp.MustCompile("data1\\.dat").Match(outf.Bytes()) {
+		t.Error("Failed to find data files in the forward-secret tape")
+	}
+}
+
+func TestPrunePrekeys(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+
+	CreatePrekey(fs, "foo", "test1", -time.Hour, new(bytes.Buffer))
+	CreatePrekey(fs, "foo", "test1", time.Hour, new(bytes.Buffer))
+
+	out := new(bytes.Buffer)
+	if err := PrunePrekeys(fs, "foo", out); err != nil {
+		t.Fatalf("Unable to prune prekeys: %v", err)
+	}
+	if strings.Count(out.String(), "Deleted expired prekey") != 1 {
+		t.Errorf("Expected one prekey to be deleted but got %q", out.String())
+	}
+
+	keystore, err := loadKeystore(fs, "foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keystore.Prekeys) != 1 {
+		t.Errorf("Expected one prekey to remain but found %d", len(keystore.Prekeys))
+	}
+}
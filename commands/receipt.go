@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+// writeReceipt writes a receipt for the tape at archive, signed with the
+// receiver's key, to receiptFile.
+func writeReceipt(fs afero.Fs, archive, receiptFile string, sender *rsa.PublicKey, result string, signKey crypto.Signer) error {
+	if signKey == nil {
+		return errors.New("A private key is required to sign a receipt")
+	}
+
+	file, err := fs.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	receipt := &repository.Receipt{Time: time.Now().UTC(), Result: result}
+	if receipt.Tape, err = repository.TapeHash(file); err != nil {
+		return err
+	}
+	if sender != nil {
+		receipt.Sender = repository.Fingerprint(sender)
+	}
+	if err = receipt.Sign(signKey); err != nil {
+		return err
+	}
+
+	out, err := fs.OpenFile(receiptFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return repository.WriteReceipt(out, receipt)
+}
+
+// receiptForVerified writes a receipt for a tape that verified, signed with
+// the named private key.
+func receiptForVerified(fs afero.Fs, archive, keystoreName, pubKeyName, privKeyName, receiptFile string) error {
+	provider, err := openKeyProvider(fs, keystoreName)
+	if err != nil {
+		return err
+	}
+	defer repository.CloseKeyProvider(provider)
+
+	signKey, err := provider.PrivateKey(privKeyName)
+	if err != nil {
+		return repository.NewError(err, fmt.Sprintf("Unable to use private key %s", privKeyName))
+	}
+
+	var sender *rsa.PublicKey
+	if pubKeyName != "" {
+		if sender, err = provider.PublicKey(pubKeyName); err != nil {
+			return err
+		}
+	} else {
+		file, err := fs.Open(archive)
+		if err != nil {
+			return err
+		}
+		_, _, sender, err = repository.ReadLabelWithProvider(file, provider)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	return writeReceipt(fs, archive, receiptFile, sender, repository.ReceiptVerified, signKey)
+}
+
+// VerifyTapeWithReceipt verifies a sign-only tape like VerifyTape and, if it
+// verifies, writes a receipt signed with the named private key to
+// receiptFile.  Returns an error if the tape does not verify or the receipt
+// cannot be written.
+func VerifyTapeWithReceipt(fs afero.Fs, archive, keystore, pubKeyName, privKeyName, receiptFile string, format OutputFormat, out io.Writer) ([]repository.ManifestEntry, error) {
+	manifest, err := VerifyTape(fs, archive, keystore, pubKeyName, format, out)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = receiptForVerified(fs, archive, keystore, pubKeyName, privKeyName, receiptFile); err != nil {
+		return manifest, repository.NewError(err, fmt.Sprintf("Failed to write receipt for %s", archive))
+	}
+	return manifest, nil
+}
+
+// CheckReceipt checks the receiver's signature of a receipt and matches it to
+// one of the tapes sent, writing the result to out.  The receiver is the
+// named public key or, if no name is given, the key in the keystore that
+// signed the receipt.  Returns an error if the receipt is not signed by the
+// receiver or is not for any of the tapes.
+func CheckReceipt(fs afero.Fs, receiptFile, keystoreName, pubKeyName string, archives []string, out io.Writer) error {
+	file, err := fs.Open(receiptFile)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	receipt, err := repository.ReadReceipt(file)
+	if err != nil {
+		return err
+	}
+
+	provider, err := openKeyProvider(fs, keystoreName)
+	if err != nil {
+		return err
+	}
+	defer repository.CloseKeyProvider(provider)
+
+	if pubKeyName == "" {
+		if pubKeyName, err = repository.FindKeyName(provider, receipt.Receiver, false); err != nil {
+			return &repository.NoSuchKeyError{Kind: "Receipt signing key", Name: receipt.Receiver}
+		}
+	}
+	publicKey, err := provider.PublicKey(pubKeyName)
+	if err != nil {
+		return err
+	}
+	if err = receipt.Verify(publicKey); err != nil {
+		return err
+	}
+
+	for _, archive := range archives {
+		tape, err := fs.Open(archive)
+		if err != nil {
+			return err
+		}
+		hash, err := repository.TapeHash(tape)
+		tape.Close()
+		if err != nil {
+			return err
+		}
+
+		if hash == receipt.Tape {
+			fmt.Fprintf(out, "%s was %s by %s at %s\n", archive, receipt.Result, pubKeyName, receipt.Time.Format(time.RFC3339))
+			return nil
+		}
+	}
+	return fmt.Errorf("Receipt from %s is for tape %s, which is not one of the tapes sent", pubKeyName, receipt.Tape)
+}
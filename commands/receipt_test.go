@@ -0,0 +1,103 @@
+package commands
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+func TestReceipts(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+	packTestRepository(fs)
+
+	home := repository.HomeDir()
+	archive := filepath.Join(home, "archive1")
+	receipt := filepath.Join(home, "archive1.receipt")
+	UnpackRepositoryWithOptions(fs, archive, "foo", "test1", "test3", OpenOptions{ReceiptFile: receipt})
+
+	out := new(bytes.Buffer)
+	if err := CheckReceipt(fs, receipt, "foo", "", []string{archive}, out); err != nil {
+		t.Fatalf("Unable to check receipt: %v", err)
+	}
+	if !regexp.MustCompile("archive1 was unpacked by test1").Match(out.Bytes()) {
+		t.Errorf("Receipt not matched to the tape: %s", out.String())
+	}
+
+	if err := CheckReceipt(fs, receipt, "foo", "test3", []string{archive}, out); err == nil {
+		t.Error("Should not check a receipt with the wrong receiver key")
+	}
+
+	other := filepath.Join(home, "archive2")
+	PackRepository(fs, map[string]string{"archive": other, "files": filepath.Join(home, "data2.dat"), "keystore": "foo", "pubkey": "test1", "privkey": "test3"})
+	if err := CheckReceipt(fs, receipt, "foo", "", []string{other}, out); err == nil {
+		t.Error("Should not match a receipt to another tape")
+	}
+}
+
+func TestVerifyReceipt(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+
+	home := repository.HomeDir()
+	archive := filepath.Join(home, "archive1")
+	receipt := filepath.Join(home, "archive1.receipt")
+	PackRepository(fs, map[string]string{
+		"archive":   archive,
+		"files":     filepath.Join(home, "data1.dat"),
+		"keystore":  "foo",
+		"privkey":   "test3",
+		"sign-only": "true",
+	})
+
+	out := new(bytes.Buffer)
+	if _, err := VerifyTapeWithReceipt(fs, archive, "foo", "", "test1", receipt, OutputText, out); err != nil {
+		t.Fatalf("Unable to verify tape and write a receipt: %v", err)
+	}
+	out.Reset()
+	if err := CheckReceipt(fs, receipt, "foo", "test1", []string{archive}, out); err != nil {
+		t.Errorf("Unable to check receipt for a verified tape: %v", err)
+	}
+	if !regexp.MustCompile("was verified").Match(out.Bytes()) {
+		t.Errorf("Receipt result not reported: %s", out.String())
+	}
+}
+
+func TestReceiptForUnverifiedTape(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+	packTestRepository(fs)
+
+	home := repository.HomeDir()
+	archive := filepath.Join(home, "archive1")
+	receipt := filepath.Join(home, "archive1.receipt")
+	tamperPayload(t, fs, archive)
+	if _, err := UnpackRepositoryWithOptions(fs, archive, "foo", "test1", "test3", OpenOptions{ReceiptFile: receipt}); ExitCode(err) != ExitBadSignature {
+		t.Errorf("Expected a bad signature unpacking a tampered tape but got %v", err)
+	}
+	if exists, _ := afero.Exists(fs, receipt); exists {
+		t.Error("Should not write a receipt for a tampered tape")
+	}
+
+	// A tape without its trailer may be unpacked unverified, but not receipted.
+	tape, _ := afero.ReadFile(fs, archive)
+	info, err := repository.InspectTape(bytes.NewReader(tape))
+	if err != nil {
+		t.Fatalf("Unable to inspect archive: %v", err)
+	}
+	afero.WriteFile(fs, archive, tape[:info.LabelSize+info.PayloadSize], 0600)
+	opts := OpenOptions{ReceiptFile: receipt, Unverified: true}
+	if _, err = UnpackRepositoryWithOptions(fs, archive, "foo", "test1", "test3", opts); ExitCode(err) != ExitBadSignature {
+		t.Errorf("Expected a bad signature receipting an unverified tape but got %v", err)
+	}
+	if exists, _ := afero.Exists(fs, receipt); exists {
+		t.Error("Should not write a receipt for an unverified tape")
+	}
+}
@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+// RelabelTape rewrites the label of a tape or detached label so the
+// recipient key can read it, without re-encrypting the payload.  The new
+// label is written to output, or over the archive if output is empty.  When
+// no key names are given the keys recorded in the old label are found with
+// the key provider.
+func RelabelTape(fs afero.Fs, archive, output, keystore, privKeyName, pubKeyName, recipientName string) error {
+	provider, err := openKeyProvider(fs, keystore)
+	if err != nil {
+		return err
+	}
+	defer repository.CloseKeyProvider(provider)
+
+	key := repository.Key{Policy: repository.ProviderPolicy(provider)}
+	if key.Escrow, err = repository.ProviderEscrow(provider); err != nil {
+		return err
+	}
+	if privKeyName == "" && pubKeyName == "" {
+		file, err := fs.Open(archive)
+		if err != nil {
+			return err
+		}
+		_, key.PrivateKey, key.PublicKey, err = repository.ReadLabelWithProvider(file, provider)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	} else {
+		if key.PrivateKey, err = provider.PrivateKey(privKeyName); err != nil {
+			return err
+		}
+		if key.PublicKey, err = provider.PublicKey(pubKeyName); err != nil {
+			return err
+		}
+	}
+
+	recipient, err := provider.PublicKey(recipientName)
+	if err != nil {
+		return err
+	}
+
+	return repository.RelabelFile(fs, archive, output, key, recipient)
+}
@@ -0,0 +1,44 @@
+package commands
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/darcinc/repository"
+)
+
+func TestRelabelTape(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+	packTestRepository(fs)
+
+	archive := filepath.Join(repository.HomeDir(), "archive1")
+	output := filepath.Join(repository.HomeDir(), "archive2")
+
+	if err := RelabelTape(fs, archive, output, "foo", "test1", "test3", "test3"); err != nil {
+		t.Fatalf("Unable to relabel tape: %v", err)
+	}
+
+	outf := new(bytes.Buffer)
+	ListContents(fs, output, "foo", "test3", "test1", outf)
+	if !regexp.MustCompile("data1\\.dat").Match(outf.Bytes()) {
+		t.Error("Failed to find data files in the relabeled tape")
+	}
+
+	if err := RelabelTape(fs, output, "", "foo", "", "", "test1"); err != nil {
+		t.Fatalf("Unable to relabel tape in place with keys from the label: %v", err)
+	}
+
+	outf.Reset()
+	ListContents(fs, output, "foo", "", "", outf)
+	if !regexp.MustCompile("data2\\.dat").Match(outf.Bytes()) {
+		t.Error("Failed to find data files in the tape relabeled in place")
+	}
+
+	if err := RelabelTape(fs, archive, output, "foo", "test1", "test3", "missing"); err == nil {
+		t.Error("Should not relabel a tape for a missing key")
+	}
+}
@@ -0,0 +1,138 @@
+package commands
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+// CreateShare writes the custodian's share of a threshold tape's key to
+// outfile.  The custodian's private key is found in the label if
+// privKeyName is empty.
+func CreateShare(fs afero.Fs, archive, keystore, privKeyName, outfile string) error {
+	provider, err := openKeyProvider(fs, keystore)
+	if err != nil {
+		return err
+	}
+	defer repository.CloseKeyProvider(provider)
+
+	var share *repository.Share
+	if privKeyName != "" {
+		share, err = createShareWithKey(fs, archive, provider, privKeyName)
+	} else {
+		share, err = createShareWithProvider(fs, archive, provider)
+	}
+	if err != nil {
+		return err
+	}
+
+	out, err := fs.OpenFile(outfile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	return repository.WriteShare(out, share)
+}
+
+func createShareWithKey(fs afero.Fs, archive string, provider repository.KeyProvider, name string) (*repository.Share, error) {
+	privateKey, err := provider.PrivateKey(name)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := fs.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return repository.CreateShare(file, privateKey)
+}
+
+// createShareWithProvider tries each of the provider's private keys until
+// one is a custodian of the tape.
+func createShareWithProvider(fs afero.Fs, archive string, provider repository.KeyProvider) (*repository.Share, error) {
+	lister, ok := provider.(repository.KeyLister)
+	if !ok {
+		return nil, fmt.Errorf("The key provider cannot list its keys, name the custodian's key")
+	}
+
+	names, err := lister.KeyNames()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		privateKey, err := provider.PrivateKey(name)
+		if err != nil {
+			continue
+		}
+
+		file, err := fs.Open(archive)
+		if err != nil {
+			return nil, err
+		}
+		share, err := repository.CreateShare(file, privateKey)
+		file.Close()
+		if err == nil {
+			return share, nil
+		}
+	}
+
+	return nil, fmt.Errorf("None of the keys is a custodian of %s", archive)
+}
+
+func openTapeWithShares(fs afero.Fs, archive, keystore, pubKeyName string, shareFiles []string) (*repository.TapeReader, func(), error) {
+	provider, err := openKeyProvider(fs, keystore)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer repository.CloseKeyProvider(provider)
+
+	publicKey, err := provider.PublicKey(pubKeyName)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	shares := []*repository.Share{}
+	for _, shareFile := range shareFiles {
+		file, err := fs.Open(shareFile)
+		if err != nil {
+			return nil, nil, err
+		}
+		share, err := repository.ReadShare(file)
+		file.Close()
+		if err != nil {
+			return nil, nil, repository.NewError(err, fmt.Sprintf("Unable to read share %s", shareFile))
+		}
+		shares = append(shares, share)
+	}
+
+	file, err := fs.Open(archive)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	repo, err := repository.OpenTapeWithShares(file, shares, publicKey)
+	if err != nil {
+		file.Close()
+		return nil, nil, err
+	}
+	return repo, func() { file.Close() }, nil
+}
+
+// CombineShares combines the custodians' shares of a threshold tape's key
+// and unpacks the tape.  The label signature is checked with the sender's
+// public key.
+func CombineShares(fs afero.Fs, archive, keystore, pubKeyName string, shareFiles []string) (*TapeResult, error) {
+	repo, done, err := openTapeWithShares(fs, archive, keystore, pubKeyName, shareFiles)
+	if err != nil {
+		return nil, repository.NewError(err, fmt.Sprintf("Failed to open %s with shares", archive))
+	}
+	defer done()
+
+	return tapeResult(repo), extractFiles(fs, repo)
+}
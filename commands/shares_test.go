@@ -0,0 +1,48 @@
+package commands
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/darcinc/repository"
+)
+
+func TestThresholdShares(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+
+	home := repository.HomeDir()
+	archive := filepath.Join(home, "archive1")
+	PackRepository(fs, map[string]string{
+		"archive":    archive,
+		"files":      filepath.Join(home, "data1.dat"),
+		"keystore":   "foo",
+		"privkey":    "test3",
+		"custodians": "test1,test3",
+		"threshold":  "2",
+	})
+
+	share1 := filepath.Join(home, "test1.share")
+	share3 := filepath.Join(home, "test3.share")
+	if err := CreateShare(fs, archive, "foo", "test1", share1); err != nil {
+		t.Fatalf("Unable to create share with named key: %v", err)
+	}
+	if err := CreateShare(fs, archive, "foo", "test3", share3); err != nil {
+		t.Fatalf("Unable to create share with named key: %v", err)
+	}
+	if err := CreateShare(fs, archive, "foo", "", filepath.Join(home, "found.share")); err != nil {
+		t.Fatalf("Unable to create share with key from the label: %v", err)
+	}
+
+	if _, _, err := openTapeWithShares(fs, archive, "foo", "test3", []string{share1}); err == nil {
+		t.Error("One share should not open a tape with a threshold of two")
+	}
+
+	fs.Remove(filepath.Join(home, "data1.dat"))
+	CombineShares(fs, archive, "foo", "test3", []string{share1, share3})
+
+	if _, err := fs.Stat(filepath.Join(home, "data1.dat")); err != nil {
+		t.Errorf("Failed to find file after combining shares: %v", err)
+	}
+}
@@ -0,0 +1,34 @@
+package commands
+
+import (
+	"os"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+// loadStreamState reads the stream state kept in the named file, or returns
+// an empty state if the file does not exist yet.
+func loadStreamState(fs afero.Fs, fileName string) (*repository.StreamState, error) {
+	file, err := fs.Open(fileName)
+	if os.IsNotExist(err) {
+		return repository.NewStreamState(), nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return repository.OpenStreamState(file)
+}
+
+// saveStreamState replaces the named file with the stream state.
+func saveStreamState(fs afero.Fs, fileName string, state *repository.StreamState) error {
+	file, err := fs.OpenFile(fileName, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return state.Save(file)
+}
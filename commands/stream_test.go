@@ -0,0 +1,53 @@
+package commands
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/darcinc/repository"
+)
+
+func TestStreamTapes(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+
+	home := repository.HomeDir()
+	senderState := filepath.Join(home, "sender.state")
+	receiverState := filepath.Join(home, "receiver.state")
+	archives := []string{filepath.Join(home, "archive1"), filepath.Join(home, "archive2")}
+	for _, archive := range archives {
+		args := map[string]string{
+			"archive":  archive,
+			"files":    strings.Join([]string{filepath.Join(home, "data1.dat")}, ","),
+			"keystore": "foo",
+			"pubkey":   "test1",
+			"privkey":  "test3",
+			"stream":   "nightly",
+			"state":    senderState,
+		}
+		PackRepository(fs, args)
+	}
+
+	opts := OpenOptions{StateFile: receiverState}
+	UnpackRepositoryWithOptions(fs, archives[0], "foo", "test1", "test3", opts)
+
+	file, _ := fs.Open(archives[0])
+	_, _, err := openTape(fs, "foo", "test1", "test3", file, opts)
+	file.Close()
+	if streamErr, ok := err.(*repository.StreamError); !ok || streamErr.Kind != repository.StreamDuplicate {
+		t.Errorf("Expected a duplicate tape but got %v", err)
+	}
+
+	file, _ = fs.Open(archives[1])
+	defer file.Close()
+	tr, done, err := openTape(fs, "foo", "", "", file, opts)
+	if err != nil {
+		t.Fatalf("Unable to open the next tape in the stream: %v", err)
+	}
+	done()
+	if tr.Key.Label.Stream == nil || tr.Key.Label.Stream.Sequence != 2 {
+		t.Errorf("Expected the second tape in the stream but got %v", tr.Key.Label.Stream)
+	}
+}
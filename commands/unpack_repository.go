@@ -1,39 +1,70 @@
 package commands
 
 import (
+	"errors"
+	"fmt"
 	"io"
-	"log"
 
 	"github.com/darcinc/afero"
 	"github.com/darcinc/repository"
 )
 
-// UnpackRepository unpacks a repository
-func UnpackRepository(fs afero.Fs, archive, keystore, privKeyName, pubKeyName string) {
-	privateKey, publicKey, err := readKeysFromKeystore(fs, keystore, privKeyName, pubKeyName)
-	if err != nil {
-		log.Fatalf("Failed to find public or private keys: %v", err)
-	}
+// UnpackRepository unpacks a repository.  If no key names are given, the
+// keys recorded in the tape's label are used.
+func UnpackRepository(fs afero.Fs, archive, keystore, privKeyName, pubKeyName string) (*TapeResult, error) {
+	return UnpackRepositoryWithOptions(fs, archive, keystore, privKeyName, pubKeyName, OpenOptions{})
+}
 
+// UnpackRepositoryWithOptions unpacks a repository like UnpackRepository,
+// but only if it passes the checks in opts.  The tape is recorded in the
+// stream state, and a receipt signed with the receiver's private key is
+// written, once it has been unpacked.  A receipt is only written for a tape
+// whose trailer was verified.
+func UnpackRepositoryWithOptions(fs afero.Fs, archive, keystore, privKeyName, pubKeyName string, opts OpenOptions) (*TapeResult, error) {
 	file, err := fs.Open(archive)
 	if err != nil {
-		log.Fatalf("Failed to open archive %s: %v", archive, err)
+		return nil, err
 	}
 	defer file.Close()
 
-	repo, err := repository.OpenTape(privateKey, publicKey, file)
+	repo, done, err := openTape(fs, keystore, privKeyName, pubKeyName, file, opts)
 	if err != nil {
-		log.Fatalf("Failed to open repository %s: %v", archive, err)
+		return nil, repository.NewError(err, fmt.Sprintf("Failed to open repository %s", archive))
+	}
+	defer done()
+
+	if opts.ReceiptFile != "" && !repo.Verified() {
+		return nil, &repository.SignatureError{What: "tape", Err: errors.New("A receipt needs a verified tape")}
+	}
+
+	result := tapeResult(repo)
+	if err = extractFiles(fs, repo); err != nil {
+		return result, err
 	}
 
-	for err = nil; err == nil; {
-		err = repo.ExtractFile(fs)
+	if opts.StateFile != "" {
+		if err = saveStreamState(fs, opts.StateFile, repo.Key.Streams); err != nil {
+			return result, repository.NewError(err, fmt.Sprintf("Failed to save stream state %s", opts.StateFile))
+		}
+	}
+
+	if opts.ReceiptFile != "" {
+		if err = writeReceipt(fs, archive, opts.ReceiptFile, repo.Key.PublicKey, repository.ReceiptUnpacked, repo.Key.PrivateKey); err != nil {
+			return result, repository.NewError(err, fmt.Sprintf("Failed to write receipt %s", opts.ReceiptFile))
+		}
+	}
+	return result, nil
+}
+
+// extractFiles extracts every file on the tape.
+func extractFiles(fs afero.Fs, repo *repository.TapeReader) error {
+	for {
+		err := repo.ExtractFile(fs)
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			if err != io.EOF {
-				log.Fatalf("Failed to extract file: %v", err)
-			} else {
-				break
-			}
+			return repository.NewError(err, "Failed to extract file")
 		}
 	}
 }
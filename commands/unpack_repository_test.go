@@ -1,9 +1,11 @@
 package commands
 
 import (
+	"bytes"
 	"path/filepath"
 	"testing"
 
+	"github.com/darcinc/afero"
 	"github.com/darcinc/repository"
 )
 
@@ -30,3 +32,40 @@ func TestUnpackRepository(t *testing.T) {
 		t.Errorf("Failed to find file: %v", err)
 	}
 }
+
+// tamperPayload flips a byte in the middle of the archive after the label.
+func tamperPayload(t *testing.T, fs afero.Fs, archive string) {
+	t.Helper()
+	tape, err := afero.ReadFile(fs, archive)
+	if err != nil {
+		t.Fatalf("Unable to read archive: %v", err)
+	}
+	info, err := repository.InspectTape(bytes.NewReader(tape))
+	if err != nil {
+		t.Fatalf("Unable to inspect archive: %v", err)
+	}
+	tape[info.LabelSize+info.PayloadSize/2] ^= 0xff
+	afero.WriteFile(fs, archive, tape, 0600)
+}
+
+func TestUnpackTamperedRepository(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+	packTestRepository(fs)
+
+	archive := filepath.Join(repository.HomeDir(), "archive1")
+	tamperPayload(t, fs, archive)
+	for _, name := range []string{"data1.dat", "data2.dat"} {
+		fs.Remove(filepath.Join(repository.HomeDir(), name))
+	}
+
+	if _, err := UnpackRepository(fs, archive, "foo", "test1", "test3"); ExitCode(err) != ExitBadSignature {
+		t.Errorf("Expected a tampered tape not to verify but got %v", err)
+	}
+	for _, name := range []string{"data1.dat", "data2.dat"} {
+		if _, err := fs.Stat(filepath.Join(repository.HomeDir(), name)); err == nil {
+			t.Errorf("File %s unpacked from a tampered tape", name)
+		}
+	}
+}
@@ -0,0 +1,99 @@
+package commands
+
+import (
+	"crypto/rsa"
+	"fmt"
+	"io"
+
+	"github.com/darcinc/afero"
+	"github.com/darcinc/repository"
+)
+
+// VerifyTape checks the signature and manifest of a sign-only tape and
+// writes the manifest to out in the output format.  The sender's public key
+// is the named key, or is found with the key provider from the tape's label
+// if no name is given.  Returns the manifest, or an error if the tape does
+// not verify.
+func VerifyTape(fs afero.Fs, archive, keystoreName, pubKeyName string, format OutputFormat, out io.Writer) ([]repository.ManifestEntry, error) {
+	provider, err := openKeyProvider(fs, keystoreName)
+	if err != nil {
+		return nil, err
+	}
+	defer repository.CloseKeyProvider(provider)
+
+	file, err := fs.Open(archive)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var publicKey *rsa.PublicKey
+	if pubKeyName != "" {
+		publicKey, err = provider.PublicKey(pubKeyName)
+	} else {
+		_, _, publicKey, err = repository.ReadLabelWithProvider(file, provider)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err = file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	manifest, err := repository.VerifyTape(file, publicKey)
+	if err != nil {
+		return nil, err
+	}
+
+	if format != OutputText {
+		return manifest, writeManifest(file, archive, manifest, publicKey, format, out)
+	}
+	for _, entry := range manifest {
+		fmt.Fprintf(out, "%64s %10d %s\n", entry.Sum(), entry.Size, entry.Name)
+	}
+	fmt.Fprintf(out, "%s is signed by %s\n", archive, repository.Fingerprint(publicKey))
+	return manifest, nil
+}
+
+// writeManifest writes a verified manifest as an EntryRecord for each file
+// followed by a TapeRecord for the archive, or as one TapeDocument for JSON.
+// The hash algorithm is read from the tape's label.
+func writeManifest(tape io.ReadSeeker, archive string, manifest []repository.ManifestEntry, publicKey *rsa.PublicKey, format OutputFormat, out io.Writer) error {
+	info, err := repository.InspectTape(tape)
+	if err != nil {
+		return err
+	}
+
+	document := TapeDocument{
+		TapeRecord: TapeRecord{
+			Kind:      KindTape,
+			Archive:   archive,
+			Status:    StatusVerified,
+			Signer:    repository.Fingerprint(publicKey),
+			Algorithm: info.Hash,
+		},
+		Entries: []EntryRecord{},
+	}
+	for _, entry := range manifest {
+		record := EntryRecord{
+			Kind:      KindEntry,
+			Name:      entry.Name,
+			Size:      entry.Size,
+			Digest:    entry.Sum(),
+			Algorithm: info.Hash,
+			Status:    StatusVerified,
+		}
+		if format == OutputNDJSON {
+			if err = writeRecord(out, format, record); err != nil {
+				return err
+			}
+			continue
+		}
+		document.Entries = append(document.Entries, record)
+	}
+
+	if format == OutputNDJSON {
+		return writeRecord(out, format, document.TapeRecord)
+	}
+	return writeRecord(out, format, document)
+}
@@ -0,0 +1,49 @@
+package commands
+
+import (
+	"bytes"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/darcinc/repository"
+)
+
+func TestVerifySignOnlyTape(t *testing.T) {
+	fs := createFSWithKeystore(t)
+	addTestKeys(fs, t)
+	createTestData(fs)
+
+	home := repository.HomeDir()
+	archive := filepath.Join(home, "archive1")
+	PackRepository(fs, map[string]string{
+		"archive":   archive,
+		"files":     filepath.Join(home, "data1.dat"),
+		"keystore":  "foo",
+		"privkey":   "test3",
+		"sign-only": "true",
+	})
+
+	out := new(bytes.Buffer)
+	if _, err := VerifyTape(fs, archive, "foo", "", OutputText, out); err != nil {
+		t.Fatalf("Unable to verify sign-only tape: %v", err)
+	}
+	if !regexp.MustCompile("data1\\.dat").Match(out.Bytes()) {
+		t.Errorf("Manifest not printed: %s", out.String())
+	}
+
+	if _, err := VerifyTape(fs, archive, "foo", "test2", OutputText, out); err == nil {
+		t.Error("Should not verify a sign-only tape with the wrong key")
+	}
+
+	out.Reset()
+	ListContents(fs, archive, "foo", "", "", out)
+	if !regexp.MustCompile("data1\\.dat").Match(out.Bytes()) {
+		t.Error("Failed to list a sign-only tape with the sender's key found from the label")
+	}
+
+	packTestRepository(fs)
+	if _, err := VerifyTape(fs, archive, "foo", "test3", OutputText, out); err == nil {
+		t.Error("Should not verify an encrypted tape without a private key")
+	}
+}
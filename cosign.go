@@ -0,0 +1,226 @@
+package repository
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/darcinc/afero"
+)
+
+// cosignContext separates co-signatures from every other signature made with
+// the same keys.
+var cosignContext = []byte("repository co-signature\x00")
+
+// SignerPolicy requires a tape to be signed by at least Required of Keys.
+// The sender counts if its key is one of Keys, and so does each approver who
+// co-signed the label, see CoSign.
+type SignerPolicy struct {
+	Keys     []*rsa.PublicKey
+	Required int
+}
+
+// SignerPolicyError is returned when a tape has fewer verified signatures
+// from the keys of a SignerPolicy than the policy requires.  Verified lists
+// the fingerprints of the policy's keys whose signatures were verified.
+type SignerPolicyError struct {
+	Required int
+	Verified []string
+}
+
+func (e *SignerPolicyError) Error() string {
+	if len(e.Verified) == 0 {
+		return fmt.Sprintf("Tape needs %d signatures from the required signers but has none", e.Required)
+	}
+	return fmt.Sprintf("Tape needs %d signatures from the required signers but only has %d, from %s", e.Required, len(e.Verified), strings.Join(e.Verified, ", "))
+}
+
+// approvalDigest is the digest signed by co-signers, made with the label's
+// hash algorithm.  Co-signers need not be able to open the tape, so it covers
+// the label header, which holds the wrapped tape key, but not the key itself.
+func approvalDigest(algorithm crypto.Hash, header []byte) []byte {
+	hash := algorithm.New()
+	hash.Write(cosignContext)
+	hash.Write(header)
+	return hash.Sum(nil)
+}
+
+// cosignatures lists the label's signatures other than the sender's.
+func (raw *rawLabel) cosignatures() []labelSignature {
+	result := []labelSignature{}
+	for _, sig := range raw.signatures {
+		if sig.Signer != raw.header.Sender {
+			result = append(result, sig)
+		}
+	}
+	return result
+}
+
+// cosign reads the label from in and returns it with a co-signature made with
+// key's private key added.  Also returns the size of the old label.
+func cosign(in io.Reader, key Key) ([]byte, int64, error) {
+	if key.PrivateKey == nil {
+		return nil, 0, errors.New("A private key is required to co-sign a label")
+	}
+	if err := key.checkPolicy(); err != nil {
+		return nil, 0, err
+	}
+	signPub, err := rsaPublicKey(key.PrivateKey.Public())
+	if err != nil {
+		return nil, 0, err
+	}
+
+	counter := &countingReader{in: in}
+	raw, err := readRawLabel(counter)
+	if err != nil {
+		return nil, 0, NewError(err, "Unable to read label")
+	}
+	if raw.version == legacyLabelVersion {
+		return nil, 0, errors.New("Labels of this version cannot be co-signed")
+	}
+	if err = key.policy().CheckHash(raw.header.Hash); err != nil {
+		return nil, 0, err
+	}
+	algorithm, err := lookupHash(raw.header.Hash)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	signer := Fingerprint(signPub)
+	if signer == raw.header.Sender {
+		return nil, 0, errors.New("The sender cannot co-sign its own label")
+	}
+	for _, sig := range raw.signatures {
+		if sig.Signer == signer {
+			return nil, 0, fmt.Errorf("Label is already co-signed by %s", signer)
+		}
+	}
+
+	value, err := signDigest(key.PrivateKey, algorithm, approvalDigest(algorithm, raw.headerBytes))
+	if err != nil {
+		return nil, 0, NewError(err, "Failed to co-sign the label")
+	}
+	raw.signatures = append(raw.signatures, labelSignature{Signer: signer, Value: value})
+
+	buffer := new(bytes.Buffer)
+	if err = raw.write(buffer); err != nil {
+		return nil, 0, NewError(err, "Unable to write the co-signed label")
+	}
+	return buffer.Bytes(), counter.count, nil
+}
+
+// CoSign copies a tape or detached label from in to out, adding a
+// co-signature made with key's private key to its label.  The co-signature
+// approves the label header, which holds the wrapped tape key, so the tape
+// is neither decrypted nor re-encrypted and the approver need not be one of
+// its recipients.  The trailer does not cover the label's signatures and is
+// copied as is.
+func CoSign(in io.Reader, out io.Writer, key Key) error {
+	label, _, err := cosign(in, key)
+	if err != nil {
+		return err
+	}
+
+	return writeRelabeled(out, in, label, nil)
+}
+
+// CoSignFile co-signs the tape or detached label at path, see CoSign.  The
+// result is written to output, or replaces the file at path when output is
+// empty or the same path.
+func CoSignFile(fs afero.Fs, path, output string, key Key) error {
+	return replaceLabel(fs, path, output, nil, func(in io.Reader) ([]byte, int64, error) {
+		return cosign(in, key)
+	})
+}
+
+// Signers lists the fingerprints of the keys in signers whose signatures of
+// the label were verified, starting with the sender's.
+func (l *Label) Signers(signers []*rsa.PublicKey) []string {
+	result := []string{}
+	if l.sender != "" {
+		result = append(result, l.sender)
+	}
+
+	algorithm := l.digestAlgorithm()
+	for _, key := range signers {
+		fingerprint := Fingerprint(key)
+		for _, sig := range l.cosignatures {
+			if sig.Signer != fingerprint {
+				continue
+			}
+			if verifyDigest(key, algorithm, approvalDigest(algorithm, l.header), sig.Value) == nil {
+				result = append(result, fingerprint)
+			}
+			break
+		}
+	}
+	return result
+}
+
+// Check returns a *SignerPolicyError unless at least Required of the
+// policy's keys are among the verified signers.
+func (p *SignerPolicy) Check(verified []string) error {
+	keys := map[string]bool{}
+	for _, key := range p.Keys {
+		keys[Fingerprint(key)] = true
+	}
+
+	counted := []string{}
+	for _, signer := range verified {
+		if keys[signer] {
+			counted = append(counted, signer)
+			delete(keys, signer)
+		}
+	}
+	if len(counted) < p.Required {
+		return &SignerPolicyError{Required: p.Required, Verified: counted}
+	}
+	return nil
+}
+
+// CheckSigners verifies the label's co-signatures made with the policy's
+// keys and checks that the policy is met, returning a *SignerPolicyError if
+// it is not.  The signers verified are added to those reported by Signers.
+func (r *TapeReader) CheckSigners(policy *SignerPolicy) error {
+	for _, signer := range r.Key.Label.Signers(policy.Keys) {
+		if !contains(r.signers, signer) {
+			r.signers = append(r.signers, signer)
+		}
+	}
+	return policy.Check(r.signers)
+}
+
+// Signers lists the fingerprints of the keys whose signatures of the tape's
+// label were verified: the sender's, and those of the co-signers whose keys
+// were in the signer policy, or in the provider the tape was opened with.
+func (r *TapeReader) Signers() []string {
+	return r.signers
+}
+
+// providerSigners finds the keys of the label's co-signers in the provider.
+func (l *Label) providerSigners(provider KeyProvider) []*rsa.PublicKey {
+	result := []*rsa.PublicKey{}
+	for _, sig := range l.cosignatures {
+		name, err := FindKeyName(provider, sig.Signer, false)
+		if err != nil {
+			continue
+		}
+		if key, err := provider.PublicKey(name); err == nil {
+			result = append(result, key)
+		}
+	}
+	return result
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"testing"
+
+	"github.com/darcinc/afero"
+)
+
+func TestCoSign(t *testing.T) {
+	fs := setupFs()
+	createSimpleTape(fs, []string{pathFor("data", "db", "files", "db2.dat")})
+	tape, _ := afero.ReadFile(fs, pathFor("backups", "bk1.bak"))
+
+	once := new(bytes.Buffer)
+	if err := CoSign(bytes.NewReader(tape), once, Key{PrivateKey: testKey}); err != nil {
+		t.Fatalf("Unable to co-sign tape: %v", err)
+	}
+	if err := CoSign(bytes.NewReader(once.Bytes()), new(bytes.Buffer), Key{PrivateKey: testKey}); err == nil {
+		t.Error("Should not co-sign a label twice with the same key")
+	}
+	if err := CoSign(bytes.NewReader(tape), new(bytes.Buffer), Key{PrivateKey: medKey}); err == nil {
+		t.Error("The sender should not be able to co-sign its own label")
+	}
+
+	twice := new(bytes.Buffer)
+	if err := CoSign(bytes.NewReader(once.Bytes()), twice, Key{PrivateKey: longKey}); err != nil {
+		t.Fatalf("Unable to co-sign tape a second time: %v", err)
+	}
+	if err := CheckSender(bytes.NewReader(twice.Bytes()), &medKey.PublicKey); err != nil {
+		t.Errorf("Co-signing should not break the trailer: %v", err)
+	}
+
+	key := Key{PrivateKey: medKey, PublicKey: &medKey.PublicKey}
+	key.Signers = &SignerPolicy{Keys: []*rsa.PublicKey{&testKey.PublicKey, &longKey.PublicKey}, Required: 2}
+	tr, err := OpenTapeWithKey(key, bytes.NewReader(twice.Bytes()))
+	if err != nil {
+		t.Fatalf("Unable to open a tape co-signed by both approvers: %v", err)
+	}
+	if signers := tr.Signers(); len(signers) != 3 || signers[0] != Fingerprint(&medKey.PublicKey) {
+		t.Errorf("Expected the sender and two co-signers but got %v", signers)
+	}
+	if contents, err := tr.Contents(); err != nil || len(contents) != 1 {
+		t.Errorf("Unable to read co-signed tape, got %v: %v", contents, err)
+	}
+
+	_, err = OpenTapeWithKey(key, bytes.NewReader(once.Bytes()))
+	if policyErr, ok := err.(*SignerPolicyError); !ok || len(policyErr.Verified) != 1 {
+		t.Errorf("Expected a signer policy error with one verified signer but got %v", err)
+	}
+
+	key.Signers = &SignerPolicy{Keys: []*rsa.PublicKey{&medKey.PublicKey, &testKey.PublicKey}, Required: 2}
+	if _, err = OpenTapeWithKey(key, bytes.NewReader(once.Bytes())); err != nil {
+		t.Errorf("The sender should count towards the signer policy: %v", err)
+	}
+}
+
+func TestCoSignTampered(t *testing.T) {
+	fs := setupFs()
+	createSimpleTape(fs, []string{pathFor("data", "db", "files", "db2.dat")})
+	tape, _ := afero.ReadFile(fs, pathFor("backups", "bk1.bak"))
+
+	out := new(bytes.Buffer)
+	if err := CoSign(bytes.NewReader(tape), out, Key{PrivateKey: testKey}); err != nil {
+		t.Fatalf("Unable to co-sign tape: %v", err)
+	}
+
+	raw, err := readRawLabel(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("Unable to read co-signed label: %v", err)
+	}
+	label := Label{header: raw.headerBytes, cosignatures: raw.cosignatures()}
+	label.cosignatures[0].Value[0] ^= 1
+	if signers := label.Signers([]*rsa.PublicKey{&testKey.PublicKey}); len(signers) != 0 {
+		t.Errorf("A tampered co-signature should not be verified, got %v", signers)
+	}
+}
+
+func TestCoSignFile(t *testing.T) {
+	fs := setupFs()
+	createSimpleTape(fs, []string{pathFor("data", "db", "files", "db2.dat")})
+	path := pathFor("backups", "bk1.bak")
+
+	if err := CoSignFile(fs, path, "", Key{PrivateKey: testKey}); err != nil {
+		t.Fatalf("Unable to co-sign tape in place: %v", err)
+	}
+
+	data, _ := afero.ReadFile(fs, path)
+	key := Key{PrivateKey: medKey, PublicKey: &medKey.PublicKey}
+	key.Signers = &SignerPolicy{Keys: []*rsa.PublicKey{&testKey.PublicKey}, Required: 1}
+	if _, err := OpenTapeWithKey(key, bytes.NewReader(data)); err != nil {
+		t.Errorf("Unable to open tape co-signed in place: %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package repository
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/x509"
+	"fmt"
+	"path/filepath"
+	"runtime"
+	"sort"
+
+	"github.com/darcinc/afero"
+)
+
+// KeystoreProblem is a problem found by CheckKeystore.  Key is empty when the
+// problem is with the keystore file or directory rather than a key.
+type KeystoreProblem struct {
+	Key     string
+	Problem string
+}
+
+// String formats the problem for display.
+func (p KeystoreProblem) String() string {
+	if p.Key == "" {
+		return p.Problem
+	}
+	return fmt.Sprintf("%s: %s", p.Key, p.Problem)
+}
+
+// CheckKeystore looks for problems with a keystore: RSA and hybrid keys
+// that cannot be parsed, are weaker than the policy allows or have expired,
+// the same key stored under more than one name, and a keystore file or
+// directory that users other than the owner can read.  When policy is nil
+// the keystore's own policy is used.
+func CheckKeystore(fs afero.Fs, location string, policy *Policy) ([]KeystoreProblem, error) {
+	keystorePath := KeystorePath(location)
+	problems := checkPermissions(fs, keystorePath)
+
+	file, err := fs.Open(keystorePath)
+	if err != nil {
+		return nil, NewError(err, fmt.Sprintf("Unable to open keystore %s", location))
+	}
+	defer file.Close()
+
+	keystore, err := OpenKeystore(file)
+	if err != nil {
+		return nil, NewError(err, fmt.Sprintf("Unable to read keystore %s", location))
+	}
+
+	if policy == nil {
+		policy = keystore.KeyPolicy()
+	}
+
+	names := map[string][]string{}
+	check := func(name string, pub crypto.PublicKey, fingerprint string) {
+		if err := policy.CheckKey(pub); err != nil {
+			problems = append(problems, KeystoreProblem{name, err.(*PolicyError).Reason})
+		}
+
+		created, ok := keystore.KeyCreated(name)
+		if !ok && policy.MaxKeyAgeDays > 0 {
+			problems = append(problems, KeystoreProblem{name, "key has no creation time, so its age is unknown"})
+		} else if err := policy.CheckAge(created); err != nil {
+			problems = append(problems, KeystoreProblem{name, err.(*PolicyError).Reason})
+		}
+
+		names[fingerprint] = append(names[fingerprint], name)
+	}
+
+	for _, name := range sortedNames(keystore.PrivateKeys) {
+		key, err := x509.ParsePKCS1PrivateKey(keystore.PrivateKeys[name])
+		if err != nil {
+			problems = append(problems, KeystoreProblem{name, fmt.Sprintf("private key cannot be parsed: %v", err)})
+			continue
+		}
+		check(name, &key.PublicKey, Fingerprint(&key.PublicKey))
+	}
+
+	for _, name := range sortedNames(keystore.PublicKeys) {
+		key, err := x509.ParsePKIXPublicKey(keystore.PublicKeys[name])
+		if err != nil {
+			problems = append(problems, KeystoreProblem{name, fmt.Sprintf("public key cannot be parsed: %v", err)})
+			continue
+		}
+		pub, ok := key.(*rsa.PublicKey)
+		if !ok {
+			problems = append(problems, KeystoreProblem{name, fmt.Sprintf("public key is a %T, not an RSA key", key)})
+			continue
+		}
+		check(name, pub, Fingerprint(pub))
+	}
+
+	for _, name := range sortedNames(keystore.HybridKeys) {
+		key, err := ParseHybridPrivateKey(keystore.HybridKeys[name])
+		if err != nil {
+			problems = append(problems, KeystoreProblem{name, fmt.Sprintf("hybrid key cannot be parsed: %v", err)})
+			continue
+		}
+		check(name, key.Public(), HybridFingerprint(key.Public()))
+	}
+
+	for _, name := range sortedNames(keystore.HybridPublicKeys) {
+		key, err := ParseHybridPublicKey(keystore.HybridPublicKeys[name])
+		if err != nil {
+			problems = append(problems, KeystoreProblem{name, fmt.Sprintf("hybrid public key cannot be parsed: %v", err)})
+			continue
+		}
+		check(name, key, HybridFingerprint(key))
+	}
+
+	fingerprints := []string{}
+	for fingerprint := range names {
+		fingerprints = append(fingerprints, fingerprint)
+	}
+	sort.Strings(fingerprints)
+
+	for _, fingerprint := range fingerprints {
+		if len(names[fingerprint]) > 1 {
+			problems = append(problems, KeystoreProblem{"", fmt.Sprintf("the same key is stored as %v", names[fingerprint])})
+		}
+	}
+
+	return problems, nil
+}
+
+// checkPermissions reports a keystore file or directory that is accessible
+// by anyone but its owner.  Windows permissions are not checked.
+func checkPermissions(fs afero.Fs, keystorePath string) []KeystoreProblem {
+	if runtime.GOOS == "windows" {
+		return nil
+	}
+
+	problems := []KeystoreProblem{}
+	for _, path := range []string{filepath.Dir(keystorePath), keystorePath} {
+		info, err := fs.Stat(path)
+		if err != nil {
+			continue
+		}
+		if info.Mode().Perm()&0077 != 0 {
+			problems = append(problems, KeystoreProblem{"", fmt.Sprintf("%s has mode %v, it should only be accessible by its owner", path, info.Mode().Perm())})
+		}
+	}
+
+	return problems
+}
+
+func sortedNames(keys map[string][]byte) []string {
+	result := []string{}
+	for name := range keys {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
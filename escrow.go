@@ -0,0 +1,62 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// EscrowMissingError is returned by CheckEscrow when a label does not wrap
+// the tape key for some of the escrow keys.
+type EscrowMissingError struct {
+	Fingerprints []string
+}
+
+func (e *EscrowMissingError) Error() string {
+	return fmt.Sprintf("Label has no escrow slot for %s", strings.Join(e.Fingerprints, ", "))
+}
+
+// addEscrow wraps the label's key for each of its escrow keys.
+func (l *Label) addEscrow(raw *rawLabel) error {
+	raw.header.Escrow = nil
+	for _, key := range l.Escrow {
+		wrapped := new(bytes.Buffer)
+		if err := l.writeHeader(wrapped, key); err != nil {
+			return NewError(err, "Unable to wrap the key for escrow")
+		}
+		raw.header.Escrow = append(raw.header.Escrow, keySlot{Recipient: Fingerprint(key), Wrapped: wrapped.Bytes()})
+	}
+	return nil
+}
+
+// CheckEscrow reads a label and checks that it wraps the tape key for each
+// of the escrow keys, returning an *EscrowMissingError if it does not.  No
+// private key is needed, so the label's signature, which covers the escrow
+// slots, is only checked when the tape is opened.
+func CheckEscrow(repoFile io.Reader, escrow []*rsa.PublicKey) error {
+	raw, err := readRawLabel(repoFile)
+	if err != nil {
+		return NewError(err, "Unable to read label")
+	}
+
+	present := map[string]bool{}
+	if raw.version != legacyLabelVersion {
+		for _, fingerprint := range raw.escrowed() {
+			present[fingerprint] = true
+		}
+	}
+
+	missing := []string{}
+	for _, key := range escrow {
+		if fingerprint := Fingerprint(key); !present[fingerprint] {
+			missing = append(missing, fingerprint)
+		}
+	}
+	if len(missing) > 0 {
+		return &EscrowMissingError{Fingerprints: missing}
+	}
+
+	return nil
+}
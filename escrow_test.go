@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestEscrowOpensTape(t *testing.T) {
+	fs := setupFs()
+	buffer := new(bytes.Buffer)
+	key := Key{
+		PrivateKey: medKey,
+		Custodians: []*rsa.PublicKey{&medKey.PublicKey, &longKey.PublicKey},
+		Threshold:  2,
+		Escrow:     []*rsa.PublicKey{&testKey.PublicKey},
+	}
+	tw, err := NewTapeWriter(key, buffer)
+	if err != nil {
+		t.Fatalf("Unable to write escrowed tape: %v", err)
+	}
+	tw.AddFile(fs, pathFor("data", "db", "files", "db2.dat"))
+	tw.Close()
+
+	if err = CheckEscrow(bytes.NewReader(buffer.Bytes()), key.Escrow); err != nil {
+		t.Errorf("Escrow slot not found: %v", err)
+	}
+
+	tr, err := OpenTape(testKey, &medKey.PublicKey, bytes.NewReader(buffer.Bytes()))
+	if err != nil {
+		t.Fatalf("Escrow key should open the tape: %v", err)
+	}
+	if contents, _ := tr.Contents(); len(contents) != 1 {
+		t.Errorf("Expected one file on the tape but got %v", contents)
+	}
+
+	keystore := &Keystore{PrivateKeys: map[string][]byte{}, PublicKeys: map[string][]byte{}}
+	keystore.AddPrivateKey("escrow", testKey)
+	keystore.AddPublicKey("sender", &medKey.PublicKey)
+	if _, err = OpenTapeWithProvider(NewKeystoreProvider(keystore), bytes.NewReader(buffer.Bytes())); err != nil {
+		t.Errorf("Escrow key should be found by fingerprint: %v", err)
+	}
+}
+
+func TestCheckEscrowFlagsMissingSlot(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	if _, err := NewTapeWriter(tapeKey, buffer); err != nil {
+		t.Fatalf("Unable to write tape: %v", err)
+	}
+
+	err := CheckEscrow(bytes.NewReader(buffer.Bytes()), []*rsa.PublicKey{&testKey.PublicKey})
+	missing, ok := err.(*EscrowMissingError)
+	if !ok {
+		t.Fatalf("Expected an EscrowMissingError but got %v", err)
+	}
+	if len(missing.Fingerprints) != 1 || missing.Fingerprints[0] != Fingerprint(&testKey.PublicKey) {
+		t.Errorf("Wrong fingerprints reported missing: %v", missing.Fingerprints)
+	}
+}
+
+func TestKeystoreEscrow(t *testing.T) {
+	keystore := &Keystore{PrivateKeys: map[string][]byte{}, PublicKeys: map[string][]byte{}}
+	keystore.AddPublicKey("corporate", &testKey.PublicKey)
+
+	if err := keystore.SetEscrow([]string{"missing"}); err == nil {
+		t.Error("Should not name a missing key as escrow")
+	}
+	if err := keystore.SetEscrow([]string{"corporate"}); err != nil {
+		t.Fatalf("Unable to set escrow: %v", err)
+	}
+
+	escrow, err := ProviderEscrow(NewKeystoreProvider(keystore))
+	if err != nil || len(escrow) != 1 || escrow[0].N.Cmp(testKey.N) != 0 {
+		t.Errorf("Wrong escrow keys %v: %v", escrow, err)
+	}
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"sort"
+
+	_ "golang.org/x/crypto/blake2b"
+)
+
+// Hash algorithms a tape can be signed with.  The algorithm is recorded in
+// the label header and used for the label signature, co-signatures, the
+// trailer, the metadata hash and the hashes in a sign-only tape's manifest.
+const (
+	HashSHA256  = "sha256"
+	HashSHA384  = "sha384"
+	HashSHA512  = "sha512"
+	HashBLAKE2b = "blake2b-512"
+
+	// DefaultHash is used when no hash algorithm is chosen, and by labels
+	// that do not record one.
+	DefaultHash = HashSHA256
+)
+
+var hashAlgorithms = map[string]crypto.Hash{
+	HashSHA256:  crypto.SHA256,
+	HashSHA384:  crypto.SHA384,
+	HashSHA512:  crypto.SHA512,
+	HashBLAKE2b: crypto.BLAKE2b_512,
+}
+
+// HashAlgorithms lists the names of the supported hash algorithms.
+func HashAlgorithms() []string {
+	result := []string{}
+	for name := range hashAlgorithms {
+		result = append(result, name)
+	}
+	sort.Strings(result)
+	return result
+}
+
+// lookupHash returns the hash algorithm with the given name.  An empty name
+// is the DefaultHash.
+func lookupHash(name string) (crypto.Hash, error) {
+	if name == "" {
+		name = DefaultHash
+	}
+	algorithm, ok := hashAlgorithms[name]
+	if !ok {
+		return 0, &UnsupportedVersionError{What: "hash algorithm", Value: name}
+	}
+	return algorithm, nil
+}
+
+// usesPSS reports whether signatures of digests made with the algorithm use
+// RSA-PSS.  PKCS#1 v1.5 has no encoding for BLAKE2b digests, so they are
+// signed with PSS; the SHA-2 digests are signed with PKCS#1 v1.5 as before.
+func usesPSS(algorithm crypto.Hash) bool {
+	return algorithm == crypto.BLAKE2b_512
+}
+
+// signingName describes how digests made with the algorithm are signed.
+func signingName(algorithm crypto.Hash) string {
+	if usesPSS(algorithm) {
+		return "RSA-PSS, " + algorithm.String()
+	}
+	return "RSA PKCS#1 v1.5, " + algorithm.String()
+}
+
+// signDigest signs a digest made with the algorithm.
+func signDigest(signKey crypto.Signer, algorithm crypto.Hash, digest []byte) ([]byte, error) {
+	if usesPSS(algorithm) {
+		return signKey.Sign(rand.Reader, digest, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash, Hash: algorithm})
+	}
+	return signKey.Sign(rand.Reader, digest, algorithm)
+}
+
+// verifyDigest checks a signature made by signDigest.
+func verifyDigest(publicKey *rsa.PublicKey, algorithm crypto.Hash, digest, signature []byte) error {
+	if usesPSS(algorithm) {
+		return rsa.VerifyPSS(publicKey, algorithm, digest, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+	}
+	return rsa.VerifyPKCS1v15(publicKey, algorithm, digest, signature)
+}
+
+// digestAlgorithm returns the label's hash algorithm.  Labels are only
+// written or read with supported algorithms.
+func (l *Label) digestAlgorithm() crypto.Hash {
+	algorithm, err := lookupHash(l.hashName)
+	if err != nil {
+		return crypto.SHA256
+	}
+	return algorithm
+}
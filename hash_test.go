@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"testing"
+)
+
+func writeHashTape(t *testing.T, key Key) []byte {
+	fs := setupFs()
+	out := new(bytes.Buffer)
+	tape, err := NewTapeWriter(key, out)
+	if err != nil {
+		t.Fatalf("Unable to create %s tape: %v", key.Hash, err)
+	}
+	if err = tape.AddDirectory(fs, pathFor("data", "db")); err != nil {
+		t.Fatalf("Unable to add files: %v", err)
+	}
+	if err = tape.Close(); err != nil {
+		t.Fatalf("Unable to close tape: %v", err)
+	}
+	return out.Bytes()
+}
+
+func TestTapeHashAlgorithms(t *testing.T) {
+	for _, name := range HashAlgorithms() {
+		key := tapeKey
+		key.Hash = name
+		key.Metadata = &Metadata{Description: name}
+		tape := writeHashTape(t, key)
+
+		tr, err := OpenTape(medKey, &medKey.PublicKey, bytes.NewReader(tape))
+		if err != nil {
+			t.Fatalf("Unable to open %s tape: %v", name, err)
+		}
+		if tr.Metadata() == nil || tr.Metadata().Description != name {
+			t.Errorf("Wrong metadata on %s tape: %v", name, tr.Metadata())
+		}
+		if err = CheckSender(bytes.NewReader(tape), &medKey.PublicKey); err != nil {
+			t.Errorf("Unable to check the trailer of %s tape: %v", name, err)
+		}
+
+		cosigned := new(bytes.Buffer)
+		if err = CoSign(bytes.NewReader(tape), cosigned, Key{PrivateKey: testKey}); err != nil {
+			t.Fatalf("Unable to co-sign %s tape: %v", name, err)
+		}
+		tr, err = OpenTape(medKey, &medKey.PublicKey, bytes.NewReader(cosigned.Bytes()))
+		if err != nil {
+			t.Fatalf("Unable to open co-signed %s tape: %v", name, err)
+		}
+		if signers := tr.Key.Label.Signers([]*rsa.PublicKey{&testKey.PublicKey}); len(signers) != 2 {
+			t.Errorf("Expected the co-signature on %s tape to verify but got %v", name, signers)
+		}
+
+		info, err := InspectTape(bytes.NewReader(tape))
+		if err != nil || info.Hash != name {
+			t.Errorf("Expected inspection to report %s but got %v: %v", name, info.Hash, err)
+		}
+	}
+}
+
+func TestSignOnlyTapeHash(t *testing.T) {
+	key := Key{PrivateKey: medKey, SignOnly: true, Hash: HashBLAKE2b}
+	tape := writeHashTape(t, key)
+
+	manifest, err := VerifyTape(bytes.NewReader(tape), &medKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Unable to verify BLAKE2b sign-only tape: %v", err)
+	}
+	if len(manifest) != 4 || manifest[3].SHA256 != "" || len(manifest[3].Sum()) != 128 {
+		t.Errorf("Expected BLAKE2b digests in the manifest but got %v", manifest)
+	}
+}
+
+func TestHashPolicy(t *testing.T) {
+	key := tapeKey
+	key.Hash = "md5"
+	if _, err := NewTapeWriter(key, new(bytes.Buffer)); err == nil {
+		t.Error("Should not write a tape with an unsupported hash algorithm")
+	}
+
+	policy := DefaultPolicy()
+	policy.Hashes = []string{HashSHA384, HashSHA512}
+	key.Policy = policy
+	key.Hash = ""
+	if _, err := NewTapeWriter(key, new(bytes.Buffer)); err == nil {
+		t.Error("Should not write a tape with a hash algorithm the policy does not allow")
+	}
+
+	key.Hash = HashSHA384
+	tape := writeHashTape(t, key)
+	reader := Key{PrivateKey: medKey, PublicKey: &medKey.PublicKey, Policy: policy}
+	if _, err := OpenTapeWithKey(reader, bytes.NewReader(tape)); err != nil {
+		t.Errorf("Unable to open a tape with an allowed hash algorithm: %v", err)
+	}
+
+	key.Policy = nil
+	tape = writeHashTape(t, tapeKey)
+	_, err := OpenTapeWithKey(reader, bytes.NewReader(tape))
+	if _, ok := err.(*PolicyError); !ok {
+		t.Errorf("Expected a policy error opening a SHA-256 tape but got %v", err)
+	}
+	err = CheckSenderWithPolicy(bytes.NewReader(tape), &medKey.PublicKey, policy)
+	if _, ok := err.(*PolicyError); !ok {
+		t.Errorf("Expected a policy error checking the sender of a SHA-256 tape but got %v", err)
+	}
+
+	policy.Hashes = []string{"md5"}
+	if err = policy.Validate(); err == nil {
+		t.Error("Should not validate a policy allowing an unknown hash algorithm")
+	}
+}
@@ -0,0 +1,156 @@
+package repository
+
+import (
+	"crypto/ecdh"
+	"crypto/mlkem"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/pem"
+	"errors"
+	"fmt"
+)
+
+// HybridKeyType names hybrid ML-KEM-768 and X25519 keys in keystores and
+// policies.
+const HybridKeyType = "mlkem768-x25519"
+
+// PEM block types for hybrid keys.
+const (
+	hybridPublicPEM  = "MLKEM768-X25519 PUBLIC KEY"
+	hybridPrivatePEM = "MLKEM768-X25519 PRIVATE KEY"
+)
+
+// hybridSeedSize is the size of an ML-KEM-768 decapsulation key seed.
+const hybridSeedSize = 64
+
+// HybridPublicKey is a recipient key that combines an ML-KEM-768
+// encapsulation key with an X25519 key.  A tape key wrapped for it stays
+// confidential unless both are broken.
+type HybridPublicKey struct {
+	MLKEM  *mlkem.EncapsulationKey768
+	X25519 *ecdh.PublicKey
+}
+
+// HybridPrivateKey is the private half of a HybridPublicKey.
+type HybridPrivateKey struct {
+	MLKEM  *mlkem.DecapsulationKey768
+	X25519 *ecdh.PrivateKey
+}
+
+// HybridKeyProvider is implemented by key providers that hold hybrid keys.
+type HybridKeyProvider interface {
+	// HybridPublicKey returns the named hybrid public key.
+	HybridPublicKey(name string) (*HybridPublicKey, error)
+
+	// FindHybridKey returns the hybrid private key with the given
+	// fingerprint, see HybridFingerprint.
+	FindHybridKey(fingerprint string) (*HybridPrivateKey, error)
+}
+
+// GenerateHybridKey generates a new hybrid key.
+func GenerateHybridKey() (*HybridPrivateKey, error) {
+	mlkemKey, err := mlkem.GenerateKey768()
+	if err != nil {
+		return nil, NewError(err, "Unable to generate ML-KEM key")
+	}
+
+	x25519Key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, NewError(err, "Unable to generate X25519 key")
+	}
+
+	return &HybridPrivateKey{MLKEM: mlkemKey, X25519: x25519Key}, nil
+}
+
+// Public returns the public half of the key.
+func (k *HybridPrivateKey) Public() *HybridPublicKey {
+	return &HybridPublicKey{MLKEM: k.MLKEM.EncapsulationKey(), X25519: k.X25519.PublicKey()}
+}
+
+// Bytes encodes the key as the ML-KEM seed followed by the X25519 key.
+func (k *HybridPrivateKey) Bytes() []byte {
+	return append(k.MLKEM.Bytes(), k.X25519.Bytes()...)
+}
+
+// ParseHybridPrivateKey decodes a key encoded by HybridPrivateKey.Bytes.
+func ParseHybridPrivateKey(data []byte) (*HybridPrivateKey, error) {
+	if len(data) != hybridSeedSize+32 {
+		return nil, errors.New("Hybrid private key has the wrong size")
+	}
+
+	mlkemKey, err := mlkem.NewDecapsulationKey768(data[:hybridSeedSize])
+	if err != nil {
+		return nil, err
+	}
+	x25519Key, err := ecdh.X25519().NewPrivateKey(data[hybridSeedSize:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &HybridPrivateKey{MLKEM: mlkemKey, X25519: x25519Key}, nil
+}
+
+// Bytes encodes the key as the ML-KEM encapsulation key followed by the
+// X25519 key.
+func (k *HybridPublicKey) Bytes() []byte {
+	return append(k.MLKEM.Bytes(), k.X25519.Bytes()...)
+}
+
+// ParseHybridPublicKey decodes a key encoded by HybridPublicKey.Bytes.
+func ParseHybridPublicKey(data []byte) (*HybridPublicKey, error) {
+	if len(data) != mlkem.EncapsulationKeySize768+32 {
+		return nil, errors.New("Hybrid public key has the wrong size")
+	}
+
+	mlkemKey, err := mlkem.NewEncapsulationKey768(data[:mlkem.EncapsulationKeySize768])
+	if err != nil {
+		return nil, err
+	}
+	x25519Key, err := ecdh.X25519().NewPublicKey(data[mlkem.EncapsulationKeySize768:])
+	if err != nil {
+		return nil, err
+	}
+
+	return &HybridPublicKey{MLKEM: mlkemKey, X25519: x25519Key}, nil
+}
+
+// HybridFingerprint identifies a hybrid public key.  It is the hex encoded
+// SHA-256 hash of the key's encoding.
+func HybridFingerprint(key *HybridPublicKey) string {
+	return fmt.Sprintf("%x", sha256.Sum256(key.Bytes()))
+}
+
+// EncodeHybridKey encodes a hybrid private or public key as PEM.
+func EncodeHybridKey(priv *HybridPrivateKey, pub *HybridPublicKey) []byte {
+	if priv != nil {
+		return pem.EncodeToMemory(&pem.Block{Type: hybridPrivatePEM, Bytes: priv.Bytes()})
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: hybridPublicPEM, Bytes: pub.Bytes()})
+}
+
+// DecodeHybridKey decodes a PEM encoded hybrid key.  Returns the private
+// key, if the data holds one, and the public key.  Returns an error if the
+// data does not hold a hybrid key.
+func DecodeHybridKey(data []byte) (*HybridPrivateKey, *HybridPublicKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("No PEM block found")
+	}
+
+	switch block.Type {
+	case hybridPrivatePEM:
+		priv, err := ParseHybridPrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, NewError(err, "Unable to parse hybrid private key")
+		}
+		return priv, priv.Public(), nil
+	case hybridPublicPEM:
+		pub, err := ParseHybridPublicKey(block.Bytes)
+		if err != nil {
+			return nil, nil, NewError(err, "Unable to parse hybrid public key")
+		}
+		return nil, pub, nil
+	}
+
+	return nil, nil, fmt.Errorf("PEM block %s is not a hybrid key", block.Type)
+}
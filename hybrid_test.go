@@ -0,0 +1,86 @@
+package repository
+
+import (
+	"bytes"
+	"testing"
+)
+
+var hybridKey = generateHybridKey()
+
+func generateHybridKey() *HybridPrivateKey {
+	key, err := GenerateHybridKey()
+	if err != nil {
+		panic(err)
+	}
+	return key
+}
+
+func TestHybridKeyEncoding(t *testing.T) {
+	priv, pub, err := DecodeHybridKey(EncodeHybridKey(hybridKey, nil))
+	if err != nil {
+		t.Fatalf("Unable to decode hybrid private key: %v", err)
+	}
+	if !bytes.Equal(priv.Bytes(), hybridKey.Bytes()) || HybridFingerprint(pub) != HybridFingerprint(hybridKey.Public()) {
+		t.Error("Hybrid private key changed when encoded")
+	}
+
+	priv, pub, err = DecodeHybridKey(EncodeHybridKey(nil, hybridKey.Public()))
+	if err != nil {
+		t.Fatalf("Unable to decode hybrid public key: %v", err)
+	}
+	if priv != nil || !bytes.Equal(pub.Bytes(), hybridKey.Public().Bytes()) {
+		t.Error("Hybrid public key changed when encoded")
+	}
+
+	rsaKey := new(bytes.Buffer)
+	EncodeKey(rsaKey, FormatPEM, "test", nil, &medKey.PublicKey, nil)
+	if _, _, err = DecodeHybridKey(rsaKey.Bytes()); err == nil {
+		t.Error("RSA key should not decode as a hybrid key")
+	}
+}
+
+func TestHybridTape(t *testing.T) {
+	keystore := &Keystore{PrivateKeys: map[string][]byte{}, PublicKeys: map[string][]byte{}}
+	keystore.AddHybridKey("mine", hybridKey)
+	keystore.AddPublicKey("sender", &medKey.PublicKey)
+	provider := NewKeystoreProvider(keystore)
+
+	fs := setupFs()
+	buffer := new(bytes.Buffer)
+	tw, err := NewTapeWriter(Key{HybridKey: hybridKey.Public(), PrivateKey: medKey}, buffer)
+	if err != nil {
+		t.Fatalf("Unable to write hybrid tape: %v", err)
+	}
+	tw.AddFile(fs, pathFor("data", "db", "files", "db2.dat"))
+	tw.Close()
+
+	if !bytes.Contains(buffer.Bytes(), []byte(`"mode":"mlkem768-x25519"`)) {
+		t.Error("Expected a hybrid label")
+	}
+
+	tr, err := OpenTapeWithProvider(provider, bytes.NewReader(buffer.Bytes()))
+	if err != nil {
+		t.Fatalf("Unable to open hybrid tape: %v", err)
+	}
+	if contents, _ := tr.Contents(); len(contents) != 1 {
+		t.Errorf("Expected one file on the tape but got %v", contents)
+	}
+
+	_, err = OpenTapeWithKey(Key{PublicKey: &medKey.PublicKey, HybridKeys: provider}, bytes.NewReader(buffer.Bytes()))
+	if err != nil {
+		t.Errorf("Unable to open hybrid tape with a key: %v", err)
+	}
+
+	_, err = OpenTape(medKey, &medKey.PublicKey, bytes.NewReader(buffer.Bytes()))
+	if err == nil {
+		t.Error("Hybrid tape should not open with an RSA key")
+	}
+
+	other := &Keystore{PrivateKeys: map[string][]byte{}, PublicKeys: map[string][]byte{}}
+	other.AddHybridKey("other", generateHybridKey())
+	other.AddPublicKey("sender", &medKey.PublicKey)
+	_, err = OpenTapeWithProvider(NewKeystoreProvider(other), bytes.NewReader(buffer.Bytes()))
+	if _, ok := err.(*Error); !ok {
+		t.Errorf("Expected the tape not to open with another hybrid key but got %v", err)
+	}
+}
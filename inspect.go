@@ -0,0 +1,161 @@
+package repository
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// SlotInfo describes one wrapped copy of the tape key.  Recipient is the
+// fingerprint of the key it is wrapped for, Wrapping how it is wrapped, and
+// Bits the size of the recipient's RSA key implied by the length of the
+// wrapped key, or 0 if the key is not RSA wrapped.
+type SlotInfo struct {
+	Recipient string
+	Wrapping  string
+	Bits      int
+	Prekey    string
+}
+
+// SignatureInfo describes one signature in a label.  Bits is the size of the
+// signer's RSA key implied by the length of the signature.  Signatures are
+// not checked.
+type SignatureInfo struct {
+	Signer string
+	Sender bool
+	Bits   int
+}
+
+// TapeInfo describes the structure of a tape or detached label as far as it
+// can be read without any key.  Labels written before versioning only record
+// their Version.
+type TapeInfo struct {
+	Version       int
+	Mode          string
+	Cipher        string
+	Hash          string
+	Compression   string
+	Signing       string
+	Sender        string
+	Slots         []SlotInfo
+	Escrow        []SlotInfo
+	Threshold     int
+	Signatures    []SignatureInfo
+	NotBefore     time.Time
+	NotAfter      time.Time
+	Stream        *Stream
+	Metadata      bool
+	LabelSize     int64
+	PayloadSize   int64
+	Trailer       bool
+	TrailerSigner string
+	TrailerBits   int
+	Manifest      bool
+}
+
+// InspectTape reads the structure of a tape or detached label without
+// decrypting it or checking any signature.  If the tape is corrupt the
+// error says where, and the information read up to that point is returned
+// with it.
+func InspectTape(tape io.ReadSeeker) (*TapeInfo, error) {
+	result := &TapeInfo{}
+	if _, err := tape.Seek(0, io.SeekStart); err != nil {
+		return result, err
+	}
+
+	counter := &countingReader{in: tape}
+	raw, err := readRawLabel(counter)
+	if err != nil {
+		return result, NewError(err, "Unable to read label")
+	}
+	result.Version = raw.version
+	if raw.version == legacyLabelVersion {
+		return result, nil
+	}
+	result.LabelSize = counter.count
+	raw.inspect(result)
+
+	end, trailer, err := findTrailer(tape)
+	if err != nil {
+		return result, NewError(err, "Unable to read tape trailer")
+	}
+	if end < result.LabelSize {
+		return result, fmt.Errorf("Tape ends at %d bytes, inside its %d byte label", end, result.LabelSize)
+	}
+	result.PayloadSize = end - result.LabelSize
+	if trailer != nil {
+		result.Trailer = true
+		result.TrailerSigner = trailer.Signer
+		result.TrailerBits = len(trailer.Signature) * 8
+		result.Manifest = trailer.Manifest != nil
+	}
+	return result, nil
+}
+
+// inspect describes the label header and signatures.
+func (raw *rawLabel) inspect(info *TapeInfo) {
+	info.Mode = raw.header.Mode
+	info.Sender = raw.header.Sender
+	info.Threshold = raw.header.Threshold
+	info.Stream = raw.header.Stream
+	info.Metadata = raw.header.Metadata != ""
+	if raw.header.NotBefore != nil {
+		info.NotBefore = *raw.header.NotBefore
+	}
+	if raw.header.NotAfter != nil {
+		info.NotAfter = *raw.header.NotAfter
+	}
+
+	info.Compression = raw.header.Compression
+	if info.Compression == "" {
+		info.Compression = CompressionNone
+	}
+	info.Hash = raw.header.Hash
+	if info.Hash == "" {
+		info.Hash = DefaultHash
+	}
+	if algorithm, err := lookupHash(info.Hash); err == nil {
+		info.Signing = signingName(algorithm)
+	} else {
+		info.Signing = "unknown"
+	}
+	info.Cipher = "AES-256-CTR"
+	if raw.header.Mode == modeSigned {
+		info.Cipher = "none"
+	}
+
+	for _, slot := range raw.header.Slots {
+		info.Slots = append(info.Slots, raw.header.inspectSlot(slot))
+	}
+	for _, slot := range raw.header.Escrow {
+		info.Escrow = append(info.Escrow, SlotInfo{Recipient: slot.Recipient, Wrapping: "RSA PKCS#1 v1.5", Bits: len(slot.Wrapped) * 8})
+	}
+	for _, sig := range raw.signatures {
+		info.Signatures = append(info.Signatures, SignatureInfo{Signer: sig.Signer, Sender: sig.Signer == raw.header.Sender, Bits: len(sig.Value) * 8})
+	}
+}
+
+// inspectSlot describes how a slot wraps the tape key.
+func (h *labelHeader) inspectSlot(slot keySlot) SlotInfo {
+	result := SlotInfo{Recipient: slot.Recipient, Prekey: slot.Prekey}
+	switch h.Mode {
+	case modeRSA:
+		result.Wrapping = "RSA PKCS#1 v1.5"
+		result.Bits = len(slot.Wrapped) * 8
+	case modeThreshold:
+		result.Wrapping = "Shamir share, RSA PKCS#1 v1.5"
+		result.Bits = len(slot.Wrapped) * 8
+	case modeECDH:
+		result.Wrapping = "X25519 prekey, HKDF-SHA256, AES-256-GCM"
+	case modeHybrid:
+		result.Wrapping = "ML-KEM-768 and X25519, HKDF-SHA256, AES-256-GCM"
+	case modePassphrase:
+		result.Wrapping = "passphrase, AES-256-GCM"
+		if slot.KDF != nil {
+			result.Wrapping = fmt.Sprintf("passphrase, %s (time %d, memory %d KiB, threads %d), AES-256-GCM", slot.KDF.Name, slot.KDF.Time, slot.KDF.Memory, slot.KDF.Threads)
+		}
+	default:
+		result.Wrapping = "unknown"
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/darcinc/afero"
+)
+
+func TestInspectTape(t *testing.T) {
+	fs := setupFs()
+	createSimpleTape(fs, []string{pathFor("data", "db", "files", "db2.dat")})
+	tape, _ := afero.ReadFile(fs, pathFor("backups", "bk1.bak"))
+
+	info, err := InspectTape(bytes.NewReader(tape))
+	if err != nil {
+		t.Fatalf("Unable to inspect tape: %v", err)
+	}
+	if info.Version != labelVersion || info.Mode != modeRSA || info.Sender != Fingerprint(&medKey.PublicKey) {
+		t.Errorf("Wrong label description %+v", info)
+	}
+	if len(info.Slots) != 1 || info.Slots[0].Recipient != Fingerprint(&medKey.PublicKey) || info.Slots[0].Bits != medKey.N.BitLen() {
+		t.Errorf("Wrong recipient slots %+v", info.Slots)
+	}
+	if len(info.Signatures) != 1 || !info.Signatures[0].Sender || info.Signatures[0].Bits != medKey.N.BitLen() {
+		t.Errorf("Wrong signatures %+v", info.Signatures)
+	}
+	if !info.Trailer || info.TrailerSigner != info.Sender || info.Manifest {
+		t.Errorf("Wrong trailer description %+v", info)
+	}
+
+	end, _, _ := findTrailer(bytes.NewReader(tape))
+	if info.LabelSize+info.PayloadSize != end {
+		t.Errorf("Label of %d bytes and payload of %d bytes do not end at the trailer at %d", info.LabelSize, info.PayloadSize, end)
+	}
+
+	if info, err = InspectTape(bytes.NewReader(tape[:info.LabelSize-10])); err == nil {
+		t.Error("Should report a truncated label")
+	}
+}
+
+func TestInspectPassphraseTape(t *testing.T) {
+	out := new(bytes.Buffer)
+	tape, err := NewTapeWriter(Key{Passphrase: []byte("secret")}, out)
+	if err != nil {
+		t.Fatalf("Unable to create tape: %v", err)
+	}
+	tape.Close()
+
+	info, err := InspectTape(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("Unable to inspect tape: %v", err)
+	}
+	if info.Mode != modePassphrase || info.Trailer || len(info.Signatures) != 0 || len(info.Slots) != 1 || info.Slots[0].Bits != 0 {
+		t.Errorf("Wrong description of an unsigned passphrase tape %+v", info)
+	}
+}
@@ -0,0 +1,410 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"time"
+
+	"github.com/youmark/pkcs8"
+	"golang.org/x/crypto/ssh"
+	"software.sslmate.com/src/go-pkcs12"
+)
+
+// KeyFormat names an encoding used when importing or exporting keys.
+type KeyFormat string
+
+const (
+	// FormatPEM is PEM encoded PKCS#1 private keys and PKIX public keys.
+	FormatPEM KeyFormat = "pem"
+	// FormatPKCS8 is PEM encoded PKCS#8 private keys, encrypted when a
+	// passphrase is given, and PKIX public keys.
+	FormatPKCS8 KeyFormat = "pkcs8"
+	// FormatOpenSSH is an OpenSSH private key (id_rsa) or an authorized_keys
+	// line for public keys.
+	FormatOpenSSH KeyFormat = "openssh"
+	// FormatJWK is a JSON Web Key.
+	FormatJWK KeyFormat = "jwk"
+	// FormatPKCS12 is a PKCS#12 bundle containing the private key and a
+	// self-signed certificate for it.
+	FormatPKCS12 KeyFormat = "pkcs12"
+)
+
+// KeyFormats is the list of supported key formats.
+var KeyFormats = []KeyFormat{FormatPEM, FormatPKCS8, FormatOpenSSH, FormatJWK, FormatPKCS12}
+
+// ParseKeyFormat converts a format name into a KeyFormat.  An empty name
+// is returned as an empty format, which means detect the format when
+// importing and FormatPEM when exporting.
+func ParseKeyFormat(name string) (KeyFormat, error) {
+	if name == "" {
+		return "", nil
+	}
+
+	for _, f := range KeyFormats {
+		if string(f) == name {
+			return f, nil
+		}
+	}
+
+	return "", fmt.Errorf("Unknown key format %s", name)
+}
+
+// DecodeKey parses a key in the given format.  If the data holds a private
+// key it is returned along with its public key, otherwise the private key
+// is nil.  The passphrase is used for encrypted PKCS#8, OpenSSH and PKCS#12
+// keys and may be nil.  An empty format detects the format from the data.
+func DecodeKey(data []byte, format KeyFormat, passphrase []byte) (*rsa.PrivateKey, *rsa.PublicKey, error) {
+	if format == "" {
+		format = detectKeyFormat(data)
+	}
+
+	var priv interface{}
+	var pub interface{}
+	var err error
+
+	switch format {
+	case FormatPEM, FormatPKCS8:
+		priv, pub, err = decodePEMKey(data, format, passphrase)
+	case FormatOpenSSH:
+		priv, pub, err = decodeOpenSSHKey(data, passphrase)
+	case FormatJWK:
+		priv, pub, err = decodeJWK(data)
+	case FormatPKCS12:
+		priv, _, err = pkcs12.Decode(data, string(passphrase))
+	default:
+		err = fmt.Errorf("Unknown key format %s", format)
+	}
+	if err != nil {
+		return nil, nil, NewError(err, fmt.Sprintf("Unable to decode %s key", format))
+	}
+
+	if priv != nil {
+		pk, ok := priv.(*rsa.PrivateKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("Unsupported private key type %T", priv)
+		}
+		return pk, &pk.PublicKey, nil
+	}
+
+	pk, ok := pub.(*rsa.PublicKey)
+	if !ok {
+		return nil, nil, fmt.Errorf("Unsupported public key type %T", pub)
+	}
+	return nil, pk, nil
+}
+
+// EncodeKey writes a key in the given format.  When the private key is
+// given it is written, otherwise only the public key is written.  The name
+// is used as the key comment, key ID or certificate subject where the
+// format has one.  The passphrase encrypts PKCS#8, OpenSSH and PKCS#12
+// private keys and may be nil.
+func EncodeKey(out io.Writer, format KeyFormat, name string, priv *rsa.PrivateKey, pub *rsa.PublicKey, passphrase []byte) error {
+	if priv != nil {
+		pub = &priv.PublicKey
+	}
+
+	var err error
+	switch format {
+	case "", FormatPEM:
+		err = encodePEMKey(out, priv, pub)
+	case FormatPKCS8:
+		err = encodePKCS8Key(out, priv, pub, passphrase)
+	case FormatOpenSSH:
+		err = encodeOpenSSHKey(out, name, priv, pub, passphrase)
+	case FormatJWK:
+		err = encodeJWK(out, name, priv, pub)
+	case FormatPKCS12:
+		err = encodePKCS12(out, name, priv, passphrase)
+	default:
+		err = fmt.Errorf("Unknown key format %s", format)
+	}
+	if err != nil {
+		return NewError(err, fmt.Sprintf("Unable to encode key %s", name))
+	}
+
+	return nil
+}
+
+func detectKeyFormat(data []byte) KeyFormat {
+	trimmed := bytes.TrimSpace(data)
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("{")):
+		return FormatJWK
+	case bytes.HasPrefix(trimmed, []byte("ssh-rsa ")):
+		return FormatOpenSSH
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return FormatPKCS12
+	}
+
+	switch block.Type {
+	case "OPENSSH PRIVATE KEY":
+		return FormatOpenSSH
+	case "PRIVATE KEY", "ENCRYPTED PRIVATE KEY":
+		return FormatPKCS8
+	}
+	return FormatPEM
+}
+
+// decodePEMKey returns the first private key in the PEM data or, failing
+// that, the first public key.  Keys written by older versions used the
+// RSA PUBLIC KEY type for PKIX public keys and PRIVATE KEY for PKCS#1
+// private keys, so both encodings are tried for those types.
+func decodePEMKey(data []byte, format KeyFormat, passphrase []byte) (interface{}, interface{}, error) {
+	var pub interface{}
+
+	for block, rest := pem.Decode(data); block != nil; block, rest = pem.Decode(rest) {
+		switch block.Type {
+		case "RSA PRIVATE KEY", "PRIVATE KEY":
+			if pk, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+				return pk, nil, nil
+			}
+			pk, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+			return pk, nil, err
+		case "ENCRYPTED PRIVATE KEY":
+			if format != FormatPKCS8 {
+				return nil, nil, errors.New("Encrypted private keys require the pkcs8 format")
+			}
+			pk, err := pkcs8.ParsePKCS8PrivateKeyRSA(block.Bytes, passphrase)
+			return pk, nil, err
+		case "PUBLIC KEY", "RSA PUBLIC KEY":
+			if pub != nil {
+				continue
+			}
+			var err error
+			if pub, err = x509.ParsePKIXPublicKey(block.Bytes); err != nil {
+				if pub, err = x509.ParsePKCS1PublicKey(block.Bytes); err != nil {
+					return nil, nil, err
+				}
+			}
+		}
+	}
+
+	if pub == nil {
+		return nil, nil, errors.New("No PEM encoded key found")
+	}
+	return nil, pub, nil
+}
+
+func encodePEMKey(out io.Writer, priv *rsa.PrivateKey, pub *rsa.PublicKey) error {
+	if priv != nil {
+		block := &pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(priv)}
+		if err := pem.Encode(out, block); err != nil {
+			return err
+		}
+	}
+
+	return encodePKIXPublicKey(out, pub)
+}
+
+func encodePKCS8Key(out io.Writer, priv *rsa.PrivateKey, pub *rsa.PublicKey, passphrase []byte) error {
+	if priv != nil {
+		bytes, err := pkcs8.MarshalPrivateKey(priv, passphrase, nil)
+		if err != nil {
+			return err
+		}
+
+		blockType := "PRIVATE KEY"
+		if len(passphrase) > 0 {
+			blockType = "ENCRYPTED PRIVATE KEY"
+		}
+		if err = pem.Encode(out, &pem.Block{Type: blockType, Bytes: bytes}); err != nil {
+			return err
+		}
+	}
+
+	return encodePKIXPublicKey(out, pub)
+}
+
+func encodePKIXPublicKey(out io.Writer, pub *rsa.PublicKey) error {
+	bytes, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return err
+	}
+
+	return pem.Encode(out, &pem.Block{Type: "PUBLIC KEY", Bytes: bytes})
+}
+
+func decodeOpenSSHKey(data []byte, passphrase []byte) (interface{}, interface{}, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte("ssh-")) {
+		key, _, _, _, err := ssh.ParseAuthorizedKey(data)
+		if err != nil {
+			return nil, nil, err
+		}
+		cryptoKey, ok := key.(ssh.CryptoPublicKey)
+		if !ok {
+			return nil, nil, fmt.Errorf("Unsupported SSH key type %s", key.Type())
+		}
+		return nil, cryptoKey.CryptoPublicKey(), nil
+	}
+
+	if len(passphrase) > 0 {
+		pk, err := ssh.ParseRawPrivateKeyWithPassphrase(data, passphrase)
+		return pk, nil, err
+	}
+	pk, err := ssh.ParseRawPrivateKey(data)
+	return pk, nil, err
+}
+
+func encodeOpenSSHKey(out io.Writer, name string, priv *rsa.PrivateKey, pub *rsa.PublicKey, passphrase []byte) error {
+	if priv == nil {
+		key, err := ssh.NewPublicKey(pub)
+		if err != nil {
+			return err
+		}
+		line := bytes.TrimSpace(ssh.MarshalAuthorizedKey(key))
+		_, err = fmt.Fprintf(out, "%s %s\n", line, name)
+		return err
+	}
+
+	var block *pem.Block
+	var err error
+	if len(passphrase) > 0 {
+		block, err = ssh.MarshalPrivateKeyWithPassphrase(priv, name, passphrase)
+	} else {
+		block, err = ssh.MarshalPrivateKey(priv, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	return pem.Encode(out, block)
+}
+
+// jsonWebKey is an RSA JSON Web Key as described in RFC 7517 and RFC 7518.
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	D   string `json:"d,omitempty"`
+	P   string `json:"p,omitempty"`
+	Q   string `json:"q,omitempty"`
+	DP  string `json:"dp,omitempty"`
+	DQ  string `json:"dq,omitempty"`
+	QI  string `json:"qi,omitempty"`
+}
+
+func jwkEncode(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func jwkDecode(s string) (*big.Int, error) {
+	bytes, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(bytes), nil
+}
+
+func decodeJWK(data []byte) (interface{}, interface{}, error) {
+	key := jsonWebKey{}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, nil, err
+	}
+	if key.Kty != "RSA" {
+		return nil, nil, fmt.Errorf("Unsupported JWK key type %s", key.Kty)
+	}
+
+	values := []string{key.N, key.E}
+	if key.D != "" {
+		values = append(values, key.D, key.P, key.Q)
+	}
+	ints := make([]*big.Int, len(values))
+	for i, v := range values {
+		var err error
+		if ints[i], err = jwkDecode(v); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	pub := &rsa.PublicKey{N: ints[0], E: int(ints[1].Int64())}
+	if key.D == "" {
+		return nil, pub, nil
+	}
+
+	priv := &rsa.PrivateKey{PublicKey: *pub, D: ints[2], Primes: []*big.Int{ints[3], ints[4]}}
+	if err := priv.Validate(); err != nil {
+		return nil, nil, err
+	}
+	priv.Precompute()
+
+	return priv, nil, nil
+}
+
+func encodeJWK(out io.Writer, name string, priv *rsa.PrivateKey, pub *rsa.PublicKey) error {
+	key := jsonWebKey{
+		Kty: "RSA",
+		Kid: name,
+		N:   jwkEncode(pub.N),
+		E:   jwkEncode(big.NewInt(int64(pub.E))),
+	}
+
+	if priv != nil {
+		if len(priv.Primes) != 2 {
+			return errors.New("JWK export supports only two prime RSA keys")
+		}
+		priv.Precompute()
+		key.D = jwkEncode(priv.D)
+		key.P = jwkEncode(priv.Primes[0])
+		key.Q = jwkEncode(priv.Primes[1])
+		key.DP = jwkEncode(priv.Precomputed.Dp)
+		key.DQ = jwkEncode(priv.Precomputed.Dq)
+		key.QI = jwkEncode(priv.Precomputed.Qinv)
+	}
+
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(key)
+}
+
+// encodePKCS12 writes the private key and a self-signed certificate for it,
+// since PKCS#12 readers expect every key to be paired with a certificate.
+func encodePKCS12(out io.Writer, name string, priv *rsa.PrivateKey, passphrase []byte) error {
+	if priv == nil {
+		return errors.New("PKCS#12 export requires a private key")
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    now,
+		NotAfter:     now.AddDate(10, 0, 0),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &priv.PublicKey, priv)
+	if err != nil {
+		return err
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		return err
+	}
+
+	pfx, err := pkcs12.Modern.Encode(priv, cert, nil, string(passphrase))
+	if err != nil {
+		return err
+	}
+
+	_, err = out.Write(pfx)
+	return err
+}
@@ -0,0 +1,84 @@
+package repository
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestKeyFormatRoundTrip(t *testing.T) {
+	for _, format := range KeyFormats {
+		for _, passphrase := range [][]byte{nil, []byte("secret")} {
+			buffer := new(bytes.Buffer)
+			err := EncodeKey(buffer, format, "test", shortKey, nil, passphrase)
+			if err != nil {
+				t.Fatalf("Unable to encode %s key: %v", format, err)
+			}
+
+			priv, pub, err := DecodeKey(buffer.Bytes(), "", passphrase)
+			if err != nil {
+				t.Fatalf("Unable to decode %s key: %v", format, err)
+			}
+
+			if priv == nil || priv.D.Cmp(shortKey.D) != 0 {
+				t.Errorf("Private key mismatch for %s format", format)
+			}
+
+			if pub.N.Cmp(shortKey.N) != 0 {
+				t.Errorf("Public key mismatch for %s format", format)
+			}
+		}
+	}
+}
+
+func TestPublicKeyFormatRoundTrip(t *testing.T) {
+	for _, format := range []KeyFormat{FormatPEM, FormatPKCS8, FormatOpenSSH, FormatJWK} {
+		buffer := new(bytes.Buffer)
+		err := EncodeKey(buffer, format, "test", nil, &shortKey.PublicKey, nil)
+		if err != nil {
+			t.Fatalf("Unable to encode %s public key: %v", format, err)
+		}
+
+		priv, pub, err := DecodeKey(buffer.Bytes(), format, nil)
+		if err != nil {
+			t.Fatalf("Unable to decode %s public key: %v", format, err)
+		}
+
+		if priv != nil {
+			t.Errorf("Decoded a private key from a %s public key", format)
+		}
+
+		if pub.N.Cmp(shortKey.N) != 0 || pub.E != shortKey.E {
+			t.Errorf("Public key mismatch for %s format", format)
+		}
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := EncodeKey(buffer, FormatPKCS12, "test", nil, &shortKey.PublicKey, nil); err == nil {
+		t.Error("Should not export a public key as PKCS#12")
+	}
+}
+
+func TestExportedPEMTypes(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	if err := EncodeKey(buffer, FormatPEM, "test", shortKey, nil, nil); err != nil {
+		t.Fatalf("Unable to encode key: %v", err)
+	}
+
+	if !bytes.Contains(buffer.Bytes(), []byte("BEGIN RSA PRIVATE KEY")) {
+		t.Error("Expected a PKCS#1 private key block")
+	}
+
+	if bytes.Contains(buffer.Bytes(), []byte("RSA PUBLIC KEY")) {
+		t.Error("PKIX public keys should not be labelled RSA PUBLIC KEY")
+	}
+}
+
+func TestParseKeyFormat(t *testing.T) {
+	if f, err := ParseKeyFormat("jwk"); err != nil || f != FormatJWK {
+		t.Errorf("Expected jwk format but got %s: %v", f, err)
+	}
+
+	if _, err := ParseKeyFormat("der"); err == nil {
+		t.Error("Should not parse an unknown format")
+	}
+}
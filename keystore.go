@@ -1,10 +1,15 @@
 package repository
 
 import (
+	"crypto"
+	"crypto/ecdh"
+	"fmt"
 	"log"
 	"path"
 	"path/filepath"
 	"runtime"
+	"sort"
+	"time"
 
 	"os"
 
@@ -70,10 +75,21 @@ func keystoreExists(fs afero.Fs, location string) (bool, error) {
 	return ok, nil
 }
 
-// Keystore is the collection of private and public keys.
+// Keystore is the collection of private and public keys.  Created records
+// when each key was added, and Policy, when set, restricts which keys the
+// keystore hands out.  Prekeys holds the keystore owner's prekeys by ID.
+// HybridKeys and HybridPublicKeys hold ML-KEM-768 and X25519 hybrid keys.
+// Escrow names the keys given a copy of the tape key of every tape written
+// with the keystore.
 type Keystore struct {
-	PrivateKeys map[string][]byte
-	PublicKeys  map[string][]byte
+	PrivateKeys      map[string][]byte
+	PublicKeys       map[string][]byte
+	Created          map[string]time.Time    `json:",omitempty"`
+	Policy           *Policy                 `json:",omitempty"`
+	Prekeys          map[string]StoredPrekey `json:",omitempty"`
+	HybridKeys       map[string][]byte       `json:",omitempty"`
+	HybridPublicKeys map[string][]byte       `json:",omitempty"`
+	Escrow           []string                `json:",omitempty"`
 }
 
 // CreateKeystore creates a new key store in the given file system.  If a keystore
@@ -89,7 +105,7 @@ func CreateKeystore(fs afero.Fs, name string) (*Keystore, error) {
 	if err != nil {
 		err := fs.MkdirAll(directory, 0700)
 		if err != nil {
-			log.Fatalf("Failed to crete directory %s: %v", directory, err)
+			return nil, NewError(err, fmt.Sprintf("Failed to create directory %s", directory))
 		}
 	}
 
@@ -112,6 +128,51 @@ func (k *Keystore) AddPrivateKey(name string, key *rsa.PrivateKey) {
 	log.Printf("Adding private key: %s", name)
 	bytes := x509.MarshalPKCS1PrivateKey(key)
 	k.PrivateKeys[name] = bytes
+	k.setCreated(name)
+}
+
+func (k *Keystore) setCreated(name string) {
+	if k.Created == nil {
+		k.Created = make(map[string]time.Time)
+	}
+	k.Created[name] = time.Now().UTC()
+}
+
+// KeyCreated returns when the named key was added to the keystore.  Keys
+// added before creation times were recorded return false.
+func (k *Keystore) KeyCreated(name string) (time.Time, bool) {
+	created, ok := k.Created[name]
+	return created, ok
+}
+
+// KeyPolicy returns the keystore's policy, or the default policy if it has
+// none.
+func (k *Keystore) KeyPolicy() *Policy {
+	if k.Policy != nil {
+		return k.Policy
+	}
+	return DefaultPolicy()
+}
+
+// CheckKey checks the named key against the keystore's policy.  Returns a
+// *PolicyError if the key is too weak or has expired.
+func (k *Keystore) CheckKey(name string) error {
+	var key crypto.PublicKey
+	if rsaKey, ok := k.FindPublicKey(name); ok {
+		key = rsaKey
+	} else if hybridKey, ok := k.FindHybridPublicKey(name); ok {
+		key = hybridKey
+	} else {
+		return &NoSuchKeyError{Kind: "Key", Name: name}
+	}
+
+	policy := k.KeyPolicy()
+	if err := policy.CheckKey(key); err != nil {
+		return err
+	}
+
+	created, _ := k.KeyCreated(name)
+	return policy.CheckAge(created)
 }
 
 // FindPrivateKey finds a private key from the keystore with the given
@@ -164,6 +225,7 @@ func (k *Keystore) AddPublicKey(name string, key *rsa.PublicKey) {
 	}
 
 	k.PublicKeys[name] = bytes
+	k.setCreated(name)
 }
 
 // RemoveKey removes a private key ad or public key with
@@ -178,6 +240,143 @@ func (k *Keystore) RemoveKey(name string) {
 	if ok {
 		delete(k.PublicKeys, name)
 	}
+
+	delete(k.HybridKeys, name)
+	delete(k.HybridPublicKeys, name)
+	delete(k.Created, name)
+}
+
+// SetEscrow names the escrow keys of the keystore.  Each must be an RSA key
+// in the keystore.  An empty list removes the escrow setting.
+func (k *Keystore) SetEscrow(names []string) error {
+	for _, name := range names {
+		if _, ok := k.FindPublicKey(name); !ok {
+			return &NoSuchKeyError{Kind: "Escrow key", Name: name}
+		}
+	}
+
+	k.Escrow = names
+	return nil
+}
+
+// EscrowKeys returns the public keys named by the keystore's escrow setting.
+func (k *Keystore) EscrowKeys() ([]*rsa.PublicKey, error) {
+	result := []*rsa.PublicKey{}
+	for _, name := range k.Escrow {
+		key, ok := k.FindPublicKey(name)
+		if !ok {
+			return nil, &NoSuchKeyError{Kind: "Escrow key", Name: name}
+		}
+		if err := k.CheckKey(name); err != nil {
+			return nil, err
+		}
+		result = append(result, key)
+	}
+	return result, nil
+}
+
+// AddHybridKey adds a hybrid private key to the keystore with the given name.
+func (k *Keystore) AddHybridKey(name string, key *HybridPrivateKey) {
+	log.Printf("Adding hybrid key: %s", name)
+	if k.HybridKeys == nil {
+		k.HybridKeys = make(map[string][]byte)
+	}
+	k.HybridKeys[name] = key.Bytes()
+	k.setCreated(name)
+}
+
+// AddHybridPublicKey adds a hybrid public key to the keystore with the given
+// name.
+func (k *Keystore) AddHybridPublicKey(name string, key *HybridPublicKey) {
+	log.Printf("Adding hybrid public key: %s", name)
+	if k.HybridPublicKeys == nil {
+		k.HybridPublicKeys = make(map[string][]byte)
+	}
+	k.HybridPublicKeys[name] = key.Bytes()
+	k.setCreated(name)
+}
+
+// FindHybridKey finds a hybrid private key from the keystore with the given
+// name.  If no key is found, it returns nil and false for the second return
+// value.
+func (k *Keystore) FindHybridKey(name string) (*HybridPrivateKey, bool) {
+	bytes, ok := k.HybridKeys[name]
+	if !ok {
+		return nil, false
+	}
+
+	result, err := ParseHybridPrivateKey(bytes)
+	if err != nil {
+		panic(err)
+	}
+
+	return result, true
+}
+
+// FindHybridPublicKey returns the hybrid public key, or the public half of
+// the hybrid private key, with the given name.  If no key is found nil is
+// returned and false for the second return value.
+func (k *Keystore) FindHybridPublicKey(name string) (*HybridPublicKey, bool) {
+	if key, ok := k.FindHybridKey(name); ok {
+		return key.Public(), true
+	}
+
+	bytes, ok := k.HybridPublicKeys[name]
+	if !ok {
+		return nil, false
+	}
+
+	result, err := ParseHybridPublicKey(bytes)
+	if err != nil {
+		panic(err)
+	}
+
+	return result, true
+}
+
+// AddPrekey adds a prekey and its private key to the keystore.
+func (k *Keystore) AddPrekey(prekey *Prekey, private *ecdh.PrivateKey) {
+	if k.Prekeys == nil {
+		k.Prekeys = make(map[string]StoredPrekey)
+	}
+	k.Prekeys[prekey.ID] = StoredPrekey{Prekey: *prekey, Private: private.Bytes()}
+}
+
+// FindPrekey finds the private key of the prekey with the given ID.  If no
+// prekey is found, it returns nil and false for the second return value.
+func (k *Keystore) FindPrekey(id string) (*ecdh.PrivateKey, bool) {
+	stored, ok := k.Prekeys[id]
+	if !ok {
+		return nil, false
+	}
+
+	result, err := ecdh.X25519().NewPrivateKey(stored.Private)
+	if err != nil {
+		panic(err)
+	}
+
+	return result, true
+}
+
+// RemovePrekey removes the prekey with the given ID.  Tapes written to it
+// can no longer be read.
+func (k *Keystore) RemovePrekey(id string) {
+	delete(k.Prekeys, id)
+}
+
+// RemoveExpiredPrekeys removes every prekey that has expired and returns
+// their IDs.
+func (k *Keystore) RemoveExpiredPrekeys() []string {
+	result := []string{}
+	now := time.Now()
+	for id, stored := range k.Prekeys {
+		if now.After(stored.Prekey.Expires) {
+			result = append(result, id)
+			delete(k.Prekeys, id)
+		}
+	}
+	sort.Strings(result)
+	return result
 }
 
 // Save saves a keystore to a file.  Returns an erro if the
@@ -7,15 +7,33 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
+	"fmt"
 	"io"
-	"log"
+	"time"
 )
 
-// Label is a key and key signature to use to encrypt a tape.
+// Label is a key and key signature to use to encrypt a tape.  Labels written
+// with Escrow set also wrap the key for each of the escrow keys.  The labels
+// of sign-only tapes carry no key.  Labels written with NotBefore or
+// NotAfter set record when the tape may be opened, and labels written with
+// Stream set the tape's place in a stream.  Labels read from a tape
+// remember the sender whose signature was verified and the label's
+// co-signatures.
 type Label struct {
-	AesKey    []byte
-	iv        []byte
-	signature []byte
+	AesKey       []byte
+	Escrow       []*rsa.PublicKey
+	NotBefore    time.Time
+	NotAfter     time.Time
+	Stream       *Stream
+	iv           []byte
+	signature    []byte
+	signOnly     bool
+	header       []byte
+	sender       string
+	cosignatures []labelSignature
+	metadata     string
+	hashName     string
+	compression  string
 }
 
 func (l *Label) writeHeader(repoFile io.Writer, publicKey *rsa.PublicKey) error {
@@ -38,17 +56,22 @@ func (l *Label) writeHeader(repoFile io.Writer, publicKey *rsa.PublicKey) error
 	return nil
 }
 
-func (l *Label) readHeader(repoFile io.Reader, encKey *rsa.PrivateKey) error {
-	encryptedHeader := make([]byte, encKey.N.BitLen()/8)
-	if _, err := repoFile.Read(encryptedHeader); err != nil {
-		log.Printf("Repository#readHeader - Unable to read header out of file: %v", err)
+func (l *Label) readHeader(repoFile io.Reader, encKey crypto.Decrypter) error {
+	publicKey, err := rsaPublicKey(encKey.Public())
+	if err != nil {
 		return err
 	}
 
-	header, err := rsa.DecryptPKCS1v15(rand.Reader, encKey, encryptedHeader)
+	encryptedHeader := make([]byte, publicKey.N.BitLen()/8)
+	if _, err := io.ReadFull(repoFile, encryptedHeader); err != nil {
+		return NewError(truncated(err), "Unable to read label header")
+	}
+
+	// Legacy labels do not record the recipient, so a key that cannot
+	// decrypt the header is taken to be the wrong one.
+	header, err := encKey.Decrypt(rand.Reader, encryptedHeader, &rsa.PKCS1v15DecryptOptions{})
 	if err != nil {
-		log.Printf("Repository#readHeader - Failed to decrypt header: %v", err)
-		return err
+		return NewError(fmt.Errorf("%w: %v", ErrKeyMismatch, err), "Failed to decrypt label header")
 	}
 
 	l.AesKey = header[0:32]
@@ -57,14 +80,14 @@ func (l *Label) readHeader(repoFile io.Reader, encKey *rsa.PrivateKey) error {
 	return nil
 }
 
-func (l *Label) writeSignature(repoFile io.Writer, privateKey *rsa.PrivateKey) error {
+func (l *Label) writeSignature(repoFile io.Writer, privateKey crypto.Signer) error {
 	key := make([]byte, len(l.AesKey)+len(l.iv))
 	copy(key[0:len(l.AesKey)], l.AesKey)
 	copy(key[len(l.AesKey):], l.iv)
 
 	var err error
 	hash := sha256.Sum256(key)
-	l.signature, err = rsa.SignPKCS1v15(rand.Reader, privateKey, crypto.SHA256, hash[:])
+	l.signature, err = privateKey.Sign(rand.Reader, hash[:], crypto.SHA256)
 	if err != nil {
 		return NewError(err, "Failed to sign the label header")
 	}
@@ -79,8 +102,8 @@ func (l *Label) writeSignature(repoFile io.Writer, privateKey *rsa.PrivateKey) e
 
 func (l *Label) verifySignature(repoFile io.Reader, pubKey *rsa.PublicKey) error {
 	signature := make([]byte, (pubKey.N.BitLen() / 8))
-	if _, err := repoFile.Read(signature); err != nil {
-		return NewError(err, "Unable to verify label signature")
+	if _, err := io.ReadFull(repoFile, signature); err != nil {
+		return NewError(truncated(err), "Unable to verify label signature")
 	}
 
 	header := make([]byte, pubKey.N.BitLen()/8)
@@ -90,7 +113,7 @@ func (l *Label) verifySignature(repoFile io.Reader, pubKey *rsa.PublicKey) error
 	sha := sha256.Sum256(header[0:48])
 	err := rsa.VerifyPKCS1v15(pubKey, crypto.SHA256, sha[:], signature)
 	if err != nil {
-		return NewError(err, "Failed to verify signature")
+		return &SignatureError{What: "label", Err: err}
 	}
 
 	l.signature = signature
@@ -99,35 +122,70 @@ func (l *Label) verifySignature(repoFile io.Reader, pubKey *rsa.PublicKey) error
 }
 
 // WriteLabel creates a new label for an encrypted tape.  It consists of the
-// the header (the AES random key and initialization vector) and the
-// signature of the header.
-func (l *Label) WriteLabel(repoFile io.Writer, encKey *rsa.PublicKey, signKey *rsa.PrivateKey) error {
-	if err := l.writeHeader(repoFile, encKey); err != nil {
-		return NewError(err, "Error writing label header")
+// the header, recording the fingerprints of the sender's key and of the
+// recipient's key along with the AES random key and initialization vector
+// encrypted for the recipient, and the signature of the header.
+func (l *Label) WriteLabel(repoFile io.Writer, encKey *rsa.PublicKey, signKey crypto.Signer) error {
+	if err := l.writeVersionedLabel(repoFile, []*rsa.PublicKey{encKey}, signKey); err != nil {
+		return NewError(err, "Error writing label")
+	}
+
+	return nil
+}
+
+// WriteLabelForRecipients creates a new label like WriteLabel, with the AES
+// key and initialization vector encrypted for each of the recipients.
+func (l *Label) WriteLabelForRecipients(repoFile io.Writer, encKeys []*rsa.PublicKey, signKey crypto.Signer) error {
+	if err := l.writeVersionedLabel(repoFile, encKeys, signKey); err != nil {
+		return NewError(err, "Error writing label")
 	}
 
-	if err := l.writeSignature(repoFile, signKey); err != nil {
-		return NewError(err, "Error writing label signature")
+	return nil
+}
+
+// WriteForwardSecretLabel creates a new label whose AES key and IV can only
+// be recovered with the private half of the recipient's prekey.  The prekey
+// must be signed by encKey.  See Prekey.
+func (l *Label) WriteForwardSecretLabel(repoFile io.Writer, encKey *rsa.PublicKey, prekey *Prekey, signKey crypto.Signer) error {
+	if err := l.writeForwardSecretLabel(repoFile, encKey, prekey, signKey); err != nil {
+		return NewError(err, "Error writing label")
 	}
 
 	return nil
 }
 
-// ReadLabel reads a label in from the source reader, using the private key to
+// ReadLabel reads a label in from the source reader, using the decrypter to
 // decrypt the label and the public key to check the signature.  Returns an empty
-// label and error if there is an error.
-func ReadLabel(repoFile io.Reader, decrKey *rsa.PrivateKey, signKey *rsa.PublicKey) (Label, error) {
-	result := Label{}
+// label and error if there is an error.  Labels written before labels
+// recorded key fingerprints are read as well.
+func ReadLabel(repoFile io.Reader, decrKey crypto.Decrypter, signKey *rsa.PublicKey) (Label, error) {
+	return ReadLabelWithPrekeys(repoFile, decrKey, signKey, nil)
+}
 
-	if err := result.readHeader(repoFile, decrKey); err != nil {
-		return result, NewError(err, "Unable to read label")
+// ReadLabelWithPrekeys reads a label like ReadLabel.  Forward-secret labels
+// are opened with a prekey from prekeys.
+func ReadLabelWithPrekeys(repoFile io.Reader, decrKey crypto.Decrypter, signKey *rsa.PublicKey, prekeys PrekeyProvider) (Label, error) {
+	raw, err := readRawLabel(repoFile)
+	if err != nil {
+		return Label{}, NewError(err, "Unable to read label")
 	}
 
-	if err := result.verifySignature(repoFile, signKey); err != nil {
-		return result, NewError(err, "Unable to verify signature")
+	return raw.open(repoFile, decrKey, signKey, unwrapKeys{prekeys: prekeys})
+}
+
+// readLabel reads a label with the key's private key, prekeys, hybrid keys
+// and passphrase, checking the signature with its public key.
+func (k Key) readLabel(repoFile io.Reader) (Label, error) {
+	raw, err := readRawLabel(repoFile)
+	if err != nil {
+		return Label{}, NewError(err, "Unable to read label")
 	}
 
-	return result, nil
+	var decrKey crypto.Decrypter
+	if k.PrivateKey != nil {
+		decrKey = k.PrivateKey
+	}
+	return raw.open(repoFile, decrKey, k.PublicKey, unwrapKeys{prekeys: k.Prekeys, hybrid: k.HybridKeys, passphrase: k.Passphrase})
 }
 
 // OpenReader opens a decrypting reader encapsulating the given stream.  The
@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ecdhInfo separates label wrapping keys from other uses of the agreed key.
+const ecdhInfo = "repository label ecdh"
+
+// wrappingKey derives the AES-GCM key that wraps the tape key from agreed
+// secrets.  The salt binds the key to the public values it was agreed with.
+func wrappingKey(secret []byte, info string, salt ...[]byte) (cipher.AEAD, error) {
+	key, err := hkdf.Key(sha256.New, secret, bytes.Join(salt, nil), info, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// slotData is the additional data authenticated with a wrapped tape key.
+func slotData(slot keySlot) []byte {
+	return []byte(slot.Recipient + "\x00" + slot.Prekey)
+}
+
+// seal wraps the label's key and IV for a slot.
+func (l *Label) seal(aead cipher.AEAD, slot *keySlot) error {
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return NewError(err, "Unable to generate wrapping nonce")
+	}
+
+	plaintext := append(append([]byte{}, l.AesKey...), l.iv...)
+	slot.Wrapped = aead.Seal(nonce, nonce, plaintext, slotData(*slot))
+	return nil
+}
+
+// unseal unwraps the label's key and IV from a slot.
+func (l *Label) unseal(aead cipher.AEAD, slot keySlot) error {
+	if len(slot.Wrapped) < aead.NonceSize() {
+		return errors.New("Wrapped tape key is too short")
+	}
+
+	nonce, ciphertext := slot.Wrapped[:aead.NonceSize()], slot.Wrapped[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, slotData(slot))
+	if err != nil || len(plaintext) != 48 {
+		return errors.New("Unable to unwrap tape key")
+	}
+
+	l.AesKey = plaintext[0:32]
+	l.iv = plaintext[32:48]
+	return nil
+}
+
+// writeForwardSecretLabel wraps the label's key under a key agreed between a
+// new ephemeral key and the recipient's prekey.  The ephemeral private key
+// is discarded once the label is written, so only the prekey can recover the
+// tape key.
+func (l *Label) writeForwardSecretLabel(repoFile io.Writer, recipient *rsa.PublicKey, prekey *Prekey, signKey crypto.Signer) error {
+	signPub, err := rsaPublicKey(signKey.Public())
+	if err != nil {
+		return err
+	}
+
+	if err = prekey.Verify(recipient); err != nil {
+		return err
+	}
+	prekeyPub, err := prekey.publicKey()
+	if err != nil {
+		return err
+	}
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return NewError(err, "Unable to generate ephemeral key")
+	}
+	shared, err := ephemeral.ECDH(prekeyPub)
+	if err != nil {
+		return NewError(err, "Unable to agree a key with the prekey")
+	}
+
+	slot := keySlot{Recipient: prekey.Owner, Prekey: prekey.ID, Ephemeral: ephemeral.PublicKey().Bytes()}
+	aead, err := wrappingKey(shared, ecdhInfo, slot.Ephemeral, prekey.Public)
+	if err != nil {
+		return NewError(err, "Unable to derive wrapping key")
+	}
+	if err = l.seal(aead, &slot); err != nil {
+		return err
+	}
+
+	raw := &rawLabel{version: labelVersion}
+	raw.header = labelHeader{Mode: modeECDH, Sender: Fingerprint(signPub), Slots: []keySlot{slot}}
+	return l.signAndWrite(repoFile, raw, signKey)
+}
+
+// openForwardSecret unwraps the tape key in a forward-secret slot with the
+// prekey the slot was written for.
+func (l *Label) openForwardSecret(slot keySlot, prekeys PrekeyProvider) error {
+	if prekeys == nil {
+		return fmt.Errorf("Label is forward secret and needs prekey %s", slot.Prekey)
+	}
+
+	private, err := prekeys.Prekey(slot.Prekey)
+	if err != nil {
+		return err
+	}
+
+	ephemeral, err := ecdh.X25519().NewPublicKey(slot.Ephemeral)
+	if err != nil {
+		return NewError(err, "Label has an invalid ephemeral key")
+	}
+	shared, err := private.ECDH(ephemeral)
+	if err != nil {
+		return NewError(err, "Unable to agree a key with the ephemeral key")
+	}
+
+	aead, err := wrappingKey(shared, ecdhInfo, slot.Ephemeral, private.PublicKey().Bytes())
+	if err != nil {
+		return NewError(err, "Unable to derive wrapping key")
+	}
+	return l.unseal(aead, slot)
+}
@@ -0,0 +1,549 @@
+package repository
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Versioned labels start with labelMagic and a version byte.  The label
+// header and the signature block follow, each written as a big-endian
+// uint32 length and a JSON document:
+//
+//	magic | version | length | header | length | signatures
+//
+// Labels written before versioning have no magic.  They are the RSA
+// encrypted key and IV followed by the signature of the key and IV, and
+// their size depends on the size of the RSA keys.
+var labelMagic = []byte("REPOLBL\x00")
+
+const (
+	legacyLabelVersion = 1
+	labelVersion       = 2
+
+	// maxLabelBlock bounds the header and signature blocks so a corrupt
+	// length cannot exhaust memory.
+	maxLabelBlock = 16 << 20
+)
+
+// Label modes describe how the tape key is protected.
+const (
+	// modeRSA wraps the tape key under each recipient's RSA public key.
+	modeRSA = "rsa"
+
+	// modeECDH wraps the tape key under a key agreed between an ephemeral
+	// key and the recipient's prekey.
+	modeECDH = "ecdh"
+
+	// modeHybrid wraps the tape key under a key derived from both an
+	// ML-KEM-768 secret and an X25519 secret.
+	modeHybrid = HybridKeyType
+
+	// modeThreshold splits the tape key into shares, each wrapped under a
+	// custodian's RSA public key.  The header's threshold of shares recover
+	// it.
+	modeThreshold = "threshold"
+
+	// modePassphrase wraps the tape key under a key derived from a
+	// passphrase.  Passphrase labels need not be signed.
+	modePassphrase = "passphrase"
+
+	// modeSigned labels carry no key.  The archive is stored in plaintext
+	// and the tape's trailer signs the whole tape.
+	modeSigned = "signed"
+)
+
+// labelHeader is the unencrypted part of a versioned label.  It is covered
+// by the label signature.  Escrow slots wrap the tape key under escrow RSA
+// keys whatever the mode.  NotBefore and NotAfter bound when the tape may be
+// opened, Stream places the tape in a stream of tapes and Metadata is the
+// hash of the metadata block that follows the label.  Hash names the hash
+// algorithm the tape is signed with, DefaultHash if empty, and Compression
+// the compression of the archive, CompressionNone if empty.
+type labelHeader struct {
+	Mode        string     `json:"mode"`
+	Sender      string     `json:"sender"`
+	Slots       []keySlot  `json:"slots"`
+	Threshold   int        `json:"threshold,omitempty"`
+	Escrow      []keySlot  `json:"escrow,omitempty"`
+	NotBefore   *time.Time `json:"not_before,omitempty"`
+	NotAfter    *time.Time `json:"not_after,omitempty"`
+	Stream      *Stream    `json:"stream,omitempty"`
+	Metadata    string     `json:"metadata,omitempty"`
+	Hash        string     `json:"hash,omitempty"`
+	Compression string     `json:"compression,omitempty"`
+}
+
+// keySlot holds the tape key wrapped for one recipient, identified by the
+// fingerprint of the recipient's public key.  Forward-secret slots also
+// record the prekey and the ephemeral public key the wrapping key was agreed
+// with, hybrid slots the encapsulated ML-KEM secret and passphrase slots how
+// the wrapping key is derived from the passphrase.
+type keySlot struct {
+	Recipient    string         `json:"recipient"`
+	Wrapped      []byte         `json:"wrapped"`
+	Prekey       string         `json:"prekey,omitempty"`
+	Ephemeral    []byte         `json:"ephemeral,omitempty"`
+	Encapsulated []byte         `json:"encapsulated,omitempty"`
+	KDF          *passphraseKDF `json:"kdf,omitempty"`
+}
+
+// unwrapKeys are the sources of keys, besides the recipient's RSA key, that
+// can unwrap a tape key.  Any may be nil.
+type unwrapKeys struct {
+	prekeys    PrekeyProvider
+	hybrid     HybridKeyProvider
+	passphrase []byte
+}
+
+// labelSignature is a signature made by the key with the given fingerprint.
+type labelSignature struct {
+	Signer string `json:"signer"`
+	Value  []byte `json:"value"`
+}
+
+type signatureBlock struct {
+	Signatures []labelSignature `json:"signatures"`
+}
+
+// rawLabel is a label as read from a tape, before any key is applied.
+type rawLabel struct {
+	version     int
+	prefix      []byte
+	headerBytes []byte
+	header      labelHeader
+	signatures  []labelSignature
+}
+
+// Fingerprint identifies a public key.  It is the hex encoded SHA-256 hash of
+// the PKIX encoding of the key.
+func Fingerprint(key *rsa.PublicKey) string {
+	bytes, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return ""
+	}
+
+	hash := sha256.Sum256(bytes)
+	return fmt.Sprintf("%x", hash)
+}
+
+func writeLabelBlock(out io.Writer, data []byte) error {
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(data)))
+	if _, err := out.Write(length); err != nil {
+		return err
+	}
+
+	_, err := out.Write(data)
+	return err
+}
+
+func readLabelBlock(in io.Reader) ([]byte, error) {
+	length := make([]byte, 4)
+	if _, err := io.ReadFull(in, length); err != nil {
+		return nil, truncated(err)
+	}
+
+	size := binary.BigEndian.Uint32(length)
+	if size > maxLabelBlock {
+		return nil, fmt.Errorf("Label block of %d bytes is too large", size)
+	}
+
+	data := make([]byte, size)
+	if _, err := io.ReadFull(in, data); err != nil {
+		return nil, truncated(err)
+	}
+	return data, nil
+}
+
+// readRawLabel reads a versioned label.  If the tape starts with a legacy
+// label, the bytes consumed while looking for the magic are kept in prefix
+// so the legacy label can still be read.
+func readRawLabel(in io.Reader) (*rawLabel, error) {
+	prefix := make([]byte, len(labelMagic)+1)
+	if _, err := io.ReadFull(in, prefix); err != nil {
+		return nil, NewError(truncated(err), "Unable to read label preamble")
+	}
+
+	if !bytes.Equal(prefix[:len(labelMagic)], labelMagic) {
+		return &rawLabel{version: legacyLabelVersion, prefix: prefix}, nil
+	}
+
+	result := &rawLabel{version: int(prefix[len(labelMagic)])}
+	if result.version != labelVersion {
+		return nil, &UnsupportedVersionError{What: "label version", Value: strconv.Itoa(result.version)}
+	}
+
+	var err error
+	if result.headerBytes, err = readLabelBlock(in); err != nil {
+		return nil, NewError(err, "Unable to read label header")
+	}
+	if err = json.Unmarshal(result.headerBytes, &result.header); err != nil {
+		return nil, NewError(err, "Unable to parse label header")
+	}
+
+	signatures, err := readLabelBlock(in)
+	if err != nil {
+		return nil, NewError(err, "Unable to read label signatures")
+	}
+	block := signatureBlock{}
+	if err = json.Unmarshal(signatures, &block); err != nil {
+		return nil, NewError(err, "Unable to parse label signatures")
+	}
+	result.signatures = block.Signatures
+
+	return result, nil
+}
+
+func (raw *rawLabel) write(out io.Writer) error {
+	var err error
+	if raw.headerBytes == nil {
+		if raw.headerBytes, err = json.Marshal(raw.header); err != nil {
+			return err
+		}
+	}
+
+	signatures, err := json.Marshal(signatureBlock{Signatures: raw.signatures})
+	if err != nil {
+		return err
+	}
+
+	if _, err = out.Write(append(append([]byte{}, labelMagic...), byte(labelVersion))); err != nil {
+		return err
+	}
+	if err = writeLabelBlock(out, raw.headerBytes); err != nil {
+		return err
+	}
+	return writeLabelBlock(out, signatures)
+}
+
+// recipients lists the fingerprints of the keys the tape key is wrapped for.
+func (raw *rawLabel) recipients() []string {
+	result := []string{}
+	for _, slot := range raw.header.Slots {
+		result = append(result, slot.Recipient)
+	}
+	return result
+}
+
+// escrowed lists the fingerprints of the escrow keys the tape key is wrapped
+// for.
+func (raw *rawLabel) escrowed() []string {
+	result := []string{}
+	for _, slot := range raw.header.Escrow {
+		result = append(result, slot.Recipient)
+	}
+	return result
+}
+
+func (raw *rawLabel) slotFor(fingerprint string) (keySlot, bool) {
+	for _, slot := range raw.header.Slots {
+		if slot.Recipient == fingerprint {
+			return slot, true
+		}
+	}
+	return keySlot{}, false
+}
+
+// keyDigest is the digest signed by the sender.  It binds the header to the
+// tape key, so only a recipient can check it.
+func (raw *rawLabel) keyDigest(l *Label) []byte {
+	hash := l.digestAlgorithm().New()
+	hash.Write(raw.headerBytes)
+	hash.Write(l.AesKey)
+	hash.Write(l.iv)
+	return hash.Sum(nil)
+}
+
+// writeVersionedLabel wraps the label's key for each recipient and signs the
+// result with the sender's key.
+func (l *Label) writeVersionedLabel(repoFile io.Writer, recipients []*rsa.PublicKey, signKey crypto.Signer) error {
+	signPub, err := rsaPublicKey(signKey.Public())
+	if err != nil {
+		return err
+	}
+
+	raw := &rawLabel{version: labelVersion}
+	raw.header = labelHeader{Mode: modeRSA, Sender: Fingerprint(signPub)}
+	for _, recipient := range recipients {
+		wrapped := new(bytes.Buffer)
+		if err := l.writeHeader(wrapped, recipient); err != nil {
+			return err
+		}
+		raw.header.Slots = append(raw.header.Slots, keySlot{Recipient: Fingerprint(recipient), Wrapped: wrapped.Bytes()})
+	}
+
+	return l.signAndWrite(repoFile, raw, signKey)
+}
+
+// setOptions records the label's validity window, stream, metadata hash,
+// hash algorithm and compression in the header.
+func (l *Label) setOptions(raw *rawLabel) {
+	raw.header.NotBefore, raw.header.NotAfter = nil, nil
+	if !l.NotBefore.IsZero() {
+		notBefore := l.NotBefore.UTC()
+		raw.header.NotBefore = &notBefore
+	}
+	if !l.NotAfter.IsZero() {
+		notAfter := l.NotAfter.UTC()
+		raw.header.NotAfter = &notAfter
+	}
+	raw.header.Stream = l.Stream
+	raw.header.Metadata = l.metadata
+	raw.header.Hash = l.hashName
+	raw.header.Compression = l.compression
+}
+
+// options reads the validity window, stream, metadata hash, hash algorithm
+// and compression from the header into the label.
+func (raw *rawLabel) options(l *Label) error {
+	if _, err := lookupHash(raw.header.Hash); err != nil {
+		return err
+	}
+	if _, err := lookupCompression(raw.header.Compression); err != nil {
+		return err
+	}
+	l.hashName = raw.header.Hash
+	l.compression = raw.header.Compression
+	if raw.header.NotBefore != nil {
+		l.NotBefore = *raw.header.NotBefore
+	}
+	if raw.header.NotAfter != nil {
+		l.NotAfter = *raw.header.NotAfter
+	}
+	l.Stream = raw.header.Stream
+	l.metadata = raw.header.Metadata
+	return nil
+}
+
+// signAndWrite signs the label's header and key with the sender's key and
+// writes the label.  The label is left unsigned if signKey is nil.
+func (l *Label) signAndWrite(repoFile io.Writer, raw *rawLabel, signKey crypto.Signer) error {
+	if err := l.addEscrow(raw); err != nil {
+		return err
+	}
+	l.setOptions(raw)
+
+	var err error
+	if raw.headerBytes, err = json.Marshal(raw.header); err != nil {
+		return NewError(err, "Unable to encode label header")
+	}
+	l.header = raw.headerBytes
+	if signKey == nil {
+		return raw.write(repoFile)
+	}
+
+	l.signature, err = signDigest(signKey, l.digestAlgorithm(), raw.keyDigest(l))
+	if err != nil {
+		return NewError(err, "Failed to sign the label header")
+	}
+	raw.signatures = []labelSignature{{Signer: raw.header.Sender, Value: l.signature}}
+
+	return raw.write(repoFile)
+}
+
+// open unwraps the tape key with the decrypter, or for forward-secret and
+// hybrid labels with a prekey or hybrid key, and checks the sender's
+// signature.  A decrypter for one of the label's escrow keys opens a label of
+// any mode.  A passphrase label is opened without checking its signature
+// when signKey is nil.  The rest reader is where a legacy label continues.
+func (raw *rawLabel) open(rest io.Reader, decrKey crypto.Decrypter, signKey *rsa.PublicKey, keys unwrapKeys) (Label, error) {
+	result := Label{}
+
+	if raw.version == legacyLabelVersion {
+		rest = io.MultiReader(bytes.NewReader(raw.prefix), rest)
+		if err := result.readHeader(rest, decrKey); err != nil {
+			return result, NewError(err, "Unable to read label")
+		}
+		if err := result.verifySignature(rest, signKey); err != nil {
+			return result, NewError(err, "Unable to verify signature")
+		}
+		result.sender = Fingerprint(signKey)
+		return result, nil
+	}
+
+	result.header = raw.headerBytes
+	result.cosignatures = raw.cosignatures()
+	if err := raw.options(&result); err != nil {
+		return result, NewError(err, "Unable to read label")
+	}
+
+	var err error
+	escrow, escrowed := raw.escrowSlot(decrKey)
+	switch {
+	case escrowed:
+		err = result.readHeader(bytes.NewReader(escrow.Wrapped), decrKey)
+	case raw.header.Mode == modeRSA || raw.header.Mode == modeECDH:
+		var slot keySlot
+		if slot, err = raw.rsaSlot(decrKey); err != nil {
+			return result, err
+		}
+		if raw.header.Mode == modeRSA {
+			err = result.readHeader(bytes.NewReader(slot.Wrapped), decrKey)
+		} else {
+			err = result.openForwardSecret(slot, keys.prekeys)
+		}
+	case raw.header.Mode == modeHybrid:
+		err = result.openHybrid(raw, keys.hybrid)
+	case raw.header.Mode == modeSigned:
+		result.signOnly = true
+	case raw.header.Mode == modePassphrase:
+		err = result.openPassphrase(raw, keys.passphrase)
+	case raw.header.Mode == modeThreshold:
+		err = fmt.Errorf("Label is split among custodians, %d of their shares are needed to open it", raw.header.Threshold)
+	default:
+		err = &UnsupportedVersionError{What: "label mode", Value: raw.header.Mode}
+	}
+	if err != nil {
+		return result, NewError(err, "Unable to read label")
+	}
+
+	if signKey == nil && raw.header.Mode == modePassphrase {
+		if raw.header.Sender != "" {
+			return result, &SignatureError{What: "label", Err: fmt.Errorf("Label is signed by key %s, which is needed to verify it", raw.header.Sender)}
+		}
+		return result, nil
+	}
+	if err := raw.verify(&result, signKey); err != nil {
+		return result, NewError(err, "Unable to verify signature")
+	}
+
+	return result, nil
+}
+
+// rsaSlot returns the slot for the decrypter's RSA key.
+func (raw *rawLabel) rsaSlot(decrKey crypto.Decrypter) (keySlot, error) {
+	if decrKey == nil {
+		return keySlot{}, &KeyNotFoundError{Fingerprints: raw.recipients(), Private: true}
+	}
+
+	decrPub, err := rsaPublicKey(decrKey.Public())
+	if err != nil {
+		return keySlot{}, err
+	}
+
+	slot, ok := raw.slotFor(Fingerprint(decrPub))
+	if !ok {
+		return keySlot{}, &KeyNotFoundError{Fingerprints: raw.recipients(), Private: true}
+	}
+	return slot, nil
+}
+
+// escrowSlot returns the escrow slot for the decrypter's RSA key, if any.
+func (raw *rawLabel) escrowSlot(decrKey crypto.Decrypter) (keySlot, bool) {
+	if decrKey == nil {
+		return keySlot{}, false
+	}
+
+	decrPub, err := rsaPublicKey(decrKey.Public())
+	if err != nil {
+		return keySlot{}, false
+	}
+
+	fingerprint := Fingerprint(decrPub)
+	for _, slot := range raw.header.Escrow {
+		if slot.Recipient == fingerprint {
+			return slot, true
+		}
+	}
+	return keySlot{}, false
+}
+
+func (raw *rawLabel) verify(l *Label, signKey *rsa.PublicKey) error {
+	if raw.header.Sender == "" {
+		return errors.New("Label is not signed")
+	}
+	if signKey == nil {
+		return errors.New("The sender's public key is needed to check the label signature")
+	}
+	signer := Fingerprint(signKey)
+	if raw.header.Sender != signer {
+		return &KeyMismatchError{What: "Label", Signer: raw.header.Sender, Given: signer}
+	}
+
+	for _, sig := range raw.signatures {
+		if sig.Signer != signer {
+			continue
+		}
+		if err := verifyDigest(signKey, l.digestAlgorithm(), raw.keyDigest(l), sig.Value); err != nil {
+			return &SignatureError{What: "label", Err: err}
+		}
+		l.signature = sig.Value
+		l.sender = signer
+		return nil
+	}
+
+	return &SignatureError{What: "label", Err: errors.New("no signature from its sender")}
+}
+
+// ReadLabelWithProvider reads a label, finding the recipient's private key
+// and the sender's public key in the provider by the fingerprints recorded
+// in the label.  The provider must be able to list its keys (see
+// KeyLister).  The keys found are returned with the label.  A *PolicyError
+// is returned if the provider's policy refuses the keys with the label's
+// fingerprints.
+func ReadLabelWithProvider(repoFile io.Reader, provider KeyProvider) (Label, PrivateKey, *rsa.PublicKey, error) {
+	raw, err := readRawLabel(repoFile)
+	if err != nil {
+		return Label{}, nil, nil, NewError(err, "Unable to read label")
+	}
+
+	if raw.version == legacyLabelVersion {
+		return Label{}, nil, nil, errors.New("Labels of this version do not record key fingerprints, the keys must be named")
+	}
+
+	keys := unwrapKeys{}
+	keys.prekeys, _ = provider.(PrekeyProvider)
+	keys.hybrid, _ = provider.(HybridKeyProvider)
+
+	needsPrivateKey := raw.header.Mode != modeHybrid && raw.header.Mode != modeSigned
+	candidates := raw.escrowed()
+	if needsPrivateKey {
+		candidates = append(raw.recipients(), candidates...)
+	}
+
+	var privateKey PrivateKey
+	var refused *PolicyError
+	for _, recipient := range candidates {
+		name, err := FindKeyName(provider, recipient, true)
+		if err != nil {
+			if refused == nil {
+				errors.As(err, &refused)
+			}
+			continue
+		}
+		if privateKey, err = provider.PrivateKey(name); err == nil {
+			break
+		}
+	}
+	if privateKey == nil && needsPrivateKey {
+		if refused != nil {
+			return Label{}, nil, nil, refused
+		}
+		return Label{}, nil, nil, &KeyNotFoundError{Fingerprints: raw.recipients(), Private: true}
+	}
+
+	name, err := FindKeyName(provider, raw.header.Sender, false)
+	if errors.As(err, &refused) {
+		return Label{}, nil, nil, refused
+	}
+	if err != nil {
+		return Label{}, nil, nil, &KeyNotFoundError{Fingerprints: []string{raw.header.Sender}}
+	}
+	publicKey, err := provider.PublicKey(name)
+	if err != nil {
+		return Label{}, nil, nil, err
+	}
+
+	result, err := raw.open(repoFile, privateKey, publicKey, keys)
+	return result, privateKey, publicKey, err
+}
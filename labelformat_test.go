@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestLegacyLabelStillReads(t *testing.T) {
+	l := Label{AesKey: testAes, iv: testIv}
+	buffer := new(bytes.Buffer)
+
+	if err := l.writeHeader(buffer, &medKey.PublicKey); err != nil {
+		t.Fatalf("Unable to write legacy header: %v", err)
+	}
+	if err := l.writeSignature(buffer, longKey); err != nil {
+		t.Fatalf("Unable to write legacy signature: %v", err)
+	}
+	buffer.WriteString("payload")
+
+	reader := bytes.NewReader(buffer.Bytes())
+	l2, err := ReadLabel(reader, medKey, &longKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Unable to read legacy label: %v", err)
+	}
+
+	if string(l2.AesKey) != string(testAes) {
+		t.Errorf("Key mismatch reading legacy label")
+	}
+
+	rest := make([]byte, 7)
+	reader.Read(rest)
+	if string(rest) != "payload" {
+		t.Errorf("Label reading consumed the wrong number of bytes: %s", string(rest))
+	}
+}
+
+func TestLabelRecordsFingerprints(t *testing.T) {
+	l := Label{AesKey: testAes, iv: testIv}
+	buffer := new(bytes.Buffer)
+
+	if err := l.WriteLabel(buffer, &medKey.PublicKey, longKey); err != nil {
+		t.Fatalf("Unable to write label: %v", err)
+	}
+
+	raw, err := readRawLabel(bytes.NewReader(buffer.Bytes()))
+	if err != nil {
+		t.Fatalf("Unable to read raw label: %v", err)
+	}
+
+	if raw.version != labelVersion {
+		t.Errorf("Expected version %d but got %d", labelVersion, raw.version)
+	}
+
+	if raw.header.Sender != Fingerprint(&longKey.PublicKey) {
+		t.Errorf("Sender fingerprint not recorded")
+	}
+
+	if len(raw.header.Slots) != 1 || raw.header.Slots[0].Recipient != Fingerprint(&medKey.PublicKey) {
+		t.Errorf("Recipient fingerprint not recorded")
+	}
+}
+
+func TestWrongKeyNamesRecipient(t *testing.T) {
+	l := Label{AesKey: testAes, iv: testIv}
+	buffer := new(bytes.Buffer)
+
+	if err := l.WriteLabel(buffer, &medKey.PublicKey, longKey); err != nil {
+		t.Fatalf("Unable to write label: %v", err)
+	}
+
+	_, err := ReadLabel(bytes.NewReader(buffer.Bytes()), shortKey, &longKey.PublicKey)
+	if err == nil {
+		t.Fatal("Should not read a label with the wrong private key")
+	}
+
+	expected := "tape is for key " + Fingerprint(&medKey.PublicKey) + ", which you don't have"
+	if !strings.Contains(err.Error(), expected) {
+		t.Errorf("Expected %q in %q", expected, err.Error())
+	}
+
+	_, err = ReadLabel(bytes.NewReader(buffer.Bytes()), medKey, &shortKey.PublicKey)
+	if err == nil {
+		t.Error("Should not verify a label with the wrong public key")
+	}
+}
+
+func TestReadLabelWithProvider(t *testing.T) {
+	l := Label{AesKey: testAes, iv: testIv}
+	buffer := new(bytes.Buffer)
+
+	if err := l.WriteLabel(buffer, &medKey.PublicKey, longKey); err != nil {
+		t.Fatalf("Unable to write label: %v", err)
+	}
+
+	keystore := &Keystore{PrivateKeys: map[string][]byte{}, PublicKeys: map[string][]byte{}}
+	keystore.AddPrivateKey("other", shortKey)
+	keystore.AddPrivateKey("mine", medKey)
+	keystore.AddPublicKey("sender", &longKey.PublicKey)
+
+	l2, priv, pub, err := ReadLabelWithProvider(bytes.NewReader(buffer.Bytes()), NewKeystoreProvider(keystore))
+	if err != nil {
+		t.Fatalf("Unable to read label with provider: %v", err)
+	}
+
+	if string(l2.AesKey) != string(testAes) || pub.N.Cmp(longKey.N) != 0 || priv == nil {
+		t.Errorf("Found the wrong keys for the label")
+	}
+
+	keystore.RemoveKey("mine")
+	_, _, _, err = ReadLabelWithProvider(bytes.NewReader(buffer.Bytes()), NewKeystoreProvider(keystore))
+	if _, ok := err.(*KeyNotFoundError); !ok {
+		t.Errorf("Expected a KeyNotFoundError but got %v", err)
+	}
+}
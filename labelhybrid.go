@@ -0,0 +1,98 @@
+package repository
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/rand"
+	"errors"
+	"io"
+)
+
+// hybridInfo separates hybrid wrapping keys from other uses of the secrets.
+const hybridInfo = "repository label " + HybridKeyType
+
+// writeHybridLabel wraps the label's key under a key derived from both an
+// ML-KEM-768 shared secret encapsulated for the recipient and an X25519
+// secret agreed between an ephemeral key and the recipient's X25519 key.
+func (l *Label) writeHybridLabel(repoFile io.Writer, recipient *HybridPublicKey, signKey crypto.Signer) error {
+	signPub, err := rsaPublicKey(signKey.Public())
+	if err != nil {
+		return err
+	}
+
+	mlkemSecret, encapsulated := recipient.MLKEM.Encapsulate()
+
+	ephemeral, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return NewError(err, "Unable to generate ephemeral key")
+	}
+	x25519Secret, err := ephemeral.ECDH(recipient.X25519)
+	if err != nil {
+		return NewError(err, "Unable to agree a key with the recipient")
+	}
+
+	slot := keySlot{
+		Recipient:    HybridFingerprint(recipient),
+		Ephemeral:    ephemeral.PublicKey().Bytes(),
+		Encapsulated: encapsulated,
+	}
+	aead, err := wrappingKey(append(mlkemSecret, x25519Secret...), hybridInfo, encapsulated, slot.Ephemeral, recipient.X25519.Bytes())
+	if err != nil {
+		return NewError(err, "Unable to derive wrapping key")
+	}
+	if err = l.seal(aead, &slot); err != nil {
+		return err
+	}
+
+	raw := &rawLabel{version: labelVersion}
+	raw.header = labelHeader{Mode: modeHybrid, Sender: Fingerprint(signPub), Slots: []keySlot{slot}}
+	return l.signAndWrite(repoFile, raw, signKey)
+}
+
+// openHybrid unwraps the tape key from the first slot whose hybrid key the
+// provider has.
+func (l *Label) openHybrid(raw *rawLabel, hybridKeys HybridKeyProvider) error {
+	if hybridKeys == nil {
+		return errors.New("Label is wrapped for a hybrid key and no hybrid keys are available")
+	}
+
+	for _, slot := range raw.header.Slots {
+		private, err := hybridKeys.FindHybridKey(slot.Recipient)
+		if err != nil {
+			continue
+		}
+
+		mlkemSecret, err := private.MLKEM.Decapsulate(slot.Encapsulated)
+		if err != nil {
+			return NewError(err, "Unable to decapsulate the ML-KEM secret")
+		}
+
+		ephemeral, err := ecdh.X25519().NewPublicKey(slot.Ephemeral)
+		if err != nil {
+			return NewError(err, "Label has an invalid ephemeral key")
+		}
+		x25519Secret, err := private.X25519.ECDH(ephemeral)
+		if err != nil {
+			return NewError(err, "Unable to agree a key with the ephemeral key")
+		}
+
+		aead, err := wrappingKey(append(mlkemSecret, x25519Secret...), hybridInfo, slot.Encapsulated, slot.Ephemeral, private.X25519.PublicKey().Bytes())
+		if err != nil {
+			return NewError(err, "Unable to derive wrapping key")
+		}
+		return l.unseal(aead, slot)
+	}
+
+	return &KeyNotFoundError{Fingerprints: raw.recipients(), Private: true}
+}
+
+// WriteHybridLabel creates a new label whose AES key and IV are wrapped for
+// a hybrid ML-KEM-768 and X25519 key, so the tape stays confidential unless
+// both are broken.  The label is signed with signKey.
+func (l *Label) WriteHybridLabel(repoFile io.Writer, encKey *HybridPublicKey, signKey crypto.Signer) error {
+	if err := l.writeHybridLabel(repoFile, encKey, signKey); err != nil {
+		return NewError(err, "Error writing label")
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+package repository
+
+import (
+	"crypto"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// passphraseInfo separates label wrapping keys from other uses of the key
+// derived from a passphrase.
+const passphraseInfo = "repository label passphrase"
+
+// kdfArgon2id is the only passphrase key derivation function labels use.
+const kdfArgon2id = "argon2id"
+
+// Limits on the Argon2id parameters read from a label, so a corrupt or
+// hostile label cannot exhaust memory or time.
+const (
+	maxKDFTime   = 16
+	maxKDFMemory = 1 << 20
+)
+
+// passphraseKDF records how the wrapping key of a passphrase slot is derived
+// from the passphrase.  Memory is in KiB.
+type passphraseKDF struct {
+	Name    string `json:"name"`
+	Salt    []byte `json:"salt"`
+	Time    uint32 `json:"time"`
+	Memory  uint32 `json:"memory"`
+	Threads uint8  `json:"threads"`
+}
+
+// newPassphraseKDF returns the default Argon2id parameters with a random
+// salt.
+func newPassphraseKDF() (*passphraseKDF, error) {
+	result := &passphraseKDF{Name: kdfArgon2id, Salt: make([]byte, 16), Time: 3, Memory: 64 * 1024, Threads: 4}
+	if _, err := rand.Read(result.Salt); err != nil {
+		return nil, NewError(err, "Unable to generate passphrase salt")
+	}
+	return result, nil
+}
+
+// wrappingKey derives the AES-GCM key that wraps the tape key from the
+// passphrase.
+func (k *passphraseKDF) wrappingKey(passphrase []byte) (cipher.AEAD, error) {
+	switch {
+	case k == nil:
+		return nil, errors.New("Label has no passphrase key derivation")
+	case k.Name != kdfArgon2id:
+		return nil, &UnsupportedVersionError{What: "passphrase key derivation", Value: k.Name}
+	case k.Time < 1 || k.Time > maxKDFTime || k.Memory < 8*uint32(k.Threads) || k.Memory > maxKDFMemory || k.Threads < 1:
+		return nil, fmt.Errorf("Invalid Argon2id parameters time=%d memory=%d threads=%d", k.Time, k.Memory, k.Threads)
+	}
+
+	secret := argon2.IDKey(passphrase, k.Salt, k.Time, k.Memory, k.Threads, 32)
+	aead, err := wrappingKey(secret, passphraseInfo, k.Salt)
+	if err != nil {
+		return nil, NewError(err, "Unable to derive wrapping key")
+	}
+	return aead, nil
+}
+
+// writePassphraseLabel wraps the label's key under a key derived from the
+// passphrase.  The label is signed when signKey is not nil.
+func (l *Label) writePassphraseLabel(repoFile io.Writer, passphrase []byte, signKey crypto.Signer) error {
+	if len(passphrase) == 0 {
+		return errors.New("An empty passphrase cannot protect a tape")
+	}
+
+	raw := &rawLabel{version: labelVersion}
+	raw.header = labelHeader{Mode: modePassphrase}
+	if signKey != nil {
+		signPub, err := rsaPublicKey(signKey.Public())
+		if err != nil {
+			return err
+		}
+		raw.header.Sender = Fingerprint(signPub)
+	}
+
+	kdf, err := newPassphraseKDF()
+	if err != nil {
+		return err
+	}
+	slot := keySlot{Recipient: modePassphrase, KDF: kdf}
+	aead, err := kdf.wrappingKey(passphrase)
+	if err != nil {
+		return err
+	}
+	if err = l.seal(aead, &slot); err != nil {
+		return err
+	}
+	raw.header.Slots = []keySlot{slot}
+
+	return l.signAndWrite(repoFile, raw, signKey)
+}
+
+// openPassphrase unwraps the tape key with the passphrase.
+func (l *Label) openPassphrase(raw *rawLabel, passphrase []byte) error {
+	if passphrase == nil {
+		return errors.New("Label is protected by a passphrase")
+	}
+	if len(raw.header.Slots) != 1 {
+		return errors.New("Passphrase label must have exactly one slot")
+	}
+
+	slot := raw.header.Slots[0]
+	aead, err := slot.KDF.wrappingKey(passphrase)
+	if err != nil {
+		return err
+	}
+	if err = l.unseal(aead, slot); err != nil {
+		return &PassphraseError{}
+	}
+	return nil
+}
+
+// WritePassphraseLabel creates a new label whose AES key and IV are wrapped
+// under a key derived from the passphrase with Argon2id and a random salt.
+// Recipients need only the passphrase, not a key pair.  The label is signed
+// with signKey unless it is nil.
+func (l *Label) WritePassphraseLabel(repoFile io.Writer, passphrase []byte, signKey crypto.Signer) error {
+	if err := l.writePassphraseLabel(repoFile, passphrase, signKey); err != nil {
+		return NewError(err, "Error writing label")
+	}
+
+	return nil
+}
@@ -0,0 +1,67 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestPassphraseTape(t *testing.T) {
+	fs := setupFs()
+	passphrase := []byte("correct horse battery staple")
+
+	for _, signed := range []bool{false, true} {
+		key := Key{Passphrase: passphrase}
+		if signed {
+			key.PrivateKey = medKey
+		}
+
+		buffer := new(bytes.Buffer)
+		tw, err := NewTapeWriter(key, buffer)
+		if err != nil {
+			t.Fatalf("Unable to write passphrase tape: %v", err)
+		}
+		tw.AddFile(fs, pathFor("data", "db", "files", "db2.dat"))
+		tw.Close()
+
+		tr, err := OpenTapeWithOptions(Key{Passphrase: passphrase}, bytes.NewReader(buffer.Bytes()), WithUnverified())
+		if signed {
+			if !errors.Is(err, ErrBadSignature) {
+				t.Errorf("Should not open a signed passphrase tape without the sender's key: %v", err)
+			}
+		} else if err != nil {
+			t.Fatalf("Unable to open passphrase tape: %v", err)
+		} else if contents, _ := tr.Contents(); len(contents) != 1 {
+			t.Errorf("Expected one file on the tape but got %v", contents)
+		}
+
+		_, err = OpenTapeWithPassphrase(passphrase, &medKey.PublicKey, bytes.NewReader(buffer.Bytes()))
+		if signed && err != nil {
+			t.Errorf("Unable to check the signature of a signed passphrase tape: %v", err)
+		}
+		if !signed && err == nil {
+			t.Error("An unsigned tape should not pass a signature check")
+		}
+
+		if _, err = OpenTapeWithPassphrase([]byte("wrong"), nil, bytes.NewReader(buffer.Bytes())); !errors.Is(err, ErrBadPassphrase) {
+			t.Errorf("Expected a bad passphrase opening with the wrong passphrase but got %v", err)
+		}
+
+		if _, err = OpenTape(medKey, &medKey.PublicKey, bytes.NewReader(buffer.Bytes())); err == nil {
+			t.Error("Should not open a passphrase tape without the passphrase")
+		}
+	}
+}
+
+func TestPassphraseLabelRejectsBadParameters(t *testing.T) {
+	l := Label{AesKey: testAes, iv: testIv}
+	if err := l.WritePassphraseLabel(new(bytes.Buffer), nil, nil); err == nil {
+		t.Error("Should not write a label with an empty passphrase")
+	}
+
+	kdf, _ := newPassphraseKDF()
+	kdf.Memory = maxKDFMemory + 1
+	if _, err := kdf.wrappingKey([]byte("secret")); err == nil {
+		t.Error("Should reject Argon2id parameters beyond the limits")
+	}
+}
@@ -0,0 +1,166 @@
+package repository
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Share is one custodian's share of the key of a threshold tape.  Label
+// identifies the tape's label, so shares of different tapes are not mixed.
+// A share is secret: together with enough other shares it opens the tape.
+type Share struct {
+	Label     string `json:"label"`
+	Custodian string `json:"custodian"`
+	Value     []byte `json:"value"`
+}
+
+// labelID identifies a label by the hash of its header.
+func (raw *rawLabel) labelID() string {
+	return fmt.Sprintf("%x", sha256.Sum256(raw.headerBytes))
+}
+
+// writeThresholdLabel splits the label's key and IV into one share per
+// custodian, any threshold of which recover them, and wraps each share under
+// its custodian's public key.
+func (l *Label) writeThresholdLabel(repoFile io.Writer, custodians []*rsa.PublicKey, threshold int, signKey crypto.Signer) error {
+	signPub, err := rsaPublicKey(signKey.Public())
+	if err != nil {
+		return err
+	}
+
+	shares, err := splitSecret(append(append([]byte{}, l.AesKey...), l.iv...), len(custodians), threshold)
+	if err != nil {
+		return err
+	}
+
+	raw := &rawLabel{version: labelVersion}
+	raw.header = labelHeader{Mode: modeThreshold, Sender: Fingerprint(signPub), Threshold: threshold}
+	for i, custodian := range custodians {
+		wrapped, err := rsa.EncryptPKCS1v15(rand.Reader, custodian, shares[i])
+		if err != nil {
+			return NewError(err, "Failed to encrypt key share")
+		}
+		raw.header.Slots = append(raw.header.Slots, keySlot{Recipient: Fingerprint(custodian), Wrapped: wrapped})
+	}
+
+	return l.signAndWrite(repoFile, raw, signKey)
+}
+
+// WriteThresholdLabel creates a new label whose AES key and IV can only be
+// recovered by combining the shares of at least threshold of the custodians.
+// See CreateShare and OpenTapeWithShares.
+func (l *Label) WriteThresholdLabel(repoFile io.Writer, custodians []*rsa.PublicKey, threshold int, signKey crypto.Signer) error {
+	if err := l.writeThresholdLabel(repoFile, custodians, threshold, signKey); err != nil {
+		return NewError(err, "Error writing label")
+	}
+
+	return nil
+}
+
+// CreateShare reads a threshold label and decrypts the custodian's share of
+// the tape key with the custodian's private key.
+func CreateShare(repoFile io.Reader, decrKey crypto.Decrypter) (*Share, error) {
+	raw, err := readRawLabel(repoFile)
+	if err != nil {
+		return nil, NewError(err, "Unable to read label")
+	}
+	if raw.header.Mode != modeThreshold {
+		return nil, errors.New("Label is not split among custodians")
+	}
+
+	slot, err := raw.rsaSlot(decrKey)
+	if err != nil {
+		return nil, err
+	}
+
+	value, err := decrKey.Decrypt(rand.Reader, slot.Wrapped, &rsa.PKCS1v15DecryptOptions{})
+	if err != nil {
+		return nil, NewError(err, "Unable to decrypt key share")
+	}
+
+	return &Share{Label: raw.labelID(), Custodian: slot.Recipient, Value: value}, nil
+}
+
+// ReadShare reads a share written by WriteShare.
+func ReadShare(in io.Reader) (*Share, error) {
+	result := &Share{}
+	if err := json.NewDecoder(in).Decode(result); err != nil {
+		return nil, NewError(err, "Unable to read key share")
+	}
+	return result, nil
+}
+
+// WriteShare writes a share so it can be passed to whoever combines them.
+func WriteShare(out io.Writer, share *Share) error {
+	return json.NewEncoder(out).Encode(share)
+}
+
+// OpenTapeWithShares opens a threshold tape by combining the custodians'
+// shares of its key.  At least the label's threshold of shares from
+// different custodians is needed.  The label signature is checked with the
+// sender's public key, which must satisfy the default policy, as must the
+// label's hash algorithm.  The tape is not opened outside its validity
+// window, see WindowError.
+func OpenTapeWithShares(tape io.Reader, shares []*Share, publicKey *rsa.PublicKey) (*TapeReader, error) {
+	result := &TapeReader{Key: Key{PublicKey: publicKey}}
+	if err := result.Key.checkPolicy(); err != nil {
+		return nil, err
+	}
+
+	raw, err := readRawLabel(tape)
+	if err != nil {
+		return nil, NewError(err, "Unable to read respository label")
+	}
+	if raw.header.Mode != modeThreshold {
+		return nil, errors.New("Label is not split among custodians")
+	}
+
+	values := [][]byte{}
+	custodians := map[string]bool{}
+	for _, share := range shares {
+		if share.Label != raw.labelID() {
+			return nil, fmt.Errorf("Share from custodian %s is for another tape", share.Custodian)
+		}
+		if _, ok := raw.slotFor(share.Custodian); !ok || custodians[share.Custodian] {
+			return nil, fmt.Errorf("Share from custodian %s is not a custodian's share or is repeated", share.Custodian)
+		}
+		custodians[share.Custodian] = true
+		values = append(values, share.Value)
+	}
+	if len(values) < raw.header.Threshold {
+		return nil, fmt.Errorf("%d shares are needed to open the tape but only %d were given", raw.header.Threshold, len(values))
+	}
+
+	secret, err := combineShares(values)
+	if err != nil || len(secret) != 48 {
+		return nil, NewError(err, "Unable to combine key shares")
+	}
+	result.Key.Label.AesKey = secret[0:32]
+	result.Key.Label.iv = secret[32:48]
+
+	if err = raw.options(&result.Key.Label); err != nil {
+		return nil, NewError(err, "Unable to read respository label")
+	}
+	if err = result.Key.policy().CheckHash(result.Key.Label.hashName); err != nil {
+		return nil, err
+	}
+	if err = raw.verify(&result.Key.Label, publicKey); err != nil {
+		return nil, NewError(err, "Unable to verify signature")
+	}
+	result.Key.Label.header = raw.headerBytes
+	if err = result.Key.Label.checkWindow(time.Now(), false); err != nil {
+		return nil, err
+	}
+
+	if err = result.openArchive(tape); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
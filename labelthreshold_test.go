@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"bytes"
+	"crypto/rsa"
+	"testing"
+)
+
+func TestThresholdTape(t *testing.T) {
+	custodians := []*rsa.PrivateKey{medKey, testKey, longKey}
+	fs := setupFs()
+	buffer := new(bytes.Buffer)
+	key := Key{
+		PrivateKey: medKey,
+		Custodians: []*rsa.PublicKey{&medKey.PublicKey, &testKey.PublicKey, &longKey.PublicKey},
+		Threshold:  2,
+	}
+	tw, err := NewTapeWriter(key, buffer)
+	if err != nil {
+		t.Fatalf("Unable to write threshold tape: %v", err)
+	}
+	tw.AddFile(fs, pathFor("data", "db", "files", "db2.dat"))
+	tw.Close()
+
+	shares := []*Share{}
+	for _, custodian := range custodians {
+		share, err := CreateShare(bytes.NewReader(buffer.Bytes()), custodian)
+		if err != nil {
+			t.Fatalf("Unable to create share: %v", err)
+		}
+
+		written := new(bytes.Buffer)
+		WriteShare(written, share)
+		if share, err = ReadShare(written); err != nil {
+			t.Fatalf("Unable to read share: %v", err)
+		}
+		shares = append(shares, share)
+	}
+
+	if _, err = OpenTape(medKey, &medKey.PublicKey, bytes.NewReader(buffer.Bytes())); err == nil {
+		t.Error("A single custodian should not open a threshold tape")
+	}
+
+	if _, err = OpenTapeWithShares(bytes.NewReader(buffer.Bytes()), shares[:1], &medKey.PublicKey); err == nil {
+		t.Error("One share should not open a tape with a threshold of two")
+	}
+
+	if _, err = OpenTapeWithShares(bytes.NewReader(buffer.Bytes()), []*Share{shares[0], shares[0]}, &medKey.PublicKey); err == nil {
+		t.Error("A repeated share should not count twice")
+	}
+
+	tr, err := OpenTapeWithShares(bytes.NewReader(buffer.Bytes()), shares[1:], &medKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Unable to open threshold tape with two shares: %v", err)
+	}
+	if contents, _ := tr.Contents(); len(contents) != 1 {
+		t.Errorf("Expected one file on the tape but got %v", contents)
+	}
+
+	if _, err = OpenTapeWithShares(bytes.NewReader(buffer.Bytes()), shares[1:], &longKey.PublicKey); err == nil {
+		t.Error("Threshold tape should not verify with the wrong sender key")
+	}
+
+	other := new(bytes.Buffer)
+	NewTapeWriter(key, other)
+	if _, err = OpenTapeWithShares(bytes.NewReader(other.Bytes()), shares[1:], &medKey.PublicKey); err == nil {
+		t.Error("Shares of another tape should be rejected")
+	}
+}
@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Metadata describes who made a tape, when, where and why.  Fields holds
+// any other user supplied keys and values.  The metadata is written right
+// after the label, encrypted like the archive, and its hash is in the signed
+// label header.
+type Metadata struct {
+	Creator     string            `json:"creator,omitempty"`
+	Created     time.Time         `json:"created"`
+	Hostname    string            `json:"hostname,omitempty"`
+	Tool        string            `json:"tool,omitempty"`
+	Description string            `json:"description,omitempty"`
+	Fields      map[string]string `json:"fields,omitempty"`
+}
+
+// metadataDigest is the hash of the metadata block recorded in the label
+// header, made with the label's hash algorithm.  Unless the tape is
+// sign-only, the hash is keyed with the tape key so the header does not
+// give away guessable metadata.
+func (l *Label) metadataDigest(block []byte) string {
+	hash := l.digestAlgorithm().New()
+	if !l.signOnly {
+		hash.Write(l.AesKey)
+		hash.Write(l.iv)
+	}
+	hash.Write(block)
+	return fmt.Sprintf("%x", hash.Sum(nil))
+}
+
+// encodeMetadata encodes the metadata block and records its hash in the
+// label.
+func (l *Label) encodeMetadata(metadata *Metadata) ([]byte, error) {
+	block, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, NewError(err, "Unable to encode tape metadata")
+	}
+	l.metadata = l.metadataDigest(block)
+	return block, nil
+}
+
+// readMetadata reads the metadata block from the start of the archive and
+// checks it against the hash in the label.  Returns nil if the label has no
+// metadata.
+func (l *Label) readMetadata(archive io.Reader) (*Metadata, error) {
+	if l.metadata == "" {
+		return nil, nil
+	}
+
+	block, err := readLabelBlock(archive)
+	if err != nil {
+		return nil, NewError(err, "Unable to read tape metadata")
+	}
+	if l.metadataDigest(block) != l.metadata {
+		return nil, &SignatureError{What: "metadata", Err: errors.New("tape metadata does not match the label")}
+	}
+
+	result := &Metadata{}
+	if err = json.Unmarshal(block, result); err != nil {
+		return nil, NewError(err, "Unable to parse tape metadata")
+	}
+	return result, nil
+}
+
+// Metadata returns the tape's metadata, or nil if it has none.
+func (r *TapeReader) Metadata() *Metadata {
+	return r.metadata
+}
@@ -0,0 +1,87 @@
+package repository
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func metadataTape(t *testing.T, key Key) []byte {
+	fs := setupFs()
+	key.Metadata = &Metadata{
+		Creator:     "backup",
+		Created:     time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC),
+		Hostname:    "db1",
+		Tool:        "tapedrive",
+		Description: "Nightly database export",
+		Fields:      map[string]string{"job": "nightly-db"},
+	}
+
+	out := new(bytes.Buffer)
+	tape, err := NewTapeWriter(key, out)
+	if err != nil {
+		t.Fatalf("Unable to create tape: %v", err)
+	}
+	tape.AddFile(fs, pathFor("data", "db", "files", "db2.dat"))
+	if err = tape.Close(); err != nil {
+		t.Fatalf("Unable to close tape: %v", err)
+	}
+	return out.Bytes()
+}
+
+func checkMetadata(t *testing.T, tr *TapeReader) {
+	metadata := tr.Metadata()
+	if metadata == nil {
+		t.Fatal("Tape has no metadata")
+	}
+	if metadata.Hostname != "db1" || metadata.Fields["job"] != "nightly-db" || !metadata.Created.Equal(time.Date(2024, 3, 1, 2, 0, 0, 0, time.UTC)) {
+		t.Errorf("Wrong metadata %+v", metadata)
+	}
+	if contents, err := tr.Contents(); err != nil || len(contents) != 1 {
+		t.Errorf("Unable to read the archive after the metadata, got %v: %v", contents, err)
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	tape := metadataTape(t, tapeKey)
+	if bytes.Contains(tape, []byte("nightly-db")) {
+		t.Error("Metadata should be encrypted")
+	}
+
+	tr, err := OpenTape(medKey, &medKey.PublicKey, bytes.NewReader(tape))
+	if err != nil {
+		t.Fatalf("Unable to open tape with metadata: %v", err)
+	}
+	checkMetadata(t, tr)
+
+	out := new(bytes.Buffer)
+	if err = Relabel(bytes.NewReader(tape), out, tapeKey, &testKey.PublicKey); err != nil {
+		t.Fatalf("Unable to relabel tape: %v", err)
+	}
+	if tr, err = OpenTape(testKey, &medKey.PublicKey, bytes.NewReader(out.Bytes())); err != nil {
+		t.Fatalf("Unable to open relabeled tape with metadata: %v", err)
+	}
+	checkMetadata(t, tr)
+
+	counter := &countingReader{in: bytes.NewReader(tape)}
+	readRawLabel(counter)
+	tampered := append([]byte{}, tape...)
+	tampered[counter.count+8] ^= 1
+	if _, err = OpenTape(medKey, &medKey.PublicKey, bytes.NewReader(tampered)); err == nil {
+		t.Error("Should not open a tape with tampered metadata")
+	}
+}
+
+func TestSignOnlyMetadata(t *testing.T) {
+	tape := metadataTape(t, Key{PrivateKey: medKey, SignOnly: true})
+
+	tr, err := OpenTape(nil, &medKey.PublicKey, bytes.NewReader(tape))
+	if err != nil {
+		t.Fatalf("Unable to open sign-only tape with metadata: %v", err)
+	}
+	checkMetadata(t, tr)
+
+	if _, err = VerifyTape(bytes.NewReader(tape), &medKey.PublicKey); err != nil {
+		t.Errorf("Unable to verify sign-only tape with metadata: %v", err)
+	}
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"crypto/rsa"
+	"errors"
+	"fmt"
+)
+
+// Compression applied to the archive on a tape.  It is recorded in the
+// signed label header.
+const (
+	CompressionNone = "none"
+	CompressionGzip = "gzip"
+)
+
+// ProgressFunc is called after each file is added to or extracted from a
+// tape with the file's name, its size and the total size of the files so
+// far.
+type ProgressFunc func(name string, size, total int64)
+
+// FileFilter reports whether a file should be added to or extracted from a
+// tape.
+type FileFilter func(name string) bool
+
+// TapeOptions configures writing and reading tapes, beyond the keys in Key.
+// Writers use the Hash and Compression algorithms, wrap the tape key for the
+// additional RSA Recipients and write the Metadata.  Readers find their keys
+// with the Provider, when set.  Both call Progress, skip files the Filter
+// rejects and refuse files larger than MaxFileSize, or which take the files
+// on the tape past MaxSize; zero sizes are unlimited.  Readers refuse
+// encrypted tapes whose trailer cannot be checked unless Unverified is set.
+// Start from DefaultTapeOptions.
+type TapeOptions struct {
+	Hash        string
+	Compression string
+	Recipients  []*rsa.PublicKey
+	Metadata    *Metadata
+	Provider    KeyProvider
+	Progress    ProgressFunc
+	Filter      FileFilter
+	MaxFileSize int64
+	MaxSize     int64
+	Unverified  bool
+}
+
+// TapeOption changes one setting of the TapeOptions.
+type TapeOption func(*TapeOptions)
+
+// DefaultTapeOptions are the options used when none are given: tapes are
+// signed with the DefaultHash, not compressed and have no size limits.
+func DefaultTapeOptions() TapeOptions {
+	return TapeOptions{Hash: DefaultHash, Compression: CompressionNone}
+}
+
+// Validate checks that the options' settings make sense.
+func (o *TapeOptions) Validate() error {
+	if _, err := lookupHash(o.Hash); err != nil {
+		return err
+	}
+	if _, err := lookupCompression(o.Compression); err != nil {
+		return err
+	}
+	for _, recipient := range o.Recipients {
+		if recipient == nil {
+			return errors.New("Recipients cannot include a nil key")
+		}
+	}
+	if o.MaxFileSize < 0 || o.MaxSize < 0 {
+		return errors.New("Size limits cannot be negative")
+	}
+	return nil
+}
+
+// WithConfig replaces every option with those in config.
+func WithConfig(config TapeOptions) TapeOption {
+	return func(o *TapeOptions) { *o = config }
+}
+
+// WithHash signs the tape with the named hash algorithm, see
+// HashAlgorithms.
+func WithHash(name string) TapeOption {
+	return func(o *TapeOptions) { o.Hash = name }
+}
+
+// WithCompression compresses the archive, CompressionNone or
+// CompressionGzip.
+func WithCompression(compression string) TapeOption {
+	return func(o *TapeOptions) { o.Compression = compression }
+}
+
+// WithRecipients also wraps the tape key for each of the recipients.
+func WithRecipients(recipients ...*rsa.PublicKey) TapeOption {
+	return func(o *TapeOptions) { o.Recipients = append(o.Recipients, recipients...) }
+}
+
+// WithMetadata writes the metadata after the label.
+func WithMetadata(metadata *Metadata) TapeOption {
+	return func(o *TapeOptions) { o.Metadata = metadata }
+}
+
+// WithProvider finds the keys to read a tape in the provider, see
+// OpenTapeWithProvider.
+func WithProvider(provider KeyProvider) TapeOption {
+	return func(o *TapeOptions) { o.Provider = provider }
+}
+
+// WithProgress calls progress after each file is added or extracted.
+func WithProgress(progress ProgressFunc) TapeOption {
+	return func(o *TapeOptions) { o.Progress = progress }
+}
+
+// WithFilter only adds or extracts the files filter accepts.
+func WithFilter(filter FileFilter) TapeOption {
+	return func(o *TapeOptions) { o.Filter = filter }
+}
+
+// WithSizeLimits refuses files larger than maxFile bytes and files that take
+// the total past maxSize bytes.  Zero is unlimited.
+func WithSizeLimits(maxFile, maxSize int64) TapeOption {
+	return func(o *TapeOptions) {
+		o.MaxFileSize = maxFile
+		o.MaxSize = maxSize
+	}
+}
+
+// WithUnverified reads encrypted tapes whose trailer cannot be checked: those
+// with no trailer or read without the sender's public key, and those read
+// from a stream that cannot seek.  Their payload is not authenticated, so
+// it may have been changed; see TapeReader.Verified.
+func WithUnverified() TapeOption {
+	return func(o *TapeOptions) { o.Unverified = true }
+}
+
+// tapeOptions returns the default options, with the key's hash algorithm and
+// metadata, changed by opts.
+func (k Key) tapeOptions(opts []TapeOption) (TapeOptions, error) {
+	result := DefaultTapeOptions()
+	if k.Hash != "" {
+		result.Hash = k.Hash
+	}
+	result.Metadata = k.Metadata
+	for _, opt := range opts {
+		opt(&result)
+	}
+
+	if err := result.Validate(); err != nil {
+		return result, NewError(err, "Invalid tape options")
+	}
+	return result, nil
+}
+
+// accept reports whether a file passes the filter.
+func (o *TapeOptions) accept(name string) bool {
+	return o.Filter == nil || o.Filter(name)
+}
+
+// checkSize returns an error if a file of the given size is larger than the
+// limit, or takes the total so far past the limit.
+func (o *TapeOptions) checkSize(name string, size, total int64) error {
+	if o.MaxFileSize > 0 && size > o.MaxFileSize {
+		return fmt.Errorf("File %s is %d bytes, more than the limit of %d", name, size, o.MaxFileSize)
+	}
+	if o.MaxSize > 0 && total+size > o.MaxSize {
+		return fmt.Errorf("File %s takes the tape past its limit of %d bytes", name, o.MaxSize)
+	}
+	return nil
+}
+
+// progress reports a file added or extracted.
+func (o *TapeOptions) progress(name string, size, total int64) {
+	if o.Progress != nil {
+		o.Progress(name, size, total)
+	}
+}
+
+// lookupCompression checks a compression name.  An empty name is
+// CompressionNone.
+func lookupCompression(name string) (string, error) {
+	switch name {
+	case "", CompressionNone:
+		return CompressionNone, nil
+	case CompressionGzip:
+		return name, nil
+	}
+	return "", &UnsupportedVersionError{What: "compression", Value: name}
+}
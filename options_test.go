@@ -0,0 +1,158 @@
+package repository
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func optionsTape(t *testing.T, key Key, opts ...TapeOption) []byte {
+	fs := setupFs()
+	out := new(bytes.Buffer)
+	tape, err := NewTapeWriterWithOptions(key, out, opts...)
+	if err != nil {
+		t.Fatalf("Unable to create tape: %v", err)
+	}
+	if err = tape.AddDirectory(fs, pathFor("data", "db")); err != nil {
+		t.Fatalf("Unable to add files: %v", err)
+	}
+	if err = tape.Close(); err != nil {
+		t.Fatalf("Unable to close tape: %v", err)
+	}
+	return out.Bytes()
+}
+
+func TestTapeOptionsValidate(t *testing.T) {
+	options := DefaultTapeOptions()
+	if err := options.Validate(); err != nil {
+		t.Errorf("The default options should be valid: %v", err)
+	}
+
+	for _, opt := range []TapeOption{WithHash("md5"), WithCompression("zip"), WithRecipients(nil), WithSizeLimits(-1, 0)} {
+		options := DefaultTapeOptions()
+		opt(&options)
+		if err := options.Validate(); err == nil {
+			t.Errorf("Should not validate options %+v", options)
+		}
+		if _, err := NewTapeWriterWithOptions(tapeKey, new(bytes.Buffer), opt); err == nil {
+			t.Errorf("Should not write a tape with options %+v", options)
+		}
+	}
+}
+
+func TestCompressedTape(t *testing.T) {
+	plain := optionsTape(t, tapeKey)
+	compressed := optionsTape(t, tapeKey, WithConfig(TapeOptions{Hash: HashSHA512, Compression: CompressionGzip}))
+	if len(compressed) >= len(plain)/10 {
+		t.Errorf("Expected the compressed tape to be much smaller, %d bytes against %d", len(compressed), len(plain))
+	}
+
+	tr, err := OpenTape(medKey, &medKey.PublicKey, bytes.NewReader(compressed))
+	if err != nil {
+		t.Fatalf("Unable to open compressed tape: %v", err)
+	}
+	if contents, err := tr.Contents(); err != nil || len(contents) != 4 {
+		t.Errorf("Expected four entries on the compressed tape but got %v: %v", contents, err)
+	}
+	if err = CheckSender(bytes.NewReader(compressed), &medKey.PublicKey); err != nil {
+		t.Errorf("Unable to check the trailer of the compressed tape: %v", err)
+	}
+	if info, err := InspectTape(bytes.NewReader(compressed)); err != nil || info.Compression != CompressionGzip || info.Hash != HashSHA512 {
+		t.Errorf("Expected inspection to report gzip and sha512 but got %+v: %v", info, err)
+	}
+
+	signed := optionsTape(t, Key{PrivateKey: medKey, SignOnly: true}, WithCompression(CompressionGzip))
+	if manifest, err := VerifyTape(bytes.NewReader(signed), &medKey.PublicKey); err != nil || len(manifest) != 4 {
+		t.Errorf("Unable to verify compressed sign-only tape, got %v: %v", manifest, err)
+	}
+}
+
+func TestTapeRecipients(t *testing.T) {
+	tape := optionsTape(t, tapeKey, WithRecipients(&testKey.PublicKey, &longKey.PublicKey))
+
+	for _, recipient := range []PrivateKey{medKey, testKey, longKey} {
+		if _, err := OpenTape(recipient, &medKey.PublicKey, bytes.NewReader(tape)); err != nil {
+			t.Errorf("Each recipient should be able to open the tape: %v", err)
+		}
+	}
+
+	key := Key{PrivateKey: medKey, SignOnly: true}
+	if _, err := NewTapeWriterWithOptions(key, new(bytes.Buffer), WithRecipients(&testKey.PublicKey)); err == nil {
+		t.Error("Should not add recipients to a sign-only tape")
+	}
+	if _, err := NewTapeWriterWithOptions(tapeKey, new(bytes.Buffer), WithRecipients(&shortKey.PublicKey)); err == nil {
+		t.Error("Should not add a recipient the policy rejects")
+	}
+}
+
+func TestTapeFilterLimitsProgress(t *testing.T) {
+	written := []string{}
+	tape := optionsTape(t, tapeKey,
+		WithFilter(func(name string) bool { return !strings.HasSuffix(name, "db1.dat") }),
+		WithProgress(func(name string, size, total int64) { written = append(written, name) }))
+	if len(written) != 3 {
+		t.Errorf("Expected progress for the three files not filtered but got %v", written)
+	}
+
+	tr, err := OpenTape(medKey, &medKey.PublicKey, bytes.NewReader(tape))
+	if err != nil {
+		t.Fatalf("Unable to open filtered tape: %v", err)
+	}
+	if contents, _ := tr.Contents(); len(contents) != 3 {
+		t.Errorf("Expected the filtered file to be left off the tape but got %v", contents)
+	}
+
+	fs := setupFs()
+	out := new(bytes.Buffer)
+	tw, err := NewTapeWriterWithOptions(tapeKey, out, WithSizeLimits(600*1024, 0))
+	if err != nil {
+		t.Fatalf("Unable to create tape: %v", err)
+	}
+	if err = tw.AddFile(fs, pathFor("data", "db", "files", "db1.dat")); err == nil {
+		t.Error("Should not add a file larger than the limit")
+	}
+	if err = tw.AddFile(fs, pathFor("data", "db", "files", "db2.dat")); err != nil {
+		t.Errorf("Unable to add a file within the limit: %v", err)
+	}
+
+	tape = optionsTape(t, tapeKey)
+	extracted := []string{}
+	key := Key{PrivateKey: medKey, PublicKey: &medKey.PublicKey}
+	tr, err = OpenTapeWithOptions(key, bytes.NewReader(tape),
+		WithFilter(func(name string) bool { return !strings.HasSuffix(name, "db2.dat") }),
+		WithProgress(func(name string, size, total int64) { extracted = append(extracted, name) }),
+		WithSizeLimits(0, 1024*1024))
+	if err != nil {
+		t.Fatalf("Unable to open tape with options: %v", err)
+	}
+	var extractErr error
+	for extractErr == nil {
+		extractErr = tr.ExtractFile(setupFs())
+	}
+	if len(extracted) != 3 || strings.HasSuffix(extracted[len(extracted)-1], "db2.dat") {
+		t.Errorf("Expected the filtered file to be skipped but extracted %v: %v", extracted, extractErr)
+	}
+
+	tr, _ = OpenTapeWithOptions(key, bytes.NewReader(tape), WithSizeLimits(0, 1024))
+	for extractErr = nil; extractErr == nil; {
+		extractErr = tr.ExtractFile(setupFs())
+	}
+	if !strings.Contains(extractErr.Error(), "limit") {
+		t.Errorf("Expected extraction to stop at the size limit but got %v", extractErr)
+	}
+}
+
+func TestOpenTapeWithProviderOption(t *testing.T) {
+	keystore := &Keystore{PrivateKeys: map[string][]byte{}, PublicKeys: map[string][]byte{}}
+	keystore.AddPrivateKey("receiver", medKey)
+	keystore.AddPublicKey("sender", &medKey.PublicKey)
+	tape := optionsTape(t, tapeKey)
+
+	tr, err := OpenTapeWithOptions(Key{}, bytes.NewReader(tape), WithProvider(NewKeystoreProvider(keystore)))
+	if err != nil {
+		t.Fatalf("Unable to open tape with a provider option: %v", err)
+	}
+	if tr.Key.PublicKey == nil || Fingerprint(tr.Key.PublicKey) != Fingerprint(&medKey.PublicKey) {
+		t.Error("Expected the sender's key to be found in the provider")
+	}
+}
@@ -0,0 +1,76 @@
+package repository
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/darcinc/afero"
+)
+
+// pkcs11URI is the subset of an RFC 7512 PKCS#11 URI needed to find a token
+// and log in to it, for example
+// pkcs11:token=backups?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source=/etc/pin
+type pkcs11URI struct {
+	Module  string
+	Token   string
+	Slot    int
+	HasSlot bool
+	PIN     string
+}
+
+func parsePKCS11URI(fs afero.Fs, location string) (*pkcs11URI, error) {
+	if !strings.HasPrefix(location, "pkcs11:") {
+		return nil, fmt.Errorf("Not a PKCS#11 URI: %s", location)
+	}
+
+	result := &pkcs11URI{}
+	rest := strings.TrimPrefix(location, "pkcs11:")
+	path, query := rest, ""
+	if i := strings.Index(rest, "?"); i >= 0 {
+		path, query = rest[:i], rest[i+1:]
+	}
+
+	attributes := map[string]string{}
+	for _, part := range append(strings.Split(path, ";"), strings.Split(query, "&")...) {
+		if part == "" {
+			continue
+		}
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("Invalid PKCS#11 URI attribute %s", part)
+		}
+		value, err := url.PathUnescape(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		attributes[kv[0]] = value
+	}
+
+	result.Module = attributes["module-path"]
+	if result.Module == "" {
+		return nil, fmt.Errorf("PKCS#11 URI %s has no module-path", location)
+	}
+	result.Token = attributes["token"]
+
+	if slot, ok := attributes["slot-id"]; ok {
+		id, err := strconv.Atoi(slot)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid PKCS#11 slot-id %s", slot)
+		}
+		result.Slot = id
+		result.HasSlot = true
+	}
+
+	result.PIN = attributes["pin-value"]
+	if source, ok := attributes["pin-source"]; ok {
+		pin, err := afero.ReadFile(fs, strings.TrimPrefix(source, "file:"))
+		if err != nil {
+			return nil, NewError(err, "Unable to read PKCS#11 PIN")
+		}
+		result.PIN = strings.TrimRight(string(pin), "\r\n")
+	}
+
+	return result, nil
+}
@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Policy describes which keys are acceptable for writing and reading tapes.
+type Policy struct {
+	// MinRSABits is the smallest RSA modulus allowed.
+	MinRSABits int `json:"minRSABits"`
+
+	// Algorithms lists the key algorithms allowed, "rsa" or
+	// "mlkem768-x25519".
+	Algorithms []string `json:"algorithms"`
+
+	// MaxKeyAgeDays is the age in days after which a key expires.  Zero
+	// means keys do not expire.
+	MaxKeyAgeDays int `json:"maxKeyAgeDays"`
+
+	// Hashes lists the hash algorithms tapes may be signed with, see
+	// HashAlgorithms.  Empty allows every supported algorithm.
+	Hashes []string `json:"hashes,omitempty"`
+}
+
+// PolicyError reports a key that does not satisfy a policy.
+type PolicyError struct {
+	Reason string
+}
+
+// Error implements the error interface.
+func (e *PolicyError) Error() string {
+	return "key rejected by policy: " + e.Reason
+}
+
+// DefaultPolicy is the policy used when none is configured.  It requires
+// RSA keys of at least 2048 bits, allows hybrid keys and lets keys live
+// forever.
+func DefaultPolicy() *Policy {
+	return &Policy{
+		MinRSABits: 2048,
+		Algorithms: []string{"rsa", HybridKeyType},
+	}
+}
+
+// ReadPolicy reads a policy from JSON.  Settings missing from the JSON keep
+// their default values.
+func ReadPolicy(in io.Reader) (*Policy, error) {
+	result := DefaultPolicy()
+	if err := json.NewDecoder(in).Decode(result); err != nil {
+		return nil, NewError(err, "Unable to read policy")
+	}
+
+	if err := result.Validate(); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// Validate checks that the policy's settings make sense.
+func (p *Policy) Validate() error {
+	if p.MinRSABits < 1024 {
+		return fmt.Errorf("Policy minimum RSA size of %d bits is below 1024", p.MinRSABits)
+	}
+	if len(p.Algorithms) == 0 {
+		return fmt.Errorf("Policy allows no key algorithms")
+	}
+	if p.MaxKeyAgeDays < 0 {
+		return fmt.Errorf("Policy maximum key age cannot be negative")
+	}
+	for _, name := range p.Hashes {
+		if _, ok := hashAlgorithms[name]; !ok {
+			return fmt.Errorf("Policy allows unknown hash algorithm %q", name)
+		}
+	}
+	return nil
+}
+
+// keyAlgorithm names the algorithm of a public key as used in policies.
+func keyAlgorithm(key crypto.PublicKey) string {
+	switch key.(type) {
+	case *rsa.PublicKey:
+		return "rsa"
+	case *HybridPublicKey:
+		return HybridKeyType
+	}
+	return fmt.Sprintf("%T", key)
+}
+
+// CheckKey checks that a public key uses an allowed algorithm and is large
+// enough.  Returns a *PolicyError if it is not.
+func (p *Policy) CheckKey(key crypto.PublicKey) error {
+	algorithm := keyAlgorithm(key)
+
+	allowed := false
+	for _, a := range p.Algorithms {
+		allowed = allowed || a == algorithm
+	}
+	if !allowed {
+		return &PolicyError{Reason: fmt.Sprintf("algorithm %s is not allowed", algorithm)}
+	}
+
+	if pub, ok := key.(*rsa.PublicKey); ok && pub.N.BitLen() < p.MinRSABits {
+		return &PolicyError{Reason: fmt.Sprintf("%d bit RSA key is smaller than %d bits", pub.N.BitLen(), p.MinRSABits)}
+	}
+
+	return nil
+}
+
+// CheckHash checks that tapes may be signed with the named hash algorithm.
+// An empty name is the DefaultHash.  Returns a *PolicyError if they may not.
+func (p *Policy) CheckHash(name string) error {
+	if name == "" {
+		name = DefaultHash
+	}
+	if _, err := lookupHash(name); err != nil {
+		return &PolicyError{Reason: err.Error()}
+	}
+	if len(p.Hashes) == 0 {
+		return nil
+	}
+
+	for _, allowed := range p.Hashes {
+		if allowed == name {
+			return nil
+		}
+	}
+	return &PolicyError{Reason: fmt.Sprintf("hash algorithm %s is not allowed", name)}
+}
+
+// CheckAge checks that a key created at the given time has not expired.  A
+// zero creation time means the age is unknown and is accepted.
+func (p *Policy) CheckAge(created time.Time) error {
+	if p.MaxKeyAgeDays == 0 || created.IsZero() {
+		return nil
+	}
+
+	expires := created.AddDate(0, 0, p.MaxKeyAgeDays)
+	if time.Now().After(expires) {
+		return &PolicyError{Reason: fmt.Sprintf("key expired on %s", expires.Format("2006-01-02"))}
+	}
+	return nil
+}
+
+func (k Key) policy() *Policy {
+	if k.Policy != nil {
+		return k.Policy
+	}
+	return DefaultPolicy()
+}
+
+// checkPolicy checks the key's RSA, hybrid and custodian keys against its
+// policy.
+func (k Key) checkPolicy() error {
+	policy := k.policy()
+	if k.HybridKey != nil {
+		if err := policy.CheckKey(k.HybridKey); err != nil {
+			return err
+		}
+	}
+	if k.PublicKey != nil {
+		if err := policy.CheckKey(k.PublicKey); err != nil {
+			return err
+		}
+	}
+	for _, custodian := range k.Custodians {
+		if err := policy.CheckKey(custodian); err != nil {
+			return err
+		}
+	}
+	for _, escrow := range k.Escrow {
+		if err := policy.CheckKey(escrow); err != nil {
+			return err
+		}
+	}
+	if k.PrivateKey != nil {
+		if err := policy.CheckKey(k.PrivateKey.Public()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
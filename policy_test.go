@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/darcinc/afero"
+)
+
+func TestReadPolicy(t *testing.T) {
+	policy, err := ReadPolicy(strings.NewReader(`{"minRSABits": 4096, "maxKeyAgeDays": 365}`))
+	if err != nil {
+		t.Fatalf("Unable to read policy: %v", err)
+	}
+
+	if policy.MinRSABits != 4096 || policy.MaxKeyAgeDays != 365 || len(policy.Algorithms) != 2 {
+		t.Errorf("Policy read incorrectly: %+v", policy)
+	}
+
+	for _, bad := range []string{`{"minRSABits": 512}`, `{"algorithms": []}`, `{"maxKeyAgeDays": -1}`, `not json`} {
+		if _, err := ReadPolicy(strings.NewReader(bad)); err == nil {
+			t.Errorf("Policy %s should be rejected", bad)
+		}
+	}
+}
+
+func TestPolicyCheckKey(t *testing.T) {
+	policy := DefaultPolicy()
+	if err := policy.CheckKey(&shortKey.PublicKey); err == nil {
+		t.Error("1024 bit key should be rejected by the default policy")
+	}
+	if err := policy.CheckKey(&medKey.PublicKey); err != nil {
+		t.Errorf("2048 bit key should be accepted: %v", err)
+	}
+
+	policy.Algorithms = []string{"ed25519"}
+	if err := policy.CheckKey(&medKey.PublicKey); err == nil {
+		t.Error("RSA key should be rejected when RSA is not allowed")
+	}
+}
+
+func TestPolicyCheckAge(t *testing.T) {
+	policy := DefaultPolicy()
+	old := time.Now().AddDate(-2, 0, 0)
+	if err := policy.CheckAge(old); err != nil {
+		t.Errorf("Keys should not expire without a maximum age: %v", err)
+	}
+
+	policy.MaxKeyAgeDays = 365
+	if err := policy.CheckAge(old); err == nil {
+		t.Error("Two year old key should have expired")
+	}
+	if err := policy.CheckAge(time.Now()); err != nil {
+		t.Errorf("New key should not have expired: %v", err)
+	}
+}
+
+func TestTapePolicy(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	_, err := NewTapeWriter(Key{PublicKey: &shortKey.PublicKey, PrivateKey: medKey}, buffer)
+	if _, ok := err.(*PolicyError); !ok {
+		t.Errorf("Expected a policy error writing to a weak key but got %v", err)
+	}
+
+	lax := DefaultPolicy()
+	lax.MinRSABits = 1024
+	tw, err := NewTapeWriter(Key{PublicKey: &shortKey.PublicKey, PrivateKey: medKey, Policy: lax}, buffer)
+	if err != nil {
+		t.Fatalf("Unable to write tape under a lax policy: %v", err)
+	}
+	tw.Close()
+
+	_, err = OpenTape(shortKey, &medKey.PublicKey, bytes.NewReader(buffer.Bytes()))
+	if _, ok := err.(*PolicyError); !ok {
+		t.Errorf("Expected a policy error reading with a weak key but got %v", err)
+	}
+
+	_, err = OpenTapeWithKey(Key{PrivateKey: shortKey, PublicKey: &medKey.PublicKey, Policy: lax}, bytes.NewReader(buffer.Bytes()))
+	if err != nil {
+		t.Errorf("Unable to read tape under a lax policy: %v", err)
+	}
+}
+
+func TestCheckKeystore(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	location := pathFor("keys", "test.keys")
+	fs.MkdirAll(pathFor("keys"), 0755)
+
+	keystore := &Keystore{PrivateKeys: map[string][]byte{}, PublicKeys: map[string][]byte{}}
+	keystore.AddPrivateKey("good", medKey)
+	keystore.AddPrivateKey("weak", shortKey)
+	keystore.AddPublicKey("copy", &medKey.PublicKey)
+	keystore.AddPrivateKey("old", longKey)
+	keystore.Created["old"] = time.Now().AddDate(-3, 0, 0)
+	keystore.PublicKeys["broken"] = []byte("garbage")
+	keystore.Policy = &Policy{MinRSABits: 2048, Algorithms: []string{"rsa"}, MaxKeyAgeDays: 365}
+
+	file, _ := fs.OpenFile(location, os.O_CREATE|os.O_WRONLY, 0644)
+	keystore.Save(file)
+	file.Close()
+
+	problems, err := CheckKeystore(fs, location, nil)
+	if err != nil {
+		t.Fatalf("Unable to check keystore: %v", err)
+	}
+
+	expected := []string{"weak:", "old: key expired", "broken:", "stored as [good copy]", "mode -rwxr-xr-x", "mode -rw-r--r--"}
+	for _, e := range expected {
+		found := false
+		for _, p := range problems {
+			found = found || strings.Contains(p.String(), e)
+		}
+		if !found {
+			t.Errorf("Expected a problem containing %q in %v", e, problems)
+		}
+	}
+
+	if len(problems) != len(expected) {
+		t.Errorf("Expected %d problems but got %v", len(expected), problems)
+	}
+}
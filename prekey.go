@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Prekey is an X25519 public key published by a recipient so senders can
+// write forward-secret tapes.  It is signed by the recipient's RSA key, whose
+// fingerprint is Owner.  The recipient keeps the private half in its keystore
+// and deletes it once it expires, after which tapes written to the prekey can
+// no longer be read, even with the recipient's RSA key.
+type Prekey struct {
+	ID        string    `json:"id"`
+	Owner     string    `json:"owner"`
+	Public    []byte    `json:"public"`
+	Expires   time.Time `json:"expires"`
+	Signature []byte    `json:"signature"`
+}
+
+// PrekeyProvider is implemented by key providers that hold the private
+// halves of prekeys.
+type PrekeyProvider interface {
+	// Prekey returns the private key of the prekey with the given ID.
+	Prekey(id string) (*ecdh.PrivateKey, error)
+}
+
+// StoredPrekey is a prekey and its private key as stored in a keystore.
+type StoredPrekey struct {
+	Prekey  Prekey
+	Private []byte
+}
+
+// NewPrekey generates a prekey that expires after lifetime, signed by the
+// owner's private key.  Returns the prekey to publish and its private key.
+func NewPrekey(owner PrivateKey, lifetime time.Duration) (*Prekey, *ecdh.PrivateKey, error) {
+	ownerPub, err := rsaPublicKey(owner.Public())
+	if err != nil {
+		return nil, nil, err
+	}
+
+	private, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, nil, NewError(err, "Unable to generate prekey")
+	}
+
+	id := make([]byte, 8)
+	if _, err = rand.Read(id); err != nil {
+		return nil, nil, NewError(err, "Unable to generate prekey ID")
+	}
+
+	result := &Prekey{
+		ID:      hex.EncodeToString(id),
+		Owner:   Fingerprint(ownerPub),
+		Public:  private.PublicKey().Bytes(),
+		Expires: time.Now().UTC().Add(lifetime).Truncate(time.Second),
+	}
+
+	result.Signature, err = owner.Sign(rand.Reader, result.digest(), crypto.SHA256)
+	if err != nil {
+		return nil, nil, NewError(err, "Unable to sign prekey")
+	}
+
+	return result, private, nil
+}
+
+// digest is the digest the owner signs.
+func (p *Prekey) digest() []byte {
+	hash := sha256.New()
+	fmt.Fprintf(hash, "repository prekey\x00%s\x00%s\x00%s\x00", p.ID, p.Owner, p.Expires.UTC().Format(time.RFC3339))
+	hash.Write(p.Public)
+	return hash.Sum(nil)
+}
+
+// Verify checks that the prekey belongs to and was signed by owner and has
+// not expired.
+func (p *Prekey) Verify(owner *rsa.PublicKey) error {
+	if p.Owner != Fingerprint(owner) {
+		return fmt.Errorf("Prekey %s belongs to key %s, not %s", p.ID, p.Owner, Fingerprint(owner))
+	}
+
+	if err := rsa.VerifyPKCS1v15(owner, crypto.SHA256, p.digest(), p.Signature); err != nil {
+		return &SignatureError{What: "prekey " + p.ID, Err: err}
+	}
+
+	if time.Now().After(p.Expires) {
+		return fmt.Errorf("Prekey %s expired on %s", p.ID, p.Expires.Format(time.RFC3339))
+	}
+
+	return nil
+}
+
+// publicKey returns the prekey's X25519 public key.
+func (p *Prekey) publicKey() (*ecdh.PublicKey, error) {
+	key, err := ecdh.X25519().NewPublicKey(p.Public)
+	if err != nil {
+		return nil, NewError(err, fmt.Sprintf("Prekey %s is not an X25519 key", p.ID))
+	}
+	return key, nil
+}
+
+// ReadPrekey reads a published prekey.
+func ReadPrekey(in io.Reader) (*Prekey, error) {
+	result := &Prekey{}
+	if err := json.NewDecoder(in).Decode(result); err != nil {
+		return nil, NewError(err, "Unable to read prekey")
+	}
+	if result.ID == "" || len(result.Public) == 0 {
+		return nil, errors.New("Prekey is missing its ID or public key")
+	}
+	return result, nil
+}
+
+// WritePrekey writes a prekey for publishing.
+func WritePrekey(out io.Writer, prekey *Prekey) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(prekey)
+}
@@ -0,0 +1,110 @@
+package repository
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPrekeyVerify(t *testing.T) {
+	prekey, _, err := NewPrekey(medKey, time.Hour)
+	if err != nil {
+		t.Fatalf("Unable to create prekey: %v", err)
+	}
+
+	if err = prekey.Verify(&medKey.PublicKey); err != nil {
+		t.Errorf("Failed to verify prekey: %v", err)
+	}
+
+	if err = prekey.Verify(&longKey.PublicKey); err == nil {
+		t.Error("Prekey should not verify with another owner's key")
+	}
+
+	buffer := new(bytes.Buffer)
+	if err = WritePrekey(buffer, prekey); err != nil {
+		t.Fatalf("Unable to write prekey: %v", err)
+	}
+	published, err := ReadPrekey(buffer)
+	if err != nil {
+		t.Fatalf("Unable to read prekey: %v", err)
+	}
+	if err = published.Verify(&medKey.PublicKey); err != nil {
+		t.Errorf("Failed to verify published prekey: %v", err)
+	}
+
+	published.Expires = published.Expires.Add(time.Hour)
+	if err = published.Verify(&medKey.PublicKey); err == nil {
+		t.Error("Prekey with a changed expiry should not verify")
+	}
+
+	expired, _, _ := NewPrekey(medKey, -time.Hour)
+	if err = expired.Verify(&medKey.PublicKey); err == nil {
+		t.Error("Expired prekey should not verify")
+	}
+}
+
+func TestKeystorePrekeys(t *testing.T) {
+	keystore := &Keystore{PrivateKeys: map[string][]byte{}, PublicKeys: map[string][]byte{}}
+	current, private, _ := NewPrekey(medKey, time.Hour)
+	keystore.AddPrekey(current, private)
+	expired, private, _ := NewPrekey(medKey, -time.Hour)
+	keystore.AddPrekey(expired, private)
+
+	if key, ok := keystore.FindPrekey(current.ID); !ok || !bytes.Equal(key.PublicKey().Bytes(), current.Public) {
+		t.Error("Failed to find prekey")
+	}
+
+	removed := keystore.RemoveExpiredPrekeys()
+	if len(removed) != 1 || removed[0] != expired.ID {
+		t.Errorf("Expected only the expired prekey to be removed but got %v", removed)
+	}
+
+	if _, ok := keystore.FindPrekey(current.ID); !ok {
+		t.Error("Current prekey should not have been removed")
+	}
+}
+
+func TestForwardSecretTape(t *testing.T) {
+	keystore := &Keystore{PrivateKeys: map[string][]byte{}, PublicKeys: map[string][]byte{}}
+	keystore.AddPrivateKey("mine", medKey)
+	keystore.AddPublicKey("sender", &longKey.PublicKey)
+	prekey, private, _ := NewPrekey(medKey, time.Hour)
+	keystore.AddPrekey(prekey, private)
+	provider := NewKeystoreProvider(keystore)
+
+	fs := setupFs()
+	buffer := new(bytes.Buffer)
+	tw, err := NewTapeWriter(Key{PublicKey: &medKey.PublicKey, PrivateKey: longKey, Prekey: prekey}, buffer)
+	if err != nil {
+		t.Fatalf("Unable to write forward-secret tape: %v", err)
+	}
+	tw.AddFile(fs, pathFor("data", "db", "files", "db2.dat"))
+	tw.Close()
+
+	_, err = OpenTape(medKey, &longKey.PublicKey, bytes.NewReader(buffer.Bytes()))
+	if err == nil {
+		t.Error("Forward-secret tape should not open without the prekey")
+	}
+
+	tr, err := OpenTapeWithKey(Key{PrivateKey: medKey, PublicKey: &longKey.PublicKey, Prekeys: provider}, bytes.NewReader(buffer.Bytes()))
+	if err != nil {
+		t.Fatalf("Unable to open forward-secret tape: %v", err)
+	}
+	if contents, _ := tr.Contents(); len(contents) != 1 {
+		t.Errorf("Expected one file on the tape but got %v", contents)
+	}
+
+	if _, err = OpenTapeWithProvider(provider, bytes.NewReader(buffer.Bytes())); err != nil {
+		t.Errorf("Unable to open forward-secret tape with provider: %v", err)
+	}
+
+	keystore.RemovePrekey(prekey.ID)
+	if _, err = OpenTapeWithProvider(provider, bytes.NewReader(buffer.Bytes())); err == nil {
+		t.Error("Tape should not open once its prekey is deleted")
+	}
+
+	_, err = NewTapeWriter(Key{PublicKey: &longKey.PublicKey, PrivateKey: longKey, Prekey: prekey}, new(bytes.Buffer))
+	if err == nil {
+		t.Error("Should not write to a prekey that the recipient did not sign")
+	}
+}
@@ -0,0 +1,342 @@
+package repository
+
+import (
+	"crypto"
+	"crypto/ecdh"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/darcinc/afero"
+)
+
+// PrivateKey is a private key that can sign labels and decrypt label
+// headers.  An *rsa.PrivateKey satisfies it, as do keys that live in a
+// hardware token or another process.
+type PrivateKey interface {
+	crypto.Signer
+	crypto.Decrypter
+}
+
+// KeyProvider supplies named keys for writing and reading tapes.  The
+// private keys it returns may never leave the provider.
+type KeyProvider interface {
+	// PrivateKey returns the named private key.
+	PrivateKey(name string) (PrivateKey, error)
+
+	// PublicKey returns the named public key, or the public half of the
+	// named private key.
+	PublicKey(name string) (*rsa.PublicKey, error)
+}
+
+// KeyLister is implemented by key providers that can list their keys, which
+// lets keys be found by fingerprint.
+type KeyLister interface {
+	// KeyNames returns the names of every private and public key.
+	KeyNames() ([]string, error)
+}
+
+// PolicyProvider is implemented by key providers that carry their own key
+// policy.
+type PolicyProvider interface {
+	Policy() *Policy
+}
+
+// ProviderPolicy returns the provider's policy, or the default policy if it
+// does not have one.
+func ProviderPolicy(provider KeyProvider) *Policy {
+	if p, ok := provider.(PolicyProvider); ok {
+		return p.Policy()
+	}
+	return DefaultPolicy()
+}
+
+// EscrowProvider is implemented by key providers that name escrow keys, which
+// are given a copy of the tape key of every tape written with the provider.
+type EscrowProvider interface {
+	EscrowKeys() ([]*rsa.PublicKey, error)
+}
+
+// ProviderEscrow returns the provider's escrow keys, or none if it does not
+// name any.
+func ProviderEscrow(provider KeyProvider) ([]*rsa.PublicKey, error) {
+	if p, ok := provider.(EscrowProvider); ok {
+		return p.EscrowKeys()
+	}
+	return nil, nil
+}
+
+// keyFingerprinter is implemented by key providers that can fingerprint
+// the keys they refuse to hand out, so FindKeyName can say why a key with
+// the fingerprint it looks for cannot be used.
+type keyFingerprinter interface {
+	fingerprint(name string, private bool) (string, bool)
+}
+
+// FindKeyName returns the name of the provider's key with the given
+// fingerprint.  When private is true only private keys are considered.  If
+// the provider refuses the only key with the fingerprint, such as for
+// failing its policy, the provider's error is returned.
+func FindKeyName(provider KeyProvider, fingerprint string, private bool) (string, error) {
+	lister, ok := provider.(KeyLister)
+	if !ok {
+		return "", errors.New("The key provider cannot look up keys by fingerprint")
+	}
+
+	names, err := lister.KeyNames()
+	if err != nil {
+		return "", err
+	}
+
+	fingerprinter, _ := provider.(keyFingerprinter)
+	var refused error
+	for _, name := range names {
+		var pub *rsa.PublicKey
+		if private {
+			var key PrivateKey
+			if key, err = provider.PrivateKey(name); err == nil {
+				pub, err = rsaPublicKey(key.Public())
+			}
+		} else {
+			pub, err = provider.PublicKey(name)
+		}
+		if err != nil {
+			if fingerprinter != nil && refused == nil {
+				if match, ok := fingerprinter.fingerprint(name, private); ok && match == fingerprint {
+					refused = err
+				}
+			}
+			continue
+		}
+
+		if Fingerprint(pub) == fingerprint {
+			return name, nil
+		}
+	}
+
+	if refused != nil {
+		return "", refused
+	}
+	return "", &NoSuchKeyError{Kind: "Key with fingerprint", Name: fingerprint}
+}
+
+// OpenKeyProvider opens the key provider at a location.  A location starting
+// with "pemdir:" is a directory of PEM files, one starting with "pkcs11:" is
+// a PKCS#11 URI (see NewPKCS11Provider) and anything else is the name or
+// path of a keystore.
+func OpenKeyProvider(fs afero.Fs, location string) (KeyProvider, error) {
+	switch {
+	case strings.HasPrefix(location, "pemdir:"):
+		return &PEMDirectoryProvider{Fs: fs, Dir: strings.TrimPrefix(location, "pemdir:")}, nil
+	case strings.HasPrefix(location, "pkcs11:"):
+		return NewPKCS11Provider(fs, location)
+	}
+
+	file, err := fs.Open(KeystorePath(location))
+	if err != nil {
+		return nil, NewError(err, fmt.Sprintf("Unable to open keystore %s", location))
+	}
+	defer file.Close()
+
+	keystore, err := OpenKeystore(file)
+	if err != nil {
+		return nil, NewError(err, fmt.Sprintf("Unable to read keystore %s", location))
+	}
+
+	return NewKeystoreProvider(keystore), nil
+}
+
+// CloseKeyProvider releases any resources held by a provider, such as a
+// PKCS#11 session.  Providers without resources are left alone.
+func CloseKeyProvider(provider KeyProvider) error {
+	if closer, ok := provider.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// KeystoreProvider provides keys from a JSON keystore.
+type KeystoreProvider struct {
+	keystore *Keystore
+}
+
+// NewKeystoreProvider creates a provider for the keys in a keystore.
+func NewKeystoreProvider(keystore *Keystore) *KeystoreProvider {
+	return &KeystoreProvider{keystore: keystore}
+}
+
+// PrivateKey returns the named private key from the keystore.
+func (p *KeystoreProvider) PrivateKey(name string) (PrivateKey, error) {
+	key, ok := p.keystore.FindPrivateKey(name)
+	if !ok {
+		return nil, &NoSuchKeyError{Kind: "Private key", Name: name}
+	}
+	if err := p.keystore.CheckKey(name); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// PublicKey returns the named public key from the keystore.
+func (p *KeystoreProvider) PublicKey(name string) (*rsa.PublicKey, error) {
+	key, ok := p.keystore.FindPublicKey(name)
+	if !ok {
+		return nil, &NoSuchKeyError{Kind: "Public key", Name: name}
+	}
+	if err := p.keystore.CheckKey(name); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// fingerprint returns the fingerprint of the named key without checking it
+// against the keystore's policy.
+func (p *KeystoreProvider) fingerprint(name string, private bool) (string, bool) {
+	if _, ok := p.keystore.PrivateKeys[name]; private && !ok {
+		return "", false
+	}
+	key, ok := p.keystore.FindPublicKey(name)
+	if !ok {
+		return "", false
+	}
+	return Fingerprint(key), true
+}
+
+// Prekey returns the private key of a prekey in the keystore.
+func (p *KeystoreProvider) Prekey(id string) (*ecdh.PrivateKey, error) {
+	key, ok := p.keystore.FindPrekey(id)
+	if !ok {
+		return nil, fmt.Errorf("Prekey %s not found, it may have expired and been deleted", id)
+	}
+	return key, nil
+}
+
+// HybridPublicKey returns the named hybrid public key from the keystore.
+func (p *KeystoreProvider) HybridPublicKey(name string) (*HybridPublicKey, error) {
+	key, ok := p.keystore.FindHybridPublicKey(name)
+	if !ok {
+		return nil, &NoSuchKeyError{Kind: "Hybrid key", Name: name}
+	}
+	if err := p.keystore.CheckKey(name); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// FindHybridKey returns the hybrid private key in the keystore with the
+// given fingerprint.
+func (p *KeystoreProvider) FindHybridKey(fingerprint string) (*HybridPrivateKey, error) {
+	for name := range p.keystore.HybridKeys {
+		key, _ := p.keystore.FindHybridKey(name)
+		if HybridFingerprint(key.Public()) != fingerprint {
+			continue
+		}
+		if err := p.keystore.CheckKey(name); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	return nil, &NoSuchKeyError{Kind: "Hybrid key with fingerprint", Name: fingerprint}
+}
+
+// Policy returns the keystore's key policy.
+func (p *KeystoreProvider) Policy() *Policy {
+	return p.keystore.KeyPolicy()
+}
+
+// EscrowKeys returns the keystore's escrow keys.
+func (p *KeystoreProvider) EscrowKeys() ([]*rsa.PublicKey, error) {
+	return p.keystore.EscrowKeys()
+}
+
+// KeyNames returns the names of the keys in the keystore.
+func (p *KeystoreProvider) KeyNames() ([]string, error) {
+	result := []string{}
+	for name := range p.keystore.PrivateKeys {
+		result = append(result, name)
+	}
+	for name := range p.keystore.PublicKeys {
+		result = append(result, name)
+	}
+
+	sort.Strings(result)
+	return result, nil
+}
+
+// PEMDirectoryProvider provides keys from a directory of key files.  The key
+// with a given name is read from name.pem, or name.pub for public keys, in
+// any format understood by DecodeKey.
+type PEMDirectoryProvider struct {
+	Fs         afero.Fs
+	Dir        string
+	Passphrase []byte
+}
+
+func (p *PEMDirectoryProvider) readKey(name string, extensions ...string) (*rsa.PrivateKey, *rsa.PublicKey, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return nil, nil, fmt.Errorf("Invalid key name %q", name)
+	}
+
+	for _, ext := range extensions {
+		data, err := afero.ReadFile(p.Fs, filepath.Join(p.Dir, name+ext))
+		if err != nil {
+			continue
+		}
+		return DecodeKey(data, "", p.Passphrase)
+	}
+
+	return nil, nil, &NoSuchKeyError{Kind: "Key", Name: name, Where: p.Dir}
+}
+
+// PrivateKey returns the private key in name.pem.
+func (p *PEMDirectoryProvider) PrivateKey(name string) (PrivateKey, error) {
+	priv, _, err := p.readKey(name, ".pem")
+	if err != nil {
+		return nil, err
+	}
+	if priv == nil {
+		return nil, &NoSuchKeyError{Kind: "Private key", Name: name, Where: p.Dir}
+	}
+	return priv, nil
+}
+
+// PublicKey returns the public key in name.pub or name.pem.
+func (p *PEMDirectoryProvider) PublicKey(name string) (*rsa.PublicKey, error) {
+	_, pub, err := p.readKey(name, ".pub", ".pem")
+	return pub, err
+}
+
+// KeyNames returns the names of the .pem and .pub files in the directory.
+func (p *PEMDirectoryProvider) KeyNames() ([]string, error) {
+	infos, err := afero.ReadDir(p.Fs, p.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	result := []string{}
+	for _, info := range infos {
+		ext := filepath.Ext(info.Name())
+		name := strings.TrimSuffix(info.Name(), ext)
+		if info.IsDir() || (ext != ".pem" && ext != ".pub") || seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+
+	return result, nil
+}
+
+// rsaPublicKey returns the RSA public key of a signer or decrypter.
+func rsaPublicKey(key crypto.PublicKey) (*rsa.PublicKey, error) {
+	pub, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, errors.New("Only RSA keys are supported for labels")
+	}
+	return pub, nil
+}
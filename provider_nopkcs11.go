@@ -0,0 +1,15 @@
+//go:build !pkcs11
+
+package repository
+
+import (
+	"errors"
+
+	"github.com/darcinc/afero"
+)
+
+// NewPKCS11Provider opens a PKCS#11 token.  This build was made without the
+// pkcs11 build tag, so tokens are not supported.
+func NewPKCS11Provider(fs afero.Fs, location string) (KeyProvider, error) {
+	return nil, errors.New("PKCS#11 support requires building with -tags pkcs11")
+}
@@ -0,0 +1,258 @@
+//go:build pkcs11
+
+package repository
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"sync"
+
+	"github.com/darcinc/afero"
+	"github.com/miekg/pkcs11"
+)
+
+// digestInfoPrefixes are the DER encoded DigestInfo prefixes a token needs
+// in front of a digest when signing with the raw CKM_RSA_PKCS mechanism.
+var digestInfoPrefixes = map[crypto.Hash][]byte{
+	crypto.SHA256: {0x30, 0x31, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x01, 0x05, 0x00, 0x04, 0x20},
+	crypto.SHA384: {0x30, 0x41, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x02, 0x05, 0x00, 0x04, 0x30},
+	crypto.SHA512: {0x30, 0x51, 0x30, 0x0d, 0x06, 0x09, 0x60, 0x86, 0x48, 0x01, 0x65, 0x03, 0x04, 0x02, 0x03, 0x05, 0x00, 0x04, 0x40},
+}
+
+// PKCS11Provider provides RSA keys held in a PKCS#11 token such as a
+// hardware security module or SoftHSM.  Keys are found by their CKA_LABEL
+// and private keys never leave the token.
+type PKCS11Provider struct {
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	mu      sync.Mutex
+}
+
+// NewPKCS11Provider loads the module named in a PKCS#11 URI, opens a session
+// on the token selected by its token or slot-id attribute and logs in with
+// the pin-value or the PIN read from the pin-source file.
+func NewPKCS11Provider(fs afero.Fs, location string) (KeyProvider, error) {
+	uri, err := parsePKCS11URI(fs, location)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := pkcs11.New(uri.Module)
+	if ctx == nil {
+		return nil, fmt.Errorf("Unable to load PKCS#11 module %s", uri.Module)
+	}
+	if err = ctx.Initialize(); err != nil {
+		ctx.Destroy()
+		return nil, NewError(err, "Unable to initialize PKCS#11 module")
+	}
+
+	result := &PKCS11Provider{ctx: ctx}
+	slot, err := result.findSlot(uri)
+	if err == nil {
+		result.session, err = ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION)
+	}
+	if err == nil && uri.PIN != "" {
+		err = ctx.Login(result.session, pkcs11.CKU_USER, uri.PIN)
+	}
+	if err != nil {
+		ctx.Finalize()
+		ctx.Destroy()
+		return nil, NewError(err, "Unable to open PKCS#11 token")
+	}
+
+	return result, nil
+}
+
+func (p *PKCS11Provider) findSlot(uri *pkcs11URI) (uint, error) {
+	if uri.HasSlot {
+		return uint(uri.Slot), nil
+	}
+
+	slots, err := p.ctx.GetSlotList(true)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, slot := range slots {
+		info, err := p.ctx.GetTokenInfo(slot)
+		if err != nil {
+			continue
+		}
+		if uri.Token == "" || info.Label == uri.Token {
+			return slot, nil
+		}
+	}
+
+	return 0, fmt.Errorf("PKCS#11 token %s not found", uri.Token)
+}
+
+// Close logs out of the token and unloads the module.
+func (p *PKCS11Provider) Close() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.ctx.Logout(p.session)
+	p.ctx.CloseSession(p.session)
+	err := p.ctx.Finalize()
+	p.ctx.Destroy()
+	return err
+}
+
+func (p *PKCS11Provider) findObject(class uint, name string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, name),
+	}
+	if err := p.ctx.FindObjectsInit(p.session, template); err != nil {
+		return 0, err
+	}
+	defer p.ctx.FindObjectsFinal(p.session)
+
+	objects, _, err := p.ctx.FindObjects(p.session, 1)
+	if err != nil {
+		return 0, err
+	}
+	if len(objects) == 0 {
+		return 0, &NoSuchKeyError{Kind: "Key", Name: name, Where: "PKCS#11 token"}
+	}
+
+	return objects[0], nil
+}
+
+func (p *PKCS11Provider) readPublicKey(object pkcs11.ObjectHandle) (*rsa.PublicKey, error) {
+	attributes, err := p.ctx.GetAttributeValue(p.session, object, []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_MODULUS, nil),
+		pkcs11.NewAttribute(pkcs11.CKA_PUBLIC_EXPONENT, nil),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(attributes[0].Value),
+		E: int(new(big.Int).SetBytes(attributes[1].Value).Int64()),
+	}, nil
+}
+
+// PrivateKey returns a signer and decrypter for the private key labelled
+// name in the token.
+func (p *PKCS11Provider) PrivateKey(name string) (PrivateKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	object, err := p.findObject(pkcs11.CKO_PRIVATE_KEY, name)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, err := p.readPublicKey(object)
+	if err != nil {
+		return nil, NewError(err, fmt.Sprintf("Unable to read public half of %s", name))
+	}
+
+	return &pkcs11Key{provider: p, object: object, public: pub}, nil
+}
+
+// PublicKey returns the public key labelled name in the token.
+func (p *PKCS11Provider) PublicKey(name string) (*rsa.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	object, err := p.findObject(pkcs11.CKO_PUBLIC_KEY, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return p.readPublicKey(object)
+}
+
+// KeyNames returns the labels of the RSA keys in the token.
+func (p *PKCS11Provider) KeyNames() ([]string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	template := []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, pkcs11.CKK_RSA)}
+	if err := p.ctx.FindObjectsInit(p.session, template); err != nil {
+		return nil, err
+	}
+	objects, _, err := p.ctx.FindObjects(p.session, 1024)
+	p.ctx.FindObjectsFinal(p.session)
+	if err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{}
+	result := []string{}
+	for _, object := range objects {
+		attributes, err := p.ctx.GetAttributeValue(p.session, object, []*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, nil),
+		})
+		if err != nil {
+			continue
+		}
+		label := string(attributes[0].Value)
+		if !seen[label] {
+			seen[label] = true
+			result = append(result, label)
+		}
+	}
+
+	return result, nil
+}
+
+// pkcs11Key is a private key that stays inside the token.
+type pkcs11Key struct {
+	provider *PKCS11Provider
+	object   pkcs11.ObjectHandle
+	public   *rsa.PublicKey
+}
+
+func (k *pkcs11Key) Public() crypto.PublicKey {
+	return k.public
+}
+
+// Sign signs a digest with RSA PKCS#1 v1.5.  PSS options are not supported
+// by the raw mechanism and are refused.
+func (k *pkcs11Key) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	if _, ok := opts.(*rsa.PSSOptions); ok {
+		return nil, errors.New("PKCS#11 keys support only PKCS#1 v1.5 signatures")
+	}
+
+	prefix, ok := digestInfoPrefixes[opts.HashFunc()]
+	if !ok {
+		return nil, fmt.Errorf("Unsupported hash %v for PKCS#11 signing", opts.HashFunc())
+	}
+
+	k.provider.mu.Lock()
+	defer k.provider.mu.Unlock()
+
+	mechanism := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)}
+	if err := k.provider.ctx.SignInit(k.provider.session, mechanism, k.object); err != nil {
+		return nil, err
+	}
+
+	return k.provider.ctx.Sign(k.provider.session, append(append([]byte{}, prefix...), digest...))
+}
+
+// Decrypt decrypts an RSA PKCS#1 v1.5 ciphertext inside the token.
+func (k *pkcs11Key) Decrypt(rand io.Reader, ciphertext []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	if opts != nil {
+		if _, ok := opts.(*rsa.PKCS1v15DecryptOptions); !ok {
+			return nil, errors.New("PKCS#11 keys support only PKCS#1 v1.5 decryption")
+		}
+	}
+
+	k.provider.mu.Lock()
+	defer k.provider.mu.Unlock()
+
+	mechanism := []*pkcs11.Mechanism{pkcs11.NewMechanism(pkcs11.CKM_RSA_PKCS, nil)}
+	if err := k.provider.ctx.DecryptInit(k.provider.session, mechanism, k.object); err != nil {
+		return nil, err
+	}
+
+	return k.provider.ctx.Decrypt(k.provider.session, ciphertext)
+}
@@ -0,0 +1,46 @@
+//go:build pkcs11
+
+package repository
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/darcinc/afero"
+)
+
+// TestPKCS11Provider runs against a token such as SoftHSM holding an RSA key
+// pair labelled "tape".  Set REPOSITORY_PKCS11_URI to a PKCS#11 URI for the
+// token, e.g. pkcs11:token=test?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-value=1234
+func TestPKCS11Provider(t *testing.T) {
+	location := os.Getenv("REPOSITORY_PKCS11_URI")
+	if location == "" {
+		t.Skip("REPOSITORY_PKCS11_URI is not set")
+	}
+
+	provider, err := NewPKCS11Provider(afero.NewOsFs(), location)
+	if err != nil {
+		t.Fatalf("Unable to open token: %v", err)
+	}
+	defer CloseKeyProvider(provider)
+
+	priv, err := provider.PrivateKey("tape")
+	if err != nil {
+		t.Fatalf("Unable to find private key: %v", err)
+	}
+
+	pub, err := provider.PublicKey("tape")
+	if err != nil {
+		t.Fatalf("Unable to find public key: %v", err)
+	}
+
+	buffer := new(bytes.Buffer)
+	if _, err = NewTapeWriter(Key{PublicKey: pub, PrivateKey: priv}, buffer); err != nil {
+		t.Fatalf("Unable to write tape: %v", err)
+	}
+
+	if _, err = OpenTape(priv, pub, bytes.NewReader(buffer.Bytes())); err != nil {
+		t.Fatalf("Unable to open tape: %v", err)
+	}
+}
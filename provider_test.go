@@ -0,0 +1,138 @@
+package repository
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/darcinc/afero"
+)
+
+// externalKey hides an RSA key behind the signer and decrypter interfaces,
+// the way a token or agent key would.
+type externalKey struct {
+	key *rsa.PrivateKey
+}
+
+func (k externalKey) Public() crypto.PublicKey {
+	return &k.key.PublicKey
+}
+
+func (k externalKey) Sign(rand io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	return k.key.Sign(rand, digest, opts)
+}
+
+func (k externalKey) Decrypt(rand io.Reader, msg []byte, opts crypto.DecrypterOpts) ([]byte, error) {
+	return k.key.Decrypt(rand, msg, opts)
+}
+
+func TestExternalKeyTape(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	tw, err := NewTapeWriter(Key{PublicKey: &medKey.PublicKey, PrivateKey: externalKey{medKey}}, buffer)
+	if err != nil {
+		t.Fatalf("Unable to write tape with external key: %v", err)
+	}
+	tw.Close()
+
+	_, err = OpenTape(externalKey{medKey}, &medKey.PublicKey, bytes.NewReader(buffer.Bytes()))
+	if err != nil {
+		t.Fatalf("Unable to open tape with external key: %v", err)
+	}
+}
+
+func TestKeystoreProvider(t *testing.T) {
+	keystore := &Keystore{PrivateKeys: map[string][]byte{}, PublicKeys: map[string][]byte{}}
+	keystore.AddPrivateKey("mine", medKey)
+	keystore.AddPublicKey("theirs", &longKey.PublicKey)
+	keystore.AddPublicKey("weak", &shortKey.PublicKey)
+	provider := NewKeystoreProvider(keystore)
+
+	if _, err := provider.PrivateKey("mine"); err != nil {
+		t.Errorf("Failed to find private key: %v", err)
+	}
+
+	if _, err := provider.PrivateKey("theirs"); err == nil {
+		t.Error("Should not find a private key for a public key")
+	}
+
+	if pub, err := provider.PublicKey("theirs"); err != nil || pub.N.Cmp(longKey.N) != 0 {
+		t.Errorf("Failed to find public key: %v", err)
+	}
+
+	if _, err := provider.PublicKey("weak"); err == nil {
+		t.Error("Should not hand out a key weaker than the policy allows")
+	}
+
+	var policy *PolicyError
+	if _, err := FindKeyName(provider, Fingerprint(&shortKey.PublicKey), false); !errors.As(err, &policy) {
+		t.Errorf("Expected the policy to refuse the weak key found by fingerprint but got %v", err)
+	}
+	if name, err := FindKeyName(provider, Fingerprint(&longKey.PublicKey), false); err != nil || name != "theirs" {
+		t.Errorf("Expected to find the key by fingerprint but got %s %v", name, err)
+	}
+	if _, err := FindKeyName(provider, Fingerprint(&longKey.PublicKey), true); !errors.Is(err, ErrNoSuchKey) {
+		t.Errorf("Should not find a private key for a public key's fingerprint: %v", err)
+	}
+}
+
+func TestPEMDirectoryProvider(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	dir := pathFor("keys")
+	fs.MkdirAll(dir, 0700)
+
+	mine, _ := fs.OpenFile(filepath.Join(dir, "mine.pem"), os.O_CREATE|os.O_WRONLY, 0600)
+	EncodeKey(mine, FormatPKCS8, "mine", medKey, nil, nil)
+	mine.Close()
+
+	theirs, _ := fs.OpenFile(filepath.Join(dir, "theirs.pub"), os.O_CREATE|os.O_WRONLY, 0600)
+	EncodeKey(theirs, FormatOpenSSH, "theirs", nil, &shortKey.PublicKey, nil)
+	theirs.Close()
+
+	provider, err := OpenKeyProvider(fs, "pemdir:"+dir)
+	if err != nil {
+		t.Fatalf("Unable to open PEM directory provider: %v", err)
+	}
+
+	if priv, err := provider.PrivateKey("mine"); err != nil || priv.Public().(*rsa.PublicKey).N.Cmp(medKey.N) != 0 {
+		t.Errorf("Failed to find private key: %v", err)
+	}
+
+	if pub, err := provider.PublicKey("mine"); err != nil || pub.N.Cmp(medKey.N) != 0 {
+		t.Errorf("Failed to find public half of private key: %v", err)
+	}
+
+	if pub, err := provider.PublicKey("theirs"); err != nil || pub.N.Cmp(shortKey.N) != 0 {
+		t.Errorf("Failed to find public key: %v", err)
+	}
+
+	if _, err := provider.PrivateKey("theirs"); err == nil {
+		t.Error("Should not find a private key for a public key file")
+	}
+
+	if _, err := provider.PublicKey("../mine"); err == nil {
+		t.Error("Should not read keys outside the directory")
+	}
+}
+
+func TestParsePKCS11URI(t *testing.T) {
+	fs := afero.NewMemMapFs()
+	afero.WriteFile(fs, pathFor("pin"), []byte("1234\n"), 0600)
+
+	uri, err := parsePKCS11URI(fs, "pkcs11:token=backups;slot-id=2?module-path=/usr/lib/softhsm/libsofthsm2.so&pin-source="+pathFor("pin"))
+	if err != nil {
+		t.Fatalf("Unable to parse URI: %v", err)
+	}
+
+	if uri.Module != "/usr/lib/softhsm/libsofthsm2.so" || uri.Token != "backups" || !uri.HasSlot || uri.Slot != 2 || uri.PIN != "1234" {
+		t.Errorf("Unexpected URI contents: %+v", uri)
+	}
+
+	if _, err := parsePKCS11URI(fs, "pkcs11:token=backups"); err == nil {
+		t.Error("Should require a module path")
+	}
+}
@@ -0,0 +1,118 @@
+package repository
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// receiptContext separates receipt signatures from every other signature
+// made with the same keys.
+var receiptContext = []byte("repository receipt\x00")
+
+// Results recorded in a receipt.
+const (
+	// ReceiptVerified means the receiver checked the whole tape against the
+	// sender's signature.
+	ReceiptVerified = "verified"
+
+	// ReceiptUnpacked means the receiver opened the tape, checked its label
+	// and unpacked every file on it.
+	ReceiptUnpacked = "unpacked"
+)
+
+// Receipt is the receiver's signed statement that it received a tape.  Tape
+// is the TapeHash of the tape received, Sender and Receiver the fingerprints
+// of the sender's key and of the key that signs the receipt, and Result how
+// the tape was checked.
+type Receipt struct {
+	Tape      string    `json:"tape"`
+	Sender    string    `json:"sender"`
+	Receiver  string    `json:"receiver"`
+	Time      time.Time `json:"time"`
+	Result    string    `json:"result"`
+	Signature []byte    `json:"signature,omitempty"`
+}
+
+// TapeHash identifies a whole tape, as sent, by the hex encoded SHA-256 hash
+// of its bytes.
+func TapeHash(tape io.Reader) (string, error) {
+	hash := sha256.New()
+	if _, err := io.Copy(hash, tape); err != nil {
+		return "", NewError(err, "Unable to read tape")
+	}
+	return fmt.Sprintf("%x", hash.Sum(nil)), nil
+}
+
+// digest is the digest signed by the receiver.  It covers every field of the
+// receipt except the signature.
+func (r *Receipt) digest() ([]byte, error) {
+	unsigned := *r
+	unsigned.Signature = nil
+	data, err := json.Marshal(unsigned)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := sha256.New()
+	hash.Write(receiptContext)
+	hash.Write(data)
+	return hash.Sum(nil), nil
+}
+
+// Sign records the signer as the receiver and signs the receipt.
+func (r *Receipt) Sign(signKey crypto.Signer) error {
+	signPub, err := rsaPublicKey(signKey.Public())
+	if err != nil {
+		return err
+	}
+	r.Receiver = Fingerprint(signPub)
+
+	digest, err := r.digest()
+	if err != nil {
+		return NewError(err, "Unable to encode receipt")
+	}
+	if r.Signature, err = signKey.Sign(rand.Reader, digest, crypto.SHA256); err != nil {
+		return NewError(err, "Failed to sign the receipt")
+	}
+	return nil
+}
+
+// Verify checks that the receipt was signed by the receiver's public key.
+func (r *Receipt) Verify(publicKey *rsa.PublicKey) error {
+	if len(r.Signature) == 0 {
+		return errors.New("Receipt is not signed")
+	}
+	if receiver := Fingerprint(publicKey); r.Receiver != receiver {
+		return &KeyMismatchError{What: "Receipt", Signer: r.Receiver, Given: receiver}
+	}
+
+	digest, err := r.digest()
+	if err != nil {
+		return NewError(err, "Unable to encode receipt")
+	}
+	if err = rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, digest, r.Signature); err != nil {
+		return &SignatureError{What: "receipt", Err: err}
+	}
+	return nil
+}
+
+// ReadReceipt reads a receipt written by WriteReceipt.
+func ReadReceipt(in io.Reader) (*Receipt, error) {
+	result := &Receipt{}
+	if err := json.NewDecoder(in).Decode(result); err != nil {
+		return nil, NewError(err, "Unable to read receipt")
+	}
+	return result, nil
+}
+
+// WriteReceipt writes a receipt so it can be returned to the sender.
+func WriteReceipt(out io.Writer, receipt *Receipt) error {
+	return json.NewEncoder(out).Encode(receipt)
+}
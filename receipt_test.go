@@ -0,0 +1,44 @@
+package repository
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestReceipt(t *testing.T) {
+	tape := []byte("the whole tape")
+	hash, err := TapeHash(bytes.NewReader(tape))
+	if err != nil {
+		t.Fatalf("Unable to hash tape: %v", err)
+	}
+
+	receipt := &Receipt{Tape: hash, Sender: Fingerprint(&medKey.PublicKey), Time: time.Now().UTC(), Result: ReceiptUnpacked}
+	if err = receipt.Sign(testKey); err != nil {
+		t.Fatalf("Unable to sign receipt: %v", err)
+	}
+
+	buffer := new(bytes.Buffer)
+	if err = WriteReceipt(buffer, receipt); err != nil {
+		t.Fatalf("Unable to write receipt: %v", err)
+	}
+	read, err := ReadReceipt(buffer)
+	if err != nil {
+		t.Fatalf("Unable to read receipt: %v", err)
+	}
+	if err = read.Verify(&testKey.PublicKey); err != nil {
+		t.Errorf("Unable to verify receipt: %v", err)
+	}
+	if read.Tape != hash || read.Result != ReceiptUnpacked {
+		t.Errorf("Receipt does not name the tape and result: %+v", read)
+	}
+
+	if err = read.Verify(&medKey.PublicKey); err == nil {
+		t.Error("Should not verify a receipt with another key")
+	}
+
+	read.Result = ReceiptVerified
+	if err = read.Verify(&testKey.PublicKey); err == nil {
+		t.Error("Should not verify a tampered receipt")
+	}
+}
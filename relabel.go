@@ -0,0 +1,233 @@
+package repository
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/darcinc/afero"
+)
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	in    io.Reader
+	count int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.in.Read(p)
+	r.count += int64(n)
+	return n, err
+}
+
+// relabel reads the label from in with key and returns a new label, signed
+// with key's private key, that gives recipient and key's escrow keys the
+// same tape key.  Also returns the size of the old label.  The old trailer is
+// checked against key's public key first, since the relabeled tape is signed
+// again with key's private key.
+func relabel(in io.Reader, key Key, recipient *rsa.PublicKey) ([]byte, int64, error) {
+	key.Policy = key.policy()
+	if err := key.checkPolicy(); err != nil {
+		return nil, 0, err
+	}
+	if err := key.Policy.CheckKey(recipient); err != nil {
+		return nil, 0, err
+	}
+
+	counter := &countingReader{in: in}
+	label, err := key.readLabel(counter)
+	if err != nil {
+		return nil, 0, NewError(err, "Unable to read the old label")
+	}
+	if label.signOnly {
+		return nil, 0, errors.New("Sign-only tapes have no tape key to give a recipient, so they cannot be relabeled")
+	}
+	if err = key.Policy.CheckHash(label.hashName); err != nil {
+		return nil, 0, err
+	}
+	if err = verifyOldTrailer(in, counter.count, key.PublicKey); err != nil {
+		return nil, 0, err
+	}
+
+	label.Escrow = key.Escrow
+	buffer := new(bytes.Buffer)
+	if err = label.WriteLabel(buffer, recipient, key.PrivateKey); err != nil {
+		return nil, 0, NewError(err, "Unable to write the new label")
+	}
+
+	return buffer.Bytes(), counter.count, nil
+}
+
+// verifyOldTrailer checks the trailer of the tape in in, whose label ends at
+// labelEnd, against the old sender's public key and leaves in just after the
+// label.  A detached label has nothing after it to check.
+func verifyOldTrailer(in io.Reader, labelEnd int64, publicKey *rsa.PublicKey) error {
+	seeker, ok := in.(io.ReadSeeker)
+	if !ok {
+		return &SignatureError{What: "tape", Err: errors.New("The tape must be seekable to verify it before relabeling")}
+	}
+
+	end, trailer, err := findTrailer(seeker)
+	if err != nil {
+		return NewError(err, "Unable to read the old trailer")
+	}
+	if trailer != nil {
+		if _, _, err = readTrailer(seeker, publicKey); err != nil {
+			return NewError(err, "Unable to verify the old trailer")
+		}
+	} else if end > labelEnd {
+		return &SignatureError{What: "tape", Err: errors.New("Tape has no trailer")}
+	}
+
+	if _, err = seeker.Seek(labelEnd, io.SeekStart); err != nil {
+		return NewError(err, "Unable to read the tape payload")
+	}
+	return nil
+}
+
+// padLabel pads a versioned label to size bytes with whitespace after the
+// signature block's JSON, so the label can replace a larger one in place.
+func padLabel(label []byte, size int64) []byte {
+	padding := int(size) - len(label)
+	headerLength := binary.BigEndian.Uint32(label[len(labelMagic)+1:])
+	offset := len(labelMagic) + 1 + 4 + int(headerLength)
+
+	signatureLength := binary.BigEndian.Uint32(label[offset:])
+	binary.BigEndian.PutUint32(label[offset:], signatureLength+uint32(padding))
+	return append(label, bytes.Repeat([]byte(" "), padding)...)
+}
+
+// Relabel copies a tape from in to out, replacing its label with one for a
+// new recipient.  The old label is read with key, whose private key must be
+// the old recipient's and whose public key must be the old sender's.  The new
+// label gives recipient the same tape key and is signed with key's private
+// key, so the payload is copied without being decrypted.  The tape's trailer
+// must verify with key's public key, and is replaced with one signed by key's
+// private key, so in must be seekable.  Detached labels are relabeled the
+// same way.  Sign-only tapes cannot be relabeled.
+func Relabel(in io.Reader, out io.Writer, key Key, recipient *rsa.PublicKey) error {
+	label, _, err := relabel(in, key, recipient)
+	if err != nil {
+		return err
+	}
+
+	return writeRelabeled(out, in, label, key.PrivateKey)
+}
+
+// writeRelabeled writes the new label and the payload that follows the old
+// label in in, and a new trailer signing them.  When signKey is nil the rest
+// of the tape, trailer included, is copied as is.
+func writeRelabeled(out io.Writer, in io.Reader, label []byte, signKey crypto.Signer) error {
+	if signKey == nil {
+		if _, err := out.Write(label); err != nil {
+			return NewError(err, "Unable to write the new label")
+		}
+		if _, err := io.Copy(out, in); err != nil {
+			return NewError(err, "Unable to copy the tape payload")
+		}
+		return nil
+	}
+
+	raw, err := readRawLabel(bytes.NewReader(label))
+	if err != nil {
+		return err
+	}
+	if _, err = out.Write(label); err != nil {
+		return NewError(err, "Unable to write the new label")
+	}
+
+	algorithm, err := lookupHash(raw.header.Hash)
+	if err != nil {
+		return err
+	}
+	hash := trailerHash(algorithm, raw.headerBytes)
+	if err = copyWithoutTrailer(io.MultiWriter(out, hash), in); err != nil {
+		return NewError(err, "Unable to copy the tape payload")
+	}
+	return writeTrailer(out, hash, algorithm, nil, signKey)
+}
+
+// RelabelFile relabels the tape or detached label at path for a new
+// recipient, see Relabel.  The result is written to output, or replaces the
+// file at path when output is empty or the same path.
+func RelabelFile(fs afero.Fs, path, output string, key Key, recipient *rsa.PublicKey) error {
+	return replaceLabel(fs, path, output, key.PrivateKey, func(in io.Reader) ([]byte, int64, error) {
+		return relabel(in, key, recipient)
+	})
+}
+
+// replaceLabel replaces the label of the tape or detached label at path with
+// the one newLabel makes from it, which also returns the size of the old
+// label.  The result is written to output, or replaces the file at path when
+// output is empty or the same path.  A new label that is no larger than the
+// old one is written over it without rewriting the payload, which is only
+// read to sign the tape; otherwise the tape is rewritten to a temporary file
+// that is then renamed over the original.  The trailer is replaced with one
+// signed by signKey, or kept as is when signKey is nil.
+func replaceLabel(fs afero.Fs, path, output string, signKey crypto.Signer, newLabel func(io.Reader) ([]byte, int64, error)) error {
+	in, err := fs.Open(path)
+	if err != nil {
+		return NewError(err, fmt.Sprintf("Unable to open tape %s", path))
+	}
+	defer in.Close()
+
+	label, oldSize, err := newLabel(in)
+	if err != nil {
+		return err
+	}
+
+	if output != "" && output != path {
+		out, err := fs.OpenFile(output, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+		if err != nil {
+			return NewError(err, fmt.Sprintf("Unable to create tape %s", output))
+		}
+		defer out.Close()
+
+		return writeRelabeled(out, in, label, signKey)
+	}
+
+	if int64(len(label)) <= oldSize {
+		out, err := fs.OpenFile(path, os.O_RDWR, 0600)
+		if err != nil {
+			return NewError(err, fmt.Sprintf("Unable to open tape %s for writing", path))
+		}
+		defer out.Close()
+
+		if _, err = out.WriteAt(padLabel(label, oldSize), 0); err != nil {
+			return NewError(err, fmt.Sprintf("Unable to write new label into %s", path))
+		}
+		if signKey == nil {
+			return nil
+		}
+		if err = resignTape(out, signKey); err != nil {
+			return NewError(err, fmt.Sprintf("Unable to sign relabeled tape %s", path))
+		}
+		return nil
+	}
+
+	temp, err := afero.TempFile(fs, filepath.Dir(path), filepath.Base(path)+".relabel")
+	if err != nil {
+		return NewError(err, "Unable to create temporary tape")
+	}
+	defer fs.Remove(temp.Name())
+
+	err = writeRelabeled(temp, in, label, signKey)
+	if closeErr := temp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return NewError(err, "Unable to write temporary tape")
+	}
+
+	in.Close()
+	if err = fs.Rename(temp.Name(), path); err != nil {
+		return NewError(err, fmt.Sprintf("Unable to replace tape %s", path))
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/darcinc/afero"
+)
+
+func tapeContents(t *testing.T, data []byte, key Key) []string {
+	tr, err := OpenTapeWithKey(key, bytes.NewReader(data))
+	if err != nil {
+		t.Fatalf("Unable to open relabeled tape: %v", err)
+	}
+
+	contents, err := tr.Contents()
+	if err != nil {
+		t.Fatalf("Unable to read relabeled tape: %v", err)
+	}
+	return contents
+}
+
+func TestRelabel(t *testing.T) {
+	fs := setupFs()
+	createSimpleTape(fs, []string{pathFor("data", "db", "files", "db1.dat")})
+	original, _ := afero.ReadFile(fs, pathFor("backups", "bk1.bak"))
+
+	out := new(bytes.Buffer)
+	err := Relabel(bytes.NewReader(original), out, tapeKey, &testKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Unable to relabel tape: %v", err)
+	}
+
+	contents := tapeContents(t, out.Bytes(), Key{PrivateKey: testKey, PublicKey: &medKey.PublicKey})
+	if len(contents) != 1 {
+		t.Errorf("Expected one file in relabeled tape but got %v", contents)
+	}
+
+	if _, err = OpenTape(medKey, &medKey.PublicKey, bytes.NewReader(out.Bytes())); err == nil {
+		t.Error("Old recipient should not be able to read the relabeled tape")
+	}
+
+	err = Relabel(bytes.NewReader(original), new(bytes.Buffer), Key{PrivateKey: testKey, PublicKey: &medKey.PublicKey}, &longKey.PublicKey)
+	if err == nil {
+		t.Error("Should not relabel a tape without the recipient's private key")
+	}
+}
+
+func TestRelabelFileInPlace(t *testing.T) {
+	fs := setupFs()
+	createSimpleTape(fs, []string{pathFor("data", "db", "files", "db1.dat")})
+	tape := pathFor("backups", "bk1.bak")
+
+	// The larger key needs a larger label, so the tape is rewritten.
+	if err := RelabelFile(fs, tape, "", tapeKey, &longKey.PublicKey); err != nil {
+		t.Fatalf("Unable to relabel tape for a larger key: %v", err)
+	}
+	data, _ := afero.ReadFile(fs, tape)
+	if contents := tapeContents(t, data, Key{PrivateKey: longKey, PublicKey: &medKey.PublicKey}); len(contents) != 1 {
+		t.Errorf("Expected one file in relabeled tape but got %v", contents)
+	}
+
+	// The smaller key's label is padded and written over the old one.
+	if err := RelabelFile(fs, tape, tape, Key{PrivateKey: longKey, PublicKey: &medKey.PublicKey}, &testKey.PublicKey); err != nil {
+		t.Fatalf("Unable to relabel tape for a smaller key: %v", err)
+	}
+	relabeled, _ := afero.ReadFile(fs, tape)
+	// Only the trailer, signed by the larger key, may grow.
+	oldEnd, _, _ := findTrailer(bytes.NewReader(data))
+	newEnd, _, _ := findTrailer(bytes.NewReader(relabeled))
+	if oldEnd != newEnd {
+		t.Errorf("Relabeling in place moved the end of the payload from %d to %d", oldEnd, newEnd)
+	}
+	if err := CheckSender(bytes.NewReader(relabeled), &longKey.PublicKey); err != nil {
+		t.Errorf("Tape relabeled in place should be signed by the new sender: %v", err)
+	}
+	if contents := tapeContents(t, relabeled, Key{PrivateKey: testKey, PublicKey: &longKey.PublicKey}); len(contents) != 1 {
+		t.Errorf("Expected one file in relabeled tape but got %v", contents)
+	}
+}
+
+func TestRelabelFileToOutput(t *testing.T) {
+	fs := setupFs()
+	createSimpleTape(fs, []string{pathFor("data", "db", "files", "db1.dat")})
+	tape := pathFor("backups", "bk1.bak")
+	output := pathFor("backups", "bk2.bak")
+	original, _ := afero.ReadFile(fs, tape)
+
+	if err := RelabelFile(fs, tape, output, tapeKey, &testKey.PublicKey); err != nil {
+		t.Fatalf("Unable to relabel tape to a new file: %v", err)
+	}
+
+	unchanged, _ := afero.ReadFile(fs, tape)
+	if !bytes.Equal(original, unchanged) {
+		t.Error("Relabeling to a new file should leave the original alone")
+	}
+
+	data, _ := afero.ReadFile(fs, output)
+	if contents := tapeContents(t, data, Key{PrivateKey: testKey, PublicKey: &medKey.PublicKey}); len(contents) != 1 {
+		t.Errorf("Expected one file in relabeled tape but got %v", contents)
+	}
+}
+
+func TestRelabelTamperedTape(t *testing.T) {
+	fs := setupFs()
+	createSimpleTape(fs, []string{pathFor("data", "db", "files", "db1.dat")})
+	tape := pathFor("backups", "bk1.bak")
+	original, _ := afero.ReadFile(fs, tape)
+
+	end, _, _ := findTrailer(bytes.NewReader(original))
+	tampered := append([]byte{}, original...)
+	tampered[end-1] ^= 0xff
+	err := Relabel(bytes.NewReader(tampered), new(bytes.Buffer), tapeKey, &testKey.PublicKey)
+	if !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected a bad signature relabeling a tampered tape but got %v", err)
+	}
+
+	afero.WriteFile(fs, tape, tampered, 0600)
+	if err = RelabelFile(fs, tape, "", tapeKey, &testKey.PublicKey); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected a bad signature relabeling a tampered file but got %v", err)
+	}
+	if data, _ := afero.ReadFile(fs, tape); !bytes.Equal(data, tampered) {
+		t.Error("Refused relabel should leave the tape alone")
+	}
+
+	if err = Relabel(bytes.NewReader(original), new(bytes.Buffer), Key{PrivateKey: medKey, PublicKey: &testKey.PublicKey}, &longKey.PublicKey); err == nil {
+		t.Error("Should not relabel a tape with the wrong sender's key")
+	}
+}
+
+func TestRelabelSignOnlyTape(t *testing.T) {
+	tape := writeSignOnlyTape(t)
+
+	out := new(bytes.Buffer)
+	if err := Relabel(bytes.NewReader(tape), out, Key{PublicKey: &medKey.PublicKey, PrivateKey: medKey}, &testKey.PublicKey); err == nil {
+		t.Error("Should not relabel a sign-only tape")
+	}
+	if out.Len() != 0 {
+		t.Errorf("Refused relabel wrote %d bytes", out.Len())
+	}
+}
@@ -1,7 +1,41 @@
 package repository
 
 import (
+	"errors"
 	"fmt"
+	"io"
+	"strings"
+)
+
+// Sentinel errors.  errors.Is finds them in the errors returned by the
+// package, which wrap them in the typed errors below or in an *Error.
+var (
+	// ErrBadSignature means a signature did not verify: what was signed was
+	// changed after signing, or was signed by another key.
+	ErrBadSignature = errors.New("bad signature")
+
+	// ErrNoSuchKey means a keystore or key provider has no key by the name
+	// asked for.
+	ErrNoSuchKey = errors.New("no such key")
+
+	// ErrKeyMismatch means a tape, label or receipt was made for or signed
+	// by a key other than the one given.
+	ErrKeyMismatch = errors.New("key does not match")
+
+	// ErrTruncated means a tape or label ended before it was complete.
+	ErrTruncated = errors.New("tape is truncated")
+
+	// ErrUnsafePath means a file on a tape has a path that could be
+	// extracted outside the directories it was packed from.
+	ErrUnsafePath = errors.New("unsafe path")
+
+	// ErrUnsupportedVersion means a label uses a version, mode or algorithm
+	// this package does not support.
+	ErrUnsupportedVersion = errors.New("unsupported version")
+
+	// ErrBadPassphrase means the passphrase given does not unwrap a
+	// passphrase label's tape key.
+	ErrBadPassphrase = errors.New("bad passphrase")
 )
 
 // Error describes an error when reading, writing or creating repositories.
@@ -14,9 +48,17 @@ type Error struct {
 // Error implements the error interface, returning the string representation
 // of the error.
 func (re *Error) Error() string {
+	if re.OriginalError == nil {
+		return re.Message
+	}
 	return fmt.Sprintf("%s: %v", re.Message, re.OriginalError)
 }
 
+// Unwrap returns the original error, so errors.Is and errors.As see it.
+func (re *Error) Unwrap() error {
+	return re.OriginalError
+}
+
 // NewError is a convenience method for creating new repository
 // errors from a message and original error.
 func NewError(err error, message string) *Error {
@@ -25,3 +67,164 @@ func NewError(err error, message string) *Error {
 		Message:       message,
 	}
 }
+
+// KeyNotFoundError reports that a tape needs a key that is not available.
+// Fingerprints lists the keys that would do, see Fingerprint.
+type KeyNotFoundError struct {
+	Fingerprints []string
+	Private      bool
+}
+
+// Error implements the error interface.
+func (e *KeyNotFoundError) Error() string {
+	keys := strings.Join(e.Fingerprints, ", ")
+	switch {
+	case !e.Private:
+		return fmt.Sprintf("tape was signed by key %s, which you don't have", keys)
+	case len(e.Fingerprints) == 1:
+		return fmt.Sprintf("tape is for key %s, which you don't have", keys)
+	}
+	return fmt.Sprintf("tape is for keys %s, none of which you have", keys)
+}
+
+// Is reports that a missing key is a key mismatch, see ErrKeyMismatch.
+func (e *KeyNotFoundError) Is(target error) bool {
+	return target == ErrKeyMismatch
+}
+
+// NoSuchKeyError reports that there is no Kind of key, such as "Private
+// key", called Name, in Where if it is set.
+type NoSuchKeyError struct {
+	Kind  string
+	Name  string
+	Where string
+}
+
+// Error implements the error interface.
+func (e *NoSuchKeyError) Error() string {
+	if e.Where != "" {
+		return fmt.Sprintf("%s %s not found in %s", e.Kind, e.Name, e.Where)
+	}
+	return fmt.Sprintf("%s %s not found", e.Kind, e.Name)
+}
+
+// Is reports that the error is ErrNoSuchKey.
+func (e *NoSuchKeyError) Is(target error) bool {
+	return target == ErrNoSuchKey
+}
+
+// SignatureError reports a signature that did not verify.  What names what
+// was signed, such as "label", "tape" or "receipt".
+type SignatureError struct {
+	What string
+	Err  error
+}
+
+// Error implements the error interface.
+func (e *SignatureError) Error() string {
+	return fmt.Sprintf("Failed to verify %s signature: %v", e.What, e.Err)
+}
+
+// Unwrap returns the reason the signature did not verify.
+func (e *SignatureError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports that the error is ErrBadSignature.
+func (e *SignatureError) Is(target error) bool {
+	return target == ErrBadSignature
+}
+
+// KeyMismatchError reports that What, such as "Label", "Tape" or "Receipt",
+// was signed by the key with fingerprint Signer, not the key given.
+type KeyMismatchError struct {
+	What   string
+	Signer string
+	Given  string
+}
+
+// Error implements the error interface.
+func (e *KeyMismatchError) Error() string {
+	return fmt.Sprintf("%s was signed by key %s, not %s", e.What, e.Signer, e.Given)
+}
+
+// Is reports that the error is ErrKeyMismatch.
+func (e *KeyMismatchError) Is(target error) bool {
+	return target == ErrKeyMismatch
+}
+
+// TruncatedError reports that a tape or label ended early.
+type TruncatedError struct {
+	Err error
+}
+
+// Error implements the error interface.
+func (e *TruncatedError) Error() string {
+	return fmt.Sprintf("Tape is truncated: %v", e.Err)
+}
+
+// Unwrap returns the error that ended reading.
+func (e *TruncatedError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports that the error is ErrTruncated.
+func (e *TruncatedError) Is(target error) bool {
+	return target == ErrTruncated
+}
+
+// truncated returns a *TruncatedError for errors that mean the input ended
+// early, and other errors as they are.
+func truncated(err error) error {
+	if err == io.EOF || errors.Is(err, io.ErrUnexpectedEOF) {
+		return &TruncatedError{Err: err}
+	}
+	return err
+}
+
+// UnsupportedVersionError reports that a label uses a What, such as a
+// "label version" or "hash algorithm", of Value, which is not supported.
+type UnsupportedVersionError struct {
+	What  string
+	Value string
+}
+
+// Error implements the error interface.
+func (e *UnsupportedVersionError) Error() string {
+	return fmt.Sprintf("Unsupported %s %q", e.What, e.Value)
+}
+
+// Is reports that the error is ErrUnsupportedVersion.
+func (e *UnsupportedVersionError) Is(target error) bool {
+	return target == ErrUnsupportedVersion
+}
+
+// UnsafePathError reports a file on a tape whose path is unsafe to extract,
+// see ErrUnsafePath.
+type UnsafePathError struct {
+	Path string
+}
+
+// Error implements the error interface.
+func (e *UnsafePathError) Error() string {
+	return fmt.Sprintf("Unsafe path %q on tape", e.Path)
+}
+
+// Is reports that the error is ErrUnsafePath.
+func (e *UnsafePathError) Is(target error) bool {
+	return target == ErrUnsafePath
+}
+
+// PassphraseError reports that a passphrase did not unwrap a label's tape
+// key, see ErrBadPassphrase.
+type PassphraseError struct{}
+
+// Error implements the error interface.
+func (e *PassphraseError) Error() string {
+	return "Unable to unwrap tape key, the passphrase is wrong"
+}
+
+// Is reports that the error is ErrBadPassphrase.
+func (e *PassphraseError) Is(target error) bool {
+	return target == ErrBadPassphrase
+}
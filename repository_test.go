@@ -1,8 +1,11 @@
 package repository
 
 import (
+	"archive/tar"
+	"bytes"
 	"crypto/rand"
 	"crypto/rsa"
+	"errors"
 	"fmt"
 	"io"
 	"testing"
@@ -11,7 +14,7 @@ import (
 var (
 	testAes  = []byte("AESKEY256-32-Character1234567890")
 	testIv   = []byte("1234567890123456")
-	testKey  = generateTestKey(1024)
+	testKey  = generateTestKey(2048)
 	shortKey = generateTestKey(1024)
 	medKey   = generateTestKey(2048)
 	longKey  = generateTestKey(4096)
@@ -41,4 +44,90 @@ func TestError(t *testing.T) {
 	if err.Error() != fmt.Sprintf("%s: %v", "This is an error", io.EOF) {
 		t.Errorf("Incorrect string representation")
 	}
+
+	if !errors.Is(err, io.EOF) {
+		t.Errorf("Expected the original error to be unwrapped")
+	}
+}
+
+func TestTypedErrors(t *testing.T) {
+	tape := writeHashTape(t, tapeKey)
+
+	_, err := OpenTape(medKey, &testKey.PublicKey, bytes.NewReader(tape))
+	var mismatch *KeyMismatchError
+	if !errors.Is(err, ErrKeyMismatch) || !errors.As(err, &mismatch) || mismatch.What != "Label" {
+		t.Errorf("Expected a key mismatch opening with the wrong sender but got %v", err)
+	}
+	if _, err = OpenTape(testKey, &medKey.PublicKey, bytes.NewReader(tape)); !errors.Is(err, ErrKeyMismatch) {
+		t.Errorf("Expected a key mismatch opening with the wrong recipient but got %v", err)
+	}
+
+	tampered := append([]byte{}, tape...)
+	tampered[len(tampered)/2] ^= 0xff
+	err = CheckSender(bytes.NewReader(tampered), &medKey.PublicKey)
+	var signature *SignatureError
+	if !errors.Is(err, ErrBadSignature) || !errors.As(err, &signature) || signature.What != "tape" {
+		t.Errorf("Expected a bad signature on a tampered tape but got %v", err)
+	}
+	if _, err = OpenTape(medKey, &medKey.PublicKey, bytes.NewReader(tampered)); !errors.As(err, &signature) || signature.What != "tape" {
+		t.Errorf("Expected a bad signature opening a tampered tape but got %v", err)
+	}
+
+	if _, err = OpenTape(medKey, &medKey.PublicKey, bytes.NewReader(tape[:len(labelMagic)+10])); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Expected a truncated label but got %v", err)
+	}
+	if _, err = OpenTape(medKey, &medKey.PublicKey, bytes.NewReader(tape[:len(tape)/2])); !errors.Is(err, ErrBadSignature) {
+		t.Errorf("Expected a truncated tape not to verify but got %v", err)
+	}
+	tr, err := OpenTapeWithOptions(Key{PrivateKey: medKey, PublicKey: &medKey.PublicKey}, bytes.NewReader(tape[:len(tape)/2]), WithUnverified())
+	if err != nil {
+		t.Fatalf("Unable to open the start of the tape: %v", err)
+	}
+	if _, err = tr.Contents(); !errors.Is(err, ErrTruncated) {
+		t.Errorf("Expected a truncated archive but got %v", err)
+	}
+
+	versioned := append([]byte{}, tape...)
+	versioned[len(labelMagic)] = 99
+	_, err = OpenTape(medKey, &medKey.PublicKey, bytes.NewReader(versioned))
+	var unsupported *UnsupportedVersionError
+	if !errors.Is(err, ErrUnsupportedVersion) || !errors.As(err, &unsupported) || unsupported.Value != "99" {
+		t.Errorf("Expected an unsupported version but got %v", err)
+	}
+	if _, err = lookupHash("md5"); !errors.Is(err, ErrUnsupportedVersion) {
+		t.Errorf("Expected an unsupported hash algorithm but got %v", err)
+	}
+}
+
+func TestUnsafePath(t *testing.T) {
+	out := new(bytes.Buffer)
+	tw, err := NewTapeWriter(tapeKey, out)
+	if err != nil {
+		t.Fatalf("Unable to create tape: %v", err)
+	}
+	name := "data/../../etc/passwd"
+	tw.tarWriter.WriteHeader(&tar.Header{Name: name, Mode: 0600, Size: 4, Typeflag: tar.TypeReg})
+	tw.tarWriter.Write([]byte("root"))
+	if err = tw.Close(); err != nil {
+		t.Fatalf("Unable to close tape: %v", err)
+	}
+
+	tr, err := OpenTape(medKey, &medKey.PublicKey, bytes.NewReader(out.Bytes()))
+	if err != nil {
+		t.Fatalf("Unable to open tape: %v", err)
+	}
+	err = tr.ExtractFile(setupFs())
+	var unsafe *UnsafePathError
+	if !errors.Is(err, ErrUnsafePath) || !errors.As(err, &unsafe) || unsafe.Path != name {
+		t.Errorf("Expected an unsafe path but got %v", err)
+	}
+
+	for _, name := range []string{"", "a/../b", "..\\b"} {
+		if checkPath(name) == nil {
+			t.Errorf("Path %q should be unsafe", name)
+		}
+	}
+	if err = checkPath(pathFor("data", "db", "..db")); err != nil {
+		t.Errorf("Expected a file named ..db to be safe: %v", err)
+	}
 }
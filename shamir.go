@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"crypto/rand"
+	"errors"
+)
+
+// Shamir secret sharing over GF(2^8), using the AES field polynomial.  Each
+// share is its x coordinate followed by one y coordinate per secret byte.
+
+var (
+	gfExp [510]byte
+	gfLog [256]byte
+)
+
+func init() {
+	x := byte(1)
+	for i := 0; i < 255; i++ {
+		gfExp[i] = x
+		gfExp[i+255] = x
+		gfLog[x] = byte(i)
+		x = gfMulSlow(x, 3)
+	}
+}
+
+// gfMulSlow multiplies without tables, used to build them.
+func gfMulSlow(a, b byte) byte {
+	var result byte
+	for b > 0 {
+		if b&1 != 0 {
+			result ^= a
+		}
+		carry := a & 0x80
+		a <<= 1
+		if carry != 0 {
+			a ^= 0x1b
+		}
+		b >>= 1
+	}
+	return result
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfDiv(a, b byte) byte {
+	if a == 0 {
+		return 0
+	}
+	return gfExp[int(gfLog[a])+255-int(gfLog[b])]
+}
+
+// splitSecret splits a secret into n shares, any k of which recover it.
+func splitSecret(secret []byte, n, k int) ([][]byte, error) {
+	if k < 1 || k > n || n > 255 {
+		return nil, errors.New("Threshold must be between 1 and the number of shares, which must be at most 255")
+	}
+
+	shares := make([][]byte, n)
+	for i := range shares {
+		shares[i] = make([]byte, len(secret)+1)
+		shares[i][0] = byte(i + 1)
+	}
+
+	coefficients := make([]byte, k)
+	for b, value := range secret {
+		coefficients[0] = value
+		if _, err := rand.Read(coefficients[1:]); err != nil {
+			return nil, err
+		}
+
+		for _, share := range shares {
+			// Evaluate the polynomial at x with Horner's rule.
+			x, y := share[0], byte(0)
+			for c := k - 1; c >= 0; c-- {
+				y = gfMul(y, x) ^ coefficients[c]
+			}
+			share[b+1] = y
+		}
+	}
+
+	return shares, nil
+}
+
+// combineShares recovers a secret from k or more of its shares by
+// interpolating the polynomial at zero.
+func combineShares(shares [][]byte) ([]byte, error) {
+	if len(shares) == 0 {
+		return nil, errors.New("No shares to combine")
+	}
+
+	size := len(shares[0])
+	seen := map[byte]bool{}
+	for _, share := range shares {
+		if len(share) != size || size < 2 {
+			return nil, errors.New("Shares have different sizes")
+		}
+		if share[0] == 0 || seen[share[0]] {
+			return nil, errors.New("Shares must be distinct")
+		}
+		seen[share[0]] = true
+	}
+
+	secret := make([]byte, size-1)
+	for i, share := range shares {
+		// Lagrange basis polynomial for this share, evaluated at zero.
+		basis := byte(1)
+		for j, other := range shares {
+			if i != j {
+				basis = gfMul(basis, gfDiv(other[0], other[0]^share[0]))
+			}
+		}
+
+		for b := range secret {
+			secret[b] ^= gfMul(basis, share[b+1])
+		}
+	}
+
+	return secret, nil
+}
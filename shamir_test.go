@@ -0,0 +1,42 @@
+package repository
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestShamir(t *testing.T) {
+	secret := []byte("a secret tape key and its vector")
+	shares, err := splitSecret(secret, 5, 3)
+	if err != nil {
+		t.Fatalf("Unable to split secret: %v", err)
+	}
+
+	for _, subset := range [][]int{{0, 1, 2}, {4, 2, 0}, {1, 3, 4}, {0, 1, 2, 3, 4}} {
+		chosen := [][]byte{}
+		for _, i := range subset {
+			chosen = append(chosen, shares[i])
+		}
+
+		recovered, err := combineShares(chosen)
+		if err != nil {
+			t.Fatalf("Unable to combine shares %v: %v", subset, err)
+		}
+		if !bytes.Equal(recovered, secret) {
+			t.Errorf("Shares %v recovered the wrong secret", subset)
+		}
+	}
+
+	recovered, _ := combineShares(shares[:2])
+	if bytes.Equal(recovered, secret) {
+		t.Error("Two shares should not recover the secret")
+	}
+
+	if _, err = combineShares([][]byte{shares[0], shares[0]}); err == nil {
+		t.Error("Duplicate shares should be rejected")
+	}
+
+	if _, err = splitSecret(secret, 2, 3); err == nil {
+		t.Error("Threshold above the number of shares should be rejected")
+	}
+}
@@ -0,0 +1,99 @@
+package repository
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ManifestEntry describes one file on a tape.  SHA256 is the hex encoded
+// hash of the file's contents on tapes signed with SHA-256, and Digest the
+// hash made with the tape's hash algorithm on other tapes.  Both are empty
+// for directories and other entries that are not regular files.
+type ManifestEntry struct {
+	Name   string `json:"name"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256,omitempty"`
+	Digest string `json:"digest,omitempty"`
+}
+
+// setDigest records the hash of the file's contents made with the
+// algorithm.
+func (e *ManifestEntry) setDigest(algorithm crypto.Hash, sum []byte) {
+	if algorithm == crypto.SHA256 {
+		e.SHA256 = hex.EncodeToString(sum)
+	} else {
+		e.Digest = hex.EncodeToString(sum)
+	}
+}
+
+// Sum returns the hex encoded hash of the file's contents, whichever
+// algorithm made it.
+func (e ManifestEntry) Sum() string {
+	if e.Digest != "" {
+		return e.Digest
+	}
+	return e.SHA256
+}
+
+// WriteSignedLabel creates a new label for a sign-only tape.  The label
+// carries no key, so the tape is not encrypted and Escrow is ignored.  Only
+// the label is signed here; TapeWriter.Close signs the whole tape.
+func (l *Label) WriteSignedLabel(repoFile io.Writer, signKey crypto.Signer) error {
+	signPub, err := rsaPublicKey(signKey.Public())
+	if err != nil {
+		return NewError(err, "Error writing label")
+	}
+
+	*l = Label{signOnly: true, NotBefore: l.NotBefore, NotAfter: l.NotAfter, Stream: l.Stream, metadata: l.metadata, hashName: l.hashName, compression: l.compression}
+	raw := &rawLabel{version: labelVersion}
+	raw.header = labelHeader{Mode: modeSigned, Sender: Fingerprint(signPub)}
+	if err = l.signAndWrite(repoFile, raw, signKey); err != nil {
+		return NewError(err, "Error writing label")
+	}
+
+	return nil
+}
+
+// VerifyTape checks the signature of a sign-only tape and that every file on
+// it matches the signed manifest, which is returned.  Only the sender's
+// public key is needed.
+func VerifyTape(tape io.ReadSeeker, publicKey *rsa.PublicKey) ([]ManifestEntry, error) {
+	tr, err := OpenTape(nil, publicKey, tape)
+	if err != nil {
+		return nil, err
+	}
+	if !tr.Key.Label.signOnly {
+		return nil, errors.New("Only sign-only tapes can be verified without a private key")
+	}
+
+	for i := 0; ; i++ {
+		header, err := tr.tarReader.Next()
+		if err == io.EOF {
+			if i != len(tr.manifest) {
+				return nil, fmt.Errorf("Tape has %d files but its manifest lists %d", i, len(tr.manifest))
+			}
+			return tr.manifest, nil
+		}
+		if err != nil {
+			return nil, NewError(err, "Unable to read tape")
+		}
+
+		algorithm := tr.Key.Label.digestAlgorithm()
+		hash := algorithm.New()
+		size, err := io.Copy(hash, tr.tarReader)
+		if err != nil {
+			return nil, NewError(err, "Unable to read tape")
+		}
+		entry := ManifestEntry{Name: header.Name, Size: size}
+		if hasContents(header.FileInfo()) {
+			entry.setDigest(algorithm, hash.Sum(nil))
+		}
+		if i >= len(tr.manifest) || tr.manifest[i] != entry {
+			return nil, fmt.Errorf("File %s does not match the tape's manifest", header.Name)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/darcinc/afero"
+)
+
+func writeSignOnlyTape(t *testing.T) []byte {
+	fs := setupFs()
+	buffer := new(bytes.Buffer)
+	tw, err := NewTapeWriter(Key{PrivateKey: medKey, SignOnly: true}, buffer)
+	if err != nil {
+		t.Fatalf("Unable to write sign-only tape: %v", err)
+	}
+	if err = tw.AddDirectory(fs, pathFor("data", "db")); err != nil {
+		t.Fatalf("Unable to add files: %v", err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatalf("Unable to close sign-only tape: %v", err)
+	}
+	return buffer.Bytes()
+}
+
+func TestSignOnlyTape(t *testing.T) {
+	tape := writeSignOnlyTape(t)
+
+	manifest, err := VerifyTape(bytes.NewReader(tape), &medKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Unable to verify sign-only tape: %v", err)
+	}
+	if len(manifest) != 4 || manifest[3].SHA256 == "" {
+		t.Errorf("Unexpected manifest %v", manifest)
+	}
+
+	tr, err := OpenTape(nil, &medKey.PublicKey, bytes.NewReader(tape))
+	if err != nil {
+		t.Fatalf("Unable to open sign-only tape with only the public key: %v", err)
+	}
+	if contents, _ := tr.Contents(); len(contents) != 4 {
+		t.Errorf("Expected four entries on the tape but got %v", contents)
+	}
+
+	if _, err = VerifyTape(bytes.NewReader(tape), &longKey.PublicKey); err == nil {
+		t.Error("Should not verify a sign-only tape with the wrong key")
+	}
+
+	if _, err = OpenTape(nil, &medKey.PublicKey, bytes.NewBuffer(tape)); err == nil {
+		t.Error("Should not open a sign-only tape that cannot be verified")
+	}
+}
+
+func TestSignOnlyTapeDetectsTampering(t *testing.T) {
+	tape := writeSignOnlyTape(t)
+
+	tampered := append([]byte{}, tape...)
+	tampered[len(tampered)/2] ^= 1
+	if _, err := OpenTape(nil, &medKey.PublicKey, bytes.NewReader(tampered)); err == nil {
+		t.Error("Should not open a tampered sign-only tape")
+	}
+
+	truncated := tape[:len(tape)-10]
+	if _, err := VerifyTape(bytes.NewReader(truncated), &medKey.PublicKey); err == nil {
+		t.Error("Should not verify a truncated sign-only tape")
+	}
+}
+
+// symlinkFs reports the file at link as a symbolic link.
+type symlinkFs struct {
+	afero.Fs
+	link string
+}
+
+func (fs symlinkFs) Stat(name string) (os.FileInfo, error) {
+	info, err := fs.Fs.Stat(name)
+	if err != nil || name != fs.link {
+		return info, err
+	}
+	return symlinkInfo{info}, nil
+}
+
+type symlinkInfo struct {
+	os.FileInfo
+}
+
+func (info symlinkInfo) Mode() os.FileMode {
+	return os.ModeSymlink | 0777
+}
+
+func TestSignOnlyTapeWithSymlink(t *testing.T) {
+	link := pathFor("data", "db", "files", "db2.dat")
+	fs := symlinkFs{Fs: setupFs(), link: link}
+	buffer := new(bytes.Buffer)
+	tw, err := NewTapeWriter(Key{PrivateKey: medKey, SignOnly: true}, buffer)
+	if err != nil {
+		t.Fatalf("Unable to write sign-only tape: %v", err)
+	}
+	if err = tw.AddFile(fs, pathFor("data", "db", "files", "db1.dat")); err != nil {
+		t.Fatalf("Unable to add file: %v", err)
+	}
+	if err = tw.AddFile(fs, link); err != nil {
+		t.Fatalf("Unable to add symlink: %v", err)
+	}
+	if err = tw.Close(); err != nil {
+		t.Fatalf("Unable to close sign-only tape: %v", err)
+	}
+
+	manifest, err := VerifyTape(bytes.NewReader(buffer.Bytes()), &medKey.PublicKey)
+	if err != nil {
+		t.Fatalf("Unable to verify sign-only tape with a symlink: %v", err)
+	}
+	if len(manifest) != 2 || manifest[0].SHA256 == "" || manifest[1].SHA256 != "" || manifest[1].Size != 0 {
+		t.Errorf("Expected a digest only for the regular file but got %v", manifest)
+	}
+}
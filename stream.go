@@ -0,0 +1,153 @@
+package repository
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Stream places a tape in a stream of tapes, such as a scheduled transfer,
+// from one sender to one recipient.  Sequence numbers start at 1 and grow by
+// one with each tape, and Previous is the Hash of the label of the tape
+// before.  The stream is recorded in the signed label header.
+type Stream struct {
+	ID       string `json:"id"`
+	Sequence uint64 `json:"sequence"`
+	Previous string `json:"previous,omitempty"`
+}
+
+// StreamPosition is the sequence number and label hash of the last tape
+// sent or received in a stream.
+type StreamPosition struct {
+	Sequence uint64 `json:"sequence"`
+	Hash     string `json:"hash"`
+}
+
+// StreamState keeps the last position in each stream.  Senders use it to
+// number their tapes, see Next and Sent, and receivers to detect missing,
+// repeated and replayed tapes, see Receive.  A receiver keys its streams by
+// the fingerprint of the sender's key as well as the stream ID.  When
+// AcceptGaps is set a receiver accepts a tape after missing ones.
+type StreamState struct {
+	Streams    map[string]StreamPosition `json:"streams"`
+	AcceptGaps bool                      `json:"-"`
+}
+
+// Kinds of StreamError.
+const (
+	// StreamGap means tapes before this one in the stream never arrived.
+	StreamGap = "gap"
+
+	// StreamDuplicate means the tape was already received.
+	StreamDuplicate = "duplicate"
+
+	// StreamReplay means a tape older than the last one received was
+	// received again.
+	StreamReplay = "replay"
+
+	// StreamBroken means the tape does not follow the last one received,
+	// although its sequence number does.
+	StreamBroken = "broken"
+)
+
+// StreamError is returned when a tape does not follow the last tape received
+// in its stream.  Last is the sequence number of that tape.
+type StreamError struct {
+	Kind     string
+	ID       string
+	Sequence uint64
+	Last     uint64
+}
+
+func (e *StreamError) Error() string {
+	switch e.Kind {
+	case StreamGap:
+		return fmt.Sprintf("Tapes %d to %d of stream %s are missing", e.Last+1, e.Sequence-1, e.ID)
+	case StreamDuplicate:
+		return fmt.Sprintf("Tape %d of stream %s was already received", e.Sequence, e.ID)
+	case StreamReplay:
+		return fmt.Sprintf("Tape %d of stream %s is older than tape %d, which was already received", e.Sequence, e.ID, e.Last)
+	}
+	return fmt.Sprintf("Tape %d of stream %s does not follow tape %d", e.Sequence, e.ID, e.Last)
+}
+
+// NewStreamState returns a state with no streams.
+func NewStreamState() *StreamState {
+	return &StreamState{Streams: map[string]StreamPosition{}}
+}
+
+// OpenStreamState reads a stream state written by Save.
+func OpenStreamState(in io.Reader) (*StreamState, error) {
+	result := NewStreamState()
+	if err := json.NewDecoder(in).Decode(result); err != nil {
+		return nil, NewError(err, "Unable to read stream state")
+	}
+	if result.Streams == nil {
+		result.Streams = map[string]StreamPosition{}
+	}
+	return result, nil
+}
+
+// Save writes the stream state.
+func (s *StreamState) Save(out io.Writer) error {
+	encoder := json.NewEncoder(out)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(s)
+}
+
+// Next returns the position of the next tape a sender writes in the stream.
+func (s *StreamState) Next(id string) *Stream {
+	last := s.Streams[id]
+	return &Stream{ID: id, Sequence: last.Sequence + 1, Previous: last.Hash}
+}
+
+// Sent records the label of a tape the sender wrote as the last in its
+// stream.
+func (s *StreamState) Sent(l *Label) {
+	if l.Stream != nil {
+		s.Streams[l.Stream.ID] = StreamPosition{Sequence: l.Stream.Sequence, Hash: l.Hash()}
+	}
+}
+
+// Receive checks that a received label follows the last one received in its
+// stream and records it as the last, returning a *StreamError if it does
+// not.  The first tape received in a stream is always accepted, as are tapes
+// that are not in a stream.
+func (s *StreamState) Receive(l *Label) error {
+	if l.Stream == nil {
+		return nil
+	}
+
+	key := l.sender + "/" + l.Stream.ID
+	last, known := s.Streams[key]
+	err := &StreamError{ID: l.Stream.ID, Sequence: l.Stream.Sequence, Last: last.Sequence}
+	switch {
+	case !known:
+	case l.Stream.Sequence == last.Sequence && l.Hash() == last.Hash:
+		err.Kind = StreamDuplicate
+	case l.Stream.Sequence <= last.Sequence:
+		err.Kind = StreamReplay
+	case l.Stream.Sequence > last.Sequence+1:
+		if !s.AcceptGaps {
+			err.Kind = StreamGap
+		}
+	case l.Stream.Previous != last.Hash:
+		err.Kind = StreamBroken
+	}
+	if err.Kind != "" {
+		return err
+	}
+
+	s.Streams[key] = StreamPosition{Sequence: l.Stream.Sequence, Hash: l.Hash()}
+	return nil
+}
+
+// Hash identifies a label by the hex encoded SHA-256 hash of its header.
+// Labels written before versioning have no header and hash to "".
+func (l *Label) Hash() string {
+	if l.header == nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(l.header))
+}
@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"bytes"
+	"testing"
+)
+
+func streamTapes(t *testing.T, count int) [][]byte {
+	fs := setupFs()
+	sender := NewStreamState()
+
+	result := [][]byte{}
+	for i := 0; i < count; i++ {
+		key := tapeKey
+		key.Stream = sender.Next("nightly")
+
+		out := new(bytes.Buffer)
+		tape, err := NewTapeWriter(key, out)
+		if err != nil {
+			t.Fatalf("Unable to create tape: %v", err)
+		}
+		tape.AddFile(fs, pathFor("data", "db", "files", "db2.dat"))
+		if err = tape.Close(); err != nil {
+			t.Fatalf("Unable to close tape: %v", err)
+		}
+		sender.Sent(&tape.Key.Label)
+		result = append(result, out.Bytes())
+	}
+	return result
+}
+
+func receiveTape(state *StreamState, tape []byte) error {
+	_, err := OpenTapeWithKey(Key{PrivateKey: medKey, PublicKey: &medKey.PublicKey, Streams: state}, bytes.NewReader(tape))
+	return err
+}
+
+func streamErrorKind(err error) string {
+	if streamErr, ok := err.(*StreamError); ok {
+		return streamErr.Kind
+	}
+	return ""
+}
+
+func TestStream(t *testing.T) {
+	tapes := streamTapes(t, 4)
+	receiver := NewStreamState()
+
+	for i, tape := range tapes[:2] {
+		if err := receiveTape(receiver, tape); err != nil {
+			t.Fatalf("Unable to receive tape %d: %v", i+1, err)
+		}
+	}
+
+	if err := receiveTape(receiver, tapes[1]); streamErrorKind(err) != StreamDuplicate {
+		t.Errorf("Expected a duplicate but got %v", err)
+	}
+	if err := receiveTape(receiver, tapes[0]); streamErrorKind(err) != StreamReplay {
+		t.Errorf("Expected a replay but got %v", err)
+	}
+	if err := receiveTape(receiver, tapes[3]); streamErrorKind(err) != StreamGap {
+		t.Errorf("Expected a gap but got %v", err)
+	}
+
+	receiver.AcceptGaps = true
+	if err := receiveTape(receiver, tapes[3]); err != nil {
+		t.Errorf("Should accept a tape after a gap when gaps are accepted: %v", err)
+	}
+	if err := receiveTape(receiver, tapes[2]); streamErrorKind(err) != StreamReplay {
+		t.Errorf("Expected a late tape to be a replay but got %v", err)
+	}
+}
+
+func TestStreamBroken(t *testing.T) {
+	first := streamTapes(t, 2)
+	second := streamTapes(t, 2)
+
+	receiver := NewStreamState()
+	if err := receiveTape(receiver, first[0]); err != nil {
+		t.Fatalf("Unable to receive tape: %v", err)
+	}
+	if err := receiveTape(receiver, second[1]); streamErrorKind(err) != StreamBroken {
+		t.Errorf("Expected a broken chain but got %v", err)
+	}
+}
+
+func TestStreamStateSave(t *testing.T) {
+	tapes := streamTapes(t, 2)
+	receiver := NewStreamState()
+	if err := receiveTape(receiver, tapes[0]); err != nil {
+		t.Fatalf("Unable to receive tape: %v", err)
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := receiver.Save(buffer); err != nil {
+		t.Fatalf("Unable to save stream state: %v", err)
+	}
+	loaded, err := OpenStreamState(buffer)
+	if err != nil {
+		t.Fatalf("Unable to read stream state: %v", err)
+	}
+	if err = receiveTape(loaded, tapes[0]); streamErrorKind(err) != StreamDuplicate {
+		t.Errorf("Expected a duplicate after reloading the state but got %v", err)
+	}
+	if err = receiveTape(loaded, tapes[1]); err != nil {
+		t.Errorf("Unable to receive the next tape after reloading the state: %v", err)
+	}
+}
@@ -2,11 +2,17 @@ package repository
 
 import (
 	"archive/tar"
+	"compress/gzip"
+	"crypto"
 	"crypto/cipher"
 	"crypto/rsa"
+	"errors"
 	"fmt"
+	"hash"
 	"io"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/darcinc/afero"
 )
@@ -17,11 +23,69 @@ import (
 // public key used to encrypt the label and the private key
 // used to sign the label.  When deciphering tapes, it contains
 // the private key to unencrypt the label and the public
-// to to veify the label signature.
+// to to veify the label signature.  The private key may be an
+// *rsa.PrivateKey or any key supplied by a KeyProvider.  Both keys
+// must satisfy the Policy, or DefaultPolicy if it is nil.  The other
+// fields choose how the tape is written and what is checked when it is
+// read.
 type Key struct {
 	Label      Label
 	PublicKey  *rsa.PublicKey
-	PrivateKey *rsa.PrivateKey
+	PrivateKey PrivateKey
+	Policy     *Policy
+
+	// Prekey, when set, makes tapes forward secret: the label can only be
+	// opened with the private half of the recipient's prekey, which is
+	// found in Prekeys when reading.
+	Prekey  *Prekey
+	Prekeys PrekeyProvider
+
+	// HybridKey, when set, writes tapes for that hybrid key instead of the
+	// public key.  They are read with a key found in HybridKeys.
+	HybridKey  *HybridPublicKey
+	HybridKeys HybridKeyProvider
+
+	// Custodians, when set, split the tape key among them instead, and
+	// Threshold of them must combine their shares to read the tape.
+	Custodians []*rsa.PublicKey
+	Threshold  int
+
+	// Escrow keys are given the tape key whatever the label, and any of
+	// them can read the tape.
+	Escrow []*rsa.PublicKey
+
+	// Passphrase, when set, wraps the tape key under a key derived from
+	// it instead, and the private key, if any, signs the label.
+	Passphrase []byte
+
+	// SignOnly tapes are not encrypted at all: the archive is written in
+	// plaintext and the private key signs the whole tape, so the public
+	// key alone verifies it.
+	SignOnly bool
+
+	// Signers, when reading, requires the label to be signed or
+	// co-signed by enough of its keys.
+	Signers *SignerPolicy
+
+	// NotBefore and NotAfter, when set, bound when the tape may be
+	// opened, unless IgnoreWindow is set when reading it.
+	NotBefore    time.Time
+	NotAfter     time.Time
+	IgnoreWindow bool
+
+	// Stream, when set, places the tape in a stream of tapes; it needs a
+	// private key to sign it.  When reading, Streams checks and records
+	// the tape's place in its stream.
+	Stream  *Stream
+	Streams *StreamState
+
+	// Metadata, when set, is written after the label.
+	Metadata *Metadata
+
+	// Hash names the hash algorithm the tape is signed with, DefaultHash
+	// if empty.  It must be allowed by the Policy, as must the label's
+	// algorithm when reading.
+	Hash string
 }
 
 // TapeReader is used to read from and unpack an encrypted
@@ -32,6 +96,12 @@ type TapeReader struct {
 	Key          Key
 	tarReader    *tar.Reader
 	cryptoReader *cipher.StreamReader
+	manifest     []ManifestEntry
+	signers      []string
+	metadata     *Metadata
+	options      TapeOptions
+	total        int64
+	verified     bool
 }
 
 // TapeWriter is used to write data into a tape.  It contains
@@ -41,6 +111,12 @@ type TapeWriter struct {
 	Key          Key
 	tarWriter    *tar.Writer
 	cryptoWriter io.Writer
+	gzipWriter   *gzip.Writer
+	manifest     []ManifestEntry
+	hash         hash.Hash
+	out          io.Writer
+	options      TapeOptions
+	total        int64
 }
 
 // NewTapeWriter creates a new tape writer.  It returns
@@ -51,37 +127,138 @@ type TapeWriter struct {
 // encrypted.  The complete label is considered the encrypted key, initialization
 // vector and the unencrypted signature.
 func NewTapeWriter(key Key, repoFile io.Writer) (*TapeWriter, error) {
-	result := &TapeWriter{Key: key}
-	var err error
+	return NewTapeWriterWithOptions(key, repoFile)
+}
+
+// NewTapeWriterWithOptions creates a new tape writer like NewTapeWriter,
+// with the default options changed by opts.  The options' hash algorithm and
+// metadata replace the key's.  Additional recipients are only allowed when
+// the tape key is wrapped under the key's RSA public key.
+func NewTapeWriterWithOptions(key Key, repoFile io.Writer, opts ...TapeOption) (*TapeWriter, error) {
+	options, err := key.tapeOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	key.Hash, key.Metadata = options.Hash, options.Metadata
+
+	if err := key.checkPolicy(); err != nil {
+		return nil, err
+	}
+	if err := key.policy().CheckHash(key.Hash); err != nil {
+		return nil, err
+	}
+	for _, recipient := range options.Recipients {
+		if err := key.policy().CheckKey(recipient); err != nil {
+			return nil, err
+		}
+	}
+
+	result := &TapeWriter{Key: key, out: repoFile, options: options}
 
 	result.Key.Label, err = RandomLabel()
 	if err != nil {
 		return nil, NewError(err, "Unable to generate new, random label")
 	}
+	result.Key.Label.Escrow = key.Escrow
+	result.Key.Label.NotBefore = key.NotBefore
+	result.Key.Label.NotAfter = key.NotAfter
+	result.Key.Label.Stream = key.Stream
+	result.Key.Label.signOnly = key.SignOnly
+	if key.Hash != DefaultHash {
+		result.Key.Label.hashName = key.Hash
+	}
+	if options.Compression != CompressionNone {
+		result.Key.Label.compression = options.Compression
+	}
 
-	err = result.Key.Label.WriteLabel(repoFile, key.PublicKey, key.PrivateKey)
+	var metadata []byte
+	if key.Metadata != nil {
+		if metadata, err = result.Key.Label.encodeMetadata(key.Metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	rsaRecipients := key.Passphrase == nil && !key.SignOnly && len(key.Custodians) == 0 && key.HybridKey == nil && key.Prekey == nil
+	switch {
+	case len(options.Recipients) > 0 && !rsaRecipients:
+		err = errors.New("Additional recipients are only allowed for tapes wrapped under RSA keys")
+	case key.Stream != nil && key.PrivateKey == nil:
+		err = errors.New("A private key is required to sign the label of a tape in a stream")
+	case key.Passphrase != nil:
+		var signKey crypto.Signer
+		if key.PrivateKey != nil {
+			signKey = key.PrivateKey
+		}
+		err = result.Key.Label.WritePassphraseLabel(repoFile, key.Passphrase, signKey)
+	case key.PrivateKey == nil:
+		err = errors.New("A private key is required to sign the label")
+	case key.SignOnly:
+		err = result.Key.Label.WriteSignedLabel(repoFile, key.PrivateKey)
+	case len(key.Custodians) > 0:
+		err = result.Key.Label.WriteThresholdLabel(repoFile, key.Custodians, key.Threshold, key.PrivateKey)
+	case key.HybridKey != nil:
+		err = result.Key.Label.WriteHybridLabel(repoFile, key.HybridKey, key.PrivateKey)
+	case key.Prekey != nil:
+		err = result.Key.Label.WriteForwardSecretLabel(repoFile, key.PublicKey, key.Prekey, key.PrivateKey)
+	default:
+		err = result.Key.Label.WriteLabelForRecipients(repoFile, append([]*rsa.PublicKey{key.PublicKey}, options.Recipients...), key.PrivateKey)
+	}
 	if err != nil {
 		return nil, NewError(err, "Unable to write label into output writer")
 	}
 
-	result.cryptoWriter, err = result.Key.Label.OpenWriter(repoFile)
-	if err != nil {
+	out := repoFile
+	if key.PrivateKey != nil {
+		result.hash = trailerHash(result.Key.Label.digestAlgorithm(), result.Key.Label.header)
+		out = io.MultiWriter(repoFile, result.hash)
+	}
+
+	if key.SignOnly {
+		result.cryptoWriter = out
+	} else if result.cryptoWriter, err = result.Key.Label.OpenWriter(out); err != nil {
 		return nil, NewError(err, "Unable to open respository writer")
 	}
 
-	result.tarWriter = tar.NewWriter(result.cryptoWriter)
+	if metadata != nil {
+		if err = writeLabelBlock(result.cryptoWriter, metadata); err != nil {
+			return nil, NewError(err, "Unable to write tape metadata")
+		}
+	}
+	if options.Compression == CompressionGzip {
+		result.gzipWriter = gzip.NewWriter(result.cryptoWriter)
+		result.tarWriter = tar.NewWriter(result.gzipWriter)
+	} else {
+		result.tarWriter = tar.NewWriter(result.cryptoWriter)
+	}
 
 	return result, nil
 }
 
+// hasContents reports whether an entry's contents are written to the tape
+// and digested in its manifest.  Only regular files have contents; other
+// entries, such as directories and links, are just a header.
+func hasContents(info os.FileInfo) bool {
+	return info.Mode().IsRegular()
+}
+
 // AddFile adds data to the tape by reading the contents of a file
 // a given path.  The writing occurs in two parts.  First in the
-// metadata about the file and then are the actual file contents.
+// metadata about the file and then are the actual file contents, for
+// regular files.  Files the options' filter rejects are skipped.
 func (r *TapeWriter) AddFile(fs afero.Fs, filePath string) error {
+	if !r.options.accept(filePath) {
+		return nil
+	}
+
 	fileInfo, err := fs.Stat(filePath)
 	if err != nil {
 		return NewError(err, fmt.Sprintf("Unable to stat file %s", filePath))
 	}
+	if hasContents(fileInfo) {
+		if err = r.options.checkSize(filePath, fileInfo.Size(), r.total); err != nil {
+			return err
+		}
+	}
 
 	header, err := tar.FileInfoHeader(fileInfo, filePath)
 	if err != nil {
@@ -94,22 +271,59 @@ func (r *TapeWriter) AddFile(fs afero.Fs, filePath string) error {
 		return NewError(err, fmt.Sprintf("Unable to write header into file %s", filePath))
 	}
 
-	if !fileInfo.IsDir() {
+	if hasContents(fileInfo) {
 		infile, err := fs.Open(filePath)
 		if err != nil {
 			return NewError(err, fmt.Sprintf("Unable to open input file %s", filePath))
 		}
 		defer infile.Close()
 
-		_, err = io.Copy(r.tarWriter, infile)
+		algorithm := r.Key.Label.digestAlgorithm()
+		digest := algorithm.New()
+		_, err = io.Copy(io.MultiWriter(r.tarWriter, digest), infile)
 		if err != nil {
 			return NewError(err, fmt.Sprintf("Failed to copy data from input file %s to tar writer", filePath))
 		}
+		entry := ManifestEntry{Name: filePath, Size: header.Size}
+		entry.setDigest(algorithm, digest.Sum(nil))
+		r.manifest = append(r.manifest, entry)
+		r.total += header.Size
+	} else {
+		r.manifest = append(r.manifest, ManifestEntry{Name: filePath})
 	}
 
+	r.options.progress(filePath, header.Size, r.total)
 	return nil
 }
 
+// Close finishes the tape by closing the archive.  Unless the tape has no
+// sender, a trailer with the sender's signature of the whole tape, which
+// anyone with the sender's public key can check, is written after the
+// archive along with a sign-only tape's manifest.  The underlying writer is
+// not closed.
+func (r *TapeWriter) Close() error {
+	if err := r.tarWriter.Close(); err != nil {
+		return NewError(err, "Unable to close the tape archive")
+	}
+	if r.gzipWriter != nil {
+		if err := r.gzipWriter.Close(); err != nil {
+			return NewError(err, "Unable to finish compressing the tape archive")
+		}
+	}
+
+	if r.hash == nil {
+		return nil
+	}
+	var manifest []ManifestEntry
+	if r.Key.SignOnly {
+		manifest = r.manifest
+		if manifest == nil {
+			manifest = []ManifestEntry{}
+		}
+	}
+	return writeTrailer(r.out, r.hash, r.Key.Label.digestAlgorithm(), manifest, r.Key.PrivateKey)
+}
+
 // AddDirectory adds an entire directory and its contents at one time
 func (r *TapeWriter) AddDirectory(fs afero.Fs, dirpath string) error {
 	err := afero.Walk(fs, dirpath, func(path string, info os.FileInfo, err error) error {
@@ -123,38 +337,246 @@ func (r *TapeWriter) AddDirectory(fs afero.Fs, dirpath string) error {
 
 // OpenTape opens a tape for reading.  It decrypts and verifies the label
 // and then set up the arhicve reader to read from the tape.
-func OpenTape(privateKey *rsa.PrivateKey, publicKey *rsa.PublicKey, tape io.Reader) (*TapeReader, error) {
-	result := &TapeReader{}
-	result.Key.PrivateKey = privateKey
-	result.Key.PublicKey = publicKey
-	var err error
+func OpenTape(privateKey PrivateKey, publicKey *rsa.PublicKey, tape io.Reader) (*TapeReader, error) {
+	return OpenTapeWithKey(Key{PrivateKey: privateKey, PublicKey: publicKey}, tape)
+}
+
+// OpenTapeWithPassphrase opens a tape protected by a passphrase.  The label's
+// signature is checked with publicKey, which may only be nil if the label is
+// not signed.
+func OpenTapeWithPassphrase(passphrase []byte, publicKey *rsa.PublicKey, tape io.Reader) (*TapeReader, error) {
+	return OpenTapeWithKey(Key{Passphrase: passphrase, PublicKey: publicKey}, tape)
+}
+
+// OpenTapeWithKey opens a tape for reading with the private and public keys
+// of key, which must satisfy the key's policy, as must the label's hash
+// algorithm.  If key.Signers is set, a
+// *SignerPolicyError is returned unless enough of its keys signed the label.
+// A *WindowError is returned outside the label's validity window unless
+// key.IgnoreWindow is set.  If key.Streams is set, a *StreamError is
+// returned unless the tape follows the last one received in its stream.
+func OpenTapeWithKey(key Key, tape io.Reader) (*TapeReader, error) {
+	return OpenTapeWithOptions(key, tape)
+}
+
+// OpenTapeWithOptions opens a tape for reading like OpenTapeWithKey, with
+// the default options changed by opts.  When the options have a Provider
+// the tape is opened like OpenTapeWithProviderAndKey instead.  The options'
+// filter, size limits and progress apply to ExtractFile and Contents.
+func OpenTapeWithOptions(key Key, tape io.Reader, opts ...TapeOption) (*TapeReader, error) {
+	options, err := key.tapeOptions(opts)
+	if err != nil {
+		return nil, err
+	}
+	if options.Provider != nil {
+		return openTapeWithProvider(options.Provider, key, tape, options)
+	}
+
+	if err := key.checkPolicy(); err != nil {
+		return nil, err
+	}
+
+	result := &TapeReader{Key: key, options: options}
 
-	result.Key.Label, err = ReadLabel(tape, privateKey, publicKey)
+	result.Key.Label, err = key.readLabel(tape)
 	if err != nil {
 		return nil, NewError(err, "Unable to read respository label")
 	}
+	if err = key.policy().CheckHash(result.Key.Label.hashName); err != nil {
+		return nil, err
+	}
+
+	result.signers = result.Key.Label.Signers(nil)
+	if key.Signers != nil {
+		if err = result.CheckSigners(key.Signers); err != nil {
+			return nil, err
+		}
+	}
+	if err = result.Key.Label.checkWindow(time.Now(), key.IgnoreWindow); err != nil {
+		return nil, err
+	}
+	if key.Streams != nil {
+		if err = key.Streams.Receive(&result.Key.Label); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = result.openArchive(tape); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// OpenTapeWithProvider opens a tape for reading without being told which keys
+// to use.  The label records the fingerprints of the recipient's key and of
+// the sender's key, and the matching keys are found in the provider.  If the
+// provider has no matching private key a *KeyNotFoundError is returned.
+// The keys must satisfy the provider's policy.  Co-signatures made with keys
+// in the provider are verified, see Signers and CheckSigners.
+func OpenTapeWithProvider(provider KeyProvider, tape io.Reader) (*TapeReader, error) {
+	return OpenTapeWithProviderAndKey(provider, Key{}, tape)
+}
 
-	cryptoReader, err := result.Key.Label.OpenReader(tape)
+// OpenTapeWithProviderAndKey opens a tape like OpenTapeWithProvider, finding
+// its keys in the provider.  The Signers, IgnoreWindow and Streams of key
+// apply as for OpenTapeWithKey, and its keys are ignored.
+func OpenTapeWithProviderAndKey(provider KeyProvider, key Key, tape io.Reader) (*TapeReader, error) {
+	return OpenTapeWithOptions(key, tape, WithProvider(provider))
+}
+
+func openTapeWithProvider(provider KeyProvider, key Key, tape io.Reader, options TapeOptions) (*TapeReader, error) {
+	result := &TapeReader{options: options}
+	result.Key.Policy = ProviderPolicy(provider)
+	result.Key.Prekeys, _ = provider.(PrekeyProvider)
+	result.Key.HybridKeys, _ = provider.(HybridKeyProvider)
+	result.Key.Signers = key.Signers
+	result.Key.IgnoreWindow = key.IgnoreWindow
+	result.Key.Streams = key.Streams
+	var err error
+
+	result.Key.Label, result.Key.PrivateKey, result.Key.PublicKey, err = ReadLabelWithProvider(tape, provider)
 	if err != nil {
-		return nil, NewError(err, "Unable to open a new crypto reader")
+		return nil, NewError(err, "Unable to read respository label")
 	}
 
-	result.tarReader = tar.NewReader(cryptoReader)
+	if err = result.Key.checkPolicy(); err != nil {
+		return nil, err
+	}
+	if err = result.Key.policy().CheckHash(result.Key.Label.hashName); err != nil {
+		return nil, err
+	}
+	result.signers = result.Key.Label.Signers(result.Key.Label.providerSigners(provider))
+	if key.Signers != nil {
+		if err = result.CheckSigners(key.Signers); err != nil {
+			return nil, err
+		}
+	}
+	if err = result.Key.Label.checkWindow(time.Now(), key.IgnoreWindow); err != nil {
+		return nil, err
+	}
+	if key.Streams != nil {
+		if err = key.Streams.Receive(&result.Key.Label); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = result.openArchive(tape); err != nil {
+		return nil, err
+	}
 	return result, nil
 }
 
+// openArchive sets up the archive reader for the tape after its label,
+// reading the metadata first if there is any.  The trailer's signature of
+// the whole tape is checked with the sender's public key before anything is
+// read from the archive, so the tape must be an io.ReadSeeker with a
+// trailer unless the options allow unverified tapes.  Sign-only tapes are
+// always verified.
+func (r *TapeReader) openArchive(tape io.Reader) error {
+	archive, err := r.verifyArchive(tape)
+	if err != nil {
+		return err
+	}
+	if !r.Key.Label.signOnly {
+		cryptoReader, err := r.Key.Label.OpenReader(archive)
+		if err != nil {
+			return NewError(err, "Unable to open a new crypto reader")
+		}
+		archive = cryptoReader
+	}
+
+	if r.metadata, err = r.Key.Label.readMetadata(archive); err != nil {
+		return err
+	}
+	if r.Key.Label.compression == CompressionGzip {
+		if archive, err = gzip.NewReader(archive); err != nil {
+			return NewError(err, "Unable to decompress the tape archive")
+		}
+	}
+	r.tarReader = tar.NewReader(archive)
+	return nil
+}
+
+// verifyArchive checks the trailer of the tape and returns a reader of the
+// archive, which ends where the trailer starts.  The tape is returned as it
+// is when it cannot be verified and the options allow it.
+func (r *TapeReader) verifyArchive(tape io.Reader) (io.Reader, error) {
+	seeker, ok := tape.(io.ReadSeeker)
+	unverified := func(reason string) (io.Reader, error) {
+		if r.options.Unverified && !r.Key.Label.signOnly {
+			return tape, nil
+		}
+		return nil, &SignatureError{What: "tape", Err: errors.New(reason)}
+	}
+	switch {
+	case !ok:
+		return unverified("The tape must be seekable to verify it")
+	case r.Key.PublicKey == nil:
+		return unverified("The sender's public key is needed to verify the tape")
+	case r.Key.Label.header == nil:
+		return unverified("Labels of this version do not have trailers")
+	}
+
+	start, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, NewError(err, "Unable to find the start of the archive")
+	}
+	if _, trailer, err := findTrailer(seeker); err != nil {
+		return nil, NewError(err, "Unable to read the tape trailer")
+	} else if trailer == nil {
+		if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+			return nil, NewError(err, "Unable to return to the start of the archive")
+		}
+		return unverified("Tape has no trailer")
+	}
+
+	end, manifest, err := readTrailer(seeker, r.Key.PublicKey)
+	if err != nil {
+		return nil, NewError(err, "Unable to verify tape")
+	}
+	if _, err = seeker.Seek(start, io.SeekStart); err != nil {
+		return nil, NewError(err, "Unable to return to the start of the archive")
+	}
+
+	r.manifest = manifest
+	r.verified = true
+	return io.LimitReader(seeker, end-start), nil
+}
+
+// Verified reports whether the trailer's signature of the whole tape was
+// checked with the sender's public key.  Only tapes opened with
+// WithUnverified can be read without it.
+func (r *TapeReader) Verified() bool {
+	return r.verified
+}
+
+// Manifest returns the signed manifest of a sign-only tape, or nil for other
+// tapes.
+func (r *TapeReader) Manifest() []ManifestEntry {
+	return r.manifest
+}
+
 // ExtractFile reads a file out of the tape and writes it onto the disk.
 // it uses metadata stored about the file to determine the file name
 // and any other characterisitics to set on the created file.
 //
+// Files the options' filter rejects are skipped, and files past the
+// options' size limits are not extracted.
+//
 // TODO: Need to check for and create intermediate directories.
 func (r *TapeReader) ExtractFile(fs afero.Fs) error {
-	header, err := r.tarReader.Next()
+	header, err := r.next()
 	if err == io.EOF {
 		return err
 	}
 	if err != nil {
-		return NewError(err, "Failed to extract file from repository")
+		return NewError(truncated(err), "Failed to extract file from repository")
+	}
+	if err = checkPath(header.Name); err != nil {
+		return err
+	}
+	if err = r.options.checkSize(header.Name, header.Size, r.total); err != nil {
+		return err
 	}
 
 	if header.FileInfo().IsDir() {
@@ -169,24 +591,117 @@ func (r *TapeReader) ExtractFile(fs afero.Fs) error {
 
 		_, err = io.Copy(file, r.tarReader)
 		if err != nil {
-			return NewError(err, fmt.Sprintf("Failed to extract file %s", header.Name))
+			return NewError(truncated(err), fmt.Sprintf("Failed to extract file %s", header.Name))
 		}
 		finfo := header.FileInfo()
 		fs.Chmod(header.Name, finfo.Mode())
+		r.total += header.Size
 	}
 
+	r.options.progress(header.Name, header.Size, r.total)
 	return nil
 }
 
-// Contents returns the contents of a tape.  Each is an en
-func (r *TapeReader) Contents() ([]string, error) {
-	result := []string{}
+// next returns the header of the next file on the tape the options' filter
+// accepts.
+func (r *TapeReader) next() (*tar.Header, error) {
+	for {
+		header, err := r.tarReader.Next()
+		if err != nil || r.options.accept(header.Name) {
+			return header, err
+		}
+	}
+}
+
+// Entry describes a file on a tape from its tar header.  Type is file, dir,
+// symlink, link or other, Mode includes the type bits, and Link is the
+// target of a link.
+type Entry struct {
+	Name    string
+	Type    string
+	Size    int64
+	Mode    os.FileMode
+	ModTime time.Time
+	Link    string
+}
+
+// entryType names the type of file a tar header is for.
+func entryType(header *tar.Header) string {
+	switch header.Typeflag {
+	case tar.TypeReg, tar.TypeRegA:
+		return "file"
+	case tar.TypeDir:
+		return "dir"
+	case tar.TypeSymlink:
+		return "symlink"
+	case tar.TypeLink:
+		return "link"
+	}
+	return "other"
+}
 
-	for header, err := r.tarReader.Next(); header != nil && err == nil; header, err = r.tarReader.Next() {
+// NextEntry describes the next file on the tape the options' filter
+// accepts, skipping the contents of the one before.  Returns io.EOF after
+// the last file, so a long tape can be listed as it is read.
+func (r *TapeReader) NextEntry() (*Entry, error) {
+	header, err := r.next()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, NewError(truncated(err), "Failed to list the contents of the tape")
+	}
+	return &Entry{
+		Name:    header.Name,
+		Type:    entryType(header),
+		Size:    header.Size,
+		Mode:    header.FileInfo().Mode(),
+		ModTime: header.ModTime,
+		Link:    header.Linkname,
+	}, nil
+}
+
+// Entries describes the files on a tape the options' filter accepts.
+func (r *TapeReader) Entries() ([]Entry, error) {
+	result := []Entry{}
+	for {
+		entry, err := r.NextEntry()
+		if err == io.EOF {
+			return result, nil
+		}
 		if err != nil {
 			return nil, err
 		}
-		result = append(result, fmt.Sprintf("%v %s", header.FileInfo().Mode(), header.Name))
+		result = append(result, *entry)
+	}
+}
+
+// Contents returns the contents of a tape the options' filter accepts.  Each
+// is an entry's mode and name, such as "-rw-r--r-- data/report.csv".
+func (r *TapeReader) Contents() ([]string, error) {
+	entries, err := r.Entries()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]string, len(entries))
+	for i, entry := range entries {
+		result[i] = fmt.Sprintf("%v %s", entry.Mode, entry.Name)
 	}
 	return result, nil
 }
+
+// checkPath returns an *UnsafePathError for a path on a tape that is empty
+// or has a ".." element, which could write outside the directories the tape
+// was packed from.
+func checkPath(name string) error {
+	if name == "" || strings.ContainsRune(name, 0) {
+		return &UnsafePathError{Path: name}
+	}
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '/' || r == '\\' }) {
+		if part == ".." {
+			return &UnsafePathError{Path: name}
+		}
+	}
+	return nil
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"strings"
 	"testing"
 
 	"github.com/darcinc/afero"
@@ -93,6 +94,7 @@ func createSimpleTape(fs afero.Fs, files []string) afero.Fs {
 	for _, f := range files {
 		tape.AddFile(fs, f)
 	}
+	tape.Close()
 	backFile.Close()
 
 	return fs
@@ -100,10 +102,11 @@ func createSimpleTape(fs afero.Fs, files []string) afero.Fs {
 
 func TestCreateTape(t *testing.T) {
 	buffer := new(bytes.Buffer)
-	_, err := NewTapeWriter(Key{PublicKey: &testKey.PublicKey, PrivateKey: testKey}, buffer)
+	tw, err := NewTapeWriter(Key{PublicKey: &testKey.PublicKey, PrivateKey: testKey}, buffer)
 	if err != nil {
 		log.Fatalf("Unable to write out repository: %v", err)
 	}
+	tw.Close()
 
 	reader := bytes.NewReader(buffer.Bytes())
 	_, err = OpenTape(testKey, &testKey.PublicKey, reader)
@@ -316,6 +319,36 @@ func TestListContents(t *testing.T) {
 	//}
 }
 
+func TestEntries(t *testing.T) {
+	fs := setupFs()
+	createSimpleTape(fs, []string{pathFor("data", "db", "files", "db1.dat"), pathFor("data", "db", "files", "db2.dat")})
+
+	file, err := fs.Open(pathFor("backups", "bk1.bak"))
+	if err != nil {
+		t.Fatalf("Unable to open backup file: %v", err)
+	}
+	tr, err := OpenTape(tapeKey.PrivateKey, tapeKey.PublicKey, file)
+	if err != nil {
+		t.Fatalf("Unable open tape for reading: %v", err)
+	}
+
+	entry, err := tr.NextEntry()
+	if err != nil {
+		t.Fatalf("Unable to read the first entry: %v", err)
+	}
+	if !strings.HasSuffix(entry.Name, "db1.dat") || entry.Type != "file" || entry.Size != 1024*1024 || entry.Mode.Perm() != 0641 || entry.ModTime.IsZero() {
+		t.Errorf("Wrong first entry %+v", entry)
+	}
+
+	entries, err := tr.Entries()
+	if err != nil || len(entries) != 1 || entries[0].Size != 512*1024 {
+		t.Errorf("Expected the second entry to be left but got %+v: %v", entries, err)
+	}
+	if _, err = tr.NextEntry(); err != io.EOF {
+		t.Errorf("Expected the end of the tape but got %v", err)
+	}
+}
+
 func TestAddDirectory(t *testing.T) {
 	fs := setupFs()
 	file, err := fs.OpenFile(pathFor("backups", "bk1.bak"), os.O_WRONLY|os.O_CREATE, 0600)
@@ -329,6 +362,7 @@ func TestAddDirectory(t *testing.T) {
 	}
 
 	tape.AddDirectory(fs, pathFor("data", "db"))
+	tape.Close()
 	file.Close()
 
 	fs.Remove(pathFor("data", "db", "files", "db1.dat"))
@@ -381,6 +415,7 @@ func xestSavePermissionBits(t *testing.T) {
 	}
 
 	tape.AddDirectory(fs, pathFor("data", "db"))
+	tape.Close()
 	file.Close()
 
 	fs.Remove(pathFor("data", "db", "files", "db1.dat"))
@@ -416,3 +451,27 @@ func xestSavePermissionBits(t *testing.T) {
 		}
 	}
 }
+
+func TestOpenTapeWithProvider(t *testing.T) {
+	fs := setupFs()
+	createSimpleTape(fs, []string{pathFor("data", "db", "files", "db1.dat")})
+
+	file, err := fs.Open(pathFor("backups", "bk1.bak"))
+	if err != nil {
+		t.Fatalf("Unable to open backup file: %v", err)
+	}
+	defer file.Close()
+
+	keystore := &Keystore{PrivateKeys: map[string][]byte{}, PublicKeys: map[string][]byte{}}
+	keystore.AddPrivateKey("backups", medKey)
+
+	tr, err := OpenTapeWithProvider(NewKeystoreProvider(keystore), file)
+	if err != nil {
+		t.Fatalf("Unable to open tape with provider: %v", err)
+	}
+
+	entries, err := tr.Contents()
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected 1 entry but got %d: %v", len(entries), err)
+	}
+}
@@ -0,0 +1,293 @@
+package repository
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rsa"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+
+	"github.com/darcinc/afero"
+)
+
+// Signed tapes end with a trailer after the archive, followed by the
+// trailer's length as a big-endian uint32 and trailerMagic:
+//
+//	label | archive | trailer | length | magic
+//
+// The trailer signs the label header and the archive.
+var trailerMagic = []byte("REPOTRL\x00")
+
+// maxTrailer bounds the trailers looked for when a tape is read as a stream.
+// Only sign-only tapes, whose manifest is in the trailer, have larger ones.
+const maxTrailer = 64 << 10
+
+// tapeTrailer holds the sender's signature of the label header and the
+// archive, followed by the manifest of a sign-only tape.
+type tapeTrailer struct {
+	Manifest  json.RawMessage `json:"manifest,omitempty"`
+	Signer    string          `json:"signer"`
+	Signature []byte          `json:"signature"`
+}
+
+// trailerHash starts the hash a trailer signs with the label header, using
+// the label's hash algorithm.  The label's signatures are left out, so
+// co-signatures can be added to a label without breaking the trailer.
+func trailerHash(algorithm crypto.Hash, header []byte) hash.Hash {
+	hash := algorithm.New()
+	hash.Write(header)
+	return hash
+}
+
+// hashTape returns the hash a trailer signs of a tape's label header and the
+// archive that follows the label, which ends at end, and the label's hash
+// algorithm.
+func hashTape(tape io.ReadSeeker, end int64) (hash.Hash, crypto.Hash, error) {
+	if _, err := tape.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+
+	counter := &countingReader{in: tape}
+	raw, err := readRawLabel(counter)
+	if err != nil {
+		return nil, 0, NewError(err, "Unable to read label")
+	}
+	if raw.version == legacyLabelVersion {
+		return nil, 0, errors.New("Labels of this version do not have trailers")
+	}
+	algorithm, err := lookupHash(raw.header.Hash)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	hash := trailerHash(algorithm, raw.headerBytes)
+	if _, err = io.CopyN(hash, tape, end-counter.count); err != nil {
+		return nil, 0, truncated(err)
+	}
+	return hash, algorithm, nil
+}
+
+// writeTrailer signs the hash of the tape written so far, made with the
+// algorithm and followed by the manifest if there is one, and writes the
+// trailer.
+func writeTrailer(out io.Writer, hash hash.Hash, algorithm crypto.Hash, manifest []ManifestEntry, signKey crypto.Signer) error {
+	signPub, err := rsaPublicKey(signKey.Public())
+	if err != nil {
+		return err
+	}
+	trailer := tapeTrailer{Signer: Fingerprint(signPub)}
+
+	if manifest != nil {
+		if trailer.Manifest, err = json.Marshal(manifest); err != nil {
+			return NewError(err, "Unable to encode manifest")
+		}
+		hash.Write(trailer.Manifest)
+	}
+
+	if trailer.Signature, err = signDigest(signKey, algorithm, hash.Sum(nil)); err != nil {
+		return NewError(err, "Failed to sign the tape")
+	}
+
+	data, err := json.Marshal(trailer)
+	if err != nil {
+		return NewError(err, "Unable to encode tape trailer")
+	}
+	length := make([]byte, 4)
+	binary.BigEndian.PutUint32(length, uint32(len(data)))
+
+	if _, err = out.Write(append(append(data, length...), trailerMagic...)); err != nil {
+		return NewError(err, "Unable to write tape trailer")
+	}
+	return nil
+}
+
+// findTrailer reads the trailer at the end of a tape.  Returns the offset of
+// the trailer, where the archive ends, or the end of the tape and a nil
+// trailer if the tape has no trailer.
+func findTrailer(tape io.ReadSeeker) (int64, *tapeTrailer, error) {
+	end, err := tape.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, nil, err
+	}
+
+	footer := make([]byte, 4+len(trailerMagic))
+	if end < int64(len(footer)) {
+		return end, nil, nil
+	}
+	if _, err = tape.Seek(end-int64(len(footer)), io.SeekStart); err != nil {
+		return 0, nil, err
+	}
+	if _, err = io.ReadFull(tape, footer); err != nil {
+		return 0, nil, truncated(err)
+	}
+	if !bytes.Equal(footer[4:], trailerMagic) {
+		return end, nil, nil
+	}
+
+	start := end - int64(len(footer)) - int64(binary.BigEndian.Uint32(footer))
+	if start < 0 {
+		return 0, nil, errors.New("Tape trailer is corrupt")
+	}
+	if _, err = tape.Seek(start, io.SeekStart); err != nil {
+		return 0, nil, err
+	}
+	data := make([]byte, end-int64(len(footer))-start)
+	if _, err = io.ReadFull(tape, data); err != nil {
+		return 0, nil, truncated(err)
+	}
+	trailer := &tapeTrailer{}
+	if err = json.Unmarshal(data, trailer); err != nil {
+		return 0, nil, NewError(err, "Unable to parse tape trailer")
+	}
+	return start, trailer, nil
+}
+
+// readTrailer reads the trailer at the end of a tape and checks its
+// signature with the sender's public key.  Returns the offset of the trailer,
+// where the archive ends, and the manifest, which is nil unless the tape is
+// sign-only.
+func readTrailer(tape io.ReadSeeker, publicKey *rsa.PublicKey) (int64, []ManifestEntry, error) {
+	start, trailer, err := findTrailer(tape)
+	if err != nil {
+		return 0, nil, err
+	}
+	if trailer == nil {
+		return 0, nil, errors.New("Tape has no trailer")
+	}
+
+	if signer := Fingerprint(publicKey); trailer.Signer != signer {
+		return 0, nil, &KeyMismatchError{What: "Tape", Signer: trailer.Signer, Given: signer}
+	}
+	hash, algorithm, err := hashTape(tape, start)
+	if err != nil {
+		return 0, nil, err
+	}
+	hash.Write(trailer.Manifest)
+	if err = verifyDigest(publicKey, algorithm, hash.Sum(nil), trailer.Signature); err != nil {
+		return 0, nil, &SignatureError{What: "tape", Err: err}
+	}
+
+	if trailer.Manifest == nil {
+		return start, nil, nil
+	}
+	manifest := []ManifestEntry{}
+	if err = json.Unmarshal(trailer.Manifest, &manifest); err != nil {
+		return 0, nil, NewError(err, "Unable to parse manifest")
+	}
+	return start, manifest, nil
+}
+
+// trailerSize returns the size of the trailer, length and magic at the end
+// of tail, or 0 if tail does not end with a whole trailer.
+func trailerSize(tail []byte) int {
+	footer := 4 + len(trailerMagic)
+	if len(tail) < footer || !bytes.Equal(tail[len(tail)-len(trailerMagic):], trailerMagic) {
+		return 0
+	}
+
+	size := int(binary.BigEndian.Uint32(tail[len(tail)-footer:])) + footer
+	if size > len(tail) {
+		return 0
+	}
+	return size
+}
+
+// copyWithoutTrailer copies in to out, leaving out a trailer at the end of
+// in.  The last maxTrailer bytes are held back until in ends, so the copy
+// never writes part of the trailer.
+func copyWithoutTrailer(out io.Writer, in io.Reader) error {
+	buffer := make([]byte, 32*1024)
+	held := []byte{}
+	for {
+		n, err := in.Read(buffer)
+		held = append(held, buffer[:n]...)
+		if over := len(held) - maxTrailer; over > 0 {
+			if _, err := out.Write(held[:over]); err != nil {
+				return err
+			}
+			held = held[:copy(held, held[over:])]
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := out.Write(held[:len(held)-trailerSize(held)])
+	return err
+}
+
+// resignTape replaces the trailer of a tape, or adds one if it has none,
+// with one signing the tape as it now is.
+func resignTape(tape afero.File, signKey crypto.Signer) error {
+	end, _, err := findTrailer(tape)
+	if err != nil {
+		return err
+	}
+
+	hash, algorithm, err := hashTape(tape, end)
+	if err != nil {
+		return err
+	}
+	if err = tape.Truncate(end); err != nil {
+		return err
+	}
+	if _, err = tape.Seek(end, io.SeekStart); err != nil {
+		return err
+	}
+	return writeTrailer(tape, hash, algorithm, nil, signKey)
+}
+
+// TapeSigner returns the fingerprint of the key that signed a tape's
+// trailer.  The signature is not checked, see CheckSender.
+func TapeSigner(tape io.ReadSeeker) (string, error) {
+	_, trailer, err := findTrailer(tape)
+	if err != nil {
+		return "", NewError(err, "Unable to read tape trailer")
+	}
+	if trailer == nil {
+		return "", errors.New("Tape has no trailer")
+	}
+	return trailer.Signer, nil
+}
+
+// CheckSender checks the signature in a tape's trailer, which covers the
+// label and the encrypted payload, with the sender's public key.  No private
+// key is needed, so a relay can reject tapes from unknown senders before
+// anyone decrypts them.  The label's hash algorithm must be allowed by the
+// DefaultPolicy.
+func CheckSender(tape io.ReadSeeker, publicKey *rsa.PublicKey) error {
+	return CheckSenderWithPolicy(tape, publicKey, nil)
+}
+
+// CheckSenderWithPolicy checks the signature in a tape's trailer like
+// CheckSender, refusing a label whose hash algorithm the policy does not
+// allow.  A nil policy is the DefaultPolicy.
+func CheckSenderWithPolicy(tape io.ReadSeeker, publicKey *rsa.PublicKey, policy *Policy) error {
+	if policy == nil {
+		policy = DefaultPolicy()
+	}
+	if _, err := tape.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	raw, err := readRawLabel(tape)
+	if err != nil {
+		return NewError(err, "Unable to read label")
+	}
+	if err = policy.CheckHash(raw.header.Hash); err != nil {
+		return err
+	}
+	if signer := Fingerprint(publicKey); raw.version != legacyLabelVersion && raw.header.Sender != "" && raw.header.Sender != signer {
+		return &KeyMismatchError{What: "Label", Signer: raw.header.Sender, Given: signer}
+	}
+
+	if _, _, err = readTrailer(tape, publicKey); err != nil {
+		return NewError(err, "Unable to check the sender's signature")
+	}
+	return nil
+}
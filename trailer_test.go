@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/darcinc/afero"
+)
+
+func TestCheckSender(t *testing.T) {
+	fs := setupFs()
+	createSimpleTape(fs, []string{pathFor("data", "db", "files", "db2.dat")})
+	tape, _ := afero.ReadFile(fs, pathFor("backups", "bk1.bak"))
+
+	if err := CheckSender(bytes.NewReader(tape), &medKey.PublicKey); err != nil {
+		t.Fatalf("Unable to check the sender of a tape: %v", err)
+	}
+
+	signer, err := TapeSigner(bytes.NewReader(tape))
+	if err != nil || signer != Fingerprint(&medKey.PublicKey) {
+		t.Errorf("Wrong tape signer %s: %v", signer, err)
+	}
+
+	if err = CheckSender(bytes.NewReader(tape), &longKey.PublicKey); err == nil {
+		t.Error("Should not check the sender with the wrong key")
+	}
+
+	tampered := append([]byte{}, tape...)
+	tampered[len(tampered)/2] ^= 1
+	if err = CheckSender(bytes.NewReader(tampered), &medKey.PublicKey); err == nil {
+		t.Error("Should not check the sender of a tampered tape")
+	}
+
+	unclosed := new(bytes.Buffer)
+	NewTapeWriter(tapeKey, unclosed)
+	if err = CheckSender(bytes.NewReader(unclosed.Bytes()), &medKey.PublicKey); err == nil {
+		t.Error("Should not check the sender of a tape without a trailer")
+	}
+}
+
+func TestRelabelResignsTrailer(t *testing.T) {
+	fs := setupFs()
+	createSimpleTape(fs, []string{pathFor("data", "db", "files", "db2.dat")})
+	tape, _ := afero.ReadFile(fs, pathFor("backups", "bk1.bak"))
+
+	out := new(bytes.Buffer)
+	if err := Relabel(bytes.NewReader(tape), out, tapeKey, &testKey.PublicKey); err != nil {
+		t.Fatalf("Unable to relabel tape: %v", err)
+	}
+
+	if err := CheckSender(bytes.NewReader(out.Bytes()), &medKey.PublicKey); err != nil {
+		t.Errorf("Relabeled tape should have a valid trailer: %v", err)
+	}
+	if trailers := bytes.Count(out.Bytes(), trailerMagic); trailers != 1 {
+		t.Errorf("Expected one trailer on the relabeled tape but found %d", trailers)
+	}
+}
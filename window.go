@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// AuditLog records each decision to open or refuse a tape with a validity
+// window, including when the window is overridden.  It is the standard
+// logger unless replaced.
+var AuditLog = log.Default()
+
+// WindowError is returned when a tape is opened before its NotBefore time
+// or after its NotAfter time.  Either may be zero if the label does not set
+// it.
+type WindowError struct {
+	NotBefore time.Time
+	NotAfter  time.Time
+	Now       time.Time
+}
+
+func (e *WindowError) Error() string {
+	if !e.NotBefore.IsZero() && e.Now.Before(e.NotBefore) {
+		return fmt.Sprintf("Tape may not be opened before %s", e.NotBefore.Format(time.RFC3339))
+	}
+	return fmt.Sprintf("Tape expired at %s", e.NotAfter.Format(time.RFC3339))
+}
+
+// checkWindow returns a *WindowError if the label is opened outside its
+// validity window, unless the window is overridden.  Both outcomes are
+// recorded in the AuditLog.  Labels without a window are always opened.
+func (l *Label) checkWindow(now time.Time, override bool) error {
+	if l.NotBefore.IsZero() && l.NotAfter.IsZero() {
+		return nil
+	}
+
+	window := fmt.Sprintf("valid from %s until %s", formatWindowTime(l.NotBefore), formatWindowTime(l.NotAfter))
+	if (l.NotBefore.IsZero() || !now.Before(l.NotBefore)) && (l.NotAfter.IsZero() || now.Before(l.NotAfter)) {
+		AuditLog.Printf("audit: opened tape from sender %s %s", l.sender, window)
+		return nil
+	}
+
+	err := &WindowError{NotBefore: l.NotBefore, NotAfter: l.NotAfter, Now: now}
+	if override {
+		AuditLog.Printf("audit: opened tape from sender %s %s despite the window: %v", l.sender, window, err)
+		return nil
+	}
+	AuditLog.Printf("audit: refused tape from sender %s %s: %v", l.sender, window, err)
+	return err
+}
+
+func formatWindowTime(t time.Time) string {
+	if t.IsZero() {
+		return "any time"
+	}
+	return t.Format(time.RFC3339)
+}
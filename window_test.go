@@ -0,0 +1,106 @@
+package repository
+
+import (
+	"bytes"
+	"log"
+	"strings"
+	"testing"
+	"time"
+)
+
+func windowTape(t *testing.T, notBefore, notAfter time.Time) []byte {
+	fs := setupFs()
+	key := tapeKey
+	key.NotBefore, key.NotAfter = notBefore, notAfter
+
+	out := new(bytes.Buffer)
+	tape, err := NewTapeWriter(key, out)
+	if err != nil {
+		t.Fatalf("Unable to create tape: %v", err)
+	}
+	tape.AddFile(fs, pathFor("data", "db", "files", "db2.dat"))
+	if err = tape.Close(); err != nil {
+		t.Fatalf("Unable to close tape: %v", err)
+	}
+	return out.Bytes()
+}
+
+func captureAudit(t *testing.T) *bytes.Buffer {
+	saved := AuditLog
+	audit := new(bytes.Buffer)
+	AuditLog = log.New(audit, "", 0)
+	t.Cleanup(func() { AuditLog = saved })
+	return audit
+}
+
+func TestTapeWindow(t *testing.T) {
+	audit := captureAudit(t)
+	key := Key{PrivateKey: medKey, PublicKey: &medKey.PublicKey}
+
+	open := windowTape(t, time.Now().Add(-time.Hour), time.Now().Add(time.Hour))
+	if _, err := OpenTapeWithKey(key, bytes.NewReader(open)); err != nil {
+		t.Fatalf("Unable to open tape within its window: %v", err)
+	}
+	if !strings.Contains(audit.String(), "audit: opened") {
+		t.Errorf("Opening the tape was not audited: %s", audit.String())
+	}
+
+	expired := windowTape(t, time.Time{}, time.Now().Add(-time.Hour))
+	_, err := OpenTapeWithKey(key, bytes.NewReader(expired))
+	if windowErr, ok := err.(*WindowError); !ok || !strings.Contains(windowErr.Error(), "expired") {
+		t.Errorf("Expected an expiry error but got %v", err)
+	}
+	if !strings.Contains(audit.String(), "audit: refused") {
+		t.Errorf("Refusing the tape was not audited: %s", audit.String())
+	}
+
+	early := windowTape(t, time.Now().Add(time.Hour), time.Time{})
+	if _, err = OpenTapeWithKey(key, bytes.NewReader(early)); err == nil {
+		t.Error("Should not open a tape before its not-before time")
+	}
+
+	key.IgnoreWindow = true
+	audit.Reset()
+	if _, err = OpenTapeWithKey(key, bytes.NewReader(expired)); err != nil {
+		t.Errorf("Unable to open an expired tape with the override: %v", err)
+	}
+	if !strings.Contains(audit.String(), "despite the window") {
+		t.Errorf("Overriding the window was not audited: %s", audit.String())
+	}
+}
+
+func TestTapeWindowSigned(t *testing.T) {
+	captureAudit(t)
+	expired := windowTape(t, time.Time{}, time.Now().Add(-time.Hour))
+
+	raw, err := readRawLabel(bytes.NewReader(expired))
+	if err != nil {
+		t.Fatalf("Unable to read label: %v", err)
+	}
+	later := time.Now().Add(time.Hour).UTC()
+	raw.header.NotAfter = &later
+	raw.headerBytes = nil
+
+	tampered := new(bytes.Buffer)
+	raw.write(tampered)
+	counter := &countingReader{in: bytes.NewReader(expired)}
+	readRawLabel(counter)
+	tampered.Write(expired[counter.count:])
+
+	if _, err = OpenTapeWithKey(Key{PrivateKey: medKey, PublicKey: &medKey.PublicKey}, bytes.NewReader(tampered.Bytes())); err == nil {
+		t.Error("Should not open a tape whose window was extended")
+	}
+}
+
+func TestTapeWindowRelabel(t *testing.T) {
+	captureAudit(t)
+	expired := windowTape(t, time.Time{}, time.Now().Add(-time.Hour))
+
+	out := new(bytes.Buffer)
+	if err := Relabel(bytes.NewReader(expired), out, tapeKey, &testKey.PublicKey); err != nil {
+		t.Fatalf("Unable to relabel tape: %v", err)
+	}
+	if _, err := OpenTapeWithKey(Key{PrivateKey: testKey, PublicKey: &medKey.PublicKey}, bytes.NewReader(out.Bytes())); err == nil {
+		t.Error("Relabeling should keep the tape's window")
+	}
+}